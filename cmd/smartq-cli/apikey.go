@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var apiKeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys",
+	Long: `Commands for creating, listing, and revoking the API keys used by kiosks,
+signage players and other integrations. They require an admin login.`,
+}
+
+var (
+	apiKeyScopes    []string
+	apiKeyExpiresIn time.Duration
+)
+
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create an API key",
+	Long: `Create an API key with the given scopes: queues:read, queues:write,
+tickets:create, tickets:read and tickets:write. The key is printed once and cannot be
+retrieved later.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		createAPIKey(args[0], apiKeyScopes, apiKeyExpiresIn)
+	},
+}
+
+var apiKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		listAPIKeys()
+	},
+}
+
+var apiKeyDeleteCmd = &cobra.Command{
+	Use:   "delete [keyId]",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteAPIKey(args[0])
+	},
+}
+
+func init() {
+	apiKeyCreateCmd.Flags().StringSliceVar(&apiKeyScopes, "scope", nil, "scope granted to the key (repeatable)")
+	apiKeyCreateCmd.Flags().DurationVar(&apiKeyExpiresIn, "expires-in", 0, "lifetime of the key, e.g. 720h (never expires if zero)")
+	apiKeyCreateCmd.MarkFlagRequired("scope")
+
+	apiKeyCmd.AddCommand(apiKeyCreateCmd)
+	apiKeyCmd.AddCommand(apiKeyListCmd)
+	apiKeyCmd.AddCommand(apiKeyDeleteCmd)
+	rootCmd.AddCommand(apiKeyCmd)
+}
+
+func createAPIKey(name string, scopes []string, expiresIn time.Duration) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	body := map[string]interface{}{
+		"name":   name,
+		"scopes": scopes,
+	}
+	if expiresIn > 0 {
+		body["expires_at"] = time.Now().Add(expiresIn).UTC().Format(time.RFC3339)
+	}
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/api-keys", requestBody)
+	if err != nil {
+		fmt.Println("Error creating API key:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to create API key. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var result struct {
+		Key    string                 `json:"key"`
+		APIKey map[string]interface{} `json:"api_key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Successfully created API key:")
+	fmt.Printf("  ID:      %s\n", result.APIKey["id"])
+	fmt.Printf("  Name:    %s\n", result.APIKey["name"])
+	fmt.Printf("  Scopes:  %v\n", result.APIKey["scopes"])
+	fmt.Printf("  Expires: %v\n", valueOr(result.APIKey["expires_at"], "never"))
+	fmt.Printf("  Key:     %s\n", result.Key)
+	fmt.Println("Store the key now; it cannot be shown again. Send it in the X-API-Key header.")
+}
+
+func listAPIKeys() {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodGet, apiBaseURL+"/api-keys", nil)
+	if err != nil {
+		fmt.Println("Error listing API keys:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to list API keys. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var keys []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("API keys:")
+	for _, k := range keys {
+		fmt.Printf("  - ID: %s, Name: %s, Key: %s..., Scopes: %v, Expires: %v, Last used: %v\n",
+			k["id"], k["name"], k["key_prefix"], k["scopes"], valueOr(k["expires_at"], "never"), valueOr(k["last_used_at"], "never"))
+	}
+}
+
+func deleteAPIKey(keyID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodDelete, apiBaseURL+"/api-keys/"+keyID, nil)
+	if err != nil {
+		fmt.Println("Error deleting API key:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to delete API key. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully revoked API key %s\n", keyID)
+}
+
+// valueOr returns v, or fallback when v is a JSON null.
+func valueOr(v interface{}, fallback string) interface{} {
+	if v == nil {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditTicketID  string
+	auditActorID   string
+	auditActorType string
+	auditSince     time.Duration
+	auditFrom      string
+	auditTo        string
+	auditLimit     int
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit trail of ticket actions",
+	Long: `Show who created, called, served and cancelled tickets, newest first:
+the actor (user, API key, customer, customer texting or system), the counter, the source IP and
+user agent, and the reason given. Requires an admin login.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		params := url.Values{}
+		if auditTicketID != "" {
+			params.Set("ticket_id", auditTicketID)
+		}
+		if auditActorID != "" {
+			params.Set("actor_id", auditActorID)
+		}
+		if auditActorType != "" {
+			params.Set("actor_type", auditActorType)
+		}
+		if auditSince > 0 {
+			params.Set("from", time.Now().Add(-auditSince).UTC().Format(time.RFC3339))
+		}
+		if auditFrom != "" {
+			params.Set("from", auditFrom)
+		}
+		if auditTo != "" {
+			params.Set("to", auditTo)
+		}
+		if auditLimit > 0 {
+			params.Set("limit", strconv.Itoa(auditLimit))
+		}
+		showAuditTrail(params)
+	},
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditTicketID, "ticket", "", "only actions on this ticket ID")
+	auditCmd.Flags().StringVar(&auditActorID, "actor", "", "only actions by this user or API key ID")
+	auditCmd.Flags().StringVar(&auditActorType, "actor-type", "", "only actions by this kind of actor: user, api_key, customer, sms or system")
+	auditCmd.Flags().DurationVar(&auditSince, "since", 0, "only actions in the last duration, e.g. 24h")
+	auditCmd.Flags().StringVar(&auditFrom, "from", "", "only actions at or after this RFC 3339 time")
+	auditCmd.Flags().StringVar(&auditTo, "to", "", "only actions before this RFC 3339 time")
+	auditCmd.Flags().IntVar(&auditLimit, "limit", 0, "maximum number of actions to show (default 500)")
+
+	rootCmd.AddCommand(auditCmd)
+}
+
+func showAuditTrail(params url.Values) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	endpoint := apiBaseURL + "/audit"
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	resp, err := sendRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		fmt.Println("Error retrieving audit trail:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to retrieve audit trail. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var entries []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No ticket actions found.")
+		return
+	}
+
+	fmt.Println("Audit trail:")
+	for _, e := range entries {
+		actor := fmt.Sprint(e["actor_type"])
+		if name, ok := e["actor_name"].(string); ok && name != "" {
+			actor += " " + name
+		}
+		fmt.Printf("  - %s  ticket %s (%s) -> %s by %s\n",
+			e["timestamp"], valueOr(e["ticket_number"], "?"), e["ticket_id"], e["status"], actor)
+		if counterID, ok := e["counter_id"].(string); ok {
+			fmt.Printf("      counter: %s\n", counterID)
+		}
+		if ip, ok := e["source_ip"].(string); ok && ip != "" {
+			fmt.Printf("      from:    %s %s\n", ip, valueOr(e["user_agent"], ""))
+		}
+		if reason, ok := e["reason"].(string); ok && reason != "" {
+			fmt.Printf("      reason:  %s\n", reason)
+		}
+	}
+}
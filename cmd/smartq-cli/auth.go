@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// tokenEnvVar overrides the token saved by "smartq-cli login".
+const tokenEnvVar = "SMARTQ_TOKEN"
+
+// apiKeyEnvVar holds an API key to use instead of a login token, for scripts
+// and unattended machines.
+const apiKeyEnvVar = "SMARTQ_API_KEY"
+
+var loginPassword string
+
+var loginCmd = &cobra.Command{
+	Use:   "login [username]",
+	Short: "Log in as a staff member",
+	Long: `Log in and save the login token for later commands. The password is
+prompted for unless --password is given. Set SMARTQ_TOKEN to use a token
+without saving it, or SMARTQ_API_KEY to use an API key instead of logging in.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		login(args[0], loginPassword)
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Forget the saved login token",
+	Run: func(cmd *cobra.Command, args []string) {
+		logout()
+	},
+}
+
+func init() {
+	loginCmd.Flags().StringVar(&loginPassword, "password", "", "password (prompted for if empty)")
+
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+}
+
+// tokenPath returns the file the login token is saved in.
+func tokenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "smartq", "token"), nil
+}
+
+// loadToken returns the login token from SMARTQ_TOKEN or the token file, or ""
+// when the user has not logged in.
+func loadToken() string {
+	if token := os.Getenv(tokenEnvVar); token != "" {
+		return token
+	}
+	path, err := tokenPath()
+	if err != nil {
+		return ""
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// sendRequest sends an API request with a JSON body, if any, and the API key
+// from SMARTQ_API_KEY or else the saved login token.
+func sendRequest(method, url string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey := os.Getenv(apiKeyEnvVar); apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	} else if token := loadToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// readPassword prompts for a password without echoing it when stdin is a terminal.
+func readPassword() (string, error) {
+	fmt.Print("Password: ")
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func login(username, password string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	if password == "" {
+		var err error
+		if password, err = readPassword(); err != nil {
+			fmt.Println("Error reading password:", err)
+			return
+		}
+	}
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"username": username,
+		"password": password,
+	})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := http.Post(apiBaseURL+"/auth/login", "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		fmt.Println("Error logging in:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to log in. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var result struct {
+		Token     string `json:"token"`
+		ExpiresAt string `json:"expires_at"`
+		User      struct {
+			Role string `json:"role"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	path, err := tokenPath()
+	if err != nil {
+		fmt.Println("Error locating config directory:", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		fmt.Println("Error saving token:", err)
+		return
+	}
+	if err := ioutil.WriteFile(path, []byte(result.Token), 0o600); err != nil {
+		fmt.Println("Error saving token:", err)
+		return
+	}
+
+	fmt.Printf("Logged in as %s (%s). The token expires at %s.\n", username, result.User.Role, result.ExpiresAt)
+}
+
+func logout() {
+	path, err := tokenPath()
+	if err != nil {
+		fmt.Println("Error locating config directory:", err)
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error removing token:", err)
+		return
+	}
+	fmt.Println("Logged out.")
+}
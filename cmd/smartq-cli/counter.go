@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var counterCmd = &cobra.Command{
+	Use:   "counter",
+	Short: "Manage counters",
+	Long:  `Commands for creating, listing, renaming, and deleting the counters (desks, windows) that serve a queue.`,
+}
+
+var counterCreateCmd = &cobra.Command{
+	Use:   "create [queueId] [name]",
+	Short: "Add a counter to a queue",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		createCounter(args[0], args[1])
+	},
+}
+
+var counterListCmd = &cobra.Command{
+	Use:   "list [queueId]",
+	Short: "List the counters of a queue",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		listCounters(args[0])
+	},
+}
+
+var counterRenameCmd = &cobra.Command{
+	Use:   "rename [counterId] [name]",
+	Short: "Rename a counter",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		renameCounter(args[0], args[1])
+	},
+}
+
+var counterDeleteCmd = &cobra.Command{
+	Use:   "delete [counterId]",
+	Short: "Delete a counter",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteCounter(args[0])
+	},
+}
+
+func init() {
+	counterCmd.AddCommand(counterCreateCmd)
+	counterCmd.AddCommand(counterListCmd)
+	counterCmd.AddCommand(counterRenameCmd)
+	counterCmd.AddCommand(counterDeleteCmd)
+	rootCmd.AddCommand(counterCmd)
+}
+
+func createCounter(queueID, name string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"name": name,
+	})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/queues/"+queueID+"/counters", requestBody)
+	if err != nil {
+		fmt.Println("Error creating counter:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to create counter. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Successfully created counter:")
+	fmt.Printf("  ID:   %s\n", result["id"])
+	fmt.Printf("  Name: %s\n", result["name"])
+}
+
+func listCounters(queueID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodGet, apiBaseURL+"/queues/"+queueID+"/counters", nil)
+	if err != nil {
+		fmt.Println("Error listing counters:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to list counters. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var counters []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&counters); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Counters:")
+	for _, counter := range counters {
+		fmt.Printf("  - ID: %s, Name: %s\n", counter["id"], counter["name"])
+	}
+}
+
+func renameCounter(counterID, name string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"name": name,
+	})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPut, apiBaseURL+"/counters/"+counterID, requestBody)
+	if err != nil {
+		fmt.Println("Error renaming counter:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to rename counter. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully renamed counter %s to %s\n", counterID, name)
+}
+
+func deleteCounter(counterID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodDelete, apiBaseURL+"/counters/"+counterID, nil)
+	if err != nil {
+		fmt.Println("Error deleting counter:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to delete counter. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully deleted counter %s\n", counterID)
+}
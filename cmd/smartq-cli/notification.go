@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var notificationCmd = &cobra.Command{
+	Use:   "notification",
+	Short: "Inspect messages to customers",
+	Long: `Commands for checking the text messages sent to customers and whether
+they were delivered. They require a staff login.`,
+}
+
+var (
+	notificationQueueID  string
+	notificationTicketID string
+	notificationStatus   string
+	notificationLimit    int
+)
+
+var notificationListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List messages to customers and their delivery status",
+	Long: `List text messages to customers, newest first, with their delivery
+status: pending (waiting for its first attempt or a retry), sent or failed,
+the number of attempts and the last error.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		params := url.Values{}
+		if notificationQueueID != "" {
+			params.Set("queue_id", notificationQueueID)
+		}
+		if notificationTicketID != "" {
+			params.Set("ticket_id", notificationTicketID)
+		}
+		if notificationStatus != "" {
+			params.Set("status", notificationStatus)
+		}
+		if notificationLimit > 0 {
+			params.Set("limit", strconv.Itoa(notificationLimit))
+		}
+		listNotifications(params)
+	},
+}
+
+func init() {
+	notificationListCmd.Flags().StringVar(&notificationQueueID, "queue", "", "only messages to customers of this queue ID")
+	notificationListCmd.Flags().StringVar(&notificationTicketID, "ticket", "", "only messages about this ticket ID")
+	notificationListCmd.Flags().StringVar(&notificationStatus, "status", "", "only messages with this status: pending, sent or failed")
+	notificationListCmd.Flags().IntVar(&notificationLimit, "limit", 0, "maximum number of messages to show (default 200)")
+
+	notificationCmd.AddCommand(notificationListCmd)
+	rootCmd.AddCommand(notificationCmd)
+}
+
+func listNotifications(params url.Values) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	endpoint := apiBaseURL + "/notifications"
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	resp, err := sendRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		fmt.Println("Error retrieving notifications:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to retrieve notifications. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var notifications []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&notifications); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	if len(notifications) == 0 {
+		fmt.Println("No messages found.")
+		return
+	}
+
+	fmt.Println("Messages:")
+	for _, n := range notifications {
+		fmt.Printf("  - %s  ticket %s: %s %s to %s, %s after %v attempt(s)\n",
+			n["created_at"], valueOr(n["ticket_number"], "?"), n["channel"], n["template"], n["recipient"], n["status"], n["attempts"])
+		switch n["status"] {
+		case "sent":
+			fmt.Printf("      sent at:    %s\n", n["sent_at"])
+		case "pending":
+			fmt.Printf("      next try:   %s\n", n["next_attempt_at"])
+		}
+		if lastError, ok := n["last_error"].(string); ok && lastError != "" {
+			fmt.Printf("      last error: %s\n", lastError)
+		}
+		fmt.Printf("      message:    %s\n", n["payload"])
+	}
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -19,13 +19,48 @@ var queueCmd = &cobra.Command{
 var queueCreateCmd = &cobra.Command{
 	Use:   "create [name]",
 	Short: "Create a new queue",
-	Args:  cobra.ExactArgs(1),
+	Long: `Create a new queue. Ticket numbers default to "A-001" and restart daily;
+use the flags to give the queue its own format, e.g. --prefix S for "S-001".`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		queueName := args[0]
 		createQueue(queueName)
 	},
 }
 
+// Ticket format flags for queue create. Zero values let the server pick its defaults.
+var (
+	queueTicketPrefix      string
+	queueTicketWidth       int
+	queueTicketStartNumber int
+	queueTicketResetPolicy string
+)
+
+// queueNotifyThresholds is the --notify flag of queue create.
+var queueNotifyThresholds []int
+
+var queueNotifyCmd = &cobra.Command{
+	Use:   "notify [queueId] [peopleAhead...]",
+	Short: "Set when waiting customers of a queue get a text",
+	Long: `Set the numbers of people ahead at which waiting customers of a queue get
+a text, e.g. "queue notify <queueId> 3 0" for "3 people ahead" and "you're
+next". Each customer gets each text once. Without numbers, these texts are
+turned off.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		thresholds := []int{}
+		for _, arg := range args[1:] {
+			threshold, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Printf("Error: %q is not a number of people\n", arg)
+				return
+			}
+			thresholds = append(thresholds, threshold)
+		}
+		setNotifyThresholds(args[0], thresholds)
+	},
+}
+
 var queueListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all queues",
@@ -34,22 +69,58 @@ var queueListCmd = &cobra.Command{
 	},
 }
 
+var queueCallNextCmd = &cobra.Command{
+	Use:   "call-next [queueId]",
+	Short: "Call the next waiting ticket of a queue",
+	Long: `Call the next waiting ticket of a queue: the highest-priority ticket,
+earliest first. It is moved to serving.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		callNextTicket(args[0], queueCallNextCounterID, queueCallNextReason)
+	},
+}
+
+// queueCallNextCounterID and queueCallNextReason are the --counter and
+// --reason flags of queue call-next.
+var (
+	queueCallNextCounterID string
+	queueCallNextReason    string
+)
+
 func init() {
+	queueCreateCmd.Flags().StringVar(&queueTicketPrefix, "prefix", "", "ticket number prefix, e.g. S for S-001 (default A)")
+	queueCreateCmd.Flags().IntVar(&queueTicketWidth, "width", 0, "zero-padding width of the ticket counter (default 3)")
+	queueCreateCmd.Flags().IntVar(&queueTicketStartNumber, "start", 0, "first ticket number of each period (default 1)")
+	queueCreateCmd.Flags().StringVar(&queueTicketResetPolicy, "reset", "", "when numbering restarts: daily, weekly or never (default daily)")
+	queueCreateCmd.Flags().IntSliceVar(&queueNotifyThresholds, "notify", nil, "people ahead at which waiting customers get a text, e.g. 3,0")
+
+	queueCallNextCmd.Flags().StringVar(&queueCallNextCounterID, "counter", "", "ID of the counter calling the ticket")
+	queueCallNextCmd.Flags().StringVar(&queueCallNextReason, "reason", "", "reason recorded in the audit trail")
+
 	queueCmd.AddCommand(queueCreateCmd)
 	queueCmd.AddCommand(queueListCmd) // Add the new command
+	queueCmd.AddCommand(queueCallNextCmd)
+	queueCmd.AddCommand(queueNotifyCmd)
 	rootCmd.AddCommand(queueCmd)
 }
 
 func createQueue(name string) {
 	const apiBaseURL = "http://localhost:8080/api/v1"
 	
-	requestBody, err := json.Marshal(map[string]string{"name": name})
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"name":                name,
+		"ticket_prefix":       queueTicketPrefix,
+		"ticket_number_width": queueTicketWidth,
+		"ticket_start_number": queueTicketStartNumber,
+		"ticket_reset_policy": queueTicketResetPolicy,
+		"notify_thresholds":   queueNotifyThresholds,
+	})
 	if err != nil {
 		fmt.Println("Error marshalling request body:", err)
 		return
 	}
 
-	resp, err := http.Post(apiBaseURL+"/queues", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/queues", requestBody)
 	if err != nil {
 		fmt.Println("Error creating queue:", err)
 		return
@@ -71,12 +142,48 @@ func createQueue(name string) {
 	fmt.Println("Successfully created queue:")
 	fmt.Printf("  ID:   %s\n", result["id"])
 	fmt.Printf("  Name: %s\n", result["name"])
+	fmt.Printf("  Ticket format: %s-%v digits, starting at %v, reset %s\n",
+		result["ticket_prefix"], result["ticket_number_width"], result["ticket_start_number"], result["ticket_reset_policy"])
+	if thresholds, ok := result["notify_thresholds"].([]interface{}); ok && len(thresholds) > 0 {
+		fmt.Printf("  Texts at people ahead: %v\n", thresholds)
+	}
+}
+
+func setNotifyThresholds(queueID string, thresholds []int) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"notify_thresholds": thresholds,
+	})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPut, apiBaseURL+"/queues/"+queueID+"/notify-thresholds", requestBody)
+	if err != nil {
+		fmt.Println("Error updating queue:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to update queue. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	if len(thresholds) == 0 {
+		fmt.Println("Waiting customers will not get texts about their place in line.")
+		return
+	}
+	fmt.Printf("Waiting customers will get a text at %v people ahead.\n", thresholds)
 }
 
 func listQueues() {
 	const apiBaseURL = "http://localhost:8080/api/v1"
 
-	resp, err := http.Get(apiBaseURL + "/queues")
+	resp, err := sendRequest(http.MethodGet, apiBaseURL+"/queues", nil)
 	if err != nil {
 		fmt.Println("Error listing queues:", err)
 		return
@@ -100,3 +207,44 @@ func listQueues() {
 		fmt.Printf("  - ID: %s, Name: %s\n", q["id"], q["name"])
 	}
 }
+
+func callNextTicket(queueID, counterID, reason string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	requestBody, err := ticketActionBody(counterID, reason)
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/queues/"+queueID+"/call-next", requestBody)
+	if err != nil {
+		fmt.Println("Error calling next ticket:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		fmt.Println("No tickets are waiting in this queue.")
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to call next ticket. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var ticket map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&ticket); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Now serving:")
+	fmt.Printf("  Ticket:   %s\n", ticket["ticket_number"])
+	fmt.Printf("  Customer: %s\n", ticket["customer_name"])
+	if counterName, ok := ticket["counter_name"].(string); ok {
+		fmt.Printf("  Counter:  %s\n", counterName)
+	}
+	fmt.Printf("  ID:       %s\n", ticket["id"])
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var smsCmd = &cobra.Command{
+	Use:   "sms",
+	Short: "Work with text messages from customers",
+	Long: `Customers can text STATUS for their place in line, CANCEL to leave the
+line, or LATE (optionally followed by a number, e.g. LATE 5) to let a few
+people go ahead. Their text is matched to their ticket by phone number.`,
+}
+
+var smsFrom string
+
+var smsSimulateCmd = &cobra.Command{
+	Use:   "simulate [text]",
+	Short: "Handle a text message as if a customer had sent it",
+	Long: `Handle a text message as if it came from the customer's phone number,
+without an SMS provider, and show the reply SmartQ would text back. The
+actions are real and recorded in the ticket's history as yours. Requires a
+staff login.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		simulateSMS(smsFrom, strings.Join(args, " "))
+	},
+}
+
+func init() {
+	smsSimulateCmd.Flags().StringVar(&smsFrom, "from", "", "phone number of the customer, as given at check-in")
+	smsSimulateCmd.MarkFlagRequired("from")
+
+	smsCmd.AddCommand(smsSimulateCmd)
+	rootCmd.AddCommand(smsCmd)
+}
+
+func simulateSMS(from, text string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	requestBody, err := json.Marshal(map[string]string{"from": from, "body": text})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/sms/simulate", requestBody)
+	if err != nil {
+		fmt.Println("Error simulating text message:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to simulate text message. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Printf("Command: %s\n", result["command"])
+	fmt.Printf("Ticket:  %v\n", valueOr(result["ticket_id"], "none in line"))
+	fmt.Printf("Reply:   %s\n", result["reply"])
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage the texts of messages to customers",
+	Long: `Commands for customizing the texts SmartQ sends to customers. The
+templates are ticket_created, called, next_in_line and cancelled, plus the
+replies to customers texting SmartQ: status, deferred, help and no_ticket. Their
+texts may use the placeholders {ticket_number}, {queue_name}, {counter},
+{position}, {people_ahead}, {eta} and {status_url}. A text is set for a
+locale, e.g. es or pt-BR, and either for one queue (--queue) or for every
+queue. Customers get the text of their queue in their locale, then of every
+queue, then SmartQ's built-in text, trying their language without the region
+and finally English. Changing texts requires an admin login.`,
+}
+
+var (
+	templateQueueID  string
+	templateLocale   string
+	templateTicketID string
+	templateBody     string
+)
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List customized texts",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listTemplates(templateQueueID)
+	},
+}
+
+var templateSetCmd = &cobra.Command{
+	Use:   "set [name] [locale] [text]",
+	Short: "Set the text of a template in a locale",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		setTemplate(templateQueueID, args[0], args[1], args[2])
+	},
+}
+
+var templateDeleteCmd = &cobra.Command{
+	Use:   "delete [name] [locale]",
+	Short: "Remove a customized text, going back to the fallback",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteTemplate(templateQueueID, args[0], args[1])
+	},
+}
+
+var templatePreviewCmd = &cobra.Command{
+	Use:   "preview [name]",
+	Short: "Show a template the way a customer would receive it",
+	Long: `Render a template for a ticket (--ticket) or for a sample ticket, showing
+which text was picked and why. --text renders a draft text instead.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		previewTemplate(args[0])
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{templateListCmd, templateSetCmd, templateDeleteCmd, templatePreviewCmd} {
+		c.Flags().StringVar(&templateQueueID, "queue", "", "queue ID whose texts to use (every queue if empty)")
+	}
+	templatePreviewCmd.Flags().StringVar(&templateLocale, "locale", "", "customer locale, e.g. es (the ticket's locale if empty)")
+	templatePreviewCmd.Flags().StringVar(&templateTicketID, "ticket", "", "ticket ID to fill the placeholders with")
+	templatePreviewCmd.Flags().StringVar(&templateBody, "text", "", "draft text to render instead of the saved one")
+
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateSetCmd)
+	templateCmd.AddCommand(templateDeleteCmd)
+	templateCmd.AddCommand(templatePreviewCmd)
+	rootCmd.AddCommand(templateCmd)
+}
+
+// templatesURL returns the URL of the customized texts of a queue, or of every
+// queue if queueID is empty.
+func templatesURL(queueID string) string {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	if queueID == "" {
+		return apiBaseURL + "/templates"
+	}
+	return apiBaseURL + "/queues/" + url.PathEscape(queueID) + "/templates"
+}
+
+func listTemplates(queueID string) {
+	resp, err := sendRequest(http.MethodGet, templatesURL(queueID), nil)
+	if err != nil {
+		fmt.Println("Error retrieving templates:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to retrieve templates. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var templates []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&templates); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	if len(templates) == 0 {
+		fmt.Println("No customized texts; the built-in texts are used.")
+		return
+	}
+
+	fmt.Println("Customized texts:")
+	for _, t := range templates {
+		fmt.Printf("  - %s (%s): %s\n", t["name"], t["locale"], t["body"])
+	}
+}
+
+func setTemplate(queueID, name, locale, text string) {
+	requestBody, err := json.Marshal(map[string]string{"body": text})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	endpoint := templatesURL(queueID) + "/" + url.PathEscape(name) + "/" + url.PathEscape(locale)
+	resp, err := sendRequest(http.MethodPut, endpoint, requestBody)
+	if err != nil {
+		fmt.Println("Error saving template:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to save template. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully saved the %s text for %s\n", name, locale)
+}
+
+func deleteTemplate(queueID, name, locale string) {
+	endpoint := templatesURL(queueID) + "/" + url.PathEscape(name) + "/" + url.PathEscape(locale)
+	resp, err := sendRequest(http.MethodDelete, endpoint, nil)
+	if err != nil {
+		fmt.Println("Error deleting template:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to delete template. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully removed the %s text for %s\n", name, locale)
+}
+
+func previewTemplate(name string) {
+	body := map[string]string{"name": name, "locale": templateLocale, "body": templateBody}
+	if templateQueueID != "" {
+		body["queue_id"] = templateQueueID
+	}
+	if templateTicketID != "" {
+		body["ticket_id"] = templateTicketID
+	}
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, templatesURL("")+"/preview", requestBody)
+	if err != nil {
+		fmt.Println("Error previewing template:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to preview template. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var preview map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Printf("Template: %s (%s, from %s)\n", preview["name"], preview["locale"], preview["source"])
+	fmt.Printf("  Text:    %s\n", preview["body"])
+	fmt.Printf("  Message: %s\n", preview["text"])
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -40,17 +40,23 @@ var ticketCallCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		ticketID := args[0]
-		updateTicketStatus(ticketID, "call")
+		updateTicketStatus(ticketID, "call", ticketCounterID, ticketReason)
 	},
 }
 
+// ticketCounterID is the --counter flag of ticket call: the counter calling the ticket.
+var ticketCounterID string
+
+// ticketReason is the --reason flag of the ticket actions, recorded in the audit trail.
+var ticketReason string
+
 var ticketServeCmd = &cobra.Command{
 	Use:   "serve [ticketId]",
 	Short: "Serve a ticket",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		ticketID := args[0]
-		updateTicketStatus(ticketID, "serve")
+		updateTicketStatus(ticketID, "serve", "", ticketReason)
 	},
 }
 
@@ -60,15 +66,32 @@ var ticketCancelCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		ticketID := args[0]
-		updateTicketStatus(ticketID, "cancel")
+		updateTicketStatus(ticketID, "cancel", "", ticketReason)
+	},
+}
+
+var ticketShowCmd = &cobra.Command{
+	Use:   "show [ticketId]",
+	Short: "Show a ticket and its timeline",
+	Long: `Show a ticket and the timeline of its status changes: when each happened,
+how long the ticket spent in each status, and who made the change.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		showTicket(args[0])
 	},
 }
 
 func init() {
+	ticketCallCmd.Flags().StringVar(&ticketCounterID, "counter", "", "ID of the counter calling the ticket")
+	for _, cmd := range []*cobra.Command{ticketCallCmd, ticketServeCmd, ticketCancelCmd} {
+		cmd.Flags().StringVar(&ticketReason, "reason", "", "reason recorded in the audit trail")
+	}
+
 	ticketCmd.AddCommand(ticketCreateCmd)
 	ticketCmd.AddCommand(ticketCallCmd)
 	ticketCmd.AddCommand(ticketServeCmd)
 	ticketCmd.AddCommand(ticketCancelCmd)
+	ticketCmd.AddCommand(ticketShowCmd)
 	rootCmd.AddCommand(ticketCmd)
 }
 
@@ -85,7 +108,7 @@ func createTicket(queueID, customerName, customerPhone string, priority int) {
 		return
 	}
 
-	resp, err := http.Post(apiBaseURL+"/queues/"+queueID+"/tickets", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/queues/"+queueID+"/tickets", requestBody)
 	if err != nil {
 		fmt.Println("Error creating ticket:", err)
 		return
@@ -108,12 +131,21 @@ func createTicket(queueID, customerName, customerPhone string, priority int) {
 	for k, v := range result {
 		fmt.Printf("  %s: %v\n", k, v)
 	}
+	if ahead, ok := result["people_ahead"].(float64); ok {
+		fmt.Printf("You are number %d in the queue.\n", int(ahead)+1)
+	}
 }
 
-func updateTicketStatus(ticketID, status string) {
+func updateTicketStatus(ticketID, status, counterID, reason string) {
 	const apiBaseURL = "http://localhost:8080/api/v1"
 
-	resp, err := http.Post(apiBaseURL+"/tickets/"+ticketID+"/"+status, "application/json", nil)
+	requestBody, err := ticketActionBody(counterID, reason)
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/tickets/"+ticketID+"/"+status, requestBody)
 	if err != nil {
 		fmt.Printf("Error updating ticket status to %s: %v\n", status, err)
 		return
@@ -137,3 +169,101 @@ func updateTicketStatus(ticketID, status string) {
 		fmt.Printf("  %s: %v\n", k, v)
 	}
 }
+
+// ticketActionBody builds the optional body of the ticket action endpoints.
+func ticketActionBody(counterID, reason string) ([]byte, error) {
+	body := map[string]interface{}{}
+	if counterID != "" {
+		body["counter_id"] = counterID
+	}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(body)
+}
+
+// ticketTimeline is the response of the ticket history endpoint.
+type ticketTimeline struct {
+	Ticket struct {
+		ID            string  `json:"id"`
+		QueueID       string  `json:"queue_id"`
+		TicketNumber  string  `json:"ticket_number"`
+		CustomerName  string  `json:"customer_name"`
+		CustomerPhone string  `json:"customer_phone"`
+		Status        string  `json:"status"`
+		Priority      int     `json:"priority"`
+		CounterName   *string `json:"counter_name"`
+		PeopleAhead   *int    `json:"people_ahead"`
+	} `json:"ticket"`
+	History []struct {
+		Status          string    `json:"status"`
+		Timestamp       time.Time `json:"timestamp"`
+		ActorType       string    `json:"actor_type"`
+		ActorName       string    `json:"actor_name"`
+		Reason          string    `json:"reason"`
+		DurationSeconds *float64  `json:"duration_seconds"`
+	} `json:"history"`
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+func showTicket(ticketID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodGet, apiBaseURL+"/tickets/"+ticketID+"/history", nil)
+	if err != nil {
+		fmt.Println("Error retrieving ticket:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to retrieve ticket. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var timeline ticketTimeline
+	if err := json.NewDecoder(resp.Body).Decode(&timeline); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	t := timeline.Ticket
+	fmt.Printf("Ticket %s\n", t.TicketNumber)
+	fmt.Printf("  ID:       %s\n", t.ID)
+	fmt.Printf("  Queue:    %s\n", t.QueueID)
+	fmt.Printf("  Customer: %s (%s)\n", t.CustomerName, t.CustomerPhone)
+	fmt.Printf("  Priority: %d\n", t.Priority)
+	fmt.Printf("  Status:   %s\n", t.Status)
+	if t.CounterName != nil {
+		fmt.Printf("  Counter:  %s\n", *t.CounterName)
+	}
+	if t.PeopleAhead != nil {
+		fmt.Printf("  Ahead:    %d\n", *t.PeopleAhead)
+	}
+
+	fmt.Println("Timeline:")
+	for _, h := range timeline.History {
+		duration := ""
+		if h.DurationSeconds != nil {
+			duration = formatSeconds(*h.DurationSeconds)
+		}
+		actor := h.ActorType
+		if h.ActorName != "" {
+			actor += " " + h.ActorName
+		}
+		fmt.Printf("  %s  %-10s %-10s by %s\n", h.Timestamp.Local().Format("2006-01-02 15:04:05"), h.Status, duration, actor)
+		if h.Reason != "" {
+			fmt.Printf("  %19s  reason: %s\n", "", h.Reason)
+		}
+	}
+	fmt.Printf("Total: %s\n", formatSeconds(timeline.TotalSeconds))
+}
+
+// formatSeconds renders a duration in seconds rounded to the second, e.g. 4m12s.
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
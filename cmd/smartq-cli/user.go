@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage staff accounts",
+	Long:  `Commands for creating, listing, and deleting staff accounts. They require an admin login.`,
+}
+
+var userPassword string
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create [username] [role]",
+	Short: "Create a staff account",
+	Long: `Create a staff account with role admin, staff or display. The password is
+prompted for unless --password is given.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		createUser(args[0], args[1], userPassword)
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List staff accounts",
+	Run: func(cmd *cobra.Command, args []string) {
+		listUsers()
+	},
+}
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete [userId]",
+	Short: "Delete a staff account",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteUser(args[0])
+	},
+}
+
+func init() {
+	userCreateCmd.Flags().StringVar(&userPassword, "password", "", "password (prompted for if empty)")
+
+	userCmd.AddCommand(userCreateCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userDeleteCmd)
+	rootCmd.AddCommand(userCmd)
+}
+
+func createUser(username, role, password string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	if password == "" {
+		var err error
+		if password, err = readPassword(); err != nil {
+			fmt.Println("Error reading password:", err)
+			return
+		}
+	}
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"username": username,
+		"password": password,
+		"role":     role,
+	})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/users", requestBody)
+	if err != nil {
+		fmt.Println("Error creating user:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to create user. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Successfully created user:")
+	fmt.Printf("  ID:       %s\n", result["id"])
+	fmt.Printf("  Username: %s\n", result["username"])
+	fmt.Printf("  Role:     %s\n", result["role"])
+}
+
+func listUsers() {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodGet, apiBaseURL+"/users", nil)
+	if err != nil {
+		fmt.Println("Error listing users:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to list users. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var users []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Staff accounts:")
+	for _, u := range users {
+		fmt.Printf("  - ID: %s, Username: %s, Role: %s\n", u["id"], u["username"], u["role"])
+	}
+}
+
+func deleteUser(userID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodDelete, apiBaseURL+"/users/"+userID, nil)
+	if err != nil {
+		fmt.Println("Error deleting user:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to delete user. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully deleted user %s\n", userID)
+}
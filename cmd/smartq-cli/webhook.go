@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage webhooks",
+	Long: `Commands for registering the URLs SmartQ POSTs ticket and queue events
+to, and for checking and retrying their deliveries. They require an admin
+login.`,
+}
+
+var (
+	webhookEvents      []string
+	webhookDescription string
+
+	webhookDeliveryWebhookID string
+	webhookDeliveryEventType string
+	webhookDeliveryStatus    string
+	webhookDeliveryLimit     int
+)
+
+var webhookCreateCmd = &cobra.Command{
+	Use:   "create [url]",
+	Short: "Register a webhook",
+	Long: `Register a URL to receive the given events: ticket.created, ticket.called,
+ticket.served, ticket.cancelled, ticket.deferred, queue.created and
+queue.updated. Requests are signed with the webhook's secret in the
+X-SmartQ-Signature header; the secret is printed once and cannot be
+retrieved later.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		createWebhook(args[0], webhookEvents, webhookDescription)
+	},
+}
+
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhooks",
+	Run: func(cmd *cobra.Command, args []string) {
+		listWebhooks()
+	},
+}
+
+var webhookDeleteCmd = &cobra.Command{
+	Use:   "delete [webhookId]",
+	Short: "Remove a webhook and its deliveries",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteWebhook(args[0])
+	},
+}
+
+var webhookDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "List webhook deliveries and their status",
+	Long: `List webhook deliveries, newest first, with their status: pending
+(waiting for its first attempt or a retry), sent or failed, the number of
+attempts and the last error.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		params := url.Values{}
+		if webhookDeliveryWebhookID != "" {
+			params.Set("webhook_id", webhookDeliveryWebhookID)
+		}
+		if webhookDeliveryEventType != "" {
+			params.Set("event_type", webhookDeliveryEventType)
+		}
+		if webhookDeliveryStatus != "" {
+			params.Set("status", webhookDeliveryStatus)
+		}
+		if webhookDeliveryLimit > 0 {
+			params.Set("limit", strconv.Itoa(webhookDeliveryLimit))
+		}
+		listWebhookDeliveries(params)
+	},
+}
+
+var webhookRedeliverCmd = &cobra.Command{
+	Use:   "redeliver [deliveryId]",
+	Short: "Send a sent or failed delivery again",
+	Long: `Send a delivery again with a fresh set of attempts, e.g. once its
+receiver is fixed. The event keeps its ID, so receivers can tell it apart
+from a new one.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		redeliverWebhook(args[0])
+	},
+}
+
+func init() {
+	webhookCreateCmd.Flags().StringSliceVar(&webhookEvents, "event", nil, "event type to deliver (repeatable or comma-separated)")
+	webhookCreateCmd.Flags().StringVar(&webhookDescription, "description", "", "what the webhook is for")
+	webhookCreateCmd.MarkFlagRequired("event")
+
+	webhookDeliveriesCmd.Flags().StringVar(&webhookDeliveryWebhookID, "webhook", "", "only deliveries to this webhook ID")
+	webhookDeliveriesCmd.Flags().StringVar(&webhookDeliveryEventType, "event", "", "only deliveries of this event type")
+	webhookDeliveriesCmd.Flags().StringVar(&webhookDeliveryStatus, "status", "", "only deliveries with this status: pending, sent or failed")
+	webhookDeliveriesCmd.Flags().IntVar(&webhookDeliveryLimit, "limit", 0, "maximum number of deliveries to show (default 200)")
+
+	webhookCmd.AddCommand(webhookCreateCmd)
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookDeleteCmd)
+	webhookCmd.AddCommand(webhookDeliveriesCmd)
+	webhookCmd.AddCommand(webhookRedeliverCmd)
+	rootCmd.AddCommand(webhookCmd)
+}
+
+func createWebhook(webhookURL string, events []string, description string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"url":         webhookURL,
+		"events":      events,
+		"description": description,
+	})
+	if err != nil {
+		fmt.Println("Error marshalling request body:", err)
+		return
+	}
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/webhooks", requestBody)
+	if err != nil {
+		fmt.Println("Error creating webhook:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to create webhook. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var result struct {
+		Secret  string                 `json:"secret"`
+		Webhook map[string]interface{} `json:"webhook"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Successfully created webhook:")
+	fmt.Printf("  ID:     %s\n", result.Webhook["id"])
+	fmt.Printf("  URL:    %s\n", result.Webhook["url"])
+	fmt.Printf("  Events: %v\n", result.Webhook["events"])
+	fmt.Printf("  Secret: %s\n", result.Secret)
+	fmt.Println("Store the secret now; it cannot be shown again. Use it to verify the X-SmartQ-Signature header.")
+}
+
+func listWebhooks() {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodGet, apiBaseURL+"/webhooks", nil)
+	if err != nil {
+		fmt.Println("Error listing webhooks:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to list webhooks. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var webhooks []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&webhooks); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	fmt.Println("Webhooks:")
+	for _, w := range webhooks {
+		fmt.Printf("  - ID: %s, URL: %s, Events: %v, Description: %s\n", w["id"], w["url"], w["events"], w["description"])
+	}
+}
+
+func deleteWebhook(webhookID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodDelete, apiBaseURL+"/webhooks/"+webhookID, nil)
+	if err != nil {
+		fmt.Println("Error deleting webhook:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to delete webhook. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully deleted webhook %s\n", webhookID)
+}
+
+func listWebhookDeliveries(params url.Values) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	endpoint := apiBaseURL + "/webhook-deliveries"
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	resp, err := sendRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		fmt.Println("Error retrieving webhook deliveries:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to retrieve webhook deliveries. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	var deliveries []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		fmt.Println("Error decoding response body:", err)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		fmt.Println("No deliveries found.")
+		return
+	}
+
+	fmt.Println("Deliveries:")
+	for _, d := range deliveries {
+		fmt.Printf("  - %s  %s %s to %s, %s after %v attempt(s)\n",
+			d["created_at"], d["id"], d["event_type"], d["url"], d["status"], d["attempts"])
+		switch d["status"] {
+		case "sent":
+			fmt.Printf("      delivered at: %s\n", d["delivered_at"])
+		case "pending":
+			fmt.Printf("      next try:     %s\n", d["next_attempt_at"])
+		}
+		if lastError, ok := d["last_error"].(string); ok && lastError != "" {
+			fmt.Printf("      last error:   %s\n", lastError)
+		}
+	}
+}
+
+func redeliverWebhook(deliveryID string) {
+	const apiBaseURL = "http://localhost:8080/api/v1"
+
+	resp, err := sendRequest(http.MethodPost, apiBaseURL+"/webhook-deliveries/"+deliveryID+"/redeliver", nil)
+	if err != nil {
+		fmt.Println("Error redelivering webhook delivery:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Failed to redeliver webhook delivery. Status: %s, Body: %s\n", resp.Status, string(body))
+		return
+	}
+
+	fmt.Printf("Successfully queued delivery %s to be sent again\n", deliveryID)
+}
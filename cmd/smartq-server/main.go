@@ -2,42 +2,97 @@ package main
 
 import (
 	"context" // Import context
+	"crypto/rand"
+	"errors"
+	"flag"
 	"log"
 	"net/http" // Import net/http
 	"os"       // Import os
 	"os/signal" // Import os/signal
+	"strconv"
+	"strings"
 	"syscall"  // Import syscall
 	"time"     // Import time
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/smartq/smartq/internal/api"
+	"github.com/smartq/smartq/internal/auth"
 	"github.com/smartq/smartq/internal/config"
 	"github.com/smartq/smartq/internal/notifier" // Import the notifier package
 	"github.com/smartq/smartq/internal/storage"
 )
 
 func main() {
+	inMemory := flag.Bool("memory", false, "use the in-memory store instead of DATABASE_URL (demo mode, nothing is persisted)")
+	flag.Parse()
+
 	cfg := config.LoadConfig() // Load config first
 
-	// Run database migrations
-	runMigrations(cfg.DatabaseURL)
+	// Pick the storage backend from the flags or the DATABASE_URL scheme and run its migrations
+	var db storage.Store
+	if *inMemory {
+		log.Println("Using in-memory store; data will be lost on exit.")
+		db = storage.NewMemoryStore()
+	} else if storage.IsSQLiteURL(cfg.DatabaseURL) {
+		runMigrations("file://migrations/sqlite", "sqlite3://"+storage.SQLitePath(cfg.DatabaseURL))
 
-	db, err := storage.NewPostgresDB(cfg)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		sqliteDB, err := storage.NewSQLiteDB(cfg)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		defer sqliteDB.Close()
+		db = sqliteDB
+	} else {
+		runMigrations("file://migrations", cfg.DatabaseURL)
+
+		pgDB, err := storage.NewPostgresDB(cfg)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer pgDB.Close()
+		db = pgDB
 	}
-	defer db.Close()
 
 	// Create and run the WebSocket hub
 	hub := notifier.NewHub()
 	go hub.Run()
 
-	// Create a Notifier instance
-	n := notifier.NewNotifier(hub)
+	// Create a Notifier instance, which also texts customers through the
+	// delivery worker and calls webhooks through the webhook worker
+	deliveries := newDeliveryWorker(db, cfg)
+	webhooks := newWebhookWorker(db, cfg)
+	n := notifier.NewNotifier(hub, deliveries, webhooks)
+	n.SetCountryCode(countryCode(cfg))
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if deliveries != nil {
+			deliveries.Run(workerCtx)
+		}
+	}()
+	webhooksDone := make(chan struct{})
+	go func() {
+		defer close(webhooksDone)
+		webhooks.Run(workerCtx)
+	}()
+
+	// Publish the ticket events written to the outbox by the ticket actions
+	dispatcher := notifier.NewDispatcher(db, n)
+	dispatcher.Handle(api.HandleTicketEvent(db, n))
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		dispatcher.Run(workerCtx)
+	}()
 
-	router := api.NewRouter(db, hub, n) // Pass the hub and notifier to the router
+	tokens := newTokenManager(cfg)
+	bootstrapAdmin(db, cfg)
+
+	router := api.NewRouter(db, hub, n, tokens, newInboundVerifier(cfg)) // Pass the hub and notifier to the router
 
 	// Start HTTP server
 	srv := &http.Server{
@@ -63,13 +118,19 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	// Events, messages and webhook deliveries still pending are sent after
+	// the next start
+	stopWorker()
+	<-workerDone
+	<-webhooksDone
+	<-dispatcherDone
 
 	log.Println("Server exiting")
 }
 
-func runMigrations(databaseURL string) {
+func runMigrations(sourceURL, databaseURL string) {
 	m, err := migrate.New(
-		"file://migrations",
+		sourceURL,
 		databaseURL,
 	)
 	if err != nil {
@@ -81,3 +142,121 @@ func runMigrations(databaseURL string) {
 	log.Println("Database migrations applied successfully!")
 }
 
+
+// newTokenManager creates the login token manager from the configuration.
+// Without JWT_SECRET a random secret is used, so logins do not survive a restart.
+func newTokenManager(cfg *config.Config) *auth.TokenManager {
+	ttl, err := time.ParseDuration(cfg.TokenTTL)
+	if err != nil {
+		log.Fatalf("Invalid TOKEN_TTL %q: %v", cfg.TokenTTL, err)
+	}
+
+	secret := []byte(cfg.JWTSecret)
+	if len(secret) == 0 {
+		log.Println("JWT_SECRET is not set; using a random secret, so staff must log in again after a restart.")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate token secret: %v", err)
+		}
+	}
+	return auth.NewTokenManager(secret, ttl)
+}
+
+// newDeliveryWorker creates the worker that sends the text messages to
+// customers stored in db through the configured SMS_PROVIDER, or returns nil
+// when text messages are disabled.
+func newDeliveryWorker(db storage.Store, cfg *config.Config) *notifier.DeliveryWorker {
+	attempts, err := strconv.Atoi(cfg.SMSMaxAttempts)
+	if err != nil || attempts < 1 {
+		log.Fatalf("Invalid SMS_MAX_ATTEMPTS %q: must be a positive number", cfg.SMSMaxAttempts)
+	}
+
+	var sender notifier.SMSSender
+	switch cfg.SMSProvider {
+	case "none", "":
+		log.Println("SMS_PROVIDER is none; customers will not receive text messages.")
+		return nil
+	case "log":
+		log.Println("SMS_PROVIDER is log; text messages are only written to the log.")
+		sender = notifier.NewLogSender()
+	case "twilio":
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioFromNumber == "" {
+			log.Fatal("SMS_PROVIDER twilio needs TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER")
+		}
+		sender = notifier.NewTwilioSender(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFromNumber, cfg.TwilioBaseURL)
+	default:
+		log.Fatalf("Unknown SMS_PROVIDER %q: use log, twilio or none", cfg.SMSProvider)
+	}
+	return notifier.NewDeliveryWorker(db, sender, attempts, 2*time.Second)
+}
+
+// countryCode returns the configured PHONE_COUNTRY_CODE, without a leading +.
+func countryCode(cfg *config.Config) string {
+	code := strings.TrimPrefix(cfg.PhoneCountryCode, "+")
+	if _, err := strconv.Atoi(code); err != nil || len(code) > 3 || strings.HasPrefix(code, "0") {
+		log.Fatalf("Invalid PHONE_COUNTRY_CODE %q: must be a calling code such as 1 or 44", cfg.PhoneCountryCode)
+	}
+	return code
+}
+
+// newWebhookWorker creates the worker that sends the webhook deliveries
+// stored in db.
+func newWebhookWorker(db storage.Store, cfg *config.Config) *notifier.WebhookWorker {
+	attempts, err := strconv.Atoi(cfg.WebhookMaxAttempts)
+	if err != nil || attempts < 1 {
+		log.Fatalf("Invalid WEBHOOK_MAX_ATTEMPTS %q: must be a positive number", cfg.WebhookMaxAttempts)
+	}
+	return notifier.NewWebhookWorker(db, attempts, 5*time.Second)
+}
+
+// newInboundVerifier returns the check of the SMS provider's webhook requests
+// carrying text messages from customers, or nil to serve no webhook. The log
+// provider's webhook accepts any request, so it is only served with
+// SMS_INBOUND_INSECURE=true.
+func newInboundVerifier(cfg *config.Config) notifier.InboundVerifier {
+	insecure, err := strconv.ParseBool(cfg.SMSInboundInsecure)
+	if err != nil {
+		log.Fatalf("Invalid SMS_INBOUND_INSECURE %q: must be true or false", cfg.SMSInboundInsecure)
+	}
+	switch cfg.SMSProvider {
+	case "twilio":
+		if cfg.SMSWebhookURL == "" {
+			log.Println("SMS_WEBHOOK_URL is not set; webhook signatures are checked against the URL the server sees.")
+		}
+		return notifier.NewTwilioVerifier(cfg.TwilioAuthToken, cfg.SMSWebhookURL)
+	case "log":
+		if !insecure {
+			return nil
+		}
+		log.Println("SMS_INBOUND_INSECURE is true; the inbound text message webhook accepts unsigned requests. Never use it in production.")
+		return notifier.InsecureInboundVerifier{}
+	default:
+		return nil
+	}
+}
+
+// bootstrapAdmin creates the first admin account from ADMIN_USERNAME and
+// ADMIN_PASSWORD when the database has no staff accounts yet.
+func bootstrapAdmin(db storage.Store, cfg *config.Config) {
+	ctx := context.Background()
+	users, err := db.GetUsers(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) > 0 {
+		return
+	}
+	if cfg.AdminPassword == "" {
+		log.Println("No staff accounts exist. Set ADMIN_PASSWORD to create the first admin account.")
+		return
+	}
+
+	hash, err := auth.HashPassword(cfg.AdminPassword)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_PASSWORD: %v", err)
+	}
+	if _, err := db.CreateUser(ctx, cfg.AdminUsername, hash, auth.RoleAdmin); err != nil && !errors.Is(err, storage.ErrUserExists) {
+		log.Fatalf("Failed to create admin account: %v", err)
+	}
+	log.Printf("Created admin account %q.", cfg.AdminUsername)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/auth"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// NewAPIKeyRequest represents the data needed to create an API key.
+// ExpiresAt is optional; keys without it never expire.
+type NewAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey handles creating an API key. The key itself is only returned
+// in this response; afterwards only its hash is known.
+func CreateAPIKey(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req NewAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := auth.ValidateScopes(req.Scopes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+			return
+		}
+
+		apiKey, err := db.CreateAPIKey(c.Request.Context(), req.Name, prefix, hash, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			respondError(c, err, "Failed to create API key")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"key":     key,
+			"api_key": apiKey,
+		})
+	}
+}
+
+// GetAPIKeys handles listing API keys.
+func GetAPIKeys(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := db.GetAPIKeys(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// DeleteAPIKey handles revoking an API key.
+func DeleteAPIKey(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID, err := uuid.Parse(c.Param("keyId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID format"})
+			return
+		}
+
+		if err := db.DeleteAPIKey(c.Request.Context(), keyID); err != nil {
+			respondError(c, err, "Failed to delete API key")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// maxUserAgentLength caps the user agent recorded in the audit trail.
+const maxUserAgentLength = 255
+
+// auditFrom describes the caller of a ticket action for the audit trail: the
+// logged-in user, the API key, or otherwise the customer using a public route.
+func auditFrom(c *gin.Context, reason string) storage.Audit {
+	audit := storage.Audit{
+		ActorType: storage.ActorCustomer,
+		SourceIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+	}
+	if len(audit.UserAgent) > maxUserAgentLength {
+		audit.UserAgent = audit.UserAgent[:maxUserAgentLength]
+	}
+	if user := currentUser(c); user != nil {
+		id := user.ID
+		audit.ActorType, audit.ActorID, audit.ActorName = storage.ActorUser, &id, user.Username
+	} else if key := currentAPIKey(c); key != nil {
+		id := key.ID
+		audit.ActorType, audit.ActorID, audit.ActorName = storage.ActorAPIKey, &id, key.Name
+	}
+	return audit
+}
+
+// GetAuditTrail handles querying the audit trail of ticket actions. The
+// optional query parameters ticket_id, actor_type, actor_id, from, to (RFC
+// 3339 timestamps) and limit narrow the results, which are newest first.
+func GetAuditTrail(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter storage.AuditFilter
+
+		if v := c.Query("ticket_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID format"})
+				return
+			}
+			filter.TicketID = &id
+		}
+		if v := c.Query("actor_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor ID format"})
+				return
+			}
+			filter.ActorID = &id
+		}
+		switch v := c.Query("actor_type"); v {
+		case "", storage.ActorUser, storage.ActorAPIKey, storage.ActorCustomer, storage.ActorSMS, storage.ActorSystem:
+			filter.ActorType = v
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "actor_type must be one of user, api_key, customer, sms or system"})
+			return
+		}
+		for _, p := range []struct {
+			name string
+			dst  **time.Time
+		}{{"from", &filter.From}, {"to", &filter.To}} {
+			if v := c.Query(p.name); v != "" {
+				at, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": p.name + " must be an RFC 3339 timestamp"})
+					return
+				}
+				*p.dst = &at
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > storage.DefaultAuditLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(storage.DefaultAuditLimit)})
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := db.GetAuditTrail(c.Request.Context(), filter)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve audit trail")
+			return
+		}
+		if entries == nil {
+			entries = []*storage.TicketHistory{}
+		}
+
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// TicketTimeline is the response of GetTicketHistory: a ticket and its history,
+// oldest first.
+type TicketTimeline struct {
+	Ticket       *storage.Ticket `json:"ticket"`
+	History      []TimelineEntry `json:"history"`
+	TotalSeconds float64         `json:"total_seconds"` // From check-in to the final status, or to now while the ticket is open
+}
+
+// TimelineEntry is a status change with the time the ticket then spent in
+// that status: until the next change, or until now for the current status.
+// DurationSeconds is nil for the final status of a served or cancelled ticket,
+// and for rows that leave the status unchanged, such as status checks.
+type TimelineEntry struct {
+	*storage.TicketHistory
+	DurationSeconds *float64 `json:"duration_seconds"`
+}
+
+// GetTicketHistory handles retrieving a ticket's status changes with the time
+// spent between them.
+func GetTicketHistory(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticketID, err := uuid.Parse(c.Param("ticketId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID format"})
+			return
+		}
+
+		current, err := db.GetTicketByID(c.Request.Context(), ticketID)
+		if err == nil {
+			current, err = withPeopleAhead(c.Request.Context(), db, current)
+		}
+		if err != nil {
+			respondError(c, err, "Failed to retrieve ticket")
+			return
+		}
+		history, err := db.GetTicketHistory(c.Request.Context(), ticketID)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve ticket history")
+			return
+		}
+
+		c.JSON(http.StatusOK, buildTimeline(current, history, time.Now()))
+	}
+}
+
+// buildTimeline pairs every status change with the time until the next one.
+// Rows that leave the status unchanged are listed without a duration.
+func buildTimeline(current *storage.Ticket, history []*storage.TicketHistory, now time.Time) TicketTimeline {
+	timeline := TicketTimeline{Ticket: current, History: make([]TimelineEntry, len(history))}
+	var last *storage.TicketHistory // The latest status change
+	for i, h := range history {
+		timeline.History[i].TicketHistory = h
+		if !ticket.StartsPhase(h.Status) {
+			continue
+		}
+		last = h
+
+		var end time.Time
+		if next := nextPhase(history[i+1:]); next != nil {
+			end = next.Timestamp
+		} else if !ticket.IsTerminal(h.Status) {
+			end = now
+		} else {
+			continue
+		}
+		seconds := end.Sub(h.Timestamp).Seconds()
+		timeline.History[i].DurationSeconds = &seconds
+	}
+
+	if last != nil {
+		end := last.Timestamp
+		if !ticket.IsTerminal(last.Status) {
+			end = now
+		}
+		timeline.TotalSeconds = end.Sub(history[0].Timestamp).Seconds()
+	}
+	return timeline
+}
+
+// nextPhase returns the first of history that changes the status, or nil.
+func nextPhase(history []*storage.TicketHistory) *storage.TicketHistory {
+	for _, h := range history {
+		if ticket.StartsPhase(h.Status) {
+			return h
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	row := func(status string, minutes int) *storage.TicketHistory {
+		return &storage.TicketHistory{Status: status, Timestamp: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+	seconds := func(minutes int) *float64 {
+		s := float64(minutes * 60)
+		return &s
+	}
+
+	for name, tt := range map[string]struct {
+		history []*storage.TicketHistory
+		now     time.Time
+		want    []*float64
+		total   float64
+	}{
+		"served": {
+			history: []*storage.TicketHistory{row(ticket.StatusWaiting, 0), row(ticket.StatusServing, 10), row(ticket.StatusServed, 15)},
+			want:    []*float64{seconds(10), seconds(5), nil},
+			total:   15 * 60,
+		},
+		"waiting until now": {
+			history: []*storage.TicketHistory{row(ticket.StatusWaiting, 0), row(ticket.StatusDeferred, 4)},
+			now:     start.Add(10 * time.Minute),
+			want:    []*float64{seconds(4), seconds(6)},
+			total:   10 * 60,
+		},
+		// Status checks neither split the wait nor get a duration.
+		"status checks": {
+			history: []*storage.TicketHistory{
+				row(ticket.StatusWaiting, 0), row(ticket.StatusChecked, 3), row(ticket.StatusChecked, 7),
+				row(ticket.StatusServing, 12), row(ticket.StatusServed, 20), row(ticket.StatusChecked, 21),
+			},
+			want:  []*float64{seconds(12), nil, nil, seconds(8), nil, nil},
+			total: 20 * 60,
+		},
+		"checked while waiting": {
+			history: []*storage.TicketHistory{row(ticket.StatusWaiting, 0), row(ticket.StatusChecked, 3)},
+			now:     start.Add(5 * time.Minute),
+			want:    []*float64{seconds(5), nil},
+			total:   5 * 60,
+		},
+	} {
+		timeline := buildTimeline(nil, tt.history, tt.now)
+		if len(timeline.History) != len(tt.want) {
+			t.Fatalf("%s: %d entries, want %d", name, len(timeline.History), len(tt.want))
+		}
+		for i, entry := range timeline.History {
+			got, want := entry.DurationSeconds, tt.want[i]
+			if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+				t.Errorf("%s: entry %d (%s) duration = %v, want %v", name, i, entry.Status, formatDuration(got), formatDuration(want))
+			}
+		}
+		if timeline.TotalSeconds != tt.total {
+			t.Errorf("%s: total = %v seconds, want %v", name, timeline.TotalSeconds, tt.total)
+		}
+	}
+}
+
+// formatDuration prints an optional duration for test failures.
+func formatDuration(seconds *float64) string {
+	if seconds == nil {
+		return "none"
+	}
+	return time.Duration(*seconds * float64(time.Second)).String()
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/auth"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// Gin context keys holding the authenticated *storage.User or *storage.APIKey.
+const (
+	currentUserKey   = "currentUser"
+	currentAPIKeyKey = "currentAPIKey"
+)
+
+// apiKeyHeader carries API keys. WebSocket clients may use the api_key query
+// parameter instead.
+const apiKeyHeader = "X-API-Key"
+
+// dummyPasswordHash is compared against when a login names an unknown user, so
+// that unknown and known usernames take the same time to reject.
+var dummyPasswordHash, _ = auth.HashPassword("not-a-real-password")
+
+// requireRole rejects requests that do not carry a valid login token for a
+// user with at least the given role. The user is looked up on every request,
+// so deleted accounts and role changes take effect immediately. API keys are
+// not accepted.
+func requireRole(db storage.Store, tokens *auth.TokenManager, role string) gin.HandlerFunc {
+	return authenticate(db, tokens, role, "", false)
+}
+
+// requireAccess is requireRole that also accepts API keys carrying scope.
+func requireAccess(db storage.Store, tokens *auth.TokenManager, role, scope string) gin.HandlerFunc {
+	return authenticate(db, tokens, role, scope, false)
+}
+
+// requireAccessWS is requireAccess for WebSocket upgrades. Browsers cannot set
+// headers on WebSocket requests, so the token may also be passed in the
+// access_token query parameter and the API key in api_key.
+func requireAccessWS(db storage.Store, tokens *auth.TokenManager, role, scope string) gin.HandlerFunc {
+	return authenticate(db, tokens, role, scope, true)
+}
+
+// allowAPIKey lets public routes identify the kiosk or integration calling
+// them. Requests without an API key pass through; requests with one are
+// rejected unless the key is valid and carries scope.
+func allowAPIKey(db storage.Store, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := c.GetHeader(apiKeyHeader); key != "" && !authenticateAPIKey(c, db, key, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticate(db storage.Store, tokens *auth.TokenManager, role, scope string, allowQueryToken bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(apiKeyHeader)
+		if key == "" && allowQueryToken {
+			key = c.Query("api_key")
+		}
+		if key != "" {
+			if !authenticateAPIKey(c, db, key, scope) {
+				return
+			}
+			c.Next()
+			return
+		}
+
+		token := bearerToken(c)
+		if token == "" && allowQueryToken {
+			token = c.Query("access_token")
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		claims, err := tokens.Parse(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		user, err := db.GetUserByID(c.Request.Context(), userID)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			return
+		}
+
+		if !auth.Allows(user.Role, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This action requires the " + role + " role"})
+			return
+		}
+
+		c.Set(currentUserKey, user)
+		c.Next()
+	}
+}
+
+// authenticateAPIKey checks that key is a known, unexpired API key carrying
+// scope, records its use and stores it in the context. An empty scope means
+// the route does not accept API keys. It aborts the request and returns false
+// if the key is rejected.
+func authenticateAPIKey(c *gin.Context, db storage.Store, key, scope string) bool {
+	if scope == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used for this action"})
+		return false
+	}
+
+	apiKey, err := db.GetAPIKeyByHash(c.Request.Context(), auth.HashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+			return false
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+		return false
+	}
+	now := time.Now()
+	if apiKey.Expired(now) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		return false
+	}
+	if !auth.HasScope(apiKey.Scopes, scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This action requires the " + scope + " scope"})
+		return false
+	}
+
+	// Failing to record the last use should not lock the integration out.
+	if err := db.TouchAPIKey(c.Request.Context(), apiKey.ID, now); err != nil {
+		log.Printf("Failed to record use of API key %s: %v", apiKey.ID, err)
+	}
+	apiKey.LastUsedAt = &now
+
+	c.Set(currentAPIKeyKey, apiKey)
+	return true
+}
+
+// bearerToken returns the token from an "Authorization: Bearer <token>" header.
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	return ""
+}
+
+// currentUser returns the user authenticated by requireRole, or nil on public
+// routes and for requests made with an API key.
+func currentUser(c *gin.Context) *storage.User {
+	if v, ok := c.Get(currentUserKey); ok {
+		if user, ok := v.(*storage.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// currentAPIKey returns the API key the request was made with, or nil.
+func currentAPIKey(c *gin.Context) *storage.APIKey {
+	if v, ok := c.Get(currentAPIKeyKey); ok {
+		if key, ok := v.(*storage.APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// LoginRequest represents staff login credentials.
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login handles staff login. It responds with a bearer token for the API.
+func Login(db storage.Store, tokens *auth.TokenManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := db.GetUserByUsername(c.Request.Context(), req.Username)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		if user == nil {
+			auth.CheckPassword(dummyPasswordHash, req.Password)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+		if !auth.CheckPassword(user.PasswordHash, req.Password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+
+		token, expiresAt, err := tokens.Issue(user.ID, user.Username, user.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"token":      token,
+			"token_type": "Bearer",
+			"expires_at": expiresAt,
+			"user":       user,
+		})
+	}
+}
+
+// GetCurrentUser handles returning the logged-in user.
+func GetCurrentUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, currentUser(c))
+	}
+}
+
+// NewUserRequest represents the data needed to create a staff account.
+type NewUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// CreateUser handles creating a staff account.
+func CreateUser(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req NewUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !auth.IsValidRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of admin, staff or display"})
+			return
+		}
+
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := db.CreateUser(c.Request.Context(), req.Username, hash, req.Role)
+		if err != nil {
+			respondError(c, err, "Failed to create user")
+			return
+		}
+
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// GetUsers handles listing staff accounts.
+func GetUsers(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		users, err := db.GetUsers(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+			return
+		}
+
+		c.JSON(http.StatusOK, users)
+	}
+}
+
+// DeleteUser handles removing a staff account. Users cannot delete themselves,
+// so there is always an admin left to manage the others.
+func DeleteUser(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			return
+		}
+		if user := currentUser(c); user != nil && user.ID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+			return
+		}
+
+		if err := db.DeleteUser(c.Request.Context(), userID); err != nil {
+			respondError(c, err, "Failed to delete user")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// CounterRequest represents the data needed to create or rename a counter.
+type CounterRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateCounter handles adding a counter to a queue.
+func CreateCounter(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueID, err := uuid.Parse(c.Param("queueId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID format"})
+			return
+		}
+
+		var req CounterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		counter, err := db.CreateCounter(c.Request.Context(), queueID, req.Name)
+		if err != nil {
+			respondError(c, err, "Failed to create counter")
+			return
+		}
+
+		c.JSON(http.StatusCreated, counter)
+	}
+}
+
+// GetCounters handles listing the counters of a queue.
+func GetCounters(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueID, err := uuid.Parse(c.Param("queueId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID format"})
+			return
+		}
+
+		counters, err := db.GetCountersByQueueID(c.Request.Context(), queueID)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve counters")
+			return
+		}
+
+		c.JSON(http.StatusOK, counters)
+	}
+}
+
+// GetCounter handles retrieving a counter by its ID.
+func GetCounter(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counterID, err := uuid.Parse(c.Param("counterId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid counter ID format"})
+			return
+		}
+
+		counter, err := db.GetCounterByID(c.Request.Context(), counterID)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve counter")
+			return
+		}
+
+		c.JSON(http.StatusOK, counter)
+	}
+}
+
+// UpdateCounter handles renaming a counter.
+func UpdateCounter(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counterID, err := uuid.Parse(c.Param("counterId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid counter ID format"})
+			return
+		}
+
+		var req CounterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		counter, err := db.UpdateCounter(c.Request.Context(), counterID, req.Name)
+		if err != nil {
+			respondError(c, err, "Failed to update counter")
+			return
+		}
+
+		c.JSON(http.StatusOK, counter)
+	}
+}
+
+// DeleteCounter handles removing a counter.
+func DeleteCounter(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counterID, err := uuid.Parse(c.Param("counterId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid counter ID format"})
+			return
+		}
+
+		if err := db.DeleteCounter(c.Request.Context(), counterID); err != nil {
+			respondError(c, err, "Failed to delete counter")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
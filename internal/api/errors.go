@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// statusForError maps storage errors to HTTP status codes. Errors it does not
+// know about are treated as internal server errors.
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrQueueNotFound), errors.Is(err, storage.ErrTicketNotFound),
+		errors.Is(err, storage.ErrCounterNotFound), errors.Is(err, storage.ErrUserNotFound),
+		errors.Is(err, storage.ErrAPIKeyNotFound), errors.Is(err, storage.ErrNotificationNotFound),
+		errors.Is(err, storage.ErrTemplateNotFound), errors.Is(err, storage.ErrWebhookNotFound),
+		errors.Is(err, storage.ErrDeliveryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrCounterNotInQueue):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrInvalidTransition), errors.Is(err, storage.ErrCounterExists),
+		errors.Is(err, storage.ErrUserExists), errors.Is(err, storage.ErrDeliveryPending):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondError writes the JSON error response for err. Client errors carry the
+// error message; internal errors are replaced with the generic message so that
+// database details do not leak to callers.
+func respondError(c *gin.Context, err error, message string) {
+	status := statusForError(err)
+	if status == http.StatusInternalServerError {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
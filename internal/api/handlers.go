@@ -1,24 +1,32 @@
 package api
 
 import (
-	"fmt" // Import fmt package for error formatting
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid" // Import uuid package
+	"github.com/smartq/smartq/internal/auth"
+	"github.com/smartq/smartq/internal/message"
 	"github.com/smartq/smartq/internal/notifier" // Import notifier
+	"github.com/smartq/smartq/internal/queue"
 	"github.com/smartq/smartq/internal/storage"
 )
 
 // NewQueue represents the data needed to create a new queue.
+// The ticket format fields are optional and default to "A-001", reset daily.
 type NewQueue struct {
 	Name string `json:"name" binding:"required"`
+	queue.TicketFormat
+	NotifyThresholds []int `json:"notify_thresholds"` // Optional; see queue.ValidateNotifyThresholds
 }
 
 // CreateQueue handles the creation of a new queue.
-// It now returns a gin.HandlerFunc closure to capture the *storage.PostgresDB instance.
-func CreateQueue(db *storage.PostgresDB, n *notifier.Notifier) gin.HandlerFunc { // Accept notifier
+// It now returns a gin.HandlerFunc closure to capture the storage.Store instance.
+func CreateQueue(db storage.Store, n *notifier.Notifier) gin.HandlerFunc { // Accept notifier
 	return func(c *gin.Context) {
 		var newQueue NewQueue
 		if err := c.ShouldBindJSON(&newQueue); err != nil {
@@ -26,26 +34,80 @@ func CreateQueue(db *storage.PostgresDB, n *notifier.Notifier) gin.HandlerFunc {
 			return
 		}
 
+		format := newQueue.TicketFormat.WithDefaults()
+		if err := format.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := queue.ValidateNotifyThresholds(newQueue.NotifyThresholds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Use the storage layer to create the queue
-		queue, err := db.CreateQueue(c.Request.Context(), newQueue.Name)
+		queue, err := db.CreateQueue(c.Request.Context(), newQueue.Name, format, newQueue.NotifyThresholds)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create queue"})
 			return
 		}
 
 		c.JSON(http.StatusCreated, gin.H{
-			"id":         queue.ID,
-			"name":       queue.Name,
-			"created_at": queue.CreatedAt.Format(time.RFC3339),
+			"id":                  queue.ID,
+			"name":                queue.Name,
+			"ticket_prefix":       queue.Prefix,
+			"ticket_number_width": queue.Width,
+			"ticket_start_number": queue.StartNumber,
+			"ticket_reset_policy": queue.ResetPolicy,
+			"notify_thresholds":   queue.NotifyThresholds,
+			"created_at":          queue.CreatedAt.Format(time.RFC3339),
 		})
 
 		// Send WebSocket update
 		n.SendQueueUpdate(queue)
+		n.PublishEvent(c.Request.Context(), notifier.EventQueueCreated, queue)
+	}
+}
+
+// NotifyThresholdsRequest is the body of SetNotifyThresholds.
+type NotifyThresholdsRequest struct {
+	NotifyThresholds []int `json:"notify_thresholds"`
+}
+
+// SetNotifyThresholds handles replacing the numbers of people ahead at which a
+// queue's waiting customers get a text. An empty list turns these texts off.
+func SetNotifyThresholds(db storage.Store, n *notifier.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueID, err := uuid.Parse(c.Param("queueId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID format"})
+			return
+		}
+
+		var req NotifyThresholdsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := queue.ValidateNotifyThresholds(req.NotifyThresholds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := db.SetQueueNotifyThresholds(c.Request.Context(), queueID, req.NotifyThresholds)
+		if err != nil {
+			respondError(c, err, "Failed to update queue")
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+
+		n.SendQueueUpdate(updated)
+		n.PublishEvent(c.Request.Context(), notifier.EventQueueUpdated, updated)
 	}
 }
 
 // GetQueue handles retrieving a queue by its ID.
-func GetQueue(db *storage.PostgresDB) gin.HandlerFunc {
+func GetQueue(db storage.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		queueIDStr := c.Param("queueId")
 		queueID, err := uuid.Parse(queueIDStr)
@@ -56,11 +118,7 @@ func GetQueue(db *storage.PostgresDB) gin.HandlerFunc {
 
 		queue, err := db.GetQueueByID(c.Request.Context(), queueID)
 		if err != nil {
-			if err.Error() == fmt.Sprintf("queue with ID %s not found", queueID.String()) {
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve queue"})
+			respondError(c, err, "Failed to retrieve queue")
 			return
 		}
 
@@ -69,7 +127,7 @@ func GetQueue(db *storage.PostgresDB) gin.HandlerFunc {
 }
 
 // GetTickets handles retrieving all tickets for a given queue ID.
-func GetTickets(db *storage.PostgresDB) gin.HandlerFunc {
+func GetTickets(db storage.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		queueIDStr := c.Param("queueId")
 		queueID, err := uuid.Parse(queueIDStr)
@@ -80,23 +138,47 @@ func GetTickets(db *storage.PostgresDB) gin.HandlerFunc {
 
 		tickets, err := db.GetTicketsByQueueID(c.Request.Context(), queueID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tickets"})
+			respondError(c, err, "Failed to retrieve tickets")
 			return
 		}
+		storage.SetPeopleAhead(tickets, time.Now())
 
 		c.JSON(http.StatusOK, tickets)
 	}
 }
 
+// GetTicket handles retrieving a single ticket by its ID.
+func GetTicket(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticketID, err := uuid.Parse(c.Param("ticketId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID format"})
+			return
+		}
+
+		ticket, err := db.GetTicketByID(c.Request.Context(), ticketID)
+		if err == nil {
+			ticket, err = withPeopleAhead(c.Request.Context(), db, ticket)
+		}
+		if err != nil {
+			respondError(c, err, "Failed to retrieve ticket")
+			return
+		}
+
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
 // NewTicketRequest represents the data needed to create a new ticket.
 type NewTicketRequest struct {
 	CustomerName  string `json:"customer_name" binding:"required"`
 	CustomerPhone string `json:"customer_phone" binding:"required"`
 	Priority      int    `json:"priority"` // New field for priority, optional
+	Locale        string `json:"locale"`   // Language of the customer's messages, e.g. "es"; Accept-Language if empty
 }
 
 // CreateTicket handles the creation of a new ticket for a given queue.
-func CreateTicket(db *storage.PostgresDB, n *notifier.Notifier) gin.HandlerFunc { // Accept notifier
+func CreateTicket(db storage.Store, n *notifier.Notifier) gin.HandlerFunc { // Accept notifier
 	return func(c *gin.Context) {
 		queueIDStr := c.Param("queueId")
 		queueID, err := uuid.Parse(queueIDStr)
@@ -115,22 +197,68 @@ func CreateTicket(db *storage.PostgresDB, n *notifier.Notifier) gin.HandlerFunc
 		if req.Priority == 0 {
 			req.Priority = 0 // Default to normal priority
 		}
+		locale, err := message.NormalizeLocale(req.Locale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if locale == "" {
+			locale = acceptedLocale(c.GetHeader("Accept-Language"))
+		}
+		phone, err := n.NormalizePhone(req.CustomerPhone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		ticket, err := db.CreateTicket(c.Request.Context(), queueID, req.CustomerName, req.CustomerPhone, req.Priority)
+		token, tokenHash, err := auth.GenerateTicketToken()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, ticket)
+		ticket, err := db.CreateTicket(c.Request.Context(), queueID, req.CustomerName, phone, locale, req.Priority, tokenHash, auditFrom(c, ""))
+		if err != nil {
+			respondError(c, err, "Failed to create ticket")
+			return
+		}
+		// The ticket is created; the customer still gets it if this fails.
+		if withAhead, err := withPeopleAhead(c.Request.Context(), db, ticket); err != nil {
+			log.Printf("Failed to compute people ahead of ticket %s: %v", ticket.ID, err)
+		} else {
+			ticket = withAhead
+		}
 
-		// Send WebSocket update
-		n.SendTicketUpdate(ticket)
+		c.JSON(http.StatusCreated, NewTicketResponse{Ticket: ticket, AccessToken: token, StatusURL: statusURL(token)})
+
+		// The ticket.created event went to the outbox with the ticket; the
+		// welcome text needs the access token, which only this response has
+		n.DispatchEvents()
+		textTicket(c.Request.Context(), db, n, ticket, message.TicketCreated, absoluteURL(c, statusURL(token)))
 	}
 }
 
+// TicketActionRequest is the optional body of the ticket action endpoints.
+// CounterID names the counter handling the ticket, e.g. the desk calling it.
+// Reason is recorded in the audit trail, e.g. why a ticket was cancelled.
+type TicketActionRequest struct {
+	CounterID *uuid.UUID `json:"counter_id"`
+	Reason    string     `json:"reason" binding:"max=500"`
+}
+
+// bindTicketAction reads the optional TicketActionRequest body. An empty body
+// is allowed.
+func bindTicketAction(c *gin.Context) (*TicketActionRequest, bool) {
+	var req TicketActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
 // updateTicketStatusHandler is a generic handler for updating a ticket's status.
-func updateTicketStatusHandler(db *storage.PostgresDB, n *notifier.Notifier, status string) gin.HandlerFunc { // Accept notifier
+func updateTicketStatusHandler(db storage.Store, n *notifier.Notifier, status string) gin.HandlerFunc { // Accept notifier
 	return func(c *gin.Context) {
 		ticketIDStr := c.Param("ticketId")
 		ticketID, err := uuid.Parse(ticketIDStr)
@@ -139,25 +267,58 @@ func updateTicketStatusHandler(db *storage.PostgresDB, n *notifier.Notifier, sta
 			return
 		}
 
-		ticket, err := db.UpdateTicketStatus(c.Request.Context(), ticketID, status)
+		req, ok := bindTicketAction(c)
+		if !ok {
+			return
+		}
+
+		ticket, err := db.UpdateTicketStatus(c.Request.Context(), ticketID, status, req.CounterID, auditFrom(c, req.Reason))
 		if err != nil {
-			if err.Error() == fmt.Sprintf("ticket with ID %s not found", ticketID.String()) {
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket status"})
+			respondError(c, err, "Failed to update ticket status")
 			return
 		}
 
 		c.JSON(http.StatusOK, ticket)
 
-		// Send WebSocket update
-		n.SendTicketUpdate(ticket)
+		n.DispatchEvents()
+	}
+}
+
+// CallNextTicket handles calling the next waiting ticket of a queue, optionally
+// at the counter named in the body. It responds with 204 No Content when nobody
+// is waiting.
+func CallNextTicket(db storage.Store, n *notifier.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueIDStr := c.Param("queueId")
+		queueID, err := uuid.Parse(queueIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID format"})
+			return
+		}
+
+		req, ok := bindTicketAction(c)
+		if !ok {
+			return
+		}
+
+		ticket, err := db.CallNextTicket(c.Request.Context(), queueID, req.CounterID, auditFrom(c, req.Reason))
+		if errors.Is(err, storage.ErrNoWaitingTickets) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			respondError(c, err, "Failed to call next ticket")
+			return
+		}
+
+		c.JSON(http.StatusOK, ticket)
+
+		n.DispatchEvents()
 	}
 }
 
 // GetEstimatedWaitTime handles retrieving the estimated wait time for a given queue.
-func GetEstimatedWaitTime(db *storage.PostgresDB) gin.HandlerFunc {
+func GetEstimatedWaitTime(db storage.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		queueIDStr := c.Param("queueId")
 		queueID, err := uuid.Parse(queueIDStr)
@@ -168,7 +329,7 @@ func GetEstimatedWaitTime(db *storage.PostgresDB) gin.HandlerFunc {
 
 		waitTime, err := db.CalculateEstimatedWaitTime(c.Request.Context(), queueID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate estimated wait time"})
+			respondError(c, err, "Failed to calculate estimated wait time")
 			return
 		}
 
@@ -177,11 +338,11 @@ func GetEstimatedWaitTime(db *storage.PostgresDB) gin.HandlerFunc {
 }
 
 // GetQueues handles retrieving all queues.
-func GetQueues(db *storage.PostgresDB) gin.HandlerFunc {
+func GetQueues(db storage.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		queues, err := db.GetQueues(c.Request.Context())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve queues"})
+			respondError(c, err, "Failed to retrieve queues")
 			return
 		}
 
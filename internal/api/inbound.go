@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/message"
+	"github.com/smartq/smartq/internal/notifier"
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// Commands customers can text to SmartQ. Anything else gets the help text.
+const (
+	commandStatus = "STATUS" // reply with the place in line and the estimated wait
+	commandCancel = "CANCEL" // leave the line
+	commandLate   = "LATE"   // let a few people go ahead, e.g. "LATE" or "LATE 5"
+	commandHelp   = "HELP"
+)
+
+// defaultLatePlaces is how many people a customer texting LATE without a
+// number lets go ahead.
+const defaultLatePlaces = 3
+
+// maxInboundSMSLength caps the text of an inbound message recorded in the
+// audit trail.
+const maxInboundSMSLength = 500
+
+// InboundSMSResult is what SmartQ did with a text message from a customer.
+type InboundSMSResult struct {
+	Command  string     `json:"command"`   // STATUS, CANCEL, LATE or HELP
+	TicketID *uuid.UUID `json:"ticket_id"` // The sender's ticket, if they have one in line
+	Reply    string     `json:"reply"`     // The text sent back to the sender
+}
+
+// twimlResponse is the reply to a Twilio-style webhook request, which the
+// provider texts back to the sender.
+type twimlResponse struct {
+	XMLName xml.Name `xml:"Response"`
+	Message string   `xml:"Message,omitempty"`
+}
+
+// ReceiveSMS handles the webhook the SMS provider calls with the text messages
+// customers send to SmartQ, as form parameters From and Body. The request must
+// pass verifier. The reply is returned as TwiML for the
+// provider to text back.
+func ReceiveSMS(db storage.Store, n *notifier.Notifier, verifier notifier.InboundVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !n.SMSEnabled() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Text messages are disabled"})
+			return
+		}
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := verifier.VerifyInbound(c.Request, c.Request.PostForm); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		from, body := c.PostForm("From"), c.PostForm("Body")
+		if from == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "From is required"})
+			return
+		}
+
+		audit := storage.Audit{
+			ActorType: storage.ActorSMS,
+			ActorName: from,
+			SourceIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Reason:    truncate(body, maxInboundSMSLength),
+		}
+		if len(audit.UserAgent) > maxUserAgentLength {
+			audit.UserAgent = audit.UserAgent[:maxUserAgentLength]
+		}
+		result, err := handleInboundSMS(c.Request.Context(), db, n, from, body, audit)
+		if err != nil {
+			log.Printf("Failed to handle text message from %s: %v", from, err)
+			respondError(c, err, "Failed to handle text message")
+			return
+		}
+
+		c.XML(http.StatusOK, twimlResponse{Message: result.Reply})
+	}
+}
+
+// SimulateSMSRequest is the body of SimulateSMS.
+type SimulateSMSRequest struct {
+	From string `json:"from" binding:"required"`
+	Body string `json:"body" binding:"max=500"`
+}
+
+// SimulateSMS handles a text message as if the customer had sent it, for
+// trying out the commands without an SMS provider. It responds with what was
+// done and the reply, which is not sent. Actions are recorded as the staff
+// member's.
+func SimulateSMS(db storage.Store, n *notifier.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SimulateSMSRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit := auditFrom(c, "simulated text from "+req.From+": "+req.Body)
+		result, err := handleInboundSMS(c.Request.Context(), db, n, req.From, req.Body, audit)
+		if err != nil {
+			respondError(c, err, "Failed to handle text message")
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// handleInboundSMS carries out the command in a text message from the phone
+// number from on the sender's ticket in line, recording audit with the
+// ticket's history, and returns the reply in the ticket's locale. from is
+// normalized like the numbers given at check-in; a sender whose number
+// cannot be gets the no_ticket reply.
+func handleInboundSMS(ctx context.Context, db storage.Store, n *notifier.Notifier, from, body string, audit storage.Audit) (*InboundSMSResult, error) {
+	command, places := parseSMSCommand(body)
+	result := &InboundSMSResult{Command: command}
+
+	var t *storage.Ticket
+	phone, err := n.NormalizePhone(from)
+	if err == nil {
+		t, err = db.GetActiveTicketByPhone(ctx, phone)
+	} else {
+		err = storage.ErrTicketNotFound // Not a number anyone checked in with
+	}
+	if errors.Is(err, storage.ErrTicketNotFound) {
+		name := message.NoTicket
+		if command == commandHelp {
+			name = message.Help
+		}
+		result.Reply, err = renderMessage(ctx, db, nil, name, "", message.Data{})
+		return result, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.TicketID = &t.ID
+
+	reply := message.Help
+	switch command {
+	case commandStatus:
+		if err := db.LogTicketEvent(ctx, t.ID, ticket.StatusChecked, audit); err != nil {
+			return nil, err
+		}
+		reply = message.StatusReply
+	case commandCancel:
+		if t, err = db.UpdateTicketStatus(ctx, t.ID, ticket.StatusCancelled, nil, audit); err != nil {
+			return nil, err
+		}
+		reply = message.Cancelled
+	case commandLate:
+		if t.Status != ticket.StatusWaiting {
+			break // Too late to be late; the reply says where to go.
+		}
+		audit.Reason = deferReason(DeferTicketRequest{Places: places, Reason: audit.Reason})
+		if t, err = db.DeferTicket(ctx, t.ID, places, nil, audit); err != nil {
+			return nil, err
+		}
+		reply = message.Deferred
+	}
+	if command == commandCancel || reply == message.Deferred {
+		n.DispatchEvents()
+	}
+	if t.Status == ticket.StatusServing && command != commandHelp {
+		reply = message.Called
+	}
+
+	d, err := ticketMessageData(ctx, db, t)
+	if err != nil {
+		return nil, err
+	}
+	result.Reply, err = renderMessage(ctx, db, &t.QueueID, reply, t.Locale, d)
+	return result, err
+}
+
+// parseSMSCommand returns the command of a text message, e.g. "STATUS", and
+// for LATE the number of people to let go ahead. Unknown commands are HELP.
+func parseSMSCommand(body string) (command string, places int) {
+	fields := strings.Fields(strings.ToUpper(body))
+	if len(fields) == 0 {
+		return commandHelp, 0
+	}
+	switch command = strings.Trim(fields[0], ".!?"); command {
+	case commandStatus, commandCancel:
+		return command, 0
+	case commandLate:
+		places = defaultLatePlaces
+		if len(fields) > 1 {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+				places = n
+			}
+		}
+		if places > maxDeferPlaces {
+			places = maxDeferPlaces
+		}
+		return command, places
+	default:
+		return commandHelp, 0
+	}
+}
+
+// truncate returns s cut to at most max bytes, without splitting a character.
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return strings.ToValidUTF8(s[:max], "")
+	}
+	return s
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartq/smartq/internal/message"
+	"github.com/smartq/smartq/internal/notifier"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+func TestParseSMSCommand(t *testing.T) {
+	for _, tt := range []struct {
+		body    string
+		command string
+		places  int
+	}{
+		{"STATUS", commandStatus, 0},
+		{"  status please ", commandStatus, 0},
+		{"Cancel.", commandCancel, 0},
+		{"cancel!", commandCancel, 0},
+		{"LATE", commandLate, defaultLatePlaces},
+		{"late 5", commandLate, 5},
+		{"Late?", commandLate, defaultLatePlaces},
+		{"LATE five", commandLate, defaultLatePlaces},
+		{"LATE 0", commandLate, defaultLatePlaces},
+		{"LATE -2", commandLate, defaultLatePlaces},
+		{"LATE 500", commandLate, maxDeferPlaces},
+		{"HELP", commandHelp, 0},
+		{"where am I", commandHelp, 0},
+		{"", commandHelp, 0},
+		{"   ", commandHelp, 0},
+	} {
+		command, places := parseSMSCommand(tt.body)
+		if command != tt.command || places != tt.places {
+			t.Errorf("parseSMSCommand(%q) = %s, %d; want %s, %d", tt.body, command, places, tt.command, tt.places)
+		}
+	}
+}
+
+// inboundFixture is a queue of waiting tickets, the first of which belongs to
+// the customer texting from phone.
+type inboundFixture struct {
+	db      storage.Store
+	n       *notifier.Notifier
+	tickets []*storage.Ticket
+}
+
+const inboundPhone = "+15551230000"
+
+func newInboundFixture(t *testing.T, waiting int) *inboundFixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &inboundFixture{db: storage.NewMemoryStore(), n: notifier.NewNotifier(notifier.NewHub(), nil, nil)}
+	q, err := f.db.CreateQueue(ctx, "Front desk", queue.TicketFormat{}, nil)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	for i := 0; i < waiting; i++ {
+		phone := ""
+		if i == 0 {
+			phone = inboundPhone
+		}
+		tk, err := f.db.CreateTicket(ctx, q.ID, "customer", phone, "", 0, "", storage.Audit{})
+		if err != nil {
+			t.Fatalf("CreateTicket: %v", err)
+		}
+		f.tickets = append(f.tickets, tk)
+	}
+	return f
+}
+
+// text handles body texted from inboundPhone.
+func (f *inboundFixture) text(t *testing.T, body string) *InboundSMSResult {
+	t.Helper()
+	audit := storage.Audit{ActorType: storage.ActorSMS, ActorName: inboundPhone, Reason: body}
+	result, err := handleInboundSMS(context.Background(), f.db, f.n, inboundPhone, body, audit)
+	if err != nil {
+		t.Fatalf("handleInboundSMS(%q): %v", body, err)
+	}
+	return result
+}
+
+// history returns the customer's ticket and its history rows after the
+// creation row.
+func (f *inboundFixture) history(t *testing.T) (*storage.Ticket, []*storage.TicketHistory) {
+	t.Helper()
+	ctx := context.Background()
+	tk, err := f.db.GetTicketByID(ctx, f.tickets[0].ID)
+	if err != nil {
+		t.Fatalf("GetTicketByID: %v", err)
+	}
+	history, err := f.db.GetTicketHistory(ctx, tk.ID)
+	if err != nil {
+		t.Fatalf("GetTicketHistory: %v", err)
+	}
+	return tk, history[1:]
+}
+
+// expectReply checks that reply is the named template rendered for the
+// customer's ticket as it is now.
+func (f *inboundFixture) expectReply(t *testing.T, result *InboundSMSResult, name string) {
+	t.Helper()
+	ctx := context.Background()
+	tk, err := f.db.GetTicketByID(ctx, f.tickets[0].ID)
+	if err != nil {
+		t.Fatalf("GetTicketByID: %v", err)
+	}
+	d, err := ticketMessageData(ctx, f.db, tk)
+	if err != nil {
+		t.Fatalf("ticketMessageData: %v", err)
+	}
+	want, err := renderMessage(ctx, f.db, &tk.QueueID, name, tk.Locale, d)
+	if err != nil {
+		t.Fatalf("renderMessage: %v", err)
+	}
+	if result.Reply != want {
+		t.Errorf("reply = %q, want the %s text %q", result.Reply, name, want)
+	}
+	if result.TicketID == nil || *result.TicketID != tk.ID {
+		t.Errorf("result ticket = %v, want %s", result.TicketID, tk.ID)
+	}
+}
+
+// expectSMSRow checks that row was written by the texting customer.
+func expectSMSRow(t *testing.T, row *storage.TicketHistory, status string) {
+	t.Helper()
+	if row.Status != status || row.ActorType != storage.ActorSMS || row.ActorName != inboundPhone {
+		t.Errorf("history row = %s by %s %s, want %s by sms %s", row.Status, row.ActorType, row.ActorName, status, inboundPhone)
+	}
+}
+
+func TestInboundSMSStatus(t *testing.T) {
+	f := newInboundFixture(t, 2)
+	result := f.text(t, "status")
+	if result.Command != commandStatus {
+		t.Errorf("command = %s, want STATUS", result.Command)
+	}
+	f.expectReply(t, result, message.StatusReply)
+
+	tk, history := f.history(t)
+	if tk.Status != ticket.StatusWaiting {
+		t.Errorf("status = %s, want the ticket left waiting", tk.Status)
+	}
+	if len(history) != 1 {
+		t.Fatalf("history = %d rows, want one status check", len(history))
+	}
+	expectSMSRow(t, history[0], ticket.StatusChecked)
+}
+
+func TestInboundSMSCancel(t *testing.T) {
+	f := newInboundFixture(t, 2)
+	result := f.text(t, "CANCEL")
+	f.expectReply(t, result, message.Cancelled)
+
+	tk, history := f.history(t)
+	if tk.Status != ticket.StatusCancelled {
+		t.Errorf("status = %s, want cancelled", tk.Status)
+	}
+	if len(history) != 1 {
+		t.Fatalf("history = %d rows, want one cancellation", len(history))
+	}
+	expectSMSRow(t, history[0], ticket.StatusCancelled)
+
+	// The ticket is no longer in line, so the next text finds none.
+	result = f.text(t, "STATUS")
+	want, err := renderMessage(context.Background(), f.db, nil, message.NoTicket, "", message.Data{})
+	if err != nil {
+		t.Fatalf("renderMessage: %v", err)
+	}
+	if result.TicketID != nil || result.Reply != want {
+		t.Errorf("reply after cancelling = %+v, want the no_ticket text", result)
+	}
+}
+
+func TestInboundSMSLate(t *testing.T) {
+	for _, tt := range []struct {
+		body  string
+		ahead int
+	}{
+		{"LATE", defaultLatePlaces},
+		{"late 2", 2},
+		// Letting more people go ahead than are waiting puts the ticket last.
+		{"LATE 500", 5},
+	} {
+		t.Run(tt.body, func(t *testing.T) {
+			f := newInboundFixture(t, 6)
+			result := f.text(t, tt.body)
+			if result.Command != commandLate {
+				t.Errorf("command = %s, want LATE", result.Command)
+			}
+			f.expectReply(t, result, message.Deferred)
+
+			tk, history := f.history(t)
+			tk, err := withPeopleAhead(context.Background(), f.db, tk)
+			if err != nil {
+				t.Fatalf("withPeopleAhead: %v", err)
+			}
+			if tk.Status != ticket.StatusWaiting || tk.PeopleAhead == nil || *tk.PeopleAhead != tt.ahead {
+				t.Errorf("ticket = %s with %v ahead, want waiting with %d ahead", tk.Status, tk.PeopleAhead, tt.ahead)
+			}
+			if len(history) != 1 {
+				t.Fatalf("history = %d rows, want one deferral", len(history))
+			}
+			expectSMSRow(t, history[0], ticket.StatusDeferred)
+			if !strings.Contains(history[0].Reason, tt.body) {
+				t.Errorf("reason = %q, want it to quote the text %q", history[0].Reason, tt.body)
+			}
+		})
+	}
+}
+
+func TestInboundSMSLateWhileServing(t *testing.T) {
+	f := newInboundFixture(t, 1)
+	if _, err := f.db.CallNextTicket(context.Background(), f.tickets[0].QueueID, nil, storage.Audit{}); err != nil {
+		t.Fatalf("CallNextTicket: %v", err)
+	}
+	result := f.text(t, "LATE")
+	f.expectReply(t, result, message.Called)
+
+	tk, history := f.history(t)
+	if tk.Status != ticket.StatusServing || len(history) != 1 || history[0].Status != ticket.StatusServing {
+		t.Errorf("ticket = %s with history %d rows, want it still serving and nothing recorded", tk.Status, len(history))
+	}
+}
+
+func TestInboundSMSHelp(t *testing.T) {
+	f := newInboundFixture(t, 1)
+	result := f.text(t, "what now?")
+	if result.Command != commandHelp {
+		t.Errorf("command = %s, want HELP", result.Command)
+	}
+	f.expectReply(t, result, message.Help)
+	if _, history := f.history(t); len(history) != 0 {
+		t.Errorf("history = %d rows, want nothing recorded for HELP", len(history))
+	}
+}
+
+func TestInboundSMSWithoutTicket(t *testing.T) {
+	f := newInboundFixture(t, 0)
+	ctx := context.Background()
+	for body, name := range map[string]string{"STATUS": message.NoTicket, "CANCEL": message.NoTicket, "HELP": message.Help} {
+		result, err := handleInboundSMS(ctx, f.db, f.n, "+15559999999", body, storage.Audit{ActorType: storage.ActorSMS})
+		if err != nil {
+			t.Fatalf("handleInboundSMS(%s): %v", body, err)
+		}
+		want, err := renderMessage(ctx, f.db, nil, name, "", message.Data{})
+		if err != nil {
+			t.Fatalf("renderMessage: %v", err)
+		}
+		if result.TicketID != nil || result.Reply != want {
+			t.Errorf("%s from an unknown number = %+v, want the %s text", body, result, name)
+		}
+	}
+}
+
+func TestInboundSMSFromFormattedPhone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db := storage.NewMemoryStore()
+	n := notifier.NewNotifier(notifier.NewHub(), nil, nil)
+	q, err := db.CreateQueue(ctx, "Front desk", queue.TicketFormat{}, nil)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+
+	// Customers check in with their number however they write it.
+	router := gin.New()
+	router.POST("/queues/:queueId/tickets", CreateTicket(db, n))
+	for _, phone := range []string{"(555) 123-4567", "555.123.4568"} {
+		w := httptest.NewRecorder()
+		body := `{"customer_name": "customer", "customer_phone": "` + phone + `"}`
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/queues/"+q.ID.String()+"/tickets", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("check in with %q = %d %s, want 201", phone, w.Code, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/queues/"+q.ID.String()+"/tickets", strings.NewReader(`{"customer_name": "customer", "customer_phone": "call me"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("check in with an invalid phone = %d, want 400", w.Code)
+	}
+
+	// Their texts come from the E.164 form, or from the staff simulating them.
+	for _, tt := range []struct{ from, phone string }{
+		{"+15551234567", "+15551234567"},
+		{"1 555 123 4568", "+15551234568"},
+	} {
+		result, err := handleInboundSMS(ctx, db, n, tt.from, "CANCEL", storage.Audit{ActorType: storage.ActorSMS, ActorName: tt.from})
+		if err != nil {
+			t.Fatalf("handleInboundSMS(%s): %v", tt.from, err)
+		}
+		if result.TicketID == nil {
+			t.Fatalf("CANCEL from %s found no ticket, want the one of %s", tt.from, tt.phone)
+		}
+		tk, err := db.GetTicketByID(ctx, *result.TicketID)
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		if tk.Status != ticket.StatusCancelled || tk.CustomerPhone != tt.phone {
+			t.Errorf("ticket texted from %s = %s %s, want cancelled %s", tt.from, tk.Status, tk.CustomerPhone, tt.phone)
+		}
+	}
+}
@@ -2,42 +2,147 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/smartq/smartq/internal/auth"
 	"github.com/smartq/smartq/internal/notifier" // Import notifier
 	"github.com/smartq/smartq/internal/storage"
 )
 
 // NewRouter sets up the Gin router and its routes.
-func NewRouter(db *storage.PostgresDB, hub *notifier.Hub) *gin.Engine { // Accept hub
+//
+// Customers can take tickets, follow their ticket with its access token and
+// read queue details and wait times without logging in. Everything else needs a staff login token: display accounts can
+// read tickets and counters, staff can also call, serve and cancel tickets,
+// and admins can also manage queues, counters, users, API keys and webhooks. Kiosks and
+// integrations may use an API key instead, limited to the routes its scopes
+// cover; users and API keys can only be managed with a login token.
+//
+// Customers can also text commands to SmartQ through the SMS provider's
+// webhook, which is checked with inbound and only served when inbound is set.
+func NewRouter(db storage.Store, hub *notifier.Hub, n *notifier.Notifier, tokens *auth.TokenManager, inbound notifier.InboundVerifier) *gin.Engine { // Accept hub and notifier
 	router := gin.Default()
 
+	admin := requireRole(db, tokens, auth.RoleAdmin)
+	display := requireRole(db, tokens, auth.RoleDisplay)
+	queuesRead := requireAccess(db, tokens, auth.RoleDisplay, auth.ScopeQueuesRead)
+	queuesWrite := requireAccess(db, tokens, auth.RoleAdmin, auth.ScopeQueuesWrite)
+	ticketsRead := requireAccess(db, tokens, auth.RoleStaff, auth.ScopeTicketsRead)
+	ticketsWrite := requireAccess(db, tokens, auth.RoleStaff, auth.ScopeTicketsWrite)
+
 	// Serve static files for the staff dashboard
 	router.Static("/staff", "./web/staff-dashboard")
 	// Serve static files for the public display
 	router.Static("/display", "./web/public-display")
+	// Serve static files for the customer's ticket status page
+	router.Static("/ticket-status", "./web/ticket-status")
+
+	// Customer's ticket status page, its WebSocket and the customer's own
+	// cancel and defer actions. The unguessable token in the path is the only
+	// credential.
+	router.GET("/t/:token", GetTicketStatus(db))
+	router.GET("/t/:token/ws", ServeTicketWs(db, hub))
+	router.POST("/t/:token/cancel", CancelOwnTicket(db, n))
+	router.POST("/t/:token/defer", DeferOwnTicket(db, n))
 
-	// WebSocket endpoint
-	router.GET("/ws", func(c *gin.Context) {
-		notifier.ServeWs(hub, c)
-	})
+	// WebSocket endpoint, following queues and the admin channel. Updates
+	// carry customer details, so it needs a login.
+	router.GET("/ws", requireAccessWS(db, tokens, auth.RoleDisplay, auth.ScopeQueuesRead), ServeWs(hub))
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
+		// Auth routes
+		v1.POST("/auth/login", Login(db, tokens))
+		v1.GET("/auth/me", display, GetCurrentUser())
+
 		// Queue routes
-		v1.POST("/queues", CreateQueue(db))
+		v1.POST("/queues", queuesWrite, CreateQueue(db, n))
 		v1.GET("/queues", GetQueues(db))
 		v1.GET("/queues/:queueId", GetQueue(db))
-		v1.GET("/queues/:queueId/tickets", GetTickets(db))
-		v1.POST("/queues/:queueId/tickets", CreateTicket(db))
+		v1.GET("/queues/:queueId/tickets", queuesRead, GetTickets(db))
+		v1.POST("/queues/:queueId/tickets", allowAPIKey(db, auth.ScopeTicketsCreate), CreateTicket(db, n))
 		v1.GET("/queues/:queueId/estimated-wait-time", GetEstimatedWaitTime(db))
+		v1.POST("/queues/:queueId/call-next", ticketsWrite, CallNextTicket(db, n))
+		v1.GET("/queues/:queueId/counters", queuesRead, GetCounters(db))
+		v1.POST("/queues/:queueId/counters", queuesWrite, CreateCounter(db))
+		v1.PUT("/queues/:queueId/notify-thresholds", queuesWrite, SetNotifyThresholds(db, n))
+		v1.GET("/queues/:queueId/templates", queuesRead, GetMessageTemplates(db))
+		v1.PUT("/queues/:queueId/templates/:name/:locale", queuesWrite, SetMessageTemplate(db))
+		v1.DELETE("/queues/:queueId/templates/:name/:locale", queuesWrite, DeleteMessageTemplate(db))
 		// Other queue routes will go here
 
-		// Ticket routes
+		// Counter routes
+		counters := v1.Group("/counters")
+		{
+			counters.GET("/:counterId", queuesRead, GetCounter(db))
+			counters.PUT("/:counterId", queuesWrite, UpdateCounter(db))
+			counters.DELETE("/:counterId", queuesWrite, DeleteCounter(db))
+		}
+
+		// Ticket routes. A ticket, its history and its text messages show the
+		// customer's name and phone and who handled the ticket, so reading
+		// them takes a staff login or an API key with the tickets:read scope.
 		tickets := v1.Group("/tickets")
 		{
-			tickets.POST("/:ticketId/call", updateTicketStatusHandler(db, "serving"))
-			tickets.POST("/:ticketId/serve", updateTicketStatusHandler(db, "served"))
-			tickets.POST("/:ticketId/cancel", updateTicketStatusHandler(db, "cancelled"))
+			tickets.GET("/:ticketId", ticketsRead, GetTicket(db))
+			tickets.GET("/:ticketId/history", ticketsRead, GetTicketHistory(db))
+			tickets.GET("/:ticketId/notifications", ticketsRead, GetTicketNotifications(db))
+			tickets.POST("/:ticketId/call", ticketsWrite, updateTicketStatusHandler(db, n, "serving"))
+			tickets.POST("/:ticketId/serve", ticketsWrite, updateTicketStatusHandler(db, n, "served"))
+			tickets.POST("/:ticketId/cancel", ticketsWrite, updateTicketStatusHandler(db, n, "cancelled"))
+		}
+
+		// Messages to customers and their delivery status, for staff and API
+		// keys with the tickets:read scope
+		v1.GET("/notifications", ticketsRead, GetNotifications(db))
+
+		// Text messages from customers: the SMS provider's webhook, and a
+		// simulator for staff to try the commands without a provider
+		if inbound != nil {
+			v1.POST("/sms/inbound", ReceiveSMS(db, n, inbound))
+		}
+		v1.POST("/sms/simulate", ticketsWrite, SimulateSMS(db, n))
+
+		// Texts of the messages to customers. Queue-specific texts are under
+		// the queue routes; these apply to every queue.
+		templates := v1.Group("/templates")
+		{
+			templates.GET("", queuesRead, GetMessageTemplates(db))
+			templates.POST("/preview", queuesWrite, PreviewMessageTemplate(db))
+			templates.PUT("/:name/:locale", queuesWrite, SetMessageTemplate(db))
+			templates.DELETE("/:name/:locale", queuesWrite, DeleteMessageTemplate(db))
+		}
+
+		// User routes
+		users := v1.Group("/users", admin)
+		{
+			users.GET("", GetUsers(db))
+			users.POST("", CreateUser(db))
+			users.DELETE("/:userId", DeleteUser(db))
+		}
+
+		// Audit trail of ticket actions
+		v1.GET("/audit", admin, GetAuditTrail(db))
+
+		// API key routes
+		apiKeys := v1.Group("/api-keys", admin)
+		{
+			apiKeys.GET("", GetAPIKeys(db))
+			apiKeys.POST("", CreateAPIKey(db))
+			apiKeys.DELETE("/:keyId", DeleteAPIKey(db))
+		}
+
+		// Webhooks notified of ticket and queue events, and their deliveries
+		webhooks := v1.Group("/webhooks", admin)
+		{
+			webhooks.GET("", GetWebhooks(db))
+			webhooks.POST("", CreateWebhook(db))
+			webhooks.GET("/:webhookId", GetWebhook(db))
+			webhooks.DELETE("/:webhookId", DeleteWebhook(db))
+		}
+		deliveries := v1.Group("/webhook-deliveries", admin)
+		{
+			deliveries.GET("", GetWebhookDeliveries(db))
+			deliveries.POST("/:deliveryId/redeliver", RedeliverWebhookDelivery(db, n))
 		}
 	}
 
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartq/smartq/internal/auth"
+	"github.com/smartq/smartq/internal/notifier"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+func TestTicketRoutesNeedTicketsRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db := storage.NewMemoryStore()
+	hub := notifier.NewHub()
+	router := NewRouter(db, hub, notifier.NewNotifier(hub, nil, nil), auth.NewTokenManager([]byte("secret"), time.Hour), nil)
+
+	q, err := db.CreateQueue(ctx, "Front desk", queue.TicketFormat{}, nil)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	tk, err := db.CreateTicket(ctx, q.ID, "customer", "+15551234567", "", 0, "", storage.Audit{})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	newKey := func(scope string) string {
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey: %v", err)
+		}
+		if _, err := db.CreateAPIKey(ctx, scope, prefix, hash, []string{scope}, nil); err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		return key
+	}
+	signage := newKey(auth.ScopeQueuesRead)
+	keys := []struct {
+		scope, key string
+		want       int
+	}{
+		{auth.ScopeQueuesRead, signage, http.StatusForbidden},
+		{auth.ScopeTicketsRead, newKey(auth.ScopeTicketsRead), http.StatusOK},
+	}
+
+	for _, path := range []string{"", "/history", "/notifications"} {
+		for _, k := range keys {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/tickets/"+tk.ID.String()+path, nil)
+			req.Header.Set(apiKeyHeader, k.key)
+			router.ServeHTTP(w, req)
+			if w.Code != k.want {
+				t.Errorf("GET ticket%s with a %s key = %d, want %d", path, k.scope, w.Code, k.want)
+			}
+		}
+	}
+
+	// The public display's route stays readable with queues:read.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/queues/"+q.ID.String()+"/tickets", nil)
+	req.Header.Set(apiKeyHeader, signage)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET queue tickets with a queues:read key = %d, want 200", w.Code)
+	}
+}
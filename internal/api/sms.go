@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/message"
+	"github.com/smartq/smartq/internal/notifier"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// textTicket texts the customer of a ticket the named template, e.g. that
+// their ticket was called. link is the customer's status page, if known.
+func textTicket(ctx context.Context, db storage.Store, n *notifier.Notifier, t *storage.Ticket, name, link string) {
+	if t.CustomerPhone == "" || !n.SMSEnabled() {
+		return
+	}
+	d, err := ticketMessageData(ctx, db, t)
+	if err != nil {
+		log.Printf("Failed to prepare %s text for ticket %s: %v", name, t.ID, err)
+		return
+	}
+	d.StatusURL = link
+	textCustomer(ctx, db, n, t, name, 0, d)
+}
+
+// ticketMessageData returns the placeholder values for a ticket. The people
+// ahead and the estimated wait are only known while it is waiting.
+func ticketMessageData(ctx context.Context, db storage.Store, t *storage.Ticket) (message.Data, error) {
+	q, err := db.GetQueueByID(ctx, t.QueueID)
+	if err != nil {
+		return message.Data{}, err
+	}
+	d := message.Data{TicketNumber: t.TicketNumber, QueueName: q.Name}
+	if t.CounterName != nil {
+		d.Counter = *t.CounterName
+	}
+	if t.Status != ticket.StatusWaiting {
+		return d, nil
+	}
+	if t, err = withPeopleAhead(ctx, db, t); err != nil {
+		return message.Data{}, err
+	}
+	if t.PeopleAhead != nil {
+		d.PeopleAhead = *t.PeopleAhead
+	}
+	if d.ETA, err = db.CalculateEstimatedWaitTime(ctx, t.QueueID); err != nil {
+		return message.Data{}, err
+	}
+	return d, nil
+}
+
+// textPeopleAhead texts the customers of the snapshot's waiting tickets that
+// reached one of the queue's notification thresholds, e.g. "3 people ahead of
+// you" or "you're next".
+func textPeopleAhead(ctx context.Context, db storage.Store, n *notifier.Notifier, s *queueSnapshot) {
+	if len(s.queue.NotifyThresholds) == 0 || !n.SMSEnabled() {
+		return
+	}
+	for _, t := range s.tickets {
+		if t.PeopleAhead == nil {
+			continue
+		}
+		threshold, ok := queue.ReachedNotifyThreshold(s.queue.NotifyThresholds, *t.PeopleAhead)
+		if !ok {
+			continue
+		}
+		d := message.Data{TicketNumber: t.TicketNumber, QueueName: s.queue.Name, PeopleAhead: *t.PeopleAhead, ETA: s.wait}
+		textCustomer(ctx, db, n, t, message.NextInLine, threshold, d)
+	}
+}
+
+// textCustomer renders the named template for a ticket's customer and queues
+// the text for the delivery worker, unless the ticket already got a message of
+// that template and threshold.
+func textCustomer(ctx context.Context, db storage.Store, n *notifier.Notifier, t *storage.Ticket, name string, threshold int, d message.Data) {
+	if t.CustomerPhone == "" || !n.SMSEnabled() {
+		return
+	}
+	body, err := renderMessage(ctx, db, &t.QueueID, name, t.Locale, d)
+	if err != nil {
+		log.Printf("Failed to render %s text for ticket %s: %v", name, t.ID, err)
+		return
+	}
+	notification, err := db.EnqueueNotification(ctx, t.ID, notifier.ChannelSMS, name, threshold, t.CustomerPhone, body)
+	if errors.Is(err, storage.ErrNotificationSent) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to queue %s text for ticket %s: %v", name, t.ID, err)
+		return
+	}
+	n.SendNotificationUpdate(notification)
+	n.DeliverNotifications()
+}
+
+// GetTicketNotifications handles listing the messages to a ticket's customer
+// and their delivery status, oldest first.
+func GetTicketNotifications(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticketID, err := uuid.Parse(c.Param("ticketId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID format"})
+			return
+		}
+
+		notifications, err := db.GetTicketNotifications(c.Request.Context(), ticketID)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve ticket notifications")
+			return
+		}
+
+		c.JSON(http.StatusOK, notifications)
+	}
+}
+
+// GetNotifications handles listing messages to customers and their delivery
+// status, newest first, optionally filtered by queue, ticket or status.
+func GetNotifications(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter storage.NotificationFilter
+
+		for _, p := range []struct {
+			name, label string
+			dst         **uuid.UUID
+		}{{"queue_id", "queue", &filter.QueueID}, {"ticket_id", "ticket", &filter.TicketID}} {
+			if v := c.Query(p.name); v != "" {
+				id, err := uuid.Parse(v)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + p.label + " ID format"})
+					return
+				}
+				*p.dst = &id
+			}
+		}
+		switch v := c.Query("status"); v {
+		case "", storage.NotificationPending, storage.NotificationSent, storage.NotificationFailed:
+			filter.Status = v
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of pending, sent or failed"})
+			return
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > storage.DefaultNotificationLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(storage.DefaultNotificationLimit)})
+				return
+			}
+			filter.Limit = limit
+		}
+
+		notifications, err := db.ListNotifications(c.Request.Context(), filter)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve notifications")
+			return
+		}
+
+		c.JSON(http.StatusOK, notifications)
+	}
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/auth"
+	"github.com/smartq/smartq/internal/message"
+	"github.com/smartq/smartq/internal/notifier"
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// ticketStatusPage is the HTML page served at /t/{token}. Its scripts and
+// styles are served from /ticket-status.
+const ticketStatusPage = "./web/ticket-status/index.html"
+
+// Limits on how far customers can put off their own ticket, so that a ticket
+// cannot be parked in a queue for the rest of the day.
+const (
+	maxDeferPlaces   = 20
+	maxDeferDuration = 2 * time.Hour
+)
+
+// NewTicketResponse is the response of CreateTicket: the ticket plus the
+// customer's secret link to its status page, which is not shown again.
+type NewTicketResponse struct {
+	*storage.Ticket
+	AccessToken string `json:"access_token"`
+	StatusURL   string `json:"status_url"` // Path of the status page, relative to the server
+}
+
+// TicketStatus is what a customer sees of their ticket on the status page. It
+// leaves out the customer's details, since anyone with the link can read it.
+type TicketStatus struct {
+	TicketNumber         string     `json:"ticket_number"`
+	QueueName            string     `json:"queue_name"`
+	Status               string     `json:"status"`
+	Position             int        `json:"position"`               // 1 for the next ticket to be called; 0 unless waiting
+	PeopleAhead          int        `json:"people_ahead"`           // Waiting tickets that will be called first
+	EstimatedWaitSeconds int        `json:"estimated_wait_seconds"` // From CalculateEstimatedWaitTime; 0 unless waiting
+	CounterName          *string    `json:"counter_name"`
+	DeferredUntil        *time.Time `json:"deferred_until"` // Set while the customer asked not to be called before then
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// CustomerCancelRequest is the optional body of a customer cancelling their
+// own ticket.
+type CustomerCancelRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// DeferTicketRequest is the body of a customer who is running late. Places
+// lets that many people go ahead; Until keeps the ticket from being called
+// before then. At least one of them is required.
+type DeferTicketRequest struct {
+	Places int        `json:"places" binding:"min=0"`
+	Until  *time.Time `json:"until"`
+	Reason string     `json:"reason" binding:"max=500"`
+}
+
+// statusURL returns the path of the status page for a ticket access token.
+func statusURL(token string) string {
+	return "/t/" + token
+}
+
+// absoluteURL returns path on the host the request was sent to, for links
+// sent outside the browser, e.g. in text messages.
+func absoluteURL(c *gin.Context, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + path
+}
+
+// acceptedLocale returns the first valid locale of an Accept-Language
+// header, e.g. "pt-BR" for "pt-BR,pt;q=0.9", or "" if there is none.
+func acceptedLocale(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if locale, err := message.NormalizeLocale(tag); err == nil && locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
+
+// queueSnapshot holds what is needed to compute the status of a queue's tickets.
+type queueSnapshot struct {
+	queue   *storage.Queue
+	tickets []*storage.Ticket // The waiting and serving ones, with PeopleAhead set on the waiting tickets
+	wait    time.Duration
+}
+
+func loadQueueSnapshot(ctx context.Context, db storage.Store, queueID uuid.UUID) (*queueSnapshot, error) {
+	q, err := db.GetQueueByID(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	tickets, err := db.GetActiveTicketsByQueueID(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := db.CalculateEstimatedWaitTime(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	storage.SetPeopleAhead(tickets, time.Now())
+	return &queueSnapshot{queue: q, tickets: tickets, wait: wait}, nil
+}
+
+// peopleAhead returns the people ahead of every waiting ticket of the snapshot.
+func (s *queueSnapshot) peopleAhead() map[string]int {
+	ahead := make(map[string]int)
+	for _, t := range s.tickets {
+		if t.PeopleAhead != nil {
+			ahead[t.ID.String()] = *t.PeopleAhead
+		}
+	}
+	return ahead
+}
+
+// withPeopleAhead returns t with PeopleAhead set if it is waiting, which takes
+// the other tickets of its queue into account.
+func withPeopleAhead(ctx context.Context, db storage.Store, t *storage.Ticket) (*storage.Ticket, error) {
+	if t.Status != ticket.StatusWaiting {
+		return t, nil
+	}
+	tickets, err := db.GetActiveTicketsByQueueID(ctx, t.QueueID)
+	if err != nil {
+		return nil, err
+	}
+	storage.SetPeopleAhead(tickets, time.Now())
+	for _, current := range tickets {
+		if current.ID == t.ID {
+			return current, nil
+		}
+	}
+	return t, nil
+}
+
+// statusOf returns the customer-facing status of t, one of the snapshot's tickets.
+func (s *queueSnapshot) statusOf(t *storage.Ticket) TicketStatus {
+	status := TicketStatus{
+		TicketNumber: t.TicketNumber,
+		QueueName:    s.queue.Name,
+		Status:       t.Status,
+		CounterName:  t.CounterName,
+		UpdatedAt:    t.UpdatedAt,
+	}
+	if t.Status != ticket.StatusWaiting {
+		return status
+	}
+	if t.DeferredUntil != nil && t.DeferredUntil.After(time.Now()) {
+		status.DeferredUntil = t.DeferredUntil
+	}
+	if t.PeopleAhead != nil {
+		status.PeopleAhead = *t.PeopleAhead
+	}
+	status.Position = status.PeopleAhead + 1
+	status.EstimatedWaitSeconds = int(s.wait.Seconds())
+	return status
+}
+
+// ticketByToken looks up the ticket named by the :token path parameter.
+func ticketByToken(c *gin.Context, db storage.Store) (*storage.Ticket, bool) {
+	t, err := db.GetTicketByAccessTokenHash(c.Request.Context(), auth.HashTicketToken(c.Param("token")))
+	if err != nil {
+		respondError(c, err, "Failed to retrieve ticket")
+		return nil, false
+	}
+	return t, true
+}
+
+// GetTicketStatus handles the customer's status page at /t/{token}. Browsers
+// get the HTML page, which fetches the same URL as JSON and then follows the
+// ticket over its WebSocket.
+func GetTicketStatus(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The token is in the URL, so keep it out of Referer headers and caches.
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Header("Cache-Control", "no-store")
+
+		if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+			c.File(ticketStatusPage)
+			return
+		}
+
+		t, ok := ticketByToken(c, db)
+		if !ok {
+			return
+		}
+		respondTicketStatus(c, db, t)
+	}
+}
+
+// respondTicketStatus writes the customer-facing status of t.
+func respondTicketStatus(c *gin.Context, db storage.Store, t *storage.Ticket) {
+	snapshot, err := loadQueueSnapshot(c.Request.Context(), db, t.QueueID)
+	if err != nil {
+		respondError(c, err, "Failed to retrieve ticket status")
+		return
+	}
+	for _, current := range snapshot.tickets {
+		if current.ID == t.ID {
+			t = current
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, snapshot.statusOf(t))
+}
+
+// CancelOwnTicket lets a customer leave the queue with their ticket's access
+// token. It responds with the ticket's new status.
+func CancelOwnTicket(db storage.Store, n *notifier.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CustomerCancelRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		t, ok := ticketByToken(c, db)
+		if !ok {
+			return
+		}
+		t, err := db.UpdateTicketStatus(c.Request.Context(), t.ID, ticket.StatusCancelled, nil, auditFrom(c, req.Reason))
+		if err != nil {
+			respondError(c, err, "Failed to cancel ticket")
+			return
+		}
+
+		respondTicketStatus(c, db, t)
+
+		n.DispatchEvents()
+	}
+}
+
+// DeferOwnTicket lets a customer who is running late let a few people go
+// ahead or hold their ticket until a later time, with their ticket's access
+// token. It responds with the ticket's new status.
+func DeferOwnTicket(db storage.Store, n *notifier.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DeferTicketRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		now := time.Now()
+		switch {
+		case req.Places == 0 && req.Until == nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "places or until is required"})
+			return
+		case req.Places > maxDeferPlaces:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("places must be at most %d", maxDeferPlaces)})
+			return
+		case req.Until != nil && !req.Until.After(now):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		case req.Until != nil && req.Until.Sub(now) > maxDeferDuration:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("until must be within %s", maxDeferDuration)})
+			return
+		}
+
+		t, ok := ticketByToken(c, db)
+		if !ok {
+			return
+		}
+		t, err := db.DeferTicket(c.Request.Context(), t.ID, req.Places, req.Until, auditFrom(c, deferReason(req)))
+		if err != nil {
+			respondError(c, err, "Failed to defer ticket")
+			return
+		}
+
+		respondTicketStatus(c, db, t)
+
+		n.DispatchEvents()
+	}
+}
+
+// deferReason describes a deferral for the audit trail, followed by the
+// customer's own note if they left one.
+func deferReason(req DeferTicketRequest) string {
+	var parts []string
+	if req.Places > 0 {
+		parts = append(parts, fmt.Sprintf("let %d go ahead", req.Places))
+	}
+	if req.Until != nil {
+		parts = append(parts, "held until "+req.Until.UTC().Format(time.RFC3339))
+	}
+	reason := "running late: " + strings.Join(parts, ", ")
+	if req.Reason != "" {
+		reason += ": " + req.Reason
+	}
+	return reason
+}
+
+// ServeTicketWs handles the WebSocket of a customer's status page, which only
+// receives the status of the ticket named by the token.
+func ServeTicketWs(db storage.Store, hub *notifier.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, ok := ticketByToken(c, db)
+		if !ok {
+			return
+		}
+		notifier.ServeTicketWs(hub, c, t.ID.String())
+	}
+}
+
+// HandleTicketEvent returns the handler of the ticket events dispatched from
+// the outbox: it publishes the change to the ticket's queue and texts the
+// customer when their ticket is called or cancelled. Repeated events text
+// nobody twice, as every ticket gets each of these texts only once.
+func HandleTicketEvent(db storage.Store, n *notifier.Notifier) notifier.EventHandler {
+	return func(ctx context.Context, e *storage.OutboxEvent, t *storage.Ticket) {
+		publishQueueChange(ctx, db, n, t)
+		switch e.Type {
+		case storage.EventTicketCalled:
+			textTicket(ctx, db, n, t, message.Called, "")
+		case storage.EventTicketCancelled:
+			// Customers cancelling by text are answered by the reply.
+			if e.ActorType != storage.ActorSMS {
+				textTicket(ctx, db, n, t, message.Cancelled, "")
+			}
+		}
+	}
+}
+
+// publishQueueChange pushes the people ahead of the changed ticket's queue to
+// the staff and display clients and the status of every followed ticket in
+// line, and of the changed ticket, to its status page, and texts the customers
+// who reached one of the queue's notification thresholds. Any change in a
+// queue can move the other tickets' places in line, so it runs after every
+// ticket action.
+func publishQueueChange(ctx context.Context, db storage.Store, n *notifier.Notifier, changed *storage.Ticket) {
+	snapshot, err := loadQueueSnapshot(ctx, db, changed.QueueID)
+	if err != nil {
+		log.Printf("Failed to load queue %s for ticket status updates: %v", changed.QueueID, err)
+		return
+	}
+	n.SendPeopleAhead(changed.QueueID.String(), snapshot.peopleAhead())
+	for _, t := range snapshot.tickets {
+		if n.FollowsTicket(t.ID.String()) {
+			n.SendTicketStatus(t.ID.String(), snapshot.statusOf(t))
+		}
+	}
+	// A ticket that was just served or cancelled is no longer in the snapshot.
+	if !ticket.IsActive(changed.Status) && n.FollowsTicket(changed.ID.String()) {
+		n.SendTicketStatus(changed.ID.String(), snapshot.statusOf(changed))
+	}
+	textPeopleAhead(ctx, db, n, snapshot)
+}
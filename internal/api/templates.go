@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/message"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// Sources of the customized texts, as reported by a template preview.
+const (
+	templateSourceQueue   = "queue"   // the ticket's queue's own text
+	templateSourceGlobal  = "global"  // the text customized for every queue
+	templateSourceRequest = "request" // the text sent with the preview request
+)
+
+// sampleData fills the placeholders of a preview that names no ticket.
+var sampleData = message.Data{
+	TicketNumber: "A-042",
+	QueueName:    "Sample queue",
+	Counter:      "Counter 3",
+	PeopleAhead:  2,
+	ETA:          12 * time.Minute,
+	StatusURL:    "/t/sample",
+}
+
+// messageLayers loads the customized texts that apply to a queue's tickets:
+// the queue's own, then the global ones.
+func messageLayers(ctx context.Context, db storage.Store, queueID *uuid.UUID) ([]message.Layer, error) {
+	var layers []message.Layer
+	if queueID != nil {
+		templates, err := db.GetMessageTemplates(ctx, queueID)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, message.Layer{Source: templateSourceQueue, Texts: textsOf(templates)})
+	}
+	templates, err := db.GetMessageTemplates(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, message.Layer{Source: templateSourceGlobal, Texts: textsOf(templates)}), nil
+}
+
+func textsOf(templates []*storage.MessageTemplate) message.Texts {
+	texts := make(message.Texts, len(templates))
+	for _, t := range templates {
+		texts[message.Key{Name: t.Name, Locale: t.Locale}] = t.Body
+	}
+	return texts
+}
+
+// renderMessage renders the named template for a customer of queueID in the
+// customer's locale, falling back to the global and built-in texts. A nil
+// queueID only uses the global and built-in texts.
+func renderMessage(ctx context.Context, db storage.Store, queueID *uuid.UUID, name, locale string, d message.Data) (string, error) {
+	layers, err := messageLayers(ctx, db, queueID)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := message.Resolve(name, message.Chain(locale), layers...)
+	if err != nil {
+		return "", err
+	}
+	return message.Render(resolved.Body, d), nil
+}
+
+// templateScope returns the queue named by the optional :queueId path
+// parameter, or nil for the global templates.
+func templateScope(c *gin.Context) (*uuid.UUID, bool) {
+	if c.Param("queueId") == "" {
+		return nil, true
+	}
+	queueID, err := uuid.Parse(c.Param("queueId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID format"})
+		return nil, false
+	}
+	return &queueID, true
+}
+
+// templateKey reads and checks the :name and :locale path parameters.
+func templateKey(c *gin.Context) (name, locale string, ok bool) {
+	name = c.Param("name")
+	if !message.ValidName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown template name " + name})
+		return "", "", false
+	}
+	locale, err := message.NormalizeLocale(c.Param("locale"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", "", false
+	}
+	return name, locale, true
+}
+
+// GetMessageTemplates handles listing the customized texts of a queue, or the
+// global ones. Templates without a customized text use the built-in one.
+func GetMessageTemplates(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueID, ok := templateScope(c)
+		if !ok {
+			return
+		}
+
+		templates, err := db.GetMessageTemplates(c.Request.Context(), queueID)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve message templates")
+			return
+		}
+
+		c.JSON(http.StatusOK, templates)
+	}
+}
+
+// MessageTemplateRequest is the body of SetMessageTemplate.
+type MessageTemplateRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// SetMessageTemplate handles creating or replacing the customized text of a
+// template in one locale, for a queue or for every queue.
+func SetMessageTemplate(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueID, ok := templateScope(c)
+		if !ok {
+			return
+		}
+		name, locale, ok := templateKey(c)
+		if !ok {
+			return
+		}
+
+		var req MessageTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := message.Validate(req.Body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		template, err := db.SetMessageTemplate(c.Request.Context(), queueID, name, locale, req.Body)
+		if err != nil {
+			respondError(c, err, "Failed to save message template")
+			return
+		}
+
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+// DeleteMessageTemplate handles removing a customized text, so that customers
+// get the next text in the fallback chain again.
+func DeleteMessageTemplate(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queueID, ok := templateScope(c)
+		if !ok {
+			return
+		}
+		name, locale, ok := templateKey(c)
+		if !ok {
+			return
+		}
+
+		if err := db.DeleteMessageTemplate(c.Request.Context(), queueID, name, locale); err != nil {
+			respondError(c, err, "Failed to delete message template")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// PreviewTemplateRequest is the body of PreviewMessageTemplate. QueueID picks
+// the queue whose texts are used, TicketID a ticket to fill the placeholders
+// with, and Body a draft text to render instead of the saved ones.
+type PreviewTemplateRequest struct {
+	Name     string     `json:"name" binding:"required"`
+	Locale   string     `json:"locale"`
+	QueueID  *uuid.UUID `json:"queue_id"`
+	TicketID *uuid.UUID `json:"ticket_id"`
+	Body     string     `json:"body"`
+}
+
+// TemplatePreview is a template text and what a customer would receive.
+type TemplatePreview struct {
+	message.Resolved
+	Text string `json:"text"`
+}
+
+// PreviewMessageTemplate handles rendering a template the way a customer
+// would receive it, for a ticket or for a sample ticket. Without a locale the
+// ticket's locale is used.
+func PreviewMessageTemplate(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PreviewTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !message.ValidName(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown template name " + req.Name})
+			return
+		}
+		locale, err := message.NormalizeLocale(req.Locale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Body != "" {
+			if err := message.Validate(req.Body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx := c.Request.Context()
+		data := sampleData
+		queueID := req.QueueID
+		if req.TicketID != nil {
+			t, err := db.GetTicketByID(ctx, *req.TicketID)
+			if err != nil {
+				respondError(c, err, "Failed to retrieve ticket")
+				return
+			}
+			if data, err = ticketMessageData(ctx, db, t); err != nil {
+				respondError(c, err, "Failed to retrieve ticket")
+				return
+			}
+			data.StatusURL = sampleData.StatusURL // Only the ticket's customer has its link.
+			queueID = &t.QueueID
+			if locale == "" {
+				locale = t.Locale
+			}
+		} else if queueID != nil {
+			q, err := db.GetQueueByID(ctx, *queueID)
+			if err != nil {
+				respondError(c, err, "Failed to retrieve queue")
+				return
+			}
+			data.QueueName = q.Name
+		}
+
+		var resolved message.Resolved
+		if req.Body != "" {
+			resolved = message.Resolved{Name: req.Name, Locale: locale, Source: templateSourceRequest, Body: req.Body}
+		} else {
+			layers, err := messageLayers(ctx, db, queueID)
+			if err != nil {
+				respondError(c, err, "Failed to retrieve message templates")
+				return
+			}
+			if resolved, err = message.Resolve(req.Name, message.Chain(locale), layers...); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, TemplatePreview{Resolved: resolved, Text: message.Render(resolved.Body, data)})
+	}
+}
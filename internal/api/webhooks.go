@@ -0,0 +1,197 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/notifier"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// NewWebhookRequest is the body of CreateWebhook.
+type NewWebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Description string   `json:"description" binding:"max=255"`
+}
+
+// validWebhookURL reports whether raw is an absolute http or https URL.
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// CreateWebhook handles subscribing a URL to event types. The secret signing
+// its requests is only returned in this response.
+func CreateWebhook(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req NewWebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !validWebhookURL(req.URL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+			return
+		}
+		if err := notifier.ValidateEventTypes(req.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret, err := notifier.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+
+		webhook, err := db.CreateWebhook(c.Request.Context(), req.URL, secret, dedupe(req.Events), req.Description)
+		if err != nil {
+			respondError(c, err, "Failed to create webhook")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"secret":  secret,
+			"webhook": webhook,
+		})
+	}
+}
+
+// dedupe returns values without repeats, in their first order.
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// GetWebhooks handles listing webhooks.
+func GetWebhooks(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhooks, err := db.GetWebhooks(c.Request.Context())
+		if err != nil {
+			respondError(c, err, "Failed to retrieve webhooks")
+			return
+		}
+
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// GetWebhook handles retrieving a webhook.
+func GetWebhook(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := uuid.Parse(c.Param("webhookId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID format"})
+			return
+		}
+
+		webhook, err := db.GetWebhookByID(c.Request.Context(), webhookID)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve webhook")
+			return
+		}
+
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// DeleteWebhook handles removing a webhook. Its pending deliveries are
+// dropped.
+func DeleteWebhook(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := uuid.Parse(c.Param("webhookId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID format"})
+			return
+		}
+
+		if err := db.DeleteWebhook(c.Request.Context(), webhookID); err != nil {
+			respondError(c, err, "Failed to delete webhook")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetWebhookDeliveries handles listing webhook deliveries, newest first,
+// optionally filtered by webhook_id, event_type and status and capped by
+// limit.
+func GetWebhookDeliveries(db storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter storage.WebhookDeliveryFilter
+
+		if v := c.Query("webhook_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID format"})
+				return
+			}
+			filter.WebhookID = &id
+		}
+		if v := c.Query("event_type"); v != "" {
+			if !notifier.ValidEventType(v) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type " + v})
+				return
+			}
+			filter.EventType = v
+		}
+		switch v := c.Query("status"); v {
+		case "", storage.NotificationPending, storage.NotificationSent, storage.NotificationFailed:
+			filter.Status = v
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of pending, sent or failed"})
+			return
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > storage.DefaultNotificationLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(storage.DefaultNotificationLimit)})
+				return
+			}
+			filter.Limit = limit
+		}
+
+		deliveries, err := db.ListWebhookDeliveries(c.Request.Context(), filter)
+		if err != nil {
+			respondError(c, err, "Failed to retrieve webhook deliveries")
+			return
+		}
+
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// RedeliverWebhookDelivery handles sending a sent or failed delivery again,
+// e.g. once the receiver has been fixed. It gets a fresh set of attempts.
+func RedeliverWebhookDelivery(db storage.Store, n *notifier.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID, err := uuid.Parse(c.Param("deliveryId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID format"})
+			return
+		}
+
+		delivery, err := db.RedeliverWebhookDelivery(c.Request.Context(), deliveryID, time.Now())
+		if err != nil {
+			respondError(c, err, "Failed to redeliver webhook delivery")
+			return
+		}
+
+		c.JSON(http.StatusOK, delivery)
+
+		n.DeliverWebhooks()
+	}
+}
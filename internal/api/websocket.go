@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/auth"
+	"github.com/smartq/smartq/internal/notifier"
+)
+
+// ServeWs handles the WebSocket of staff and display clients. They follow the
+// queues given as queue_id query parameters, and the admin channel with
+// channel=admin, and can change what they follow later with subscribe and
+// unsubscribe messages. The admin channel needs an admin login or an API key
+// with the queues:write scope.
+func ServeWs(hub *notifier.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access := notifier.Access{Queues: true, Admin: mayFollowAdmin(c)}
+
+		var topics []string
+		for _, v := range c.QueryArray("queue_id") {
+			if _, err := uuid.Parse(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID format"})
+				return
+			}
+			topics = append(topics, notifier.QueueTopic(v))
+		}
+		switch c.Query("channel") {
+		case "":
+		case notifier.AdminTopic:
+			if !access.Admin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "The admin channel requires the admin role or the " + auth.ScopeQueuesWrite + " scope"})
+				return
+			}
+			topics = append(topics, notifier.AdminTopic)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "channel must be admin"})
+			return
+		}
+
+		notifier.ServeWs(hub, c, access, topics)
+	}
+}
+
+// mayFollowAdmin reports whether the client authenticated for the request may
+// follow the admin channel.
+func mayFollowAdmin(c *gin.Context) bool {
+	if user := currentUser(c); user != nil {
+		return auth.Allows(user.Role, auth.RoleAdmin)
+	}
+	if key := currentAPIKey(c); key != nil {
+		return auth.HasScope(key.Scopes, auth.ScopeQueuesWrite)
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) < 40 {
+		t.Errorf("key = %q, want a long key starting with %q", key, APIKeyPrefix)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) >= len(key) {
+		t.Errorf("display prefix %q is not a proper prefix of the key", prefix)
+	}
+	if hash != HashAPIKey(key) || strings.Contains(hash, key) {
+		t.Errorf("hash = %q, want HashAPIKey(key)", hash)
+	}
+
+	other, _, otherHash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if other == key || otherHash == hash {
+		t.Error("GenerateAPIKey returned the same key twice")
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	if err := ValidateScopes([]string{ScopeTicketsCreate, ScopeQueuesRead, ScopeTicketsRead}); err != nil {
+		t.Errorf("ValidateScopes(known scopes) = %v", err)
+	}
+	if err := ValidateScopes(nil); err == nil {
+		t.Error("ValidateScopes accepted an empty list")
+	}
+	if err := ValidateScopes([]string{ScopeQueuesRead, "queues:delete"}); err == nil {
+		t.Error("ValidateScopes accepted an unknown scope")
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	scopes := []string{ScopeTicketsCreate}
+	if !HasScope(scopes, ScopeTicketsCreate) {
+		t.Error("HasScope missed a granted scope")
+	}
+	if HasScope(scopes, ScopeTicketsWrite) {
+		t.Error("HasScope granted a scope the key does not have")
+	}
+}
@@ -0,0 +1,145 @@
+// Package auth contains staff roles, password hashing and login tokens.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Staff roles. Each role may do everything the roles below it may do:
+// admins manage queues, counters and users; staff call, serve and cancel
+// tickets; displays only read the queue.
+const (
+	RoleAdmin   = "admin"
+	RoleStaff   = "staff"
+	RoleDisplay = "display"
+)
+
+// roleRanks orders the roles from least to most privileged.
+var roleRanks = map[string]int{
+	RoleDisplay: 1,
+	RoleStaff:   2,
+	RoleAdmin:   3,
+}
+
+// DefaultTokenTTL is how long a login token stays valid unless configured otherwise.
+const DefaultTokenTTL = 12 * time.Hour
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired or not
+// signed with the server's secret.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// IsValidRole reports whether role is one of the known staff roles.
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// Allows reports whether a user with role may use an endpoint that requires
+// the role required.
+func Allows(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// ValidatePassword reports whether password is acceptable for a staff account.
+func ValidatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Claims are the contents of a login token. The subject is the user ID.
+type Claims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies HS256-signed login tokens.
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokenManager creates a TokenManager signing with secret. Tokens expire
+// after ttl, or DefaultTokenTTL if ttl is zero.
+func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
+	if ttl == 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &TokenManager{secret: secret, ttl: ttl}
+}
+
+// Issue returns a signed token for the user and its expiry time.
+func (m *TokenManager) Issue(userID uuid.UUID, username, role string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	claims := Claims{
+		Username: username,
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// Parse verifies token and returns its claims. It returns an error wrapping
+// ErrInvalidToken if the token cannot be trusted.
+func (m *TokenManager) Parse(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: bad subject", ErrInvalidToken)
+	}
+	return id, nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAllows(t *testing.T) {
+	cases := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleStaff, true},
+		{RoleAdmin, RoleDisplay, true},
+		{RoleStaff, RoleAdmin, false},
+		{RoleStaff, RoleStaff, true},
+		{RoleStaff, RoleDisplay, true},
+		{RoleDisplay, RoleStaff, false},
+		{RoleDisplay, RoleDisplay, true},
+		{"", RoleDisplay, false},
+		{"root", RoleDisplay, false},
+	}
+	for _, tc := range cases {
+		if got := Allows(tc.role, tc.required); got != tc.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tc.role, tc.required, got, tc.want)
+		}
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if hash == "correct horse" {
+		t.Fatal("HashPassword returned the password itself")
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Error("CheckPassword rejected the right password")
+	}
+	if CheckPassword(hash, "battery staple") {
+		t.Error("CheckPassword accepted a wrong password")
+	}
+
+	if _, err := HashPassword("short"); err == nil {
+		t.Error("HashPassword accepted a 5-character password")
+	}
+	if _, err := HashPassword(strings.Repeat("x", 73)); err == nil {
+		t.Error("HashPassword accepted a 73-byte password")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	m := NewTokenManager([]byte("secret"), time.Hour)
+	userID := uuid.New()
+
+	token, expiresAt, err := m.Issue(userID, "alice", RoleStaff)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if d := time.Until(expiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("token expires in %v, want about an hour", d)
+	}
+
+	claims, err := m.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if id, err := claims.UserID(); err != nil || id != userID {
+		t.Errorf("UserID() = %v, %v, want %v", id, err, userID)
+	}
+	if claims.Username != "alice" || claims.Role != RoleStaff {
+		t.Errorf("claims = %+v, want alice/staff", claims)
+	}
+
+	other := NewTokenManager([]byte("other secret"), time.Hour)
+	if _, err := other.Parse(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse with wrong secret: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := m.Parse(token + "x"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse of tampered token: err = %v, want ErrInvalidToken", err)
+	}
+
+	expired := NewTokenManager([]byte("secret"), -time.Minute)
+	token, _, err = expired.Issue(userID, "alice", RoleStaff)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := m.Parse(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse of expired token: err = %v, want ErrInvalidToken", err)
+	}
+}
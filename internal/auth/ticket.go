@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// GenerateTicketToken returns a new random ticket access token and the hash to
+// store. The token is the customer's link to their ticket's status page, so it
+// is kept short enough for a QR code or an SMS while still being unguessable.
+func GenerateTicketToken() (token, hash string, err error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate ticket token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashTicketToken(token), nil
+}
+
+// HashTicketToken returns the hex-encoded SHA-256 hash of a ticket access
+// token, the form it is stored and looked up in.
+func HashTicketToken(token string) string {
+	return hashSecret(token)
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateTicketToken(t *testing.T) {
+	token, hash, err := GenerateTicketToken()
+	if err != nil {
+		t.Fatalf("GenerateTicketToken: %v", err)
+	}
+	if len(token) < 20 || strings.ContainsAny(token, "+/=") {
+		t.Errorf("token = %q, want a URL-safe token of at least 20 characters", token)
+	}
+	if hash != HashTicketToken(token) || hash == token {
+		t.Errorf("hash = %q, want HashTicketToken(token)", hash)
+	}
+
+	other, _, err := GenerateTicketToken()
+	if err != nil {
+		t.Fatalf("GenerateTicketToken: %v", err)
+	}
+	if other == token {
+		t.Error("GenerateTicketToken returned the same token twice")
+	}
+}
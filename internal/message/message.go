@@ -0,0 +1,250 @@
+// Package message renders the texts SmartQ sends to customers from named
+// templates, which can be customized per queue and per locale.
+package message
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the message templates.
+const (
+	TicketCreated = "ticket_created" // the customer checked in
+	Called        = "called"         // the ticket was called to a counter
+	NextInLine    = "next_in_line"   // the ticket reached one of the queue's notification thresholds
+	Cancelled     = "cancelled"      // the ticket was cancelled
+
+	// Replies to customers texting SmartQ.
+	StatusReply = "status"    // the customer asked for their place in line
+	Deferred    = "deferred"  // the customer let others go ahead because they are late
+	Help        = "help"      // the customer sent an unknown command
+	NoTicket    = "no_ticket" // the sender has no ticket in line
+)
+
+// Names lists every template name.
+var Names = []string{TicketCreated, Called, NextInLine, Cancelled, StatusReply, Deferred, Help, NoTicket}
+
+// DefaultLocale is the locale every fallback chain ends with. All templates
+// have a built-in text in it.
+const DefaultLocale = "en"
+
+// Placeholders lists the placeholders a template text may use, written in
+// braces, e.g. "Ticket {ticket_number}".
+var Placeholders = []string{"ticket_number", "queue_name", "counter", "position", "people_ahead", "eta", "status_url"}
+
+// MaxBodyLength caps the length of a template text, in bytes, which keeps a
+// rendered text message to a few SMS segments.
+const MaxBodyLength = 640
+
+// Builtin holds the texts SmartQ ships with, used when no customized text
+// matches.
+var Builtin = Texts{
+	{TicketCreated, "en"}: "Welcome to {queue_name}! Your ticket is {ticket_number} and you are number {position} in line. Follow your place at {status_url}",
+	{Called, "en"}:        "It's your turn! Ticket {ticket_number}, please proceed to {counter}.",
+	{NextInLine, "en"}:    "Ticket {ticket_number} at {queue_name}: you are number {position} in line. Please get ready.",
+	{Cancelled, "en"}:     "Your ticket {ticket_number} at {queue_name} has been cancelled.",
+	{StatusReply, "en"}:   "Ticket {ticket_number} at {queue_name}: you are number {position} in line, about {eta} min to go.",
+	{Deferred, "en"}:      "No problem! Ticket {ticket_number} is now number {position} in line at {queue_name}.",
+	{Help, "en"}:          "Reply STATUS for your place in line, LATE to let a few people go ahead, or CANCEL to leave the line.",
+	{NoTicket, "en"}:      "We could not find a ticket in line for this phone number.",
+
+	{TicketCreated, "es"}: "¡Bienvenido a {queue_name}! Su turno es {ticket_number} y usted es el número {position} en la fila. Siga su lugar en {status_url}",
+	{Called, "es"}:        "¡Es su turno! Turno {ticket_number}, por favor diríjase a {counter}.",
+	{NextInLine, "es"}:    "Turno {ticket_number} en {queue_name}: usted es el número {position} en la fila. Prepárese, por favor.",
+	{Cancelled, "es"}:     "Su turno {ticket_number} en {queue_name} ha sido cancelado.",
+	{StatusReply, "es"}:   "Turno {ticket_number} en {queue_name}: usted es el número {position} en la fila, faltan unos {eta} min.",
+	{Deferred, "es"}:      "¡No hay problema! El turno {ticket_number} es ahora el número {position} en la fila de {queue_name}.",
+	{Help, "es"}:          "Responda STATUS para conocer su lugar en la fila, LATE para dejar pasar a algunas personas o CANCEL para salir de la fila.",
+	{NoTicket, "es"}:      "No encontramos un turno en la fila para este número de teléfono.",
+}
+
+// Key identifies the text of a template in one locale.
+type Key struct {
+	Name   string
+	Locale string
+}
+
+// Texts holds template texts by name and locale, e.g. the customized texts of
+// one queue.
+type Texts map[Key]string
+
+// Layer is a set of texts consulted when resolving a template, named after
+// where the texts come from, e.g. "queue".
+type Layer struct {
+	Source string
+	Texts  Texts
+}
+
+// SourceBuiltin is the source of the texts in Builtin.
+const SourceBuiltin = "builtin"
+
+// Resolved is the text chosen for a template.
+type Resolved struct {
+	Name   string `json:"name"`
+	Locale string `json:"locale"` // The locale the text is written for
+	Source string `json:"source"` // The layer it comes from, or SourceBuiltin
+	Body   string `json:"body"`
+}
+
+// Resolve picks the text of the named template. It tries the locales of chain
+// in order, which should end with DefaultLocale, and in each locale the layers
+// in order and then Builtin.
+func Resolve(name string, chain []string, layers ...Layer) (Resolved, error) {
+	if !ValidName(name) {
+		return Resolved{}, fmt.Errorf("unknown template %q: use one of %s", name, strings.Join(Names, ", "))
+	}
+	layers = append(layers, Layer{Source: SourceBuiltin, Texts: Builtin})
+	for _, locale := range chain {
+		for _, layer := range layers {
+			if body, ok := layer.Texts[Key{name, locale}]; ok {
+				return Resolved{Name: name, Locale: locale, Source: layer.Source, Body: body}, nil
+			}
+		}
+	}
+	return Resolved{Name: name, Locale: DefaultLocale, Source: SourceBuiltin, Body: Builtin[Key{name, DefaultLocale}]}, nil
+}
+
+// ValidName reports whether name is one of Names.
+func ValidName(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+var localePattern = regexp.MustCompile(`^([a-z]{2,3})(?:-([A-Z]{2}|[0-9]{3}))?$`)
+
+// NormalizeLocale returns locale in its canonical form, e.g. "pt-BR" for
+// "pt_br", or an error if it is not a language code with an optional region.
+// An empty locale stays empty.
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return "", nil
+	}
+	parts := strings.SplitN(strings.ReplaceAll(locale, "_", "-"), "-", 2)
+	normalized := strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		normalized += "-" + strings.ToUpper(parts[1])
+	}
+	if !localePattern.MatchString(normalized) {
+		return "", fmt.Errorf("invalid locale %q: use a language code with an optional region, e.g. es or pt-BR", locale)
+	}
+	return normalized, nil
+}
+
+// Chain returns the locales to try, in order, for a customer with the given
+// preferred locales: each locale, then its language without the region, and
+// finally DefaultLocale. Invalid and empty locales are skipped.
+func Chain(locales ...string) []string {
+	var chain []string
+	add := func(locale string) {
+		for _, l := range chain {
+			if l == locale {
+				return
+			}
+		}
+		chain = append(chain, locale)
+	}
+	for _, locale := range locales {
+		normalized, err := NormalizeLocale(locale)
+		if err != nil || normalized == "" {
+			continue
+		}
+		add(normalized)
+		add(strings.SplitN(normalized, "-", 2)[0])
+	}
+	add(DefaultLocale)
+	return chain
+}
+
+// Validate checks a template text: it must not be empty or longer than
+// MaxBodyLength, and may only use the placeholders in Placeholders.
+func Validate(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("template text must not be empty")
+	}
+	if len(body) > MaxBodyLength {
+		return fmt.Errorf("template text must be at most %d bytes", MaxBodyLength)
+	}
+	for rest := body; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return errors.New("template text has a { without a matching }")
+		}
+		name := rest[start+1 : start+end]
+		if !knownPlaceholder(name) {
+			return fmt.Errorf("unknown placeholder {%s}: use one of {%s}", name, strings.Join(Placeholders, "}, {"))
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+func knownPlaceholder(name string) bool {
+	for _, p := range Placeholders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Data holds the values of the placeholders for one ticket.
+type Data struct {
+	TicketNumber string
+	QueueName    string
+	Counter      string        // The counter calling the ticket; the queue name if empty
+	PeopleAhead  int           // Waiting tickets called before this one
+	ETA          time.Duration // Estimated wait, shown in whole minutes
+	StatusURL    string        // Link to the customer's ticket status page
+}
+
+// Render replaces the placeholders of body with the values in d. Unknown
+// placeholders are left as they are.
+func Render(body string, d Data) string {
+	counter := d.Counter
+	if counter == "" {
+		counter = d.QueueName
+	}
+	values := map[string]string{
+		"ticket_number": d.TicketNumber,
+		"queue_name":    d.QueueName,
+		"counter":       counter,
+		"position":      strconv.Itoa(d.PeopleAhead + 1),
+		"people_ahead":  strconv.Itoa(d.PeopleAhead),
+		"eta":           strconv.Itoa(int(math.Ceil(d.ETA.Minutes()))),
+		"status_url":    d.StatusURL,
+	}
+
+	var b strings.Builder
+	for rest := body; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		b.WriteString(rest[:start])
+		if value, ok := values[rest[start+1:start+end]]; ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(rest[start : start+end+1])
+		}
+		rest = rest[start+end+1:]
+	}
+}
@@ -0,0 +1,147 @@
+package message
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	d := Data{
+		TicketNumber: "A-042",
+		QueueName:    "Pharmacy",
+		Counter:      "Desk 3",
+		PeopleAhead:  2,
+		ETA:          90 * time.Second,
+		StatusURL:    "https://example.com/t/abc",
+	}
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"{ticket_number} to {counter}", "A-042 to Desk 3"},
+		{"{queue_name}: number {position}, {people_ahead} ahead, {eta} min", "Pharmacy: number 3, 2 ahead, 2 min"},
+		{"See {status_url}.", "See https://example.com/t/abc."},
+		{"{unknown} and {ticket_number}", "{unknown} and A-042"},
+		{"unclosed {ticket_number", "unclosed {ticket_number"},
+		{"no placeholders", "no placeholders"},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.body, d); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	d.Counter = ""
+	if got := Render("Go to {counter}", d); got != "Go to Pharmacy" {
+		t.Errorf("Render without a counter = %q, want the queue name", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, body := range Builtin {
+		if err := Validate(body); err != nil {
+			t.Errorf("Validate(builtin %q): %v", body, err)
+		}
+	}
+	for _, body := range []string{"", "   ", "Hi {name}", "Hi {ticket_number", strings.Repeat("x", MaxBodyLength+1)} {
+		if err := Validate(body); err == nil {
+			t.Errorf("Validate(%q) = nil, want an error", body)
+		}
+	}
+}
+
+func TestBuiltinCoversEveryTemplate(t *testing.T) {
+	for _, name := range Names {
+		if _, ok := Builtin[Key{name, DefaultLocale}]; !ok {
+			t.Errorf("no built-in %s text in %s", name, DefaultLocale)
+		}
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"", "", true},
+		{"es", "es", true},
+		{"ES", "es", true},
+		{"pt_br", "pt-BR", true},
+		{" pt-BR ", "pt-BR", true},
+		{"es-419", "es-419", true},
+		{"english", "", false},
+		{"pt-Brazil", "", false},
+		{"e", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeLocale(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("NormalizeLocale(%q) = %q, %v; want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		locales []string
+		want    []string
+	}{
+		{nil, []string{"en"}},
+		{[]string{""}, []string{"en"}},
+		{[]string{"pt-BR"}, []string{"pt-BR", "pt", "en"}},
+		{[]string{"en-GB"}, []string{"en-GB", "en"}},
+		{[]string{"fr-CA", "es"}, []string{"fr-CA", "fr", "es", "en"}},
+		{[]string{"not a locale", "es"}, []string{"es", "en"}},
+	}
+	for _, tt := range tests {
+		if got := Chain(tt.locales...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Chain(%q) = %q, want %q", tt.locales, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	queue := Layer{Source: "queue", Texts: Texts{
+		{Called, "pt"}: "queue pt",
+		{Called, "en"}: "queue en",
+	}}
+	global := Layer{Source: "global", Texts: Texts{
+		{Called, "pt-BR"}:    "global pt-BR",
+		{Called, "fr"}:       "global fr",
+		{Cancelled, "pt-BR"}: "global cancelled pt-BR",
+	}}
+
+	tests := []struct {
+		name   string
+		chain  []string
+		want   string
+		source string
+		locale string
+	}{
+		// The most specific locale wins, even over a queue's text.
+		{Called, Chain("pt-BR"), "global pt-BR", "global", "pt-BR"},
+		// Within a locale, the queue's text comes before the global one.
+		{Called, Chain("pt-PT"), "queue pt", "queue", "pt"},
+		{Called, Chain("fr"), "global fr", "global", "fr"},
+		// A built-in text in the customer's language beats the default one.
+		{Called, Chain("es"), Builtin[Key{Called, "es"}], SourceBuiltin, "es"},
+		{Called, Chain("de"), "queue en", "queue", "en"},
+		{NextInLine, Chain("de"), Builtin[Key{NextInLine, "en"}], SourceBuiltin, "en"},
+		{Cancelled, Chain("pt-BR"), "global cancelled pt-BR", "global", "pt-BR"},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.name, tt.chain, queue, global)
+		if err != nil {
+			t.Fatalf("Resolve(%s, %v): %v", tt.name, tt.chain, err)
+		}
+		if got.Body != tt.want || got.Source != tt.source || got.Locale != tt.locale {
+			t.Errorf("Resolve(%s, %v) = %+v, want %q from %s in %s", tt.name, tt.chain, got, tt.want, tt.source, tt.locale)
+		}
+	}
+
+	if _, err := Resolve("welcome", Chain()); err == nil {
+		t.Error("Resolve(unknown template) = nil error, want an error")
+	}
+}
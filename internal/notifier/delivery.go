@@ -0,0 +1,193 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// ChannelSMS is the channel of notifications sent as text messages.
+const ChannelSMS = "sms"
+
+// DeliveryWorker sends the pending notifications stored in the database in
+// the background, so that a slow or unavailable gateway never holds up the
+// request that queued them and no message is lost when it fails. Failed
+// attempts are retried with exponential backoff, unless the error is a
+// *PermanentError, and notifications still pending when the server stops are
+// sent after it restarts.
+type DeliveryWorker struct {
+	store       storage.Store
+	sms         SMSSender
+	maxAttempts int
+	backoff     time.Duration // Delay before the first retry; doubled for every retry after it
+
+	wake         chan struct{}
+	pollInterval time.Duration
+	onUpdate     func(*storage.Notification) // Called after every attempt, if set
+}
+
+const (
+	// maxDeliveryBackoff caps the delay between two attempts of the same
+	// notification or webhook delivery.
+	maxDeliveryBackoff = 5 * time.Minute
+
+	// deliveryBatchSize is how many notifications the worker sends at the
+	// same time.
+	deliveryBatchSize = 8
+
+	// deliveryLease is how long a notification being sent is kept from other
+	// workers. One whose attempt never finishes, e.g. because the server
+	// crashed, is tried again after it.
+	deliveryLease = time.Minute
+
+	// deliveryPollInterval is how often the worker looks for retries that
+	// have become due when nothing wakes it up.
+	deliveryPollInterval = 5 * time.Second
+)
+
+// NewDeliveryWorker creates a DeliveryWorker that sends text messages with
+// sms and tries every notification up to maxAttempts times, waiting backoff
+// before the first retry. Call Run to start it.
+func NewDeliveryWorker(store storage.Store, sms SMSSender, maxAttempts int, backoff time.Duration) *DeliveryWorker {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &DeliveryWorker{
+		store:        store,
+		sms:          sms,
+		maxAttempts:  maxAttempts,
+		backoff:      backoff,
+		wake:         make(chan struct{}, 1),
+		pollInterval: deliveryPollInterval,
+	}
+}
+
+// Wake makes the worker look for notifications to send right away, e.g.
+// after one was queued. It never blocks.
+func (w *DeliveryWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due notifications until ctx is done. Attempts still in flight
+// then are abandoned; their notifications are tried again once their lease
+// runs out.
+func (w *DeliveryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		w.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends batches of due notifications until none are left.
+func (w *DeliveryWorker) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := w.store.ClaimNotifications(ctx, time.Now(), deliveryLease, deliveryBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to claim notifications: %v", err)
+			}
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, n := range batch {
+			wg.Add(1)
+			go func(n *storage.Notification) {
+				defer wg.Done()
+				w.deliver(ctx, n)
+			}(n)
+		}
+		wg.Wait()
+	}
+}
+
+// deliver makes one attempt at sending a claimed notification and records
+// the outcome.
+func (w *DeliveryWorker) deliver(ctx context.Context, n *storage.Notification) {
+	err := w.send(ctx, n)
+	if ctx.Err() != nil {
+		return
+	}
+	now := time.Now()
+	if err == nil {
+		if err := w.store.MarkNotificationSent(ctx, n.ID, now); err != nil {
+			log.Printf("Failed to record notification %s as sent: %v", n.ID, err)
+			return
+		}
+		n.Status, n.SentAt = storage.NotificationSent, &now
+		w.updated(n)
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent *PermanentError
+	if errors.As(err, &permanent) || n.Attempts >= w.maxAttempts {
+		log.Printf("Failed to send %s %s to %s after %d attempt(s): %v", n.Channel, n.Template, n.Recipient, n.Attempts, err)
+		n.Status = storage.NotificationFailed
+	} else {
+		at := now.Add(w.retryDelay(n.Attempts))
+		retryAt = &at
+		log.Printf("Failed to send %s %s to %s (attempt %d of %d), retrying at %s: %v", n.Channel, n.Template, n.Recipient, n.Attempts, w.maxAttempts, at.Format(time.RFC3339), err)
+		n.NextAttemptAt = at
+	}
+	if err := w.store.MarkNotificationFailed(ctx, n.ID, err.Error(), retryAt, now); err != nil {
+		log.Printf("Failed to record failed attempt of notification %s: %v", n.ID, err)
+		return
+	}
+	n.LastError = err.Error()
+	w.updated(n)
+}
+
+// send hands a notification to the sender of its channel.
+func (w *DeliveryWorker) send(ctx context.Context, n *storage.Notification) error {
+	switch n.Channel {
+	case ChannelSMS:
+		return w.sms.SendSMS(ctx, n.Recipient, n.Payload)
+	default:
+		return &PermanentError{Err: fmt.Errorf("unknown notification channel %q", n.Channel)}
+	}
+}
+
+// retryDelay is how long to wait after the given number of failed attempts.
+func (w *DeliveryWorker) retryDelay(attempts int) time.Duration {
+	return backoffDelay(w.backoff, attempts)
+}
+
+// backoffDelay is how long to wait after the given number of failed attempts
+// when the first retry waits backoff: twice as long after every attempt, up to
+// maxDeliveryBackoff.
+func backoffDelay(backoff time.Duration, attempts int) time.Duration {
+	delay := backoff
+	for i := 1; i < attempts && delay < maxDeliveryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxDeliveryBackoff {
+		delay = maxDeliveryBackoff
+	}
+	return delay
+}
+
+// updated reports a notification's new delivery status to onUpdate.
+func (w *DeliveryWorker) updated(n *storage.Notification) {
+	if w.onUpdate != nil {
+		w.onUpdate(n)
+	}
+}
@@ -0,0 +1,207 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// flakySender fails its first failures sends with err, then succeeds.
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	attempts int
+}
+
+func (s *flakySender) SendSMS(ctx context.Context, to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakySender) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+// queueText creates a ticket in store and queues a text message to its
+// customer.
+func queueText(t *testing.T, store storage.Store) *storage.Notification {
+	t.Helper()
+	ctx := context.Background()
+	q, err := store.CreateQueue(ctx, "Texts", queue.TicketFormat{}, nil)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	ticket, err := store.CreateTicket(ctx, q.ID, "Ann", "+15552223333", "", 0, "", storage.Audit{})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	n, err := store.EnqueueNotification(ctx, ticket.ID, ChannelSMS, "called", 0, ticket.CustomerPhone, "It's your turn!")
+	if err != nil {
+		t.Fatalf("EnqueueNotification: %v", err)
+	}
+	return n
+}
+
+// runUntilDone runs w until the notification is no longer pending and returns
+// it as stored.
+func runUntilDone(t *testing.T, w *DeliveryWorker, store storage.Store, n *storage.Notification) *storage.Notification {
+	t.Helper()
+	w.pollInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		notifications, err := store.GetTicketNotifications(context.Background(), n.TicketID)
+		if err != nil {
+			t.Fatalf("GetTicketNotifications: %v", err)
+		}
+		for _, got := range notifications {
+			if got.ID == n.ID && got.Status != storage.NotificationPending {
+				return got
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("notification %s is still pending", n.ID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeliveryWorkerRetries(t *testing.T) {
+	store := storage.NewMemoryStore()
+	n := queueText(t, store)
+	sender := &flakySender{failures: 2, err: errors.New("gateway timeout")}
+	w := NewDeliveryWorker(store, sender, 5, time.Millisecond)
+
+	var mu sync.Mutex
+	var updates []string
+	w.onUpdate = func(n *storage.Notification) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, n.Status)
+	}
+
+	got := runUntilDone(t, w, store, n)
+	if got.Status != storage.NotificationSent || got.Attempts != 3 || got.SentAt == nil || got.LastError != "gateway timeout" {
+		t.Errorf("notification = %+v, want sent on the third attempt", got)
+	}
+	if sender.Attempts() != 3 {
+		t.Errorf("attempts = %d, want 3", sender.Attempts())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 3 || updates[2] != storage.NotificationSent {
+		t.Errorf("updates = %v, want two pending retries and then sent", updates)
+	}
+}
+
+func TestDeliveryWorkerGivesUp(t *testing.T) {
+	store := storage.NewMemoryStore()
+	n := queueText(t, store)
+	sender := &flakySender{failures: 10, err: errors.New("gateway timeout")}
+	got := runUntilDone(t, NewDeliveryWorker(store, sender, 3, time.Millisecond), store, n)
+	if got.Status != storage.NotificationFailed || got.Attempts != 3 || sender.Attempts() != 3 {
+		t.Errorf("notification = %+v after %d sends, want failed after maxAttempts", got, sender.Attempts())
+	}
+
+	store = storage.NewMemoryStore()
+	n = queueText(t, store)
+	sender = &flakySender{failures: 10, err: &PermanentError{Err: errors.New("invalid number")}}
+	got = runUntilDone(t, NewDeliveryWorker(store, sender, 3, time.Millisecond), store, n)
+	if got.Status != storage.NotificationFailed || got.Attempts != 1 || got.LastError != "invalid number" {
+		t.Errorf("notification = %+v, want failed after a permanent error", got)
+	}
+}
+
+func TestDeliveryWorkerResumesAfterRestart(t *testing.T) {
+	store := storage.NewMemoryStore()
+	queued := queueText(t, store)
+
+	// A worker that stopped mid-attempt leaves its notification claimed; it is
+	// sent again once the lease runs out.
+	abandoned, err := store.EnqueueNotification(context.Background(), queued.TicketID, ChannelSMS, "next_in_line", 0, "+15552223333", "You're next")
+	if err != nil {
+		t.Fatalf("EnqueueNotification: %v", err)
+	}
+	if _, err := store.ClaimNotifications(context.Background(), time.Now(), time.Millisecond, 10); err != nil {
+		t.Fatalf("ClaimNotifications: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	sender := &flakySender{}
+	w := NewDeliveryWorker(store, sender, 5, time.Millisecond)
+	if got := runUntilDone(t, w, store, queued); got.Status != storage.NotificationSent {
+		t.Errorf("queued notification = %+v, want sent", got)
+	}
+	if got := runUntilDone(t, w, store, abandoned); got.Status != storage.NotificationSent || got.Attempts != 2 {
+		t.Errorf("abandoned notification = %+v, want sent on its second attempt", got)
+	}
+	if sender.Attempts() != 2 {
+		t.Errorf("sent %d messages, want both", sender.Attempts())
+	}
+}
+
+func TestDeliveryWorkerUnknownChannel(t *testing.T) {
+	store := storage.NewMemoryStore()
+	queued := queueText(t, store)
+	n, err := store.EnqueueNotification(context.Background(), queued.TicketID, "pigeon", "called", 1, "+15552223333", "hi")
+	if err != nil {
+		t.Fatalf("EnqueueNotification: %v", err)
+	}
+	if got := runUntilDone(t, NewDeliveryWorker(store, NewLogSender(), 5, time.Millisecond), store, n); got.Status != storage.NotificationFailed || got.Attempts != 1 {
+		t.Errorf("notification = %+v, want failed without retries", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	w := NewDeliveryWorker(storage.NewMemoryStore(), NewLogSender(), 100, 2*time.Second)
+	for attempts, want := range map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 4: 16 * time.Second, 50: maxDeliveryBackoff} {
+		if got := w.retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestNotifierDeliverNotifications(t *testing.T) {
+	w := NewDeliveryWorker(storage.NewMemoryStore(), NewLogSender(), 1, time.Millisecond)
+	n := NewNotifier(NewHub(), w, nil)
+	if !n.SMSEnabled() {
+		t.Error("SMSEnabled = false with a delivery worker")
+	}
+	n.DeliverNotifications()
+	n.DeliverNotifications() // never blocks, even when the worker is not running
+	select {
+	case <-w.wake:
+	default:
+		t.Error("DeliverNotifications did not wake the worker")
+	}
+
+	// Without a delivery worker, nothing is sent.
+	disabled := NewNotifier(NewHub(), nil, nil)
+	disabled.DeliverNotifications()
+	if disabled.SMSEnabled() {
+		t.Error("SMSEnabled = true without a delivery worker")
+	}
+}
@@ -1,24 +1,123 @@
 package notifier
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"log"
+	"sync"
+
+	"github.com/smartq/smartq/internal/storage"
+	"github.com/smartq/smartq/internal/ticket"
 )
 
-// Notifier is responsible for sending real-time updates to connected WebSocket clients.
+// Notifier is responsible for sending real-time updates to connected WebSocket
+// clients, messages to customers and events to webhooks.
 type Notifier struct {
-	hub *Hub
+	hub        *Hub
+	deliveries *DeliveryWorker // nil when text messages are disabled
+	webhooks   *WebhookWorker  // nil when events are not published
+	dispatcher *Dispatcher     // set by NewDispatcher
+
+	countryCode string // Calling code of customers' phone numbers without one
+
+	mu          sync.Mutex
+	peopleAhead map[string][]byte // Last people_ahead message sent, by queue ID
+}
+
+// NewNotifier creates a new Notifier instance. deliveries may be nil to send
+// no text messages; otherwise the Notifier reports its delivery updates to
+// WebSocket clients. webhooks may be nil to publish no events.
+func NewNotifier(hub *Hub, deliveries *DeliveryWorker, webhooks *WebhookWorker) *Notifier {
+	n := &Notifier{
+		hub:         hub,
+		deliveries:  deliveries,
+		webhooks:    webhooks,
+		peopleAhead: make(map[string][]byte),
+	}
+	if deliveries != nil {
+		deliveries.onUpdate = func(update *storage.Notification) { n.SendNotificationUpdate(update) }
+	}
+	return n
 }
 
-// NewNotifier creates a new Notifier instance.
-func NewNotifier(hub *Hub) *Notifier {
-	return &Notifier{
-		hub: hub,
+// SMSEnabled reports whether text messages are sent at all.
+func (n *Notifier) SMSEnabled() bool {
+	return n.deliveries != nil
+}
+
+// SetCountryCode sets the calling code assumed for customers' phone numbers
+// given without one, ticket.DefaultCountryCode unless set.
+func (n *Notifier) SetCountryCode(code string) {
+	n.countryCode = code
+}
+
+// NormalizePhone returns a customer's phone number in E.164 form, as stored
+// with tickets and sent by SMS providers. See ticket.NormalizePhone.
+func (n *Notifier) NormalizePhone(phone string) (string, error) {
+	code := n.countryCode
+	if code == "" {
+		code = ticket.DefaultCountryCode
+	}
+	return ticket.NormalizePhone(phone, code)
+}
+
+// DeliverNotifications tells the delivery worker that notifications were
+// queued, so that it sends them right away. It returns without waiting for
+// them to be sent.
+func (n *Notifier) DeliverNotifications() {
+	if n.deliveries != nil {
+		n.deliveries.Wake()
+	}
+}
+
+// DeliverWebhooks tells the webhook worker that deliveries are due, e.g. after
+// one was redelivered, so that it sends them right away.
+func (n *Notifier) DeliverWebhooks() {
+	if n.webhooks != nil {
+		n.webhooks.Wake()
+	}
+}
+
+// DispatchEvents tells the dispatcher that ticket events were written to the
+// outbox, so that it publishes them right away. It returns without waiting
+// for them to be published.
+func (n *Notifier) DispatchEvents() {
+	if n.dispatcher != nil {
+		n.dispatcher.Wake()
+	}
+}
+
+// PublishEvent queues an event of the given type about data, a queue, for the
+// webhooks subscribed to it, and returns without waiting for it to be
+// delivered. Failures are logged, as the action that raised the event has
+// already happened. Ticket events go through the outbox instead.
+func (n *Notifier) PublishEvent(ctx context.Context, eventType string, data interface{}) {
+	if n.webhooks == nil {
+		return
+	}
+	if err := n.webhooks.Publish(ctx, eventType, data); err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// SendNotificationUpdate sends a notification's delivery status to the
+// WebSocket clients following its queue.
+func (n *Notifier) SendNotificationUpdate(notification *storage.Notification) {
+	message, err := json.Marshal(map[string]interface{}{
+		"type": "notification_update",
+		"data": notification,
+	})
+	if err != nil {
+		log.Printf("Error marshalling notification update: %v", err)
+		return
 	}
+	n.hub.publish <- topicMessage{topics: []string{QueueTopic(notification.QueueID.String())}, data: message}
 }
 
-// SendTicketUpdate sends a ticket update message to all connected WebSocket clients.
-func (n *Notifier) SendTicketUpdate(ticket interface{}) {
+// SendTicketUpdate sends a ticket update message to the WebSocket clients
+// following the ticket's queue.
+func (n *Notifier) SendTicketUpdate(ticket *storage.Ticket) {
 	message, err := json.Marshal(map[string]interface{}{
 		"type": "ticket_update",
 		"data": ticket,
@@ -27,11 +126,12 @@ func (n *Notifier) SendTicketUpdate(ticket interface{}) {
 		log.Printf("Error marshalling ticket update: %v", err)
 		return
 	}
-	n.hub.broadcast <- message
+	n.hub.publish <- topicMessage{topics: []string{QueueTopic(ticket.QueueID.String())}, data: message}
 }
 
-// SendQueueUpdate sends a queue update message to all connected WebSocket clients.
-func (n *Notifier) SendQueueUpdate(queue interface{}) {
+// SendQueueUpdate sends a queue update message, e.g. about a new queue, to the
+// WebSocket clients on the admin channel and those following the queue.
+func (n *Notifier) SendQueueUpdate(queue *storage.Queue) {
 	message, err := json.Marshal(map[string]interface{}{
 		"type": "queue_update",
 		"data": queue,
@@ -40,5 +140,69 @@ func (n *Notifier) SendQueueUpdate(queue interface{}) {
 		log.Printf("Error marshalling queue update: %v", err)
 		return
 	}
-	n.hub.broadcast <- message
-}
\ No newline at end of file
+	n.hub.publish <- topicMessage{topics: []string{AdminTopic, QueueTopic(queue.ID.String())}, data: message}
+}
+
+// SendPeopleAhead sends the number of people ahead of each waiting ticket of a
+// queue, by ticket ID, to the WebSocket clients following the queue. Nothing
+// is sent if it has not changed since the last time.
+func (n *Notifier) SendPeopleAhead(queueID string, ahead map[string]int) {
+	message, err := json.Marshal(map[string]interface{}{
+		"type": "people_ahead",
+		"data": map[string]interface{}{
+			"queue_id":     queueID,
+			"people_ahead": ahead,
+		},
+	})
+	if err != nil {
+		log.Printf("Error marshalling people ahead: %v", err)
+		return
+	}
+
+	n.mu.Lock()
+	unchanged := bytes.Equal(n.peopleAhead[queueID], message)
+	n.peopleAhead[queueID] = message
+	n.mu.Unlock()
+	if unchanged {
+		return
+	}
+	n.hub.publish <- topicMessage{topics: []string{QueueTopic(queueID)}, data: message}
+}
+
+// SendTicketStatus sends a ticket's customer-facing status to the clients
+// following that ticket only.
+func (n *Notifier) SendTicketStatus(ticketID string, status interface{}) {
+	message, err := json.Marshal(map[string]interface{}{
+		"type": "ticket_status",
+		"data": status,
+	})
+	if err != nil {
+		log.Printf("Error marshalling ticket status: %v", err)
+		return
+	}
+	n.hub.publish <- topicMessage{topics: []string{ticketTopic(ticketID)}, data: message}
+}
+
+// FollowsTicket reports whether any client follows the ticket, so that callers
+// can skip computing statuses nobody will receive.
+func (n *Notifier) FollowsTicket(ticketID string) bool {
+	return n.hub.HasSubscribers(ticketTopic(ticketID))
+}
+
+// ticketTopic is the topic of the clients following a ticket.
+func ticketTopic(ticketID string) string {
+	return "ticket:" + ticketID
+}
+
+// queueTopicPrefix starts the topics of queues.
+const queueTopicPrefix = "queue:"
+
+// QueueTopic is the topic of the clients following a queue: its tickets,
+// people ahead and text messages.
+func QueueTopic(queueID string) string {
+	return queueTopicPrefix + queueID
+}
+
+// AdminTopic is the topic of the admin channel, with the queue-level events
+// of every queue.
+const AdminTopic = "admin"
@@ -0,0 +1,161 @@
+package notifier
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// EventHandler reacts to a ticket event dispatched from the outbox, e.g. by
+// texting the customer. t is the ticket as the change left it. As an event
+// can be dispatched more than once, handlers must tolerate repeats.
+type EventHandler func(ctx context.Context, event *storage.OutboxEvent, t *storage.Ticket)
+
+// Dispatcher publishes the ticket events that the ticket actions write to the
+// outbox in the same transaction as the change, in the order they were
+// written: to the webhooks subscribed to them, to the WebSocket clients and to
+// the EventHandlers. An event is only marked dispatched once all of them had
+// it, so a crash or an unavailable database never loses one; it is published
+// again instead. Events after one that failed wait for it to be retried.
+//
+// The WebSocket hub lives in the server process, so only one server, and one
+// Dispatcher, should run per database.
+type Dispatcher struct {
+	store    storage.Store
+	n        *Notifier
+	handlers []EventHandler
+
+	wake         chan struct{}
+	pollInterval time.Duration
+}
+
+const (
+	// dispatchPollInterval is how often the dispatcher looks for events when
+	// nothing wakes it up, e.g. to retry a failed one.
+	dispatchPollInterval = 2 * time.Second
+
+	// outboxRetention is how long dispatched events are kept before they are
+	// deleted.
+	outboxRetention = 7 * 24 * time.Hour
+
+	// outboxPruneInterval is how often dispatched events past outboxRetention
+	// are deleted.
+	outboxPruneInterval = time.Hour
+)
+
+// NewDispatcher creates the Dispatcher of the events in store, publishing them
+// through n, whose DispatchEvents wakes it from then on. Call Run to start it.
+func NewDispatcher(store storage.Store, n *Notifier) *Dispatcher {
+	d := &Dispatcher{
+		store:        store,
+		n:            n,
+		wake:         make(chan struct{}, 1),
+		pollInterval: dispatchPollInterval,
+	}
+	n.dispatcher = d
+	return d
+}
+
+// Handle adds a handler called with every event, after the webhooks and the
+// WebSocket clients had it. Call it before Run.
+func (d *Dispatcher) Handle(h EventHandler) {
+	d.handlers = append(d.handlers, h)
+}
+
+// Wake makes the dispatcher look for events to publish right away. It never
+// blocks.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes pending events until ctx is done, and deletes the events
+// dispatched more than outboxRetention ago. Events written but not yet
+// dispatched when the server stops are published after it restarts.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		d.dispatchPending(ctx)
+		if time.Since(pruned) >= outboxPruneInterval && ctx.Err() == nil {
+			d.prune(ctx)
+			pruned = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchPending publishes batches of pending events, in order, until none
+// are left or one fails.
+func (d *Dispatcher) dispatchPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := d.store.GetPendingOutboxEvents(ctx, storage.DefaultOutboxBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to read outbox events: %v", err)
+			}
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		for _, e := range events {
+			if err := d.dispatch(ctx, e); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Failed to dispatch %s event %s (attempt %d), retrying: %v", e.Type, e.ID, e.Attempts+1, err)
+				if err := d.store.MarkOutboxEventFailed(ctx, e.ID, err.Error()); err != nil {
+					log.Printf("Failed to record failed dispatch of event %s: %v", e.ID, err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// dispatch publishes one event and marks it dispatched.
+func (d *Dispatcher) dispatch(ctx context.Context, e *storage.OutboxEvent) error {
+	t, err := e.Ticket()
+	if err != nil {
+		// It can never be published; skip it rather than hold up the others.
+		log.Printf("Dropping %s event %s: %v", e.Type, e.ID, err)
+		return d.store.MarkOutboxEventDispatched(ctx, e.ID, time.Now())
+	}
+
+	if d.n.webhooks != nil {
+		// The event keeps its outbox ID, so publishing it again after a
+		// failure queues no second delivery.
+		event := Event{ID: e.ID, Type: e.Type, CreatedAt: e.CreatedAt.UTC(), Data: t}
+		if err := d.n.webhooks.publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	d.n.SendTicketUpdate(t)
+	for _, h := range d.handlers {
+		h(ctx, e, t)
+	}
+	return d.store.MarkOutboxEventDispatched(ctx, e.ID, time.Now())
+}
+
+// prune deletes the events dispatched more than outboxRetention ago.
+func (d *Dispatcher) prune(ctx context.Context) {
+	deleted, err := d.store.DeleteDispatchedOutboxEvents(ctx, time.Now().Add(-outboxRetention))
+	if err != nil {
+		log.Printf("Failed to delete dispatched outbox events: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d dispatched outbox event(s)", deleted)
+	}
+}
@@ -0,0 +1,86 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// flakyWebhookStore fails the first failures calls to EnqueueWebhookEvent.
+type flakyWebhookStore struct {
+	storage.Store
+	failures int
+}
+
+func (s *flakyWebhookStore) EnqueueWebhookEvent(ctx context.Context, eventID uuid.UUID, eventType, payload string) ([]*storage.WebhookDelivery, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("database unavailable")
+	}
+	return s.Store.EnqueueWebhookEvent(ctx, eventID, eventType, payload)
+}
+
+func TestDispatcherPublishesEventsInOrder(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyWebhookStore{Store: storage.NewMemoryStore(), failures: 1}
+	webhook, err := store.CreateWebhook(ctx, "http://127.0.0.1:9/hook", "whsec_a", []string{EventTicketCreated, EventTicketCalled}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	q, err := store.CreateQueue(ctx, "Outbox", queue.TicketFormat{}, nil)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	ticket, err := store.CreateTicket(ctx, q.ID, "Ann", "", "", 0, "", storage.Audit{})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	if _, err := store.CallNextTicket(ctx, q.ID, nil, storage.Audit{}); err != nil {
+		t.Fatalf("CallNextTicket: %v", err)
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	n := NewNotifier(hub, nil, NewWebhookWorker(store, 1, 0))
+	d := NewDispatcher(store, n)
+	var handled []string
+	d.Handle(func(ctx context.Context, e *storage.OutboxEvent, t *storage.Ticket) {
+		handled = append(handled, e.Type+" "+t.Status)
+	})
+
+	// The first event fails to reach the webhooks, so neither is handled.
+	d.dispatchPending(ctx)
+	pending, err := store.GetPendingOutboxEvents(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetPendingOutboxEvents: %v", err)
+	}
+	if len(handled) != 0 || len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError == "" || pending[1].Attempts != 0 {
+		t.Fatalf("after a failure: handled %v, pending %+v; want both events pending and the first one failed", handled, pending)
+	}
+
+	d.dispatchPending(ctx)
+	want := []string{EventTicketCreated + " waiting", EventTicketCalled + " serving"}
+	if len(handled) != len(want) || handled[0] != want[0] || handled[1] != want[1] {
+		t.Fatalf("handled %v, want %v", handled, want)
+	}
+	if pending, _ := store.GetPendingOutboxEvents(ctx, 0); len(pending) != 0 {
+		t.Errorf("pending events = %+v, want none once dispatched", pending)
+	}
+
+	// Webhook events keep the outbox event IDs, so a repeat is delivered once.
+	deliveries := deliveriesTo(t, store, webhook)
+	if len(deliveries) != 2 || deliveries[1].EventType != EventTicketCreated || deliveries[0].EventType != EventTicketCalled {
+		t.Fatalf("deliveries = %+v, want ticket.created then ticket.called", deliveries)
+	}
+	event := &storage.OutboxEvent{ID: deliveries[0].EventID, Type: EventTicketCalled, Payload: `{"id":"` + ticket.ID.String() + `"}`}
+	if err := d.dispatch(ctx, event); err != nil {
+		t.Errorf("dispatch of an already dispatched event: %v", err)
+	}
+	if deliveries := deliveriesTo(t, store, webhook); len(deliveries) != 2 {
+		t.Errorf("deliveries after publishing an event again = %d, want 2", len(deliveries))
+	}
+}
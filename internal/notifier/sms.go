@@ -0,0 +1,184 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SMSSender sends a text message to a phone number.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// PermanentError marks a send that will fail the same way if retried, such as
+// an invalid phone number or rejected credentials.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// DefaultTwilioBaseURL is the API of Twilio itself. Gateways with a
+// Twilio-compatible API can be used by pointing the sender at their URL.
+const DefaultTwilioBaseURL = "https://api.twilio.com"
+
+// TwilioSender sends text messages through the Twilio Messages API or a
+// gateway compatible with it.
+type TwilioSender struct {
+	accountSID string
+	authToken  string
+	from       string
+	baseURL    string
+	client     *http.Client
+}
+
+// NewTwilioSender creates a TwilioSender that sends from the given number. An
+// empty baseURL means DefaultTwilioBaseURL.
+func NewTwilioSender(accountSID, authToken, from, baseURL string) *TwilioSender {
+	if baseURL == "" {
+		baseURL = DefaultTwilioBaseURL
+	}
+	return &TwilioSender{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendSMS sends body to the phone number to. Client errors other than rate
+// limiting are returned as a *PermanentError.
+func (s *TwilioSender) SendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "From": {s.from}, "Body": {body}}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", s.baseURL, url.PathEscape(s.accountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("failed to create SMS request: %w", err)}
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("SMS gateway returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
+// InboundVerifier checks that a webhook request carrying a text message from
+// a customer, whose form parameters are form, comes from the SMS provider.
+type InboundVerifier interface {
+	VerifyInbound(r *http.Request, form url.Values) error
+}
+
+// InsecureInboundVerifier accepts every request, whoever sent it. It is only
+// meant for development with the log provider, as anyone could then act on a
+// customer's ticket by knowing their phone number.
+type InsecureInboundVerifier struct{}
+
+// VerifyInbound accepts the request.
+func (InsecureInboundVerifier) VerifyInbound(r *http.Request, form url.Values) error {
+	return nil
+}
+
+// TwilioSignatureHeader is the header carrying the signature of Twilio's
+// webhook requests.
+const TwilioSignatureHeader = "X-Twilio-Signature"
+
+// TwilioVerifier checks the signature Twilio, or a gateway compatible with
+// it, adds to its webhook requests.
+type TwilioVerifier struct {
+	authToken  string
+	webhookURL string
+}
+
+// NewTwilioVerifier creates a TwilioVerifier for the account's auth token.
+// webhookURL is the URL configured at the provider, which the signature
+// covers; if empty, it is rebuilt from the request, which only works when no
+// proxy in front of the server changes the scheme, host or path.
+func NewTwilioVerifier(authToken, webhookURL string) *TwilioVerifier {
+	return &TwilioVerifier{authToken: authToken, webhookURL: webhookURL}
+}
+
+// VerifyInbound checks the request's TwilioSignatureHeader.
+func (v *TwilioVerifier) VerifyInbound(r *http.Request, form url.Values) error {
+	endpoint := v.webhookURL
+	if endpoint == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		endpoint = scheme + "://" + r.Host + r.URL.RequestURI()
+	}
+	want := TwilioSignature(v.authToken, endpoint, form)
+	if !hmac.Equal([]byte(r.Header.Get(TwilioSignatureHeader)), []byte(want)) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
+
+// TwilioSignature returns Twilio's signature of a webhook request to endpoint
+// with the form parameters form: the Base64 HMAC-SHA1, keyed with the auth
+// token, of the URL followed by every parameter name and value, sorted by name.
+func TwilioSignature(authToken, endpoint string, form url.Values) string {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	io.WriteString(mac, endpoint)
+	for _, name := range names {
+		for _, value := range form[name] {
+			io.WriteString(mac, name+value)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LogSender writes text messages to the log instead of sending them, for
+// development. The access tokens in status page links are redacted, as
+// anyone holding one can cancel or defer the customer's ticket.
+type LogSender struct{}
+
+// statusLinkToken matches the access token of a ticket status page link,
+// /t/{token}.
+var statusLinkToken = regexp.MustCompile(`/t/[A-Za-z0-9_-]+`)
+
+// NewLogSender creates a LogSender.
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+// SendSMS logs the message without the access tokens in it.
+func (s *LogSender) SendSMS(ctx context.Context, to, body string) error {
+	log.Printf("SMS to %s: %s", to, statusLinkToken.ReplaceAllString(body, "/t/[redacted]"))
+	return nil
+}
@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTwilioSender(t *testing.T) {
+	var got struct {
+		path, user, password, to, from, body string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path = r.URL.Path
+		got.user, got.password, _ = r.BasicAuth()
+		got.to, got.from, got.body = r.FormValue("To"), r.FormValue("From"), r.FormValue("Body")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sender := NewTwilioSender("AC123", "secret", "+15550001111", server.URL+"/")
+	if err := sender.SendSMS(context.Background(), "+15552223333", "It's your turn!"); err != nil {
+		t.Fatalf("SendSMS: %v", err)
+	}
+	if got.path != "/2010-04-01/Accounts/AC123/Messages.json" {
+		t.Errorf("path = %q", got.path)
+	}
+	if got.user != "AC123" || got.password != "secret" {
+		t.Errorf("basic auth = %q/%q, want the account SID and auth token", got.user, got.password)
+	}
+	if got.to != "+15552223333" || got.from != "+15550001111" || got.body != "It's your turn!" {
+		t.Errorf("form = To %q, From %q, Body %q", got.to, got.from, got.body)
+	}
+}
+
+func TestTwilioSenderErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"invalid number"}`, status)
+	}))
+	defer server.Close()
+	sender := NewTwilioSender("AC123", "secret", "+15550001111", server.URL)
+
+	var permanent *PermanentError
+	if err := sender.SendSMS(context.Background(), "bogus", "hi"); !errors.As(err, &permanent) {
+		t.Errorf("SendSMS with a rejected number: err = %v, want a *PermanentError", err)
+	}
+	for _, status = range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		err := sender.SendSMS(context.Background(), "+15552223333", "hi")
+		if err == nil || errors.As(err, &permanent) {
+			t.Errorf("SendSMS with status %d: err = %v, want a temporary error", status, err)
+		}
+	}
+}
+
+func TestLogSenderRedactsAccessTokens(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	body := "A12 is checked in. Follow your place in line at https://q.example.com/t/Xy-9_abcDEF0123456789a."
+	if err := NewLogSender().SendSMS(context.Background(), "+15550001111", body); err != nil {
+		t.Fatalf("SendSMS: %v", err)
+	}
+	logged := buf.String()
+	if strings.Contains(logged, "Xy-9_abcDEF0123456789a") || !strings.Contains(logged, "SMS to +15550001111: A12 is checked in. Follow your place in line at https://q.example.com/t/[redacted].") {
+		t.Errorf("logged %q, want the message without its access token", logged)
+	}
+}
+
+func TestTwilioVerifier(t *testing.T) {
+	const endpoint = "https://example.com/api/v1/sms/inbound"
+	form := url.Values{"From": {"+15552223333"}, "To": {"+15550001111"}, "Body": {"status"}}
+	const signature = "dSOiD/7ylcZ9Vsvs36pOzcAbZ+8=" // computed independently of TwilioSignature
+	if got := TwilioSignature("secret", endpoint, form); got != signature {
+		t.Fatalf("TwilioSignature = %q, want %q", got, signature)
+	}
+
+	request := func(signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		r.Header.Set(TwilioSignatureHeader, signature)
+		return r
+	}
+	tests := []struct {
+		name     string
+		verifier *TwilioVerifier
+		r        *http.Request
+		form     url.Values
+		ok       bool
+	}{
+		{"signed", NewTwilioVerifier("secret", endpoint), request(signature), form, true},
+		{"URL from the request", NewTwilioVerifier("secret", ""), request(signature), form, true},
+		{"wrong token", NewTwilioVerifier("other", endpoint), request(signature), form, false},
+		{"unsigned", NewTwilioVerifier("secret", endpoint), request(""), form, false},
+		{"changed body", NewTwilioVerifier("secret", endpoint), request(signature), url.Values{"From": {"+15552223333"}, "To": {"+15550001111"}, "Body": {"cancel"}}, false},
+		{"other URL", NewTwilioVerifier("secret", "https://example.com/other"), request(signature), form, false},
+	}
+	for _, tt := range tests {
+		err := tt.verifier.VerifyInbound(tt.r, tt.form)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: VerifyInbound error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// Event types delivered to webhooks. The ticket events come from the outbox;
+// see Dispatcher.
+const (
+	EventTicketCreated   = storage.EventTicketCreated
+	EventTicketCalled    = storage.EventTicketCalled
+	EventTicketServed    = storage.EventTicketServed
+	EventTicketCancelled = storage.EventTicketCancelled
+	EventTicketDeferred  = storage.EventTicketDeferred
+	EventQueueCreated    = "queue.created"
+	EventQueueUpdated    = "queue.updated"
+)
+
+// EventTypes lists every event type webhooks can subscribe to.
+var EventTypes = []string{
+	EventTicketCreated,
+	EventTicketCalled,
+	EventTicketServed,
+	EventTicketCancelled,
+	EventTicketDeferred,
+	EventQueueCreated,
+	EventQueueUpdated,
+}
+
+// ValidEventType reports whether eventType is one of EventTypes.
+func ValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEventTypes reports whether events is a non-empty list of known
+// event types.
+func ValidateEventTypes(events []string) error {
+	if len(events) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, event := range events {
+		if !ValidEventType(event) {
+			return fmt.Errorf("unknown event type %q; use one of %s", event, strings.Join(EventTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// WebhookSecretPrefix starts every webhook secret, so that leaked secrets are
+// easy to spot.
+const WebhookSecretPrefix = "whsec_"
+
+// GenerateWebhookSecret returns a new random secret to sign a webhook's
+// requests with.
+func GenerateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return WebhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Headers of the webhook requests.
+const (
+	// WebhookSignatureHeader carries the time the request was signed and the
+	// signature, e.g. "t=1700000000,v1=5257a869...". See WebhookSignature.
+	WebhookSignatureHeader = "X-SmartQ-Signature"
+	// WebhookEventHeader carries the event type, e.g. "ticket.called".
+	WebhookEventHeader = "X-SmartQ-Event"
+	// WebhookDeliveryHeader carries the delivery ID, which is the same for
+	// every attempt at the delivery.
+	WebhookDeliveryHeader = "X-SmartQ-Delivery"
+)
+
+// Event is the JSON body of a webhook request. Data is the ticket or queue
+// the event is about, as returned by the API. Receivers should use ID to
+// ignore events they already handled, as an event can be delivered more than
+// once.
+type Event struct {
+	ID        uuid.UUID   `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookSignature returns the signature of a webhook request body sent at
+// timestamp, in Unix seconds: the hex HMAC-SHA256, keyed with the webhook's
+// secret, of the timestamp, a dot and the body.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, strconv.FormatInt(timestamp, 10)+".")
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a WebhookSignatureHeader value against the
+// request body, rejecting requests signed more than tolerance away from now so
+// that a captured request cannot be replayed later. It is what a receiver of
+// SmartQ's webhooks does.
+func VerifyWebhookSignature(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return errors.New("malformed webhook signature")
+	}
+	if d := now.Sub(time.Unix(timestamp, 0)); d > tolerance || d < -tolerance {
+		return errors.New("webhook signature timestamp out of tolerance")
+	}
+	want := WebhookSignature(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(want)) {
+			return nil
+		}
+	}
+	return errors.New("invalid webhook signature")
+}
+
+// WebhookWorker POSTs the webhook deliveries stored in the database in the
+// background, like DeliveryWorker does with notifications: failed attempts
+// are retried with exponential backoff unless the receiver rejects the
+// request, and deliveries still pending when the server stops are sent after
+// it restarts.
+type WebhookWorker struct {
+	store       storage.Store
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration // Delay before the first retry; doubled for every retry after it
+
+	wake         chan struct{}
+	pollInterval time.Duration
+}
+
+// webhookTimeout is how long a receiver has to respond to a webhook request.
+const webhookTimeout = 10 * time.Second
+
+// NewWebhookWorker creates a WebhookWorker that tries every delivery up to
+// maxAttempts times, waiting backoff before the first retry. Call Run to
+// start it.
+func NewWebhookWorker(store storage.Store, maxAttempts int, backoff time.Duration) *WebhookWorker {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &WebhookWorker{
+		store: store,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// A redirect is reported as a failure rather than followed, as
+			// following it would turn the POST into a GET.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		maxAttempts:  maxAttempts,
+		backoff:      backoff,
+		wake:         make(chan struct{}, 1),
+		pollInterval: deliveryPollInterval,
+	}
+}
+
+// Publish queues a new event for every webhook subscribed to its type and
+// wakes the worker to send it.
+func (w *WebhookWorker) Publish(ctx context.Context, eventType string, data interface{}) error {
+	return w.publish(ctx, Event{ID: uuid.New(), Type: eventType, CreatedAt: time.Now().UTC(), Data: data})
+}
+
+// publish queues event for every webhook subscribed to its type that does not
+// have it yet, so that publishing an event again has no effect, and wakes the
+// worker to send it.
+func (w *WebhookWorker) publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+	deliveries, err := w.store.EnqueueWebhookEvent(ctx, event.ID, event.Type, string(payload))
+	if err != nil {
+		return err
+	}
+	if len(deliveries) > 0 {
+		w.Wake()
+	}
+	return nil
+}
+
+// Wake makes the worker look for deliveries to send right away. It never
+// blocks.
+func (w *WebhookWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is done. Attempts still in flight then
+// are abandoned; their deliveries are tried again once their lease runs out.
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		w.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends batches of due deliveries until none are left.
+func (w *WebhookWorker) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := w.store.ClaimWebhookDeliveries(ctx, time.Now(), deliveryLease, deliveryBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to claim webhook deliveries: %v", err)
+			}
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, d := range batch {
+			wg.Add(1)
+			go func(d *storage.WebhookDelivery) {
+				defer wg.Done()
+				w.deliver(ctx, d)
+			}(d)
+		}
+		wg.Wait()
+	}
+}
+
+// deliver makes one attempt at sending a claimed delivery and records the
+// outcome.
+func (w *WebhookWorker) deliver(ctx context.Context, d *storage.WebhookDelivery) {
+	status, err := w.post(ctx, d)
+	if ctx.Err() != nil {
+		return
+	}
+	now := time.Now()
+	if err == nil {
+		if err := w.store.MarkWebhookDelivered(ctx, d.ID, status, now); err != nil {
+			log.Printf("Failed to record webhook delivery %s as sent: %v", d.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent *PermanentError
+	if errors.As(err, &permanent) || d.Attempts >= w.maxAttempts {
+		log.Printf("Failed to deliver %s event to %s after %d attempt(s): %v", d.EventType, d.URL, d.Attempts, err)
+	} else {
+		at := now.Add(backoffDelay(w.backoff, d.Attempts))
+		retryAt = &at
+		log.Printf("Failed to deliver %s event to %s (attempt %d of %d), retrying at %s: %v", d.EventType, d.URL, d.Attempts, w.maxAttempts, at.Format(time.RFC3339), err)
+	}
+	if err := w.store.MarkWebhookDeliveryFailed(ctx, d.ID, status, err.Error(), retryAt, now); err != nil {
+		log.Printf("Failed to record failed attempt of webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+// post sends a delivery's payload, signed with its webhook's secret, and
+// returns the HTTP status of the response, or 0 if there was none. Client
+// errors other than timeouts and rate limiting are returned as a
+// *PermanentError.
+func (w *WebhookWorker) post(ctx context.Context, d *storage.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, &PermanentError{Err: fmt.Errorf("failed to create webhook request: %w", err)}
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SmartQ-Webhooks")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, d.ID.String())
+	req.Header.Set(WebhookSignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, WebhookSignature(d.Secret, timestamp, body)))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+
+	detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("webhook receiver returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return resp.StatusCode, &PermanentError{Err: err}
+	}
+	return resp.StatusCode, err
+}
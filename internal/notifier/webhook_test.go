@@ -0,0 +1,225 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartq/smartq/internal/storage"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"type":"ticket.called"}`)
+	// Computed independently with Python's hmac module.
+	const want = "6639e40f97f392715d0395cb7645e09d2f134c7acaf0b7b24cc167fb508d0b16"
+	if got := WebhookSignature("whsec_test", 1700000000, body); got != want {
+		t.Errorf("WebhookSignature = %s, want %s", got, want)
+	}
+
+	signedAt := time.Unix(1700000000, 0)
+	header := "t=1700000000,v1=" + want
+	if err := VerifyWebhookSignature("whsec_test", header, body, signedAt.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Errorf("VerifyWebhookSignature: %v", err)
+	}
+	for name, tt := range map[string]struct {
+		secret, header string
+		body           []byte
+		now            time.Time
+	}{
+		"wrong secret":  {"other", header, body, signedAt},
+		"tampered body": {"whsec_test", header, []byte(`{"type":"ticket.served"}`), signedAt},
+		"replayed":      {"whsec_test", header, body, signedAt.Add(time.Hour)},
+		"malformed":     {"whsec_test", want, body, signedAt},
+	} {
+		if err := VerifyWebhookSignature(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute); err == nil {
+			t.Errorf("VerifyWebhookSignature(%s) = nil, want an error", name)
+		}
+	}
+}
+
+// webhookReceiver is a test server that answers webhook requests with the
+// given statuses in turn, then 200 OK, and checks their signatures.
+type webhookReceiver struct {
+	*httptest.Server
+	t        *testing.T
+	secret   string
+	statuses []int
+
+	mu       sync.Mutex
+	requests []*http.Request
+	events   []Event
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	r := &webhookReceiver{t: t, secret: secret, statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := VerifyWebhookSignature(r.secret, req.Header.Get(WebhookSignatureHeader), body, time.Now(), time.Minute); err != nil {
+		r.t.Errorf("webhook request signature: %v", err)
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("webhook request body %s: %v", body, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.events = append(r.events, event)
+	status := http.StatusOK
+	if len(r.requests) <= len(r.statuses) {
+		status = r.statuses[len(r.requests)-1]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) Requests() []*http.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*http.Request(nil), r.requests...)
+}
+
+// runWebhooksUntilDone runs w until no delivery in store is pending.
+func runWebhooksUntilDone(t *testing.T, w *WebhookWorker, store storage.Store) {
+	t.Helper()
+	w.pollInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pending, err := store.ListWebhookDeliveries(context.Background(), storage.WebhookDeliveryFilter{Status: storage.NotificationPending})
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries: %v", err)
+		}
+		if len(pending) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d deliveries are still pending", len(pending))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// deliveriesTo returns the deliveries to a webhook as stored, newest first.
+func deliveriesTo(t *testing.T, store storage.Store, webhook *storage.Webhook) []*storage.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.ListWebhookDeliveries(context.Background(), storage.WebhookDeliveryFilter{WebhookID: &webhook.ID})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	return deliveries
+}
+
+func TestWebhookWorkerRetries(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	receiver := newWebhookReceiver(t, "whsec_a", http.StatusServiceUnavailable, http.StatusInternalServerError)
+	webhook, err := store.CreateWebhook(ctx, receiver.URL, "whsec_a", []string{EventTicketCalled}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	w := NewWebhookWorker(store, 5, time.Millisecond)
+	n := NewNotifier(NewHub(), nil, w)
+	n.PublishEvent(ctx, EventTicketCreated, map[string]string{"id": "not subscribed"})
+	n.PublishEvent(ctx, EventTicketCalled, map[string]string{"ticket_number": "A-001"})
+
+	runWebhooksUntilDone(t, w, store)
+	deliveries := deliveriesTo(t, store, webhook)
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %+v, want only the subscribed event", deliveries)
+	}
+	if d := deliveries[0]; d.Status != storage.NotificationSent || d.Attempts != 3 || d.ResponseStatus != http.StatusOK || d.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want sent on the third attempt", d)
+	}
+
+	requests := receiver.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+	for _, req := range requests {
+		if req.Header.Get(WebhookEventHeader) != EventTicketCalled || req.Header.Get(WebhookDeliveryHeader) != deliveries[0].ID.String() ||
+			req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request headers = %v, want the event type, delivery ID and JSON content type", req.Header)
+		}
+	}
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if e := receiver.events[0]; e.Type != EventTicketCalled || e.ID != deliveries[0].EventID || receiver.events[2].ID != e.ID {
+		t.Errorf("event = %+v, want the same ticket.called event on every attempt", e)
+	}
+}
+
+func TestWebhookWorkerGivesUp(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	rejecting := newWebhookReceiver(t, "whsec_a", http.StatusBadRequest)
+	down := newWebhookReceiver(t, "whsec_b", http.StatusBadGateway, http.StatusBadGateway)
+	rejected, err := store.CreateWebhook(ctx, rejecting.URL, "whsec_a", []string{EventQueueCreated}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	exhausted, err := store.CreateWebhook(ctx, down.URL, "whsec_b", []string{EventQueueCreated}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	w := NewWebhookWorker(store, 2, time.Millisecond)
+	if err := w.Publish(ctx, EventQueueCreated, map[string]string{"name": "Front desk"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	runWebhooksUntilDone(t, w, store)
+	if d := deliveriesTo(t, store, rejected)[0]; d.Status != storage.NotificationFailed || d.Attempts != 1 || d.ResponseStatus != http.StatusBadRequest {
+		t.Errorf("delivery to a receiver rejecting it = %+v, want failed without retries", d)
+	}
+	d := deliveriesTo(t, store, exhausted)[0]
+	if d.Status != storage.NotificationFailed || d.Attempts != 2 || d.LastError == "" {
+		t.Errorf("delivery to a receiver that is down = %+v, want failed after maxAttempts", d)
+	}
+
+	// Redelivery starts over with a fresh set of attempts.
+	if _, err := store.RedeliverWebhookDelivery(ctx, d.ID, time.Now()); err != nil {
+		t.Fatalf("RedeliverWebhookDelivery: %v", err)
+	}
+	runWebhooksUntilDone(t, w, store)
+	if d := deliveriesTo(t, store, exhausted)[0]; d.Status != storage.NotificationSent || d.Attempts != 1 {
+		t.Errorf("redelivered delivery = %+v, want sent on its first new attempt", d)
+	}
+}
+
+func TestNotifierWithoutWebhooks(t *testing.T) {
+	// Without a webhook worker, events are dropped.
+	NewNotifier(NewHub(), nil, nil).PublishEvent(context.Background(), EventTicketCreated, nil)
+}
+
+func TestValidateEventTypes(t *testing.T) {
+	if err := ValidateEventTypes([]string{EventTicketCalled, EventQueueUpdated}); err != nil {
+		t.Errorf("ValidateEventTypes(known types) = %v, want nil", err)
+	}
+	for _, events := range [][]string{nil, {EventTicketCalled, "ticket.teleported"}} {
+		if err := ValidateEventTypes(events); err == nil {
+			t.Errorf("ValidateEventTypes(%v) = nil, want an error", events)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package notifier
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -42,6 +47,40 @@ type Client struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// What the client may follow with subscribe messages: queues, and the
+	// admin channel if admin is set. A customer following a ticket may not
+	// follow anything else.
+	access Access
+
+	// The topics the client follows: a single ticket, or queues and the admin
+	// channel. Only the hub's Run goroutine uses it.
+	topics map[string]bool
+}
+
+// Access is what a client of ServeWs may follow.
+type Access struct {
+	Queues bool // any queue
+	Admin  bool // the admin channel, with the queue-level events
+}
+
+// clientMessage is a message from a client, changing what it follows:
+//
+//	{"type": "subscribe", "queue_id": "<queue ID>"}
+//	{"type": "unsubscribe", "queue_id": "<queue ID>"}
+//	{"type": "subscribe", "channel": "admin"}
+type clientMessage struct {
+	Type    string `json:"type"`
+	QueueID string `json:"queue_id"`
+	Channel string `json:"channel"`
+}
+
+// subscription asks the hub to change the topics a client follows.
+type subscription struct {
+	client *Client
+	topic  string
+	follow bool   // false to stop following topic
+	err    string // why the request was refused, if it was
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -65,10 +104,49 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		// For now, we don't expect clients to send messages, but if they did,
-		// we would process them here.
-		log.Printf("Received message from client: %s", message)
+		c.hub.subscribe <- c.parseSubscription(message)
+	}
+}
+
+// parseSubscription turns a message from the client into a subscription, or
+// into a refusal with the reason when the message is invalid or asks for a
+// topic the client may not follow.
+func (c *Client) parseSubscription(message []byte) subscription {
+	s := subscription{client: c}
+	var m clientMessage
+	if err := json.Unmarshal(message, &m); err != nil {
+		s.err = "messages must be JSON"
+		return s
+	}
+	switch m.Type {
+	case "subscribe":
+		s.follow = true
+	case "unsubscribe":
+	default:
+		s.err = "type must be subscribe or unsubscribe"
+		return s
+	}
+	switch {
+	case m.Channel == AdminTopic && m.QueueID == "":
+		if !c.access.Admin {
+			s.err = "the admin channel requires an admin login or an API key with the queues:write scope"
+			return s
+		}
+		s.topic = AdminTopic
+	case m.Channel == "" && m.QueueID != "":
+		if !c.access.Queues {
+			s.err = "this connection cannot follow queues"
+			return s
+		}
+		if _, err := uuid.Parse(m.QueueID); err != nil {
+			s.err = "Invalid queue ID format"
+			return s
+		}
+		s.topic = QueueTopic(m.QueueID)
+	default:
+		s.err = "either queue_id or channel \"admin\" is required"
 	}
+	return s
 }
 
 // writePump pumps messages from the hub to the websocket connection.
@@ -92,19 +170,9 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			// Every message is a JSON document of its own, so each one goes
+			// out in its own frame.
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -116,28 +184,43 @@ func (c *Client) writePump() {
 	}
 }
 
-// Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+// topicMessage is a message for the clients following any of its topics.
+type topicMessage struct {
+	topics []string
+	data   []byte
+}
+
+// Hub maintains the set of active clients and routes messages to the clients
+// following their topics: a ticket, a queue or the admin channel.
 type Hub struct {
 	// Registered clients.
 	clients map[*Client]bool
 
-	// Inbound messages from the clients.
-	broadcast chan []byte
+	// Messages for the clients following a topic.
+	publish chan topicMessage
+
+	// Requests from the clients to follow a topic or stop following it.
+	subscribe chan subscription
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Number of clients following each topic, readable outside Run.
+	mu     sync.RWMutex
+	topics map[string]int
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
+		publish:    make(chan topicMessage),
+		subscribe:  make(chan subscription),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
+		topics:     make(map[string]int),
 	}
 }
 
@@ -146,34 +229,140 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
+			h.mu.Lock()
+			for topic := range client.topics {
+				h.topics[topic]++
+			}
+			h.mu.Unlock()
 			log.Printf("Client registered. Total clients: %d", len(h.clients))
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.remove(client)
 				log.Printf("Client unregistered. Total clients: %d", len(h.clients))
 			}
-		case message := <-h.broadcast:
+		case message := <-h.publish:
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if client.follows(message.topics) {
+					h.deliver(client, message.data)
 				}
 			}
+		case s := <-h.subscribe:
+			if _, ok := h.clients[s.client]; ok {
+				h.apply(s)
+			}
 		}
 	}
 }
 
-// ServeWs handles websocket requests from the peer.
-func ServeWs(hub *Hub, c *gin.Context) {
+// follows reports whether the client follows any of topics.
+func (c *Client) follows(topics []string) bool {
+	for _, topic := range topics {
+		if c.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
+
+// apply changes the topics of the client asking for s and answers it with
+// what it follows now, or with the reason s was refused.
+func (h *Hub) apply(s subscription) {
+	client := s.client
+	if s.err == "" {
+		h.mu.Lock()
+		switch {
+		case s.follow && !client.topics[s.topic]:
+			client.topics[s.topic] = true
+			h.topics[s.topic]++
+		case !s.follow && client.topics[s.topic]:
+			delete(client.topics, s.topic)
+			h.untrack(s.topic)
+		}
+		h.mu.Unlock()
+	}
+
+	var reply map[string]interface{}
+	if s.err != "" {
+		reply = map[string]interface{}{"type": "error", "data": map[string]string{"message": s.err}}
+	} else {
+		queueIDs := []string{}
+		for topic := range client.topics {
+			if strings.HasPrefix(topic, queueTopicPrefix) {
+				queueIDs = append(queueIDs, strings.TrimPrefix(topic, queueTopicPrefix))
+			}
+		}
+		sort.Strings(queueIDs)
+		reply = map[string]interface{}{"type": "subscriptions", "data": map[string]interface{}{
+			"queue_ids": queueIDs,
+			"admin":     client.topics[AdminTopic],
+		}}
+	}
+	message, err := json.Marshal(reply)
+	if err != nil {
+		log.Printf("Error marshalling subscription reply: %v", err)
+		return
+	}
+	h.deliver(client, message)
+}
+
+// deliver queues message for client, dropping the client if it cannot keep up.
+func (h *Hub) deliver(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		h.remove(client)
+	}
+}
+
+// remove unregisters client and closes its send channel.
+func (h *Hub) remove(client *Client) {
+	delete(h.clients, client)
+	close(client.send)
+	h.mu.Lock()
+	for topic := range client.topics {
+		h.untrack(topic)
+	}
+	h.mu.Unlock()
+}
+
+// untrack counts one client less following topic. h.mu must be held.
+func (h *Hub) untrack(topic string) {
+	if h.topics[topic]--; h.topics[topic] <= 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// HasSubscribers reports whether any client follows topic.
+func (h *Hub) HasSubscribers(topic string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.topics[topic] > 0
+}
+
+// ServeWs handles websocket requests from staff and display clients. The
+// client starts out following topics, QueueTopic or AdminTopic, and can
+// follow more, within access, with subscribe messages. It receives
+// the messages of the queues and channels it follows only.
+func ServeWs(hub *Hub, c *gin.Context, access Access, topics []string) {
+	serveWs(hub, c, access, topics)
+}
+
+// ServeTicketWs handles websocket requests from a customer following a single
+// ticket. The client only receives the updates sent with SendTicketStatus.
+func ServeTicketWs(hub *Hub, c *gin.Context, ticketID string) {
+	serveWs(hub, c, Access{}, []string{ticketTopic(ticketID)})
+}
+
+func serveWs(hub *Hub, c *gin.Context, access Access, topics []string) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), access: access, topics: make(map[string]bool, len(topics))}
+	for _, topic := range topics {
+		client.topics[topic] = true
+	}
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
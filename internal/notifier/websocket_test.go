@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/storage"
+)
+
+// newTestClient registers a client without a connection, following topics.
+func newTestClient(hub *Hub, access Access, topics ...string) *Client {
+	c := &Client{hub: hub, send: make(chan []byte, 16), access: access, topics: make(map[string]bool)}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	hub.register <- c
+	return c
+}
+
+// receive returns the type and data of the next message to c, or fails.
+func receive(t *testing.T, c *Client) (string, json.RawMessage) {
+	t.Helper()
+	select {
+	case data := <-c.send:
+		var m struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("message %s: %v", data, err)
+		}
+		return m.Type, m.Data
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return "", nil
+	}
+}
+
+// expectNothing fails if c has a message waiting.
+func expectNothing(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case data := <-c.send:
+		t.Errorf("unexpected message %s", data)
+	default:
+	}
+}
+
+func TestHubRoutesByQueue(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	n := NewNotifier(hub, nil, nil)
+
+	queueA, queueB := uuid.New(), uuid.New()
+	display := newTestClient(hub, Access{Queues: true}, QueueTopic(queueA.String()))
+	admin := newTestClient(hub, Access{Queues: true, Admin: true}, AdminTopic)
+	idle := newTestClient(hub, Access{Queues: true})
+
+	n.SendTicketUpdate(&storage.Ticket{ID: uuid.New(), QueueID: queueA})
+	n.SendTicketUpdate(&storage.Ticket{ID: uuid.New(), QueueID: queueB})
+	n.SendQueueUpdate(&storage.Queue{ID: queueB})
+	n.SendQueueUpdate(&storage.Queue{ID: queueA})
+
+	if typ, data := receive(t, display); typ != "ticket_update" || !json.Valid(data) {
+		t.Errorf("display got %s %s, want its queue's ticket_update", typ, data)
+	}
+	if typ, _ := receive(t, display); typ != "queue_update" {
+		t.Errorf("display got %s, want its queue's queue_update", typ)
+	}
+	for i := 0; i < 2; i++ {
+		if typ, _ := receive(t, admin); typ != "queue_update" {
+			t.Errorf("admin channel got %s, want only queue_update", typ)
+		}
+	}
+	expectNothing(t, display)
+	expectNothing(t, admin)
+	expectNothing(t, idle)
+
+	// Following another queue, then leaving it.
+	hub.subscribe <- display.parseSubscription([]byte(`{"type":"subscribe","queue_id":"` + queueB.String() + `"}`))
+	if typ, data := receive(t, display); typ != "subscriptions" {
+		t.Fatalf("reply to subscribe = %s %s, want subscriptions", typ, data)
+	}
+	n.SendPeopleAhead(queueB.String(), map[string]int{"t": 1})
+	if typ, _ := receive(t, display); typ != "people_ahead" {
+		t.Errorf("display got %s, want queue B's people_ahead", typ)
+	}
+	hub.subscribe <- display.parseSubscription([]byte(`{"type":"unsubscribe","queue_id":"` + queueB.String() + `"}`))
+	_, data := receive(t, display)
+	var subs struct {
+		QueueIDs []string `json:"queue_ids"`
+		Admin    bool     `json:"admin"`
+	}
+	if err := json.Unmarshal(data, &subs); err != nil || len(subs.QueueIDs) != 1 || subs.QueueIDs[0] != queueA.String() || subs.Admin {
+		t.Errorf("subscriptions after unsubscribing = %s, want queue A only", data)
+	}
+	n.SendPeopleAhead(queueB.String(), map[string]int{"t": 0})
+	expectNothing(t, display)
+}
+
+func TestClientSubscriptionChecks(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	display := newTestClient(hub, Access{Queues: true})
+	customer := newTestClient(hub, Access{}, ticketTopic(uuid.NewString()))
+
+	for name, tt := range map[string]struct {
+		client  *Client
+		message string
+	}{
+		"admin channel without access": {display, `{"type":"subscribe","channel":"admin"}`},
+		"queue from a ticket page":     {customer, `{"type":"subscribe","queue_id":"` + uuid.NewString() + `"}`},
+		"invalid queue ID":             {display, `{"type":"subscribe","queue_id":"front-desk"}`},
+		"unknown type":                 {display, `{"type":"follow","queue_id":"` + uuid.NewString() + `"}`},
+		"not JSON":                     {display, `subscribe`},
+	} {
+		s := tt.client.parseSubscription([]byte(tt.message))
+		if s.err == "" {
+			t.Errorf("%s: subscription accepted, want it refused", name)
+			continue
+		}
+		hub.subscribe <- s
+		if typ, _ := receive(t, tt.client); typ != "error" {
+			t.Errorf("%s: reply = %s, want error", name, typ)
+		}
+	}
+	if len(display.topics) != 0 || len(customer.topics) != 1 {
+		// Read after the hub handled the requests above, which received
+		// their replies.
+		t.Errorf("topics = %v and %v, want refused subscriptions to change nothing", display.topics, customer.topics)
+	}
+	if hub.HasSubscribers(AdminTopic) {
+		t.Error("HasSubscribers(admin) = true, want false")
+	}
+}
@@ -1,2 +1,150 @@
 // Package queue contains the core logic for managing the queue.
 package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reset policies decide when a queue's ticket numbers start over.
+const (
+	ResetDaily  = "daily"
+	ResetWeekly = "weekly"
+	ResetNever  = "never"
+)
+
+// Defaults for queues created without an explicit ticket format.
+const (
+	DefaultPrefix      = "A"
+	DefaultWidth       = 3
+	DefaultStartNumber = 1
+	DefaultResetPolicy = ResetDaily
+)
+
+const (
+	maxPrefixLength = 5
+	maxWidth        = 8
+)
+
+// TicketFormat describes how a queue numbers its tickets, e.g. prefix "S" and
+// width 3 issue "S-001", "S-002", ...
+type TicketFormat struct {
+	Prefix      string `json:"ticket_prefix"`
+	Width       int    `json:"ticket_number_width"`
+	StartNumber int    `json:"ticket_start_number"`
+	ResetPolicy string `json:"ticket_reset_policy"`
+}
+
+// DefaultTicketFormat returns the format used by queues that do not set one:
+// "A-001", restarting every day.
+func DefaultTicketFormat() TicketFormat {
+	return TicketFormat{
+		Prefix:      DefaultPrefix,
+		Width:       DefaultWidth,
+		StartNumber: DefaultStartNumber,
+		ResetPolicy: DefaultResetPolicy,
+	}
+}
+
+// WithDefaults fills the zero-valued fields of f from DefaultTicketFormat.
+func (f TicketFormat) WithDefaults() TicketFormat {
+	if f.Prefix == "" {
+		f.Prefix = DefaultPrefix
+	}
+	if f.Width == 0 {
+		f.Width = DefaultWidth
+	}
+	if f.StartNumber == 0 {
+		f.StartNumber = DefaultStartNumber
+	}
+	if f.ResetPolicy == "" {
+		f.ResetPolicy = DefaultResetPolicy
+	}
+	return f
+}
+
+// Validate reports whether f is a usable ticket format.
+func (f TicketFormat) Validate() error {
+	if len(f.Prefix) == 0 || len(f.Prefix) > maxPrefixLength {
+		return fmt.Errorf("ticket prefix must be 1 to %d letters", maxPrefixLength)
+	}
+	for _, r := range f.Prefix {
+		if r < 'A' || r > 'Z' {
+			return errors.New("ticket prefix must contain only uppercase letters A-Z")
+		}
+	}
+	if f.Width < 1 || f.Width > maxWidth {
+		return fmt.Errorf("ticket number width must be between 1 and %d", maxWidth)
+	}
+	if f.StartNumber < 1 {
+		return errors.New("ticket start number must be at least 1")
+	}
+	switch f.ResetPolicy {
+	case ResetDaily, ResetWeekly, ResetNever:
+	default:
+		return fmt.Errorf("ticket reset policy must be one of %q, %q or %q", ResetDaily, ResetWeekly, ResetNever)
+	}
+	return nil
+}
+
+// Format renders a ticket number, e.g. Format(7) is "S-007" for prefix "S"
+// and width 3. Numbers wider than Width are not truncated.
+func (f TicketFormat) Format(number int) string {
+	return fmt.Sprintf("%s-%0*d", f.Prefix, f.Width, number)
+}
+
+// Period returns the numbering period that t falls in. Ticket numbers restart
+// at StartNumber whenever the period changes. Periods are computed in UTC.
+func (f TicketFormat) Period(t time.Time) string {
+	t = t.UTC()
+	switch f.ResetPolicy {
+	case ResetWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case ResetNever:
+		return ""
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// Limits on a queue's notification thresholds.
+const (
+	maxNotifyThresholds = 5
+	maxNotifyThreshold  = 50
+)
+
+// ValidateNotifyThresholds reports whether thresholds is a usable list of
+// notification thresholds: numbers of people ahead at which a waiting
+// customer gets a text, e.g. [3, 0] for "3 people ahead" and "you're next".
+func ValidateNotifyThresholds(thresholds []int) error {
+	if len(thresholds) > maxNotifyThresholds {
+		return fmt.Errorf("at most %d notification thresholds are allowed", maxNotifyThresholds)
+	}
+	seen := make(map[int]bool, len(thresholds))
+	for _, threshold := range thresholds {
+		if threshold < 0 || threshold > maxNotifyThreshold {
+			return fmt.Errorf("notification thresholds must be between 0 and %d", maxNotifyThreshold)
+		}
+		if seen[threshold] {
+			return fmt.Errorf("duplicate notification threshold %d", threshold)
+		}
+		seen[threshold] = true
+	}
+	return nil
+}
+
+// ReachedNotifyThreshold returns the threshold a waiting ticket with ahead
+// people ahead of it has reached: the smallest of thresholds that is at least
+// ahead. A ticket that moves up several places at once thus gets one text for
+// the nearest threshold rather than one for each threshold it passed. ok is
+// false if the ticket has reached none.
+func ReachedNotifyThreshold(thresholds []int, ahead int) (threshold int, ok bool) {
+	for _, t := range thresholds {
+		if t >= ahead && (!ok || t < threshold) {
+			threshold, ok = t, true
+		}
+	}
+	return threshold, ok
+}
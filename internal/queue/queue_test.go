@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTicketFormatFormat(t *testing.T) {
+	tests := []struct {
+		format TicketFormat
+		number int
+		want   string
+	}{
+		{DefaultTicketFormat(), 7, "A-007"},
+		{TicketFormat{Prefix: "S", Width: 3}, 42, "S-042"},
+		{TicketFormat{Prefix: "WI", Width: 2}, 5, "WI-05"},
+		{TicketFormat{Prefix: "A", Width: 3}, 1000, "A-1000"},
+	}
+	for _, tt := range tests {
+		if got := tt.format.Format(tt.number); got != tt.want {
+			t.Errorf("%+v.Format(%d) = %q, want %q", tt.format, tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestTicketFormatPeriod(t *testing.T) {
+	monday := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+	sunday := time.Date(2024, time.March, 10, 23, 0, 0, 0, time.UTC)
+	nextMonday := time.Date(2024, time.March, 11, 0, 30, 0, 0, time.UTC)
+
+	daily := TicketFormat{ResetPolicy: ResetDaily}
+	if daily.Period(monday) == daily.Period(monday.Add(24*time.Hour)) {
+		t.Error("daily period should change from one day to the next")
+	}
+
+	weekly := TicketFormat{ResetPolicy: ResetWeekly}
+	if weekly.Period(monday) != weekly.Period(sunday) {
+		t.Errorf("weekly period differs within a week: %q vs %q", weekly.Period(monday), weekly.Period(sunday))
+	}
+	if weekly.Period(sunday) == weekly.Period(nextMonday) {
+		t.Error("weekly period should change on Monday")
+	}
+
+	never := TicketFormat{ResetPolicy: ResetNever}
+	if never.Period(monday) != never.Period(nextMonday.AddDate(1, 0, 0)) {
+		t.Error("never period should not change")
+	}
+}
+
+func TestTicketFormatValidate(t *testing.T) {
+	valid := []TicketFormat{
+		DefaultTicketFormat(),
+		{Prefix: "WALK", Width: 4, StartNumber: 100, ResetPolicy: ResetNever},
+		TicketFormat{Prefix: "S"}.WithDefaults(),
+	}
+	for _, f := range valid {
+		if err := f.Validate(); err != nil {
+			t.Errorf("%+v.Validate() = %v, want nil", f, err)
+		}
+	}
+
+	invalid := []TicketFormat{
+		{Prefix: "", Width: 3, StartNumber: 1, ResetPolicy: ResetDaily},
+		{Prefix: "s", Width: 3, StartNumber: 1, ResetPolicy: ResetDaily},
+		{Prefix: "TOOLONG", Width: 3, StartNumber: 1, ResetPolicy: ResetDaily},
+		{Prefix: "A", Width: 0, StartNumber: 1, ResetPolicy: ResetDaily},
+		{Prefix: "A", Width: 3, StartNumber: 0, ResetPolicy: ResetDaily},
+		{Prefix: "A", Width: 3, StartNumber: 1, ResetPolicy: "monthly"},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("%+v.Validate() = nil, want an error", f)
+		}
+	}
+}
+
+func TestValidateNotifyThresholds(t *testing.T) {
+	for _, thresholds := range [][]int{nil, {0}, {3, 0}, {10, 5, 2, 1, 0}} {
+		if err := ValidateNotifyThresholds(thresholds); err != nil {
+			t.Errorf("ValidateNotifyThresholds(%v) = %v, want nil", thresholds, err)
+		}
+	}
+	for _, thresholds := range [][]int{{-1}, {51}, {3, 3}, {6, 5, 4, 3, 2, 1}} {
+		if err := ValidateNotifyThresholds(thresholds); err == nil {
+			t.Errorf("ValidateNotifyThresholds(%v) = nil, want an error", thresholds)
+		}
+	}
+}
+
+func TestReachedNotifyThreshold(t *testing.T) {
+	thresholds := []int{0, 3}
+	tests := []struct {
+		ahead     int
+		threshold int
+		ok        bool
+	}{
+		{ahead: 5, ok: false},
+		{ahead: 4, ok: false},
+		{ahead: 3, threshold: 3, ok: true},
+		{ahead: 1, threshold: 3, ok: true},
+		{ahead: 0, threshold: 0, ok: true},
+	}
+	for _, tt := range tests {
+		threshold, ok := ReachedNotifyThreshold(thresholds, tt.ahead)
+		if threshold != tt.threshold || ok != tt.ok {
+			t.Errorf("ReachedNotifyThreshold(%v, %d) = %d, %v; want %d, %v", thresholds, tt.ahead, threshold, ok, tt.threshold, tt.ok)
+		}
+	}
+	if _, ok := ReachedNotifyThreshold(nil, 0); ok {
+		t.Error("ReachedNotifyThreshold without thresholds reported a threshold")
+	}
+}
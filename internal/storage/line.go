@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// PeopleAhead returns, for every waiting ticket among tickets, how many other
+// waiting tickets will be called before it. tickets should be all the tickets
+// of one queue, in any order.
+//
+// Tickets are called in order of priority, then position, then check-in time,
+// skipping tickets deferred until later, like CallNextTicket does. So a ticket
+// held until later has everyone ahead of it who can be called before its hold
+// ends, and is not ahead of anyone until then.
+func PeopleAhead(tickets []*Ticket, now time.Time) map[uuid.UUID]int {
+	var waiting []*Ticket
+	for _, t := range tickets {
+		if t.Status == ticket.StatusWaiting {
+			waiting = append(waiting, t)
+		}
+	}
+	sort.SliceStable(waiting, func(i, j int) bool {
+		a, b := callableAt(waiting[i], now), callableAt(waiting[j], now)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return callsBefore(waiting[i], waiting[j])
+	})
+
+	ahead := make(map[uuid.UUID]int, len(waiting))
+	for i, t := range waiting {
+		ahead[t.ID] = i
+	}
+	return ahead
+}
+
+// SetPeopleAhead fills in the PeopleAhead field of every waiting ticket among
+// tickets, which should be all the active tickets of one queue, as returned by
+// GetActiveTicketsByQueueID. Other tickets get none.
+func SetPeopleAhead(tickets []*Ticket, now time.Time) {
+	ahead := PeopleAhead(tickets, now)
+	for _, t := range tickets {
+		t.PeopleAhead = nil
+		if n, ok := ahead[t.ID]; ok {
+			n := n
+			t.PeopleAhead = &n
+		}
+	}
+}
+
+// callsBefore reports whether a comes before b in call order.
+func callsBefore(a, b *Ticket) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// callableAt returns the earliest time from now on at which t may be called.
+func callableAt(t *Ticket, now time.Time) time.Time {
+	if t.DeferredUntil != nil && t.DeferredUntil.After(now) {
+		return *t.DeferredUntil
+	}
+	return now
+}
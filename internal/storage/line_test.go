@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPeopleAhead(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	in := func(d time.Duration) *time.Time {
+		at := now.Add(d)
+		return &at
+	}
+	newTicket := func(status string, priority, position int, deferredUntil *time.Time) *Ticket {
+		return &Ticket{
+			ID:            uuid.New(),
+			Status:        status,
+			Priority:      priority,
+			Position:      position,
+			DeferredUntil: deferredUntil,
+			CreatedAt:     now.Add(time.Duration(position) * time.Second),
+		}
+	}
+
+	served := newTicket("served", 0, 1, nil)
+	first := newTicket("waiting", 0, 2, nil)
+	serving := newTicket("serving", 0, 3, nil)
+	second := newTicket("waiting", 0, 4, in(-time.Minute)) // hold already over
+	held := newTicket("waiting", 0, 5, in(15*time.Minute))
+	last := newTicket("waiting", 0, 6, nil)
+	heldLonger := newTicket("waiting", 0, 7, in(30*time.Minute))
+	urgent := newTicket("waiting", 5, 8, nil)
+	cancelled := newTicket("cancelled", 9, 9, nil)
+
+	tickets := []*Ticket{last, served, heldLonger, first, cancelled, urgent, second, serving, held}
+	got := PeopleAhead(tickets, now)
+
+	want := map[*Ticket]int{
+		urgent:     0,
+		first:      1,
+		second:     2,
+		last:       3, // the held ticket is not ahead of it
+		held:       4, // everyone not held is called before its hold ends
+		heldLonger: 5,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got people ahead for %d tickets, want %d waiting tickets", len(got), len(want))
+	}
+	for ticket, n := range want {
+		if got[ticket.ID] != n {
+			t.Errorf("ticket at position %d: people ahead = %d, want %d", ticket.Position, got[ticket.ID], n)
+		}
+	}
+
+	SetPeopleAhead(tickets, now)
+	if first.PeopleAhead == nil || *first.PeopleAhead != 1 {
+		t.Errorf("SetPeopleAhead: first.PeopleAhead = %v, want 1", first.PeopleAhead)
+	}
+	if serving.PeopleAhead != nil || served.PeopleAhead != nil {
+		t.Error("SetPeopleAhead set people ahead on a ticket that is not waiting")
+	}
+}
@@ -0,0 +1,1434 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// MemoryStore is a thread-safe, in-memory Store. It mirrors PostgresDB's
+// semantics and is intended for demos and tests; nothing is persisted.
+type MemoryStore struct {
+	mu            sync.Mutex
+	queues        map[uuid.UUID]*Queue
+	tickets       map[uuid.UUID]*Ticket
+	counters      map[uuid.UUID]*Counter
+	queueCounters map[uuid.UUID]*queueCounter
+	history       []*TicketHistory
+	notifications []*Notification
+	templates     []*MessageTemplate
+	webhooks      []*Webhook
+	deliveries    []*WebhookDelivery
+	outbox        []*OutboxEvent // in seq order
+	outboxSeq     int64
+	ticketTokens  map[string]uuid.UUID // access token hash to ticket ID
+	users         map[uuid.UUID]*User
+	apiKeys       map[uuid.UUID]*APIKey
+}
+
+// queueCounter mirrors a queue_counters row: the last issued ticket number,
+// the numbering period it belongs to and the last assigned position.
+type queueCounter struct {
+	lastNumber   int
+	lastPosition int
+	numberPeriod string
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		queues:        make(map[uuid.UUID]*Queue),
+		tickets:       make(map[uuid.UUID]*Ticket),
+		counters:      make(map[uuid.UUID]*Counter),
+		queueCounters: make(map[uuid.UUID]*queueCounter),
+		ticketTokens:  make(map[string]uuid.UUID),
+		users:         make(map[uuid.UUID]*User),
+		apiKeys:       make(map[uuid.UUID]*APIKey),
+	}
+}
+
+// CreateQueue adds a new queue. Zero-valued fields of format are filled with
+// the queue package defaults; notifyThresholds may be empty.
+func (m *MemoryStore) CreateQueue(ctx context.Context, name string, format queue.TicketFormat, notifyThresholds []int) (*Queue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := &Queue{
+		ID:               uuid.New(),
+		Name:             name,
+		TicketFormat:     format.WithDefaults(),
+		NotifyThresholds: append([]int{}, notifyThresholds...),
+		CreatedAt:        time.Now(),
+	}
+	m.queues[queue.ID] = queue
+
+	copied := *queue
+	return &copied, nil
+}
+
+// GetQueueByID retrieves a queue by its ID.
+func (m *MemoryStore) GetQueueByID(ctx context.Context, id uuid.UUID) (*Queue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue, ok := m.queues[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, id.String())
+	}
+
+	copied := *queue
+	return &copied, nil
+}
+
+// SetQueueNotifyThresholds replaces the numbers of people ahead at which the
+// queue's waiting customers get a text.
+func (m *MemoryStore) SetQueueNotifyThresholds(ctx context.Context, queueID uuid.UUID, thresholds []int) (*Queue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue, ok := m.queues[queueID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	queue.NotifyThresholds = append([]int{}, thresholds...)
+
+	copied := *queue
+	return &copied, nil
+}
+
+// GetQueues retrieves all queues, newest first.
+func (m *MemoryStore) GetQueues(ctx context.Context) ([]*Queue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var queues []*Queue
+	for _, queue := range m.queues {
+		copied := *queue
+		queues = append(queues, &copied)
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].CreatedAt.After(queues[j].CreatedAt)
+	})
+	return queues, nil
+}
+
+// GetTicketByID retrieves a ticket by its ID.
+func (m *MemoryStore) GetTicketByID(ctx context.Context, id uuid.UUID) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, ok := m.tickets[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, id.String())
+	}
+	return m.copyTicket(ticket), nil
+}
+
+// GetTicketByAccessTokenHash retrieves the ticket with the given access token hash.
+func (m *MemoryStore) GetTicketByAccessTokenHash(ctx context.Context, accessTokenHash string) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.ticketTokens[accessTokenHash]
+	if !ok {
+		return nil, fmt.Errorf("%w: by access token", ErrTicketNotFound)
+	}
+	return m.copyTicket(m.tickets[id]), nil
+}
+
+// GetActiveTicketByPhone retrieves the most recently created waiting or
+// serving ticket with the given customer phone.
+func (m *MemoryStore) GetActiveTicketByPhone(ctx context.Context, phone string) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found *Ticket
+	for _, t := range m.tickets {
+		if phone == "" || t.CustomerPhone != phone || !ticket.IsActive(t.Status) {
+			continue
+		}
+		if found == nil || t.CreatedAt.After(found.CreatedAt) {
+			found = t
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: by phone number", ErrTicketNotFound)
+	}
+	return m.copyTicket(found), nil
+}
+
+// GetTicketsByQueueID retrieves all tickets for a queue, ordered by priority
+// (higher first), then position, then creation time.
+func (m *MemoryStore) GetTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error) {
+	return m.ticketsByQueue(queueID, false), nil
+}
+
+// GetActiveTicketsByQueueID retrieves the waiting and serving tickets of a
+// queue, in the same order as GetTicketsByQueueID.
+func (m *MemoryStore) GetActiveTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error) {
+	return m.ticketsByQueue(queueID, true), nil
+}
+
+// ticketsByQueue returns copies of the tickets of a queue, only the waiting
+// and serving ones if activeOnly, in call order.
+func (m *MemoryStore) ticketsByQueue(queueID uuid.UUID, activeOnly bool) []*Ticket {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tickets []*Ticket
+	for _, t := range m.tickets {
+		if t.QueueID == queueID && (!activeOnly || ticket.IsActive(t.Status)) {
+			tickets = append(tickets, m.copyTicket(t))
+		}
+	}
+	sort.Slice(tickets, func(i, j int) bool {
+		a, b := tickets[i], tickets[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return tickets
+}
+
+// CreateTicket adds a new waiting ticket to a queue. Ticket numbers follow the
+// queue's TicketFormat; positions keep increasing for the lifetime of the queue.
+func (m *MemoryStore) CreateTicket(ctx context.Context, queueID uuid.UUID, customerName, customerPhone, locale string, priority int, accessTokenHash string, audit Audit) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.queues[queueID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+
+	now := time.Now()
+	counter, ok := m.queueCounters[queueID]
+	if !ok {
+		counter = &queueCounter{}
+		m.queueCounters[queueID] = counter
+	}
+	if period := q.Period(now); !ok || counter.numberPeriod != period {
+		counter.lastNumber = q.StartNumber
+		counter.numberPeriod = period
+	} else {
+		counter.lastNumber++
+	}
+	counter.lastPosition++
+
+	ticket := &Ticket{
+		ID:            uuid.New(),
+		QueueID:       queueID,
+		CustomerName:  customerName,
+		CustomerPhone: customerPhone,
+		TicketNumber:  q.Format(counter.lastNumber),
+		Status:        "waiting",
+		Position:      counter.lastPosition,
+		Priority:      priority,
+		Locale:        locale,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.tickets[ticket.ID] = ticket
+	if accessTokenHash != "" {
+		m.ticketTokens[accessTokenHash] = ticket.ID
+	}
+	m.logTicketStatusChange(ticket, now, audit)
+	if err := m.writeTicketEvent(ticket, ticket.Status, now, audit); err != nil {
+		return nil, err
+	}
+
+	return m.copyTicket(ticket), nil
+}
+
+// UpdateTicketStatus moves a ticket to a new status, optionally assigning it to
+// a counter, and records the change. It returns an error wrapping
+// ErrInvalidTransition if the ticket state machine forbids the move.
+func (m *MemoryStore) UpdateTicketStatus(ctx context.Context, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+	if err := checkTransition(ticket.Status, status); err != nil {
+		return nil, err
+	}
+	if err := m.checkCounterInQueue(counterID, ticket.QueueID); err != nil {
+		return nil, err
+	}
+
+	if err := m.setTicketStatus(ticket, status, counterID, audit); err != nil {
+		return nil, err
+	}
+	return m.copyTicket(ticket), nil
+}
+
+// CallNextTicket moves the highest-priority, earliest waiting ticket of a queue
+// to serving, optionally at the given counter. It returns an error wrapping ErrNoWaitingTickets when nobody is
+// waiting.
+func (m *MemoryStore) CallNextTicket(ctx context.Context, queueID uuid.UUID, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.queues[queueID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	if err := m.checkCounterInQueue(counterID, queueID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var next *Ticket
+	for _, t := range m.tickets {
+		if t.QueueID != queueID || t.Status != "waiting" || (t.DeferredUntil != nil && t.DeferredUntil.After(now)) {
+			continue
+		}
+		if next == nil || t.Priority > next.Priority ||
+			(t.Priority == next.Priority && (t.Position < next.Position ||
+				(t.Position == next.Position && t.CreatedAt.Before(next.CreatedAt)))) {
+			next = t
+		}
+	}
+	if next == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoWaitingTickets, queueID.String())
+	}
+
+	if err := m.setTicketStatus(next, "serving", counterID, audit); err != nil {
+		return nil, err
+	}
+	return m.copyTicket(next), nil
+}
+
+// DeferTicket lets a waiting ticket go behind the next places waiting tickets
+// of the same priority and/or keeps it from being called before until, like
+// PostgresDB does.
+func (m *MemoryStore) DeferTicket(ctx context.Context, ticketID uuid.UUID, places int, until *time.Time, audit Audit) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tickets[ticketID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+	if t.Status != ticket.StatusWaiting {
+		return nil, fmt.Errorf("%w: only waiting tickets can be deferred, ticket is %s", ErrInvalidTransition, t.Status)
+	}
+
+	if places > 0 {
+		var behind []*Ticket
+		for _, other := range m.tickets {
+			if other.QueueID == t.QueueID && other.Status == ticket.StatusWaiting && other.Priority == t.Priority &&
+				(other.Position > t.Position || (other.Position == t.Position && other.CreatedAt.After(t.CreatedAt))) {
+				behind = append(behind, other)
+			}
+		}
+		sort.Slice(behind, func(i, j int) bool {
+			if behind[i].Position != behind[j].Position {
+				return behind[i].Position < behind[j].Position
+			}
+			return behind[i].CreatedAt.Before(behind[j].CreatedAt)
+		})
+		if len(behind) > places {
+			behind = behind[:places]
+		}
+		previous := t.Position
+		for _, other := range behind {
+			other.Position, previous = previous, other.Position
+		}
+		t.Position = previous
+	}
+	if until != nil {
+		deferredUntil := *until
+		t.DeferredUntil = &deferredUntil
+	}
+
+	now := time.Now()
+	t.UpdatedAt = now
+	m.logTicketHistory(t, ticket.StatusDeferred, now, audit)
+	if err := m.writeTicketEvent(t, ticket.StatusDeferred, now, audit); err != nil {
+		return nil, err
+	}
+	return m.copyTicket(t), nil
+}
+
+// setTicketStatus updates a ticket's status and counter and records the
+// change. The caller must hold m.mu and have validated the transition.
+func (m *MemoryStore) setTicketStatus(ticket *Ticket, status string, counterID *uuid.UUID, audit Audit) error {
+	now := time.Now()
+	ticket.Status = status
+	if counterID != nil {
+		id := *counterID
+		ticket.CounterID = &id
+	}
+	ticket.UpdatedAt = now
+	m.logTicketStatusChange(ticket, now, audit)
+	return m.writeTicketEvent(ticket, status, now, audit)
+}
+
+// writeTicketEvent appends the outbox event of a ticket action that recorded
+// status in the ticket's history. The caller must hold m.mu.
+func (m *MemoryStore) writeTicketEvent(ticket *Ticket, status string, at time.Time, audit Audit) error {
+	e, err := newTicketEvent(m.copyTicket(ticket), status, audit, at)
+	if err != nil {
+		return err
+	}
+	m.outboxSeq++
+	e.Seq = m.outboxSeq
+	m.outbox = append(m.outbox, e)
+	return nil
+}
+
+// checkCounterInQueue verifies that counterID, if set, names a counter of the
+// given queue. The caller must hold m.mu.
+func (m *MemoryStore) checkCounterInQueue(counterID *uuid.UUID, queueID uuid.UUID) error {
+	if counterID == nil {
+		return nil
+	}
+	counter, ok := m.counters[*counterID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCounterNotFound, counterID.String())
+	}
+	if counter.QueueID != queueID {
+		return fmt.Errorf("%w: %s", ErrCounterNotInQueue, counterID.String())
+	}
+	return nil
+}
+
+// copyTicket returns a copy of ticket with its counter name filled in. The
+// caller must hold m.mu.
+func (m *MemoryStore) copyTicket(ticket *Ticket) *Ticket {
+	copied := *ticket
+	copied.CounterName = nil
+	if ticket.CounterID != nil {
+		if counter, ok := m.counters[*ticket.CounterID]; ok {
+			name := counter.Name
+			copied.CounterName = &name
+		}
+	}
+	return &copied
+}
+
+// logTicketStatusChange appends a ticket_history entry for the ticket's current
+// status and counter. The caller must hold m.mu.
+func (m *MemoryStore) logTicketStatusChange(ticket *Ticket, at time.Time, audit Audit) {
+	m.logTicketHistory(ticket, ticket.Status, at, audit)
+}
+
+// logTicketHistory appends a ticket_history entry with the given status and
+// the ticket's counter. The caller must hold m.mu.
+func (m *MemoryStore) logTicketHistory(ticket *Ticket, status string, at time.Time, audit Audit) {
+	m.history = append(m.history, &TicketHistory{
+		ID:        uuid.New(),
+		TicketID:  ticket.ID,
+		Status:    status,
+		CounterID: ticket.CounterID,
+		Audit:     audit.withDefaults(),
+		Timestamp: at,
+		CreatedAt: at,
+	})
+}
+
+// LogTicketEvent records a ticket_history entry with the given status and the
+// ticket's counter, without changing the ticket.
+func (m *MemoryStore) LogTicketEvent(ctx context.Context, ticketID uuid.UUID, status string, audit Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tickets[ticketID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+	m.logTicketHistory(t, status, time.Now(), audit)
+	return nil
+}
+
+// GetAuditTrail retrieves the ticket_history entries matching filter, newest first.
+func (m *MemoryStore) GetAuditTrail(ctx context.Context, filter AuditFilter) ([]*TicketHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []*TicketHistory
+	for _, h := range m.history {
+		switch {
+		case filter.TicketID != nil && h.TicketID != *filter.TicketID,
+			filter.ActorType != "" && h.ActorType != filter.ActorType,
+			filter.ActorID != nil && (h.ActorID == nil || *h.ActorID != *filter.ActorID),
+			filter.From != nil && h.Timestamp.Before(*filter.From),
+			filter.To != nil && !h.Timestamp.Before(*filter.To):
+			continue
+		}
+		copied := *h
+		if ticket, ok := m.tickets[h.TicketID]; ok {
+			copied.QueueID = ticket.QueueID
+			copied.TicketNumber = ticket.TicketNumber
+		}
+		entries = append(entries, &copied)
+	}
+	// History is appended in order, so reversing it puts the newest first
+	// without reordering entries that share a timestamp.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.After(entries[j].Timestamp) })
+	if limit := filter.limit(); len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// GetTicketHistory retrieves a ticket's status changes, oldest first.
+func (m *MemoryStore) GetTicketHistory(ctx context.Context, ticketID uuid.UUID) ([]*TicketHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+
+	var entries []*TicketHistory
+	for _, h := range m.history {
+		if h.TicketID != ticketID {
+			continue
+		}
+		copied := *h
+		copied.QueueID = ticket.QueueID
+		copied.TicketNumber = ticket.TicketNumber
+		entries = append(entries, &copied)
+	}
+	// History is appended in order; the stable sort only matters for entries
+	// whose timestamps were set out of order.
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	return entries, nil
+}
+
+// CalculateEstimatedWaitTime averages the time the last 10 served tickets of a
+// queue spent between 'waiting' and 'served', like PostgresDB does.
+func (m *MemoryStore) CalculateEstimatedWaitTime(ctx context.Context, queueID uuid.UUID) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	waitingAt := make(map[uuid.UUID]time.Time)
+	type servedEntry struct {
+		ticketID uuid.UUID
+		at       time.Time
+	}
+	var served []servedEntry
+	for _, h := range m.history {
+		ticket := m.tickets[h.TicketID]
+		if ticket == nil || ticket.QueueID != queueID || ticket.Status != "served" {
+			continue
+		}
+		switch h.Status {
+		case "waiting":
+			waitingAt[h.TicketID] = h.Timestamp
+		case "served":
+			served = append(served, servedEntry{ticketID: h.TicketID, at: h.Timestamp})
+		}
+	}
+	sort.Slice(served, func(i, j int) bool { return served[i].at.After(served[j].at) })
+
+	var totalDurationSeconds float64
+	var count int
+	for _, s := range served {
+		if count == 10 {
+			break
+		}
+		start, ok := waitingAt[s.ticketID]
+		if !ok {
+			continue
+		}
+		totalDurationSeconds += s.at.Sub(start).Seconds()
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil // No historical data, so 0 wait time
+	}
+
+	averageDurationSeconds := totalDurationSeconds / float64(count)
+	return time.Duration(averageDurationSeconds) * time.Second, nil
+}
+
+// CreateCounter adds a counter to a queue. Counter names are unique per queue.
+func (m *MemoryStore) CreateCounter(ctx context.Context, queueID uuid.UUID, name string) (*Counter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.queues[queueID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	if m.counterNameTaken(queueID, name, uuid.Nil) {
+		return nil, fmt.Errorf("%w: %q", ErrCounterExists, name)
+	}
+
+	now := time.Now()
+	counter := &Counter{
+		ID:        uuid.New(),
+		QueueID:   queueID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.counters[counter.ID] = counter
+
+	copied := *counter
+	return &copied, nil
+}
+
+// GetCounterByID retrieves a counter by its ID.
+func (m *MemoryStore) GetCounterByID(ctx context.Context, id uuid.UUID) (*Counter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter, ok := m.counters[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+	}
+
+	copied := *counter
+	return &copied, nil
+}
+
+// GetCountersByQueueID retrieves all counters of a queue, ordered by name.
+func (m *MemoryStore) GetCountersByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Counter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var counters []*Counter
+	for _, counter := range m.counters {
+		if counter.QueueID == queueID {
+			copied := *counter
+			counters = append(counters, &copied)
+		}
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Name < counters[j].Name })
+	return counters, nil
+}
+
+// UpdateCounter renames a counter.
+func (m *MemoryStore) UpdateCounter(ctx context.Context, id uuid.UUID, name string) (*Counter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter, ok := m.counters[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+	}
+	if m.counterNameTaken(counter.QueueID, name, id) {
+		return nil, fmt.Errorf("%w: %q", ErrCounterExists, name)
+	}
+	counter.Name = name
+	counter.UpdatedAt = time.Now()
+
+	copied := *counter
+	return &copied, nil
+}
+
+// DeleteCounter removes a counter. Tickets and history entries that referred to
+// it keep their data but lose the counter reference.
+func (m *MemoryStore) DeleteCounter(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.counters[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+	}
+	delete(m.counters, id)
+
+	for _, ticket := range m.tickets {
+		if ticket.CounterID != nil && *ticket.CounterID == id {
+			ticket.CounterID = nil
+		}
+	}
+	for _, h := range m.history {
+		if h.CounterID != nil && *h.CounterID == id {
+			h.CounterID = nil
+		}
+	}
+	return nil
+}
+
+// counterNameTaken reports whether another counter of the queue, other than
+// except, already uses name. The caller must hold m.mu.
+func (m *MemoryStore) counterNameTaken(queueID uuid.UUID, name string, except uuid.UUID) bool {
+	for _, counter := range m.counters {
+		if counter.QueueID == queueID && counter.Name == name && counter.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateUser adds a staff account. Usernames are unique.
+func (m *MemoryStore) CreateUser(ctx context.Context, username, passwordHash, role string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Username == username {
+			return nil, fmt.Errorf("%w: %q", ErrUserExists, username)
+		}
+	}
+
+	now := time.Now()
+	user := &User{
+		ID:           uuid.New(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.users[user.ID] = user
+
+	copied := *user
+	return &copied, nil
+}
+
+// GetUserByID retrieves a staff account by its ID.
+func (m *MemoryStore) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id.String())
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+// GetUserByUsername retrieves a staff account by its username.
+func (m *MemoryStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUserNotFound, username)
+}
+
+// GetUsers retrieves all staff accounts, ordered by username.
+func (m *MemoryStore) GetUsers(ctx context.Context) ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []*User
+	for _, user := range m.users {
+		copied := *user
+		users = append(users, &copied)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// DeleteUser removes a staff account.
+func (m *MemoryStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, id.String())
+	}
+	delete(m.users, id)
+	return nil
+}
+
+// CreateAPIKey stores a new API key. Only the key's hash and display prefix
+// are kept.
+func (m *MemoryStore) CreateAPIKey(ctx context.Context, name, keyPrefix, keyHash string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := &APIKey{
+		ID:        uuid.New(),
+		Name:      name,
+		KeyPrefix: keyPrefix,
+		KeyHash:   keyHash,
+		Scopes:    append([]string(nil), scopes...),
+		CreatedAt: time.Now(),
+	}
+	if expiresAt != nil {
+		at := *expiresAt
+		key.ExpiresAt = &at
+	}
+	m.apiKeys[key.ID] = key
+
+	return copyAPIKey(key), nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key.
+func (m *MemoryStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// GetAPIKeys retrieves all API keys, newest first.
+func (m *MemoryStore) GetAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []*APIKey
+	for _, key := range m.apiKeys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// TouchAPIKey records that an API key was used at usedAt.
+func (m *MemoryStore) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id.String())
+	}
+	key.LastUsedAt = &usedAt
+	return nil
+}
+
+// DeleteAPIKey revokes an API key.
+func (m *MemoryStore) DeleteAPIKey(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id.String())
+	}
+	delete(m.apiKeys, id)
+	return nil
+}
+
+// copyAPIKey returns a deep copy of key. The caller must hold m.mu.
+func copyAPIKey(key *APIKey) *APIKey {
+	copied := *key
+	copied.Scopes = append([]string(nil), key.Scopes...)
+	if key.ExpiresAt != nil {
+		at := *key.ExpiresAt
+		copied.ExpiresAt = &at
+	}
+	if key.LastUsedAt != nil {
+		at := *key.LastUsedAt
+		copied.LastUsedAt = &at
+	}
+	return &copied
+}
+
+// EnqueueNotification records a pending message of the given channel,
+// template and threshold to a ticket's customer. It returns
+// ErrNotificationSent if the ticket already got that message.
+func (m *MemoryStore) EnqueueNotification(ctx context.Context, ticketID uuid.UUID, channel, template string, threshold int, recipient, payload string) (*Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tickets[ticketID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+	for _, n := range m.notifications {
+		if n.TicketID == ticketID && n.Template == template && n.Threshold == threshold {
+			return nil, fmt.Errorf("%w: %s %d", ErrNotificationSent, template, threshold)
+		}
+	}
+
+	now := time.Now()
+	n := &Notification{
+		ID:            uuid.New(),
+		TicketID:      ticketID,
+		Channel:       channel,
+		Template:      template,
+		Threshold:     threshold,
+		Recipient:     recipient,
+		Payload:       payload,
+		Status:        NotificationPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.notifications = append(m.notifications, n)
+	return m.copyNotification(n), nil
+}
+
+// ClaimNotifications takes up to limit pending notifications that are due at
+// now, oldest due first, counts an attempt for each and reserves them until
+// now plus lease.
+func (m *MemoryStore) ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*Notification
+	for _, n := range m.notifications {
+		if n.Status == NotificationPending && !n.NextAttemptAt.After(now) {
+			due = append(due, n)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+
+	claimed := []*Notification{}
+	for _, n := range due {
+		n.Attempts++
+		n.NextAttemptAt = now.Add(lease)
+		n.UpdatedAt = now
+		claimed = append(claimed, m.copyNotification(n))
+	}
+	return claimed, nil
+}
+
+// MarkNotificationSent records that a notification was delivered at the
+// given time.
+func (m *MemoryStore) MarkNotificationSent(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNotification(id)
+	if n == nil {
+		return fmt.Errorf("%w: %s", ErrNotificationNotFound, id.String())
+	}
+	n.Status = NotificationSent
+	n.SentAt = &at
+	n.UpdatedAt = at
+	return nil
+}
+
+// MarkNotificationFailed records a failed delivery attempt. The notification
+// stays pending until retryAt, or is given up if retryAt is nil.
+func (m *MemoryStore) MarkNotificationFailed(ctx context.Context, id uuid.UUID, lastError string, retryAt *time.Time, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNotification(id)
+	if n == nil {
+		return fmt.Errorf("%w: %s", ErrNotificationNotFound, id.String())
+	}
+	n.LastError = lastError
+	n.UpdatedAt = at
+	if retryAt == nil {
+		n.Status = NotificationFailed
+	} else {
+		n.NextAttemptAt = *retryAt
+	}
+	return nil
+}
+
+// findNotification returns the stored notification with the given ID, or nil.
+// The caller must hold m.mu.
+func (m *MemoryStore) findNotification(id uuid.UUID) *Notification {
+	for _, n := range m.notifications {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// copyNotification returns a copy of n with its ticket's queue and number
+// filled in. The caller must hold m.mu.
+func (m *MemoryStore) copyNotification(n *Notification) *Notification {
+	copied := *n
+	if n.SentAt != nil {
+		at := *n.SentAt
+		copied.SentAt = &at
+	}
+	if ticket, ok := m.tickets[n.TicketID]; ok {
+		copied.QueueID = ticket.QueueID
+		copied.TicketNumber = ticket.TicketNumber
+	}
+	return &copied
+}
+
+// GetTicketNotifications returns the messages to a ticket's customer, oldest
+// first.
+func (m *MemoryStore) GetTicketNotifications(ctx context.Context, ticketID uuid.UUID) ([]*Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tickets[ticketID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+	notifications := []*Notification{}
+	for _, n := range m.notifications {
+		if n.TicketID == ticketID {
+			notifications = append(notifications, m.copyNotification(n))
+		}
+	}
+	return notifications, nil
+}
+
+// ListNotifications returns the notifications selected by filter, newest
+// first.
+func (m *MemoryStore) ListNotifications(ctx context.Context, filter NotificationFilter) ([]*Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notifications := []*Notification{}
+	// Notifications are appended in order, so walking them backwards puts the
+	// newest first.
+	for i := len(m.notifications) - 1; i >= 0 && len(notifications) < filter.limit(); i-- {
+		n := m.copyNotification(m.notifications[i])
+		switch {
+		case filter.QueueID != nil && n.QueueID != *filter.QueueID,
+			filter.TicketID != nil && n.TicketID != *filter.TicketID,
+			filter.Status != "" && n.Status != filter.Status:
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+// SetMessageTemplate creates or replaces the text of a template name and
+// locale, for one queue or, with a nil queue ID, for every queue.
+func (m *MemoryStore) SetMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale, body string) (*MessageTemplate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if queueID != nil {
+		if _, ok := m.queues[*queueID]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+		}
+	}
+
+	now := time.Now()
+	if t := m.findTemplate(queueID, name, locale); t != nil {
+		t.Body = body
+		t.UpdatedAt = now
+		return copyMessageTemplate(t), nil
+	}
+
+	t := &MessageTemplate{
+		ID:        uuid.New(),
+		Name:      name,
+		Locale:    locale,
+		Body:      body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if queueID != nil {
+		id := *queueID
+		t.QueueID = &id
+	}
+	m.templates = append(m.templates, t)
+	return copyMessageTemplate(t), nil
+}
+
+// GetMessageTemplates returns the customized texts of one queue, or the
+// global ones for a nil queue ID, ordered by name and locale.
+func (m *MemoryStore) GetMessageTemplates(ctx context.Context, queueID *uuid.UUID) ([]*MessageTemplate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if queueID != nil {
+		if _, ok := m.queues[*queueID]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+		}
+	}
+
+	templates := []*MessageTemplate{}
+	for _, t := range m.templates {
+		if sameQueue(t.QueueID, queueID) {
+			templates = append(templates, copyMessageTemplate(t))
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].Locale < templates[j].Locale
+	})
+	return templates, nil
+}
+
+// DeleteMessageTemplate removes a customized text, so that the next one in
+// the fallback chain is used again.
+func (m *MemoryStore) DeleteMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.templates {
+		if sameQueue(t.QueueID, queueID) && t.Name == name && t.Locale == locale {
+			m.templates = append(m.templates[:i], m.templates[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s", ErrTemplateNotFound, name, locale)
+}
+
+func (m *MemoryStore) findTemplate(queueID *uuid.UUID, name, locale string) *MessageTemplate {
+	for _, t := range m.templates {
+		if sameQueue(t.QueueID, queueID) && t.Name == name && t.Locale == locale {
+			return t
+		}
+	}
+	return nil
+}
+
+// sameQueue reports whether two optional queue IDs are equal, treating two
+// nil IDs as equal like IS NOT DISTINCT FROM.
+func sameQueue(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func copyMessageTemplate(t *MessageTemplate) *MessageTemplate {
+	copied := *t
+	if t.QueueID != nil {
+		id := *t.QueueID
+		copied.QueueID = &id
+	}
+	return &copied
+}
+
+// CreateWebhook stores a new webhook subscription to the given event types.
+func (m *MemoryStore) CreateWebhook(ctx context.Context, url, secret string, events []string, description string) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	w := &Webhook{
+		ID:          uuid.New(),
+		URL:         url,
+		Secret:      secret,
+		Events:      append([]string(nil), events...),
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.webhooks = append(m.webhooks, w)
+	return copyWebhook(w), nil
+}
+
+// GetWebhookByID retrieves a webhook by its ID.
+func (m *MemoryStore) GetWebhookByID(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := m.findWebhook(id)
+	if w == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, id.String())
+	}
+	return copyWebhook(w), nil
+}
+
+// GetWebhooks retrieves all webhooks, newest first.
+func (m *MemoryStore) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []*Webhook{}
+	for i := len(m.webhooks) - 1; i >= 0; i-- {
+		webhooks = append(webhooks, copyWebhook(m.webhooks[i]))
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (m *MemoryStore) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, w := range m.webhooks {
+		if w.ID == id {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			deliveries := m.deliveries[:0]
+			for _, d := range m.deliveries {
+				if d.WebhookID != id {
+					deliveries = append(deliveries, d)
+				}
+			}
+			m.deliveries = deliveries
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrWebhookNotFound, id.String())
+}
+
+// EnqueueWebhookEvent records a pending delivery of an event for every webhook
+// subscribed to its type that has none yet, and returns them.
+func (m *MemoryStore) EnqueueWebhookEvent(ctx context.Context, eventID uuid.UUID, eventType, payload string) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enqueued := make(map[uuid.UUID]bool)
+	for _, d := range m.deliveries {
+		if d.EventID == eventID {
+			enqueued[d.WebhookID] = true
+		}
+	}
+	now := time.Now()
+	deliveries := []*WebhookDelivery{}
+	for _, w := range m.webhooks {
+		if w.Subscribes(eventType) && !enqueued[w.ID] {
+			d := newWebhookDelivery(w, eventID, eventType, payload, now)
+			m.deliveries = append(m.deliveries, d)
+			deliveries = append(deliveries, m.copyWebhookDelivery(d))
+		}
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries takes up to limit pending deliveries that are due at
+// now, oldest due first, counts an attempt for each and reserves them until
+// now plus lease.
+func (m *MemoryStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == NotificationPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+
+	claimed := []*WebhookDelivery{}
+	for _, d := range due {
+		d.Attempts++
+		d.NextAttemptAt = now.Add(lease)
+		d.UpdatedAt = now
+		claimed = append(claimed, m.copyWebhookDelivery(d))
+	}
+	return claimed, nil
+}
+
+// MarkWebhookDelivered records that a delivery was accepted at the given
+// time with the given HTTP status.
+func (m *MemoryStore) MarkWebhookDelivered(ctx context.Context, id uuid.UUID, responseStatus int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.findWebhookDelivery(id)
+	if d == nil {
+		return fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+	}
+	d.Status = NotificationSent
+	d.ResponseStatus = responseStatus
+	d.LastError = ""
+	d.DeliveredAt = &at
+	d.UpdatedAt = at
+	return nil
+}
+
+// MarkWebhookDeliveryFailed records a failed delivery attempt and the HTTP
+// status of its response, or 0 if there was none. The delivery stays pending
+// until retryAt, or is given up if retryAt is nil.
+func (m *MemoryStore) MarkWebhookDeliveryFailed(ctx context.Context, id uuid.UUID, responseStatus int, lastError string, retryAt *time.Time, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.findWebhookDelivery(id)
+	if d == nil {
+		return fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+	}
+	d.ResponseStatus = responseStatus
+	d.LastError = lastError
+	d.UpdatedAt = at
+	if retryAt == nil {
+		d.Status = NotificationFailed
+	} else {
+		d.NextAttemptAt = *retryAt
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the deliveries selected by filter, newest
+// first.
+func (m *MemoryStore) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []*WebhookDelivery{}
+	// Deliveries are appended in order, so walking them backwards puts the
+	// newest first.
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < filter.limit(); i-- {
+		d := m.deliveries[i]
+		switch {
+		case filter.WebhookID != nil && d.WebhookID != *filter.WebhookID,
+			filter.EventType != "" && d.EventType != filter.EventType,
+			filter.Status != "" && d.Status != filter.Status:
+			continue
+		}
+		deliveries = append(deliveries, m.copyWebhookDelivery(d))
+	}
+	return deliveries, nil
+}
+
+// RedeliverWebhookDelivery makes a sent or failed delivery pending again, due
+// at the given time, with a fresh set of attempts.
+func (m *MemoryStore) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID, at time.Time) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.findWebhookDelivery(id)
+	if d == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+	}
+	if d.Status == NotificationPending {
+		return nil, fmt.Errorf("%w: %s", ErrDeliveryPending, id.String())
+	}
+	d.Status = NotificationPending
+	d.Attempts = 0
+	d.NextAttemptAt = at
+	d.UpdatedAt = at
+	return m.copyWebhookDelivery(d), nil
+}
+
+// findWebhook returns the stored webhook with the given ID, or nil. The caller
+// must hold m.mu.
+func (m *MemoryStore) findWebhook(id uuid.UUID) *Webhook {
+	for _, w := range m.webhooks {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// findWebhookDelivery returns the stored delivery with the given ID, or nil.
+// The caller must hold m.mu.
+func (m *MemoryStore) findWebhookDelivery(id uuid.UUID) *WebhookDelivery {
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+func copyWebhook(w *Webhook) *Webhook {
+	copied := *w
+	copied.Events = append([]string(nil), w.Events...)
+	return &copied
+}
+
+// copyWebhookDelivery returns a copy of d with its webhook's URL and secret
+// filled in. The caller must hold m.mu.
+func (m *MemoryStore) copyWebhookDelivery(d *WebhookDelivery) *WebhookDelivery {
+	copied := *d
+	if d.DeliveredAt != nil {
+		at := *d.DeliveredAt
+		copied.DeliveredAt = &at
+	}
+	if w := m.findWebhook(d.WebhookID); w != nil {
+		copied.URL = w.URL
+		copied.Secret = w.Secret
+	}
+	return &copied
+}
+
+// GetPendingOutboxEvents returns up to limit events not yet dispatched, in the
+// order they were written.
+func (m *MemoryStore) GetPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if limit <= 0 {
+		limit = DefaultOutboxBatch
+	}
+	events := []*OutboxEvent{}
+	for _, e := range m.outbox {
+		if len(events) == limit {
+			break
+		}
+		if e.DispatchedAt == nil {
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
+// findOutboxEvent returns the outbox event with the given ID. The caller must
+// hold m.mu.
+func (m *MemoryStore) findOutboxEvent(id uuid.UUID) (*OutboxEvent, error) {
+	for _, e := range m.outbox {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrEventNotFound, id.String())
+}
+
+// MarkOutboxEventDispatched records an event as dispatched at at.
+func (m *MemoryStore) MarkOutboxEventDispatched(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.findOutboxEvent(id)
+	if err != nil {
+		return err
+	}
+	e.DispatchedAt = &at
+	return nil
+}
+
+// MarkOutboxEventFailed counts a failed attempt at dispatching an event, which
+// stays pending.
+func (m *MemoryStore) MarkOutboxEventFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.findOutboxEvent(id)
+	if err != nil {
+		return err
+	}
+	e.Attempts++
+	e.LastError = lastError
+	return nil
+}
+
+// DeleteDispatchedOutboxEvents deletes the events dispatched before before and
+// returns how many there were.
+func (m *MemoryStore) DeleteDispatchedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.outbox[:0]
+	var deleted int64
+	for _, e := range m.outbox {
+		if e.DispatchedAt != nil && e.DispatchedAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	m.outbox = kept
+	return deleted, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newMemoryHarness(t *testing.T) *storeHarness {
+	m := NewMemoryStore()
+	return &storeHarness{
+		Store: m,
+		rewindDay: func(t *testing.T, queueID uuid.UUID) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for _, ticket := range m.tickets {
+				if ticket.QueueID == queueID {
+					ticket.CreatedAt = ticket.CreatedAt.Add(-24 * time.Hour)
+				}
+			}
+			if counter, ok := m.queueCounters[queueID]; ok {
+				counter.numberPeriod = m.queues[queueID].Period(time.Now().Add(-24 * time.Hour))
+			}
+		},
+		setHistoryTime: func(t *testing.T, ticketID uuid.UUID, status string, at time.Time) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for _, h := range m.history {
+				if h.TicketID == ticketID && h.Status == status {
+					h.Timestamp = at
+				}
+			}
+		},
+		history: func(t *testing.T, ticketID uuid.UUID) []string {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			var statuses []string
+			for _, h := range m.history {
+				if h.TicketID == ticketID {
+					statuses = append(statuses, h.Status)
+				}
+			}
+			return statuses
+		},
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreConformance(t, newMemoryHarness)
+}
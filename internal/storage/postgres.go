@@ -2,22 +2,29 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strconv" // Add strconv import
+	"sort"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/smartq/smartq/internal/config"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/ticket"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5" // Import pgx for pgx.ErrNoRows
 )
 
 // Queue represents a queue in the database.
 type Queue struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	queue.TicketFormat
+	NotifyThresholds []int     `json:"notify_thresholds"` // People ahead at which waiting customers get a text, e.g. [3, 0]
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 // Ticket represents a ticket in the database.
@@ -30,23 +37,178 @@ type Ticket struct {
 	Status       string    `json:"status"`
 	Position     int       `json:"position"`
 	Priority     int       `json:"priority"` // New field for priority
+	CounterID    *uuid.UUID `json:"counter_id"`   // Counter that called the ticket, if any
+	CounterName  *string    `json:"counter_name"` // Name of that counter, for displays
+	DeferredUntil *time.Time `json:"deferred_until"` // Not called before this time, if set
+	Locale        string     `json:"locale,omitempty"` // Language of the customer's messages, e.g. "es"; empty for the default
+	PeopleAhead   *int       `json:"people_ahead,omitempty"` // Waiting tickets called first; set by SetPeopleAhead on waiting tickets
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-// TicketHistory represents a status change event for a ticket.
-type TicketHistory struct {
+// Counter is a service point (desk, window, room) that serves a queue's tickets.
+type Counter struct {
 	ID        uuid.UUID `json:"id"`
-	TicketID  uuid.UUID `json:"ticket_id"`
-	Status    string    `json:"status"`
+	QueueID   uuid.UUID `json:"queue_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// User is a staff account. PasswordHash is never serialized.
+type User struct {
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// APIKey is a long-lived credential for kiosks, signage players and other
+// integrations. Only the SHA-256 hash of the key is stored; KeyHash is never
+// serialized.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"` // Leading characters of the key, to tell keys apart
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`   // Nil for keys that never expire
+	LastUsedAt *time.Time `json:"last_used_at"` // Nil until the key is first used
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the key has an expiry time that has passed.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Notification is a message to a ticket's customer, such as a text saying it
+// is their turn, along with its delivery status. A ticket gets at most one
+// notification of each template and threshold.
+type Notification struct {
+	ID            uuid.UUID  `json:"id"`
+	TicketID      uuid.UUID  `json:"ticket_id"`
+	QueueID       uuid.UUID  `json:"queue_id"`      // Filled in when reading notifications back
+	TicketNumber  string     `json:"ticket_number"` // Filled in when reading notifications back
+	Channel       string     `json:"channel"`       // How it is delivered, e.g. "sms"
+	Template      string     `json:"template"`      // Which message it is, e.g. "called"
+	Threshold     int        `json:"threshold"`     // People ahead the message was sent for, if it depends on them
+	Recipient     string     `json:"recipient"`
+	Payload       string     `json:"payload"` // The message itself
+	Status        string     `json:"status"`  // NotificationPending, NotificationSent or NotificationFailed
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"` // When a pending notification is due
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Webhook is another system's subscription to ticket and queue events, which
+// are POSTed to its URL signed with its secret. Secret is only serialized when
+// the webhook is created.
+type Webhook struct {
+	ID          uuid.UUID `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`
+	Events      []string  `json:"events"` // Event types delivered, e.g. ["ticket.called"]
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook receives events of eventType.
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event to be POSTed to one webhook, along with its
+// delivery status. Every webhook subscribed to an event gets its own delivery
+// with the same event ID and payload.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	WebhookID      uuid.UUID  `json:"webhook_id"`
+	URL            string     `json:"url"` // The webhook's, filled in when reading deliveries back
+	Secret         string     `json:"-"`   // The webhook's, filled in when reading deliveries back
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"` // The JSON request body
+	Status         string     `json:"status"`  // NotificationPending, NotificationSent or NotificationFailed
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"` // HTTP status of the last response, if any
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`           // When a pending delivery is due
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// OutboxEvent is a domain event, written in the same transaction as the change
+// it describes and dispatched afterwards to WebSocket clients, webhooks and
+// customers. Seq orders the events as they were written.
+type OutboxEvent struct {
+	ID           uuid.UUID  `json:"id"`
+	Seq          int64      `json:"seq"`
+	Type         string     `json:"type"` // One of the Event constants, e.g. EventTicketCalled
+	TicketID     uuid.UUID  `json:"ticket_id"`
+	QueueID      uuid.UUID  `json:"queue_id"`
+	ActorType    string     `json:"actor_type"` // Who made the change, as in its Audit
+	Payload      string     `json:"payload"`    // The ticket after the change, as JSON
+	Attempts     int        `json:"attempts"`   // Failed attempts at dispatching the event
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"dispatched_at,omitempty"`
+}
+
+// Ticket decodes the ticket the event is about, as the change left it.
+func (e *OutboxEvent) Ticket() (*Ticket, error) {
+	t := &Ticket{}
+	if err := json.Unmarshal([]byte(e.Payload), t); err != nil {
+		return nil, fmt.Errorf("failed to decode ticket of event %s: %w", e.ID, err)
+	}
+	return t, nil
+}
+
+// MessageTemplate is a customized text of a message to customers, for one
+// template name and locale.
+type MessageTemplate struct {
+	ID        uuid.UUID  `json:"id"`
+	QueueID   *uuid.UUID `json:"queue_id"` // nil for the text used by every queue
+	Name      string     `json:"name"`
+	Locale    string     `json:"locale"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// TicketHistory represents a status change event for a ticket, along with who
+// made the change.
+type TicketHistory struct {
+	ID           uuid.UUID  `json:"id"`
+	TicketID     uuid.UUID  `json:"ticket_id"`
+	QueueID      uuid.UUID  `json:"queue_id"`      // Filled in when reading the history back
+	TicketNumber string     `json:"ticket_number"` // Filled in when reading the history back
+	Status       string     `json:"status"`
+	CounterID    *uuid.UUID `json:"counter_id,omitempty"`
+	Audit
 	Timestamp time.Time `json:"timestamp"`
 	CreatedAt time.Time `json:"created_at"` // Redundant but for consistency
 }
 
+// PostgresDB is a Store backed by a PostgreSQL connection pool.
 type PostgresDB struct {
 	pool *pgxpool.Pool
 }
 
+var _ Store = (*PostgresDB)(nil)
+
 func NewPostgresDB(cfg *config.Config) (*PostgresDB, error) {
 	connConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
@@ -74,15 +236,38 @@ func (db *PostgresDB) Close() {
 }
 
 // CreateQueue inserts a new queue into the database.
-func (db *PostgresDB) CreateQueue(ctx context.Context, name string) (*Queue, error) {
+// Zero-valued fields of format are filled with the queue package defaults;
+// notifyThresholds may be empty.
+func (db *PostgresDB) CreateQueue(ctx context.Context, name string, format queue.TicketFormat, notifyThresholds []int) (*Queue, error) {
 	queue := &Queue{
-		ID:        uuid.New(),
-		Name:      name,
-		CreatedAt: time.Now(),
+		ID:               uuid.New(),
+		Name:             name,
+		TicketFormat:     format.WithDefaults(),
+		NotifyThresholds: append([]int{}, notifyThresholds...),
+		CreatedAt:        time.Now(),
 	}
 
-	query := `INSERT INTO queues (id, name, created_at) VALUES ($1, $2, $3) RETURNING id, name, created_at`
-	err := db.pool.QueryRow(ctx, query, queue.ID, queue.Name, queue.CreatedAt).Scan(&queue.ID, &queue.Name, &queue.CreatedAt)
+	query := `INSERT INTO queues (id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, notify_thresholds, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			  RETURNING id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, created_at`
+	err := db.pool.QueryRow(ctx, query,
+		queue.ID,
+		queue.Name,
+		queue.Prefix,
+		queue.Width,
+		queue.StartNumber,
+		queue.ResetPolicy,
+		joinThresholds(queue.NotifyThresholds),
+		queue.CreatedAt,
+	).Scan(
+		&queue.ID,
+		&queue.Name,
+		&queue.Prefix,
+		&queue.Width,
+		&queue.StartNumber,
+		&queue.ResetPolicy,
+		&queue.CreatedAt,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert queue: %w", err)
 	}
@@ -93,24 +278,95 @@ func (db *PostgresDB) CreateQueue(ctx context.Context, name string) (*Queue, err
 // GetQueueByID retrieves a queue from the database by its ID.
 func (db *PostgresDB) GetQueueByID(ctx context.Context, id uuid.UUID) (*Queue, error) {
 	queue := &Queue{}
-	query := `SELECT id, name, created_at FROM queues WHERE id = $1`
-	err := db.pool.QueryRow(ctx, query, id).Scan(&queue.ID, &queue.Name, &queue.CreatedAt)
+	var thresholds string
+	query := `SELECT id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, notify_thresholds, created_at FROM queues WHERE id = $1`
+	err := db.pool.QueryRow(ctx, query, id).Scan(&queue.ID, &queue.Name, &queue.Prefix, &queue.Width, &queue.StartNumber, &queue.ResetPolicy, &thresholds, &queue.CreatedAt)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("queue with ID %s not found", id.String())
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, id.String())
 		}
 		return nil, fmt.Errorf("failed to get queue by ID: %w", err)
 	}
+	queue.NotifyThresholds = splitThresholds(thresholds)
 	return queue, nil
 }
 
+// GetTicketByID retrieves a ticket by its ID.
+func (db *PostgresDB) GetTicketByID(ctx context.Context, id uuid.UUID) (*Ticket, error) {
+	return db.getTicket(ctx, `t.id = $1`, id, id.String())
+}
+
+// GetTicketByAccessTokenHash retrieves the ticket with the given access token hash.
+func (db *PostgresDB) GetTicketByAccessTokenHash(ctx context.Context, accessTokenHash string) (*Ticket, error) {
+	if accessTokenHash == "" {
+		return nil, fmt.Errorf("%w: no access token", ErrTicketNotFound)
+	}
+	return db.getTicket(ctx, `t.access_token_hash = $1`, accessTokenHash, "by access token")
+}
+
+// GetActiveTicketByPhone retrieves the most recently created waiting or
+// serving ticket with the given customer phone.
+func (db *PostgresDB) GetActiveTicketByPhone(ctx context.Context, phone string) (*Ticket, error) {
+	if phone == "" {
+		return nil, fmt.Errorf("%w: no phone number", ErrTicketNotFound)
+	}
+	return db.getTicket(ctx, `t.customer_phone = $1 AND t.status IN ('waiting', 'serving')
+			  ORDER BY t.created_at DESC LIMIT 1`, phone, "by phone number")
+}
+
+// getTicket retrieves the ticket matching the condition, which compares a
+// column of tickets t with $1. Lookup describes the ticket in errors.
+func (db *PostgresDB) getTicket(ctx context.Context, condition string, arg interface{}, lookup string) (*Ticket, error) {
+	ticket := &Ticket{}
+	query := `SELECT t.id, t.queue_id, t.customer_name, t.customer_phone, t.ticket_number, t.status, t.position, t.priority, t.counter_id, c.name, t.deferred_until, t.locale, t.created_at, t.updated_at
+			  FROM tickets t
+			  LEFT JOIN counters c ON c.id = t.counter_id
+			  WHERE ` + condition
+	err := db.pool.QueryRow(ctx, query, arg).Scan(
+		&ticket.ID,
+		&ticket.QueueID,
+		&ticket.CustomerName,
+		&ticket.CustomerPhone,
+		&ticket.TicketNumber,
+		&ticket.Status,
+		&ticket.Position,
+		&ticket.Priority,
+		&ticket.CounterID,
+		&ticket.CounterName,
+		&ticket.DeferredUntil,
+		&ticket.Locale,
+		&ticket.CreatedAt,
+		&ticket.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, lookup)
+		}
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	return ticket, nil
+}
+
 // GetTicketsByQueueID retrieves all tickets for a given queue ID.
 func (db *PostgresDB) GetTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error) {
+	return db.getTicketsByQueue(ctx, queueID, "")
+}
+
+// GetActiveTicketsByQueueID retrieves the waiting and serving tickets of a
+// queue.
+func (db *PostgresDB) GetActiveTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error) {
+	return db.getTicketsByQueue(ctx, queueID, ` AND t.status IN ('waiting', 'serving')`)
+}
+
+// getTicketsByQueue retrieves the tickets of a queue matching the SQL condition
+// filter, if any, in call order.
+func (db *PostgresDB) getTicketsByQueue(ctx context.Context, queueID uuid.UUID, filter string) ([]*Ticket, error) {
 	var tickets []*Ticket
-	query := `SELECT id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority, created_at, updated_at
-			  FROM tickets
-			  WHERE queue_id = $1
-			  ORDER BY priority DESC, position ASC, created_at ASC` // Order by priority (higher value = higher priority)
+	query := `SELECT t.id, t.queue_id, t.customer_name, t.customer_phone, t.ticket_number, t.status, t.position, t.priority, t.counter_id, c.name, t.deferred_until, t.locale, t.created_at, t.updated_at
+			  FROM tickets t
+			  LEFT JOIN counters c ON c.id = t.counter_id
+			  WHERE t.queue_id = $1` + filter + `
+			  ORDER BY t.priority DESC, t.position ASC, t.created_at ASC` // Order by priority (higher value = higher priority)
 	rows, err := db.pool.Query(ctx, query, queueID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tickets: %w", err)
@@ -128,6 +384,10 @@ func (db *PostgresDB) GetTicketsByQueueID(ctx context.Context, queueID uuid.UUID
 			&ticket.Status,
 			&ticket.Position,
 			&ticket.Priority, // Scan priority
+			&ticket.CounterID,
+			&ticket.CounterName,
+			&ticket.DeferredUntil,
+			&ticket.Locale,
 			&ticket.CreatedAt,
 			&ticket.UpdatedAt,
 		)
@@ -145,65 +405,37 @@ func (db *PostgresDB) GetTicketsByQueueID(ctx context.Context, queueID uuid.UUID
 }
 
 // CreateTicket inserts a new ticket into the database.
-func (db *PostgresDB) CreateTicket(ctx context.Context, queueID uuid.UUID, customerName, customerPhone string, priority int) (*Ticket, error) {
+func (db *PostgresDB) CreateTicket(ctx context.Context, queueID uuid.UUID, customerName, customerPhone, locale string, priority int, accessTokenHash string, audit Audit) (*Ticket, error) {
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx) // Rollback on error, commit on success
 
-	// Get the next ticket number and position
-	var lastTicketNumber string
-	var lastPosition int
-	
-	// Query for the last ticket number and position for the given queue on the current day
-	// This query needs to be robust to handle cases where there are no tickets yet
-	// For simplicity, let's assume ticket numbers are sequential per day per queue
-	// and positions are also sequential.
-	
-	// Get last ticket number
-	err = tx.QueryRow(ctx, `
-		SELECT COALESCE(MAX(ticket_number), 'A-000')
-		FROM tickets
-		WHERE queue_id = $1 AND created_at::date = NOW()::date`, queueID).Scan(&lastTicketNumber)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last ticket number: %w", err)
-	}
-
-	// Get last position
-	err = tx.QueryRow(ctx, `
-		SELECT COALESCE(MAX(position), 0)
-		FROM tickets
-		WHERE queue_id = $1`, queueID).Scan(&lastPosition)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last position: %w", err)
-	}
-
-	// Generate next ticket number
-	prefix := string(lastTicketNumber[0]) // Assuming 'A'
-	numStr := lastTicketNumber[2:]        // Assuming '000'
-	num, err := strconv.Atoi(numStr)
+	// Allocate the next ticket number and position from the queue's counter row.
+	// The upsert locks the row until this transaction ends, so concurrent
+	// check-ins on the same queue are serialized and never share a number.
+	ticketNumber, position, err := nextTicketCounter(ctx, tx, queueID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ticket number: %w", err)
+		return nil, err
 	}
-	nextTicketNumber := fmt.Sprintf("%s-%03d", prefix, num+1)
-	nextPosition := lastPosition + 1
 
 	ticket := &Ticket{
 		ID:           uuid.New(),
 		QueueID:      queueID,
 		CustomerName: customerName,
 		CustomerPhone: customerPhone,
-		TicketNumber: nextTicketNumber,
+		TicketNumber: ticketNumber,
 		Status:       "waiting", // Default status
-		Position:     nextPosition,
+		Position:     position,
 		Priority:     priority, // Set priority
+		Locale:       locale,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
-	query := `INSERT INTO tickets (id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority, created_at, updated_at)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority, created_at, updated_at`
+	query := `INSERT INTO tickets (id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority, access_token_hash, locale, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12) RETURNING id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority, locale, created_at, updated_at`
 	err = tx.QueryRow(ctx, query,
 		ticket.ID,
 		ticket.QueueID,
@@ -213,6 +445,8 @@ func (db *PostgresDB) CreateTicket(ctx context.Context, queueID uuid.UUID, custo
 		ticket.Status,
 		ticket.Position,
 		ticket.Priority, // Add priority to insert
+		accessTokenHash,
+		ticket.Locale,
 		ticket.CreatedAt,
 		ticket.UpdatedAt,
 	).Scan(
@@ -224,6 +458,7 @@ func (db *PostgresDB) CreateTicket(ctx context.Context, queueID uuid.UUID, custo
 		&ticket.Status,
 		&ticket.Position,
 		&ticket.Priority, // Add priority to scan
+		&ticket.Locale,
 		&ticket.CreatedAt,
 		&ticket.UpdatedAt,
 	)
@@ -232,9 +467,136 @@ func (db *PostgresDB) CreateTicket(ctx context.Context, queueID uuid.UUID, custo
 	}
 
 	// Log the initial status change
-	if err := LogTicketStatusChange(ctx, tx, ticket.ID, ticket.Status); err != nil {
+	if err := LogTicketStatusChange(ctx, tx, ticket.ID, ticket.Status, nil, audit); err != nil {
 		return nil, fmt.Errorf("failed to log initial ticket status: %w", err)
 	}
+	if err := insertTicketEvent(ctx, tx, ticket, ticket.Status, audit); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// nextTicketCounter increments the queue's counter row and returns the new
+// formatted ticket number and position. The number restarts at the queue's
+// start number whenever its reset policy enters a new period.
+func nextTicketCounter(ctx context.Context, tx pgx.Tx, queueID uuid.UUID) (string, int, error) {
+	var format queue.TicketFormat
+	err := tx.QueryRow(ctx, `
+		SELECT ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy
+		FROM queues
+		WHERE id = $1`, queueID).Scan(&format.Prefix, &format.Width, &format.StartNumber, &format.ResetPolicy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", 0, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+		}
+		return "", 0, fmt.Errorf("failed to get ticket format: %w", err)
+	}
+
+	query := `
+		INSERT INTO queue_counters (queue_id, last_number, last_position, number_period)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (queue_id) DO UPDATE SET
+			last_number = CASE
+				WHEN queue_counters.number_period = EXCLUDED.number_period THEN queue_counters.last_number + 1
+				ELSE EXCLUDED.last_number
+			END,
+			last_position = queue_counters.last_position + 1,
+			number_period = EXCLUDED.number_period
+		RETURNING last_number, last_position`
+
+	var number, position int
+	if err := tx.QueryRow(ctx, query, queueID, format.StartNumber, format.Period(time.Now())).Scan(&number, &position); err != nil {
+		return "", 0, fmt.Errorf("failed to allocate ticket number: %w", err)
+	}
+	return format.Format(number), position, nil
+}
+
+// UpdateTicketStatus moves a ticket to a new status, optionally assigning it to
+// a counter. It returns an error wrapping ErrInvalidTransition if the ticket
+// state machine forbids the move.
+func (db *PostgresDB) UpdateTicketStatus(ctx context.Context, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the ticket row so the transition check and the update are atomic.
+	var currentStatus string
+	var queueID uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT status, queue_id FROM tickets WHERE id = $1 FOR UPDATE`, ticketID).Scan(&currentStatus, &queueID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return nil, fmt.Errorf("failed to get ticket status: %w", err)
+	}
+	if err := checkTransition(currentStatus, status); err != nil {
+		return nil, err
+	}
+	if err := checkCounterInQueue(ctx, tx, counterID, queueID); err != nil {
+		return nil, err
+	}
+
+	ticket, err := setTicketStatus(ctx, tx, ticketID, status, counterID, audit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// CallNextTicket moves the highest-priority, earliest waiting ticket of a queue
+// to serving, optionally at the given counter. The candidate row is locked with
+// FOR UPDATE SKIP LOCKED, so two staff members calling at the same time always
+// get different tickets. It returns an error wrapping ErrNoWaitingTickets when
+// nobody is waiting.
+func (db *PostgresDB) CallNextTicket(ctx context.Context, queueID uuid.UUID, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM queues WHERE id = $1)`, queueID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check queue: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	if err := checkCounterInQueue(ctx, tx, counterID, queueID); err != nil {
+		return nil, err
+	}
+
+	var ticketID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		SELECT id
+		FROM tickets
+		WHERE queue_id = $1 AND status = 'waiting' AND (deferred_until IS NULL OR deferred_until <= $2)
+		ORDER BY priority DESC, position ASC, created_at ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`, queueID, time.Now()).Scan(&ticketID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrNoWaitingTickets, queueID.String())
+		}
+		return nil, fmt.Errorf("failed to select next ticket: %w", err)
+	}
+
+	ticket, err := setTicketStatus(ctx, tx, ticketID, "serving", counterID, audit)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
@@ -243,17 +605,121 @@ func (db *PostgresDB) CreateTicket(ctx context.Context, queueID uuid.UUID, custo
 	return ticket, nil
 }
 
-// UpdateTicketStatus updates the status of a ticket.
-func (db *PostgresDB) UpdateTicketStatus(ctx context.Context, ticketID uuid.UUID, status string) (*Ticket, error) {
+// DeferTicket lets a waiting ticket go behind the next places waiting tickets
+// of the same priority, by rotating their positions, and/or keeps it from
+// being called before until. It returns an error wrapping ErrInvalidTransition
+// if the ticket is not waiting.
+func (db *PostgresDB) DeferTicket(ctx context.Context, ticketID uuid.UUID, places int, until *time.Time, audit Audit) (*Ticket, error) {
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
+	var status string
+	var queueID uuid.UUID
+	var priority, position int
+	var createdAt time.Time
+	err = tx.QueryRow(ctx, `SELECT status, queue_id, priority, position, created_at FROM tickets WHERE id = $1 FOR UPDATE`, ticketID).
+		Scan(&status, &queueID, &priority, &position, &createdAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return nil, fmt.Errorf("failed to get ticket status: %w", err)
+	}
+	if status != ticket.StatusWaiting {
+		return nil, fmt.Errorf("%w: only waiting tickets can be deferred, ticket is %s", ErrInvalidTransition, status)
+	}
+
+	if places > 0 {
+		// Each ticket let ahead moves up to the place of the one before it,
+		// and the deferred ticket takes the place of the last one.
+		rows, err := tx.Query(ctx, `
+			SELECT id, position
+			FROM tickets
+			WHERE queue_id = $1 AND status = 'waiting' AND priority = $2
+			  AND (position > $3 OR (position = $3 AND created_at > $4))
+			ORDER BY position ASC, created_at ASC
+			LIMIT $5
+			FOR UPDATE`, queueID, priority, position, createdAt, places)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select tickets behind: %w", err)
+		}
+		var behindIDs []uuid.UUID
+		var behindPositions []int
+		for rows.Next() {
+			var id uuid.UUID
+			var p int
+			if err := rows.Scan(&id, &p); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan ticket row: %w", err)
+			}
+			behindIDs = append(behindIDs, id)
+			behindPositions = append(behindPositions, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error after iterating rows: %w", err)
+		}
+
+		previous := position
+		for i, id := range behindIDs {
+			if _, err := tx.Exec(ctx, `UPDATE tickets SET position = $1 WHERE id = $2`, previous, id); err != nil {
+				return nil, fmt.Errorf("failed to move ticket up: %w", err)
+			}
+			previous = behindPositions[i]
+		}
+		position = previous
+	}
+
+	t := &Ticket{}
+	query := `UPDATE tickets SET position = $2, deferred_until = COALESCE($3, deferred_until), updated_at = NOW() WHERE id = $1
+			  RETURNING id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority,
+			  counter_id, (SELECT name FROM counters WHERE id = tickets.counter_id), deferred_until, locale, created_at, updated_at`
+	err = tx.QueryRow(ctx, query, ticketID, position, until).Scan(
+		&t.ID,
+		&t.QueueID,
+		&t.CustomerName,
+		&t.CustomerPhone,
+		&t.TicketNumber,
+		&t.Status,
+		&t.Position,
+		&t.Priority,
+		&t.CounterID,
+		&t.CounterName,
+		&t.DeferredUntil,
+		&t.Locale,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to defer ticket: %w", err)
+	}
+
+	if err := LogTicketStatusChange(ctx, tx, t.ID, ticket.StatusDeferred, t.CounterID, audit); err != nil {
+		return nil, fmt.Errorf("failed to log ticket deferral: %w", err)
+	}
+	if err := insertTicketEvent(ctx, tx, t, ticket.StatusDeferred, audit); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return t, nil
+}
+
+// setTicketStatus updates a ticket's status and counter and logs the change to
+// ticket_history. The caller must already hold the ticket's row lock and have
+// validated the transition and the counter.
+func setTicketStatus(ctx context.Context, tx pgx.Tx, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
 	ticket := &Ticket{}
-	query := `UPDATE tickets SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING id, queue_id, customer_name, customer_phone, ticket_number, status, position, created_at, updated_at`
-	err = tx.QueryRow(ctx, query, status, ticketID).Scan(
+	query := `UPDATE tickets SET status = $1, counter_id = COALESCE($3, counter_id), updated_at = NOW() WHERE id = $2
+			  RETURNING id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority,
+			  counter_id, (SELECT name FROM counters WHERE id = tickets.counter_id), deferred_until, locale, created_at, updated_at`
+	err := tx.QueryRow(ctx, query, status, ticketID, counterID).Scan(
 		&ticket.ID,
 		&ticket.QueueID,
 		&ticket.CustomerName,
@@ -261,46 +727,199 @@ func (db *PostgresDB) UpdateTicketStatus(ctx context.Context, ticketID uuid.UUID
 		&ticket.TicketNumber,
 		&ticket.Status,
 		&ticket.Position,
+		&ticket.Priority,
+		&ticket.CounterID,
+		&ticket.CounterName,
+		&ticket.DeferredUntil,
+		&ticket.Locale,
 		&ticket.CreatedAt,
 		&ticket.UpdatedAt,
 	)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("ticket with ID %s not found", ticketID.String())
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
 		}
 		return nil, fmt.Errorf("failed to update ticket status: %w", err)
 	}
 
 	// Log the status change
-	if err := LogTicketStatusChange(ctx, tx, ticket.ID, ticket.Status); err != nil {
+	if err := LogTicketStatusChange(ctx, tx, ticket.ID, ticket.Status, ticket.CounterID, audit); err != nil {
 		return nil, fmt.Errorf("failed to log ticket status change: %w", err)
 	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if err := insertTicketEvent(ctx, tx, ticket, ticket.Status, audit); err != nil {
+		return nil, err
 	}
 
 	return ticket, nil
 }
 
-// LogTicketStatusChange records a ticket's status change in the ticket_history table.
-func LogTicketStatusChange(ctx context.Context, tx pgx.Tx, ticketID uuid.UUID, status string) error {
+// checkCounterInQueue verifies that counterID, if set, names a counter of the
+// given queue.
+func checkCounterInQueue(ctx context.Context, tx pgx.Tx, counterID *uuid.UUID, queueID uuid.UUID) error {
+	if counterID == nil {
+		return nil
+	}
+	var counterQueueID uuid.UUID
+	err := tx.QueryRow(ctx, `SELECT queue_id FROM counters WHERE id = $1`, *counterID).Scan(&counterQueueID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrCounterNotFound, counterID.String())
+		}
+		return fmt.Errorf("failed to get counter: %w", err)
+	}
+	if counterQueueID != queueID {
+		return fmt.Errorf("%w: %s", ErrCounterNotInQueue, counterID.String())
+	}
+	return nil
+}
+
+// LogTicketStatusChange records a ticket's status change in the ticket_history
+// table, along with the counter handling the ticket, if any, and who made the
+// change.
+func LogTicketStatusChange(ctx context.Context, tx pgx.Tx, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) error {
 	history := &TicketHistory{
 		ID:        uuid.New(),
 		TicketID:  ticketID,
 		Status:    status,
+		CounterID: counterID,
+		Audit:     audit.withDefaults(),
 		Timestamp: time.Now(),
 		CreatedAt: time.Now(),
 	}
 
-	query := `INSERT INTO ticket_history (id, ticket_id, status, timestamp, created_at) VALUES ($1, $2, $3, $4, $5)`
-	_, err := tx.Exec(ctx, query, history.ID, history.TicketID, history.Status, history.Timestamp, history.CreatedAt)
+	query := `INSERT INTO ticket_history (id, ticket_id, status, counter_id, actor_type, actor_id, actor_name, source_ip, user_agent, reason, timestamp, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := tx.Exec(ctx, query,
+		history.ID,
+		history.TicketID,
+		history.Status,
+		history.CounterID,
+		history.ActorType,
+		history.ActorID,
+		history.ActorName,
+		history.SourceIP,
+		history.UserAgent,
+		history.Reason,
+		history.Timestamp,
+		history.CreatedAt,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to log ticket status change: %w", err)
 	}
 	return nil
 }
 
+// insertTicketEvent writes the outbox event of a ticket action that recorded
+// status in ticket_history, within the action's transaction.
+func insertTicketEvent(ctx context.Context, tx pgx.Tx, t *Ticket, status string, audit Audit) error {
+	e, err := newTicketEvent(t, status, audit, time.Now())
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox_events (id, event_type, ticket_id, queue_id, actor_type, payload, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := tx.Exec(ctx, query, e.ID, e.Type, e.TicketID, e.QueueID, e.ActorType, e.Payload, e.CreatedAt); err != nil {
+		return fmt.Errorf("failed to write ticket event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditTrail retrieves the ticket_history rows matching filter, newest first.
+func (db *PostgresDB) GetAuditTrail(ctx context.Context, filter AuditFilter) ([]*TicketHistory, error) {
+	query := `SELECT th.id, th.ticket_id, t.queue_id, t.ticket_number, th.status, th.counter_id,
+			  th.actor_type, th.actor_id, th.actor_name, th.source_ip, th.user_agent, th.reason, th.timestamp, th.created_at
+			  FROM ticket_history th
+			  JOIN tickets t ON t.id = th.ticket_id
+			  WHERE TRUE`
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.TicketID != nil {
+		query += ` AND th.ticket_id = ` + arg(*filter.TicketID)
+	}
+	if filter.ActorType != "" {
+		query += ` AND th.actor_type = ` + arg(filter.ActorType)
+	}
+	if filter.ActorID != nil {
+		query += ` AND th.actor_id = ` + arg(*filter.ActorID)
+	}
+	if filter.From != nil {
+		query += ` AND th.timestamp >= ` + arg(*filter.From)
+	}
+	if filter.To != nil {
+		query += ` AND th.timestamp < ` + arg(*filter.To)
+	}
+	query += ` ORDER BY th.timestamp DESC, th.created_at DESC LIMIT ` + arg(filter.limit())
+
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ticket history: %w", err)
+	}
+	return scanTicketHistory(rows)
+}
+
+// GetTicketHistory retrieves a ticket's status changes, oldest first.
+func (db *PostgresDB) GetTicketHistory(ctx context.Context, ticketID uuid.UUID) ([]*TicketHistory, error) {
+	var exists bool
+	if err := db.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tickets WHERE id = $1)`, ticketID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+
+	query := `SELECT th.id, th.ticket_id, t.queue_id, t.ticket_number, th.status, th.counter_id,
+			  th.actor_type, th.actor_id, th.actor_name, th.source_ip, th.user_agent, th.reason, th.timestamp, th.created_at
+			  FROM ticket_history th
+			  JOIN tickets t ON t.id = th.ticket_id
+			  WHERE th.ticket_id = $1
+			  ORDER BY th.timestamp ASC, th.created_at ASC`
+	rows, err := db.pool.Query(ctx, query, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ticket history: %w", err)
+	}
+	return scanTicketHistory(rows)
+}
+
+// scanTicketHistory reads the ticket_history rows selected by GetAuditTrail and
+// GetTicketHistory and closes rows.
+func scanTicketHistory(rows pgx.Rows) ([]*TicketHistory, error) {
+	defer rows.Close()
+
+	var entries []*TicketHistory
+	for rows.Next() {
+		h := &TicketHistory{}
+		err := rows.Scan(
+			&h.ID,
+			&h.TicketID,
+			&h.QueueID,
+			&h.TicketNumber,
+			&h.Status,
+			&h.CounterID,
+			&h.ActorType,
+			&h.ActorID,
+			&h.ActorName,
+			&h.SourceIP,
+			&h.UserAgent,
+			&h.Reason,
+			&h.Timestamp,
+			&h.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ticket history row: %w", err)
+		}
+		entries = append(entries, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
 // CalculateEstimatedWaitTime calculates the estimated wait time for a given queue.
 // It does this by looking at the average time tickets spent in 'waiting' status
 // for recently served tickets in that queue.
@@ -353,10 +972,23 @@ func (db *PostgresDB) CalculateEstimatedWaitTime(ctx context.Context, queueID uu
 	return time.Duration(averageDurationSeconds) * time.Second, nil
 }
 
+// SetQueueNotifyThresholds replaces the numbers of people ahead at which the
+// queue's waiting customers get a text.
+func (db *PostgresDB) SetQueueNotifyThresholds(ctx context.Context, queueID uuid.UUID, thresholds []int) (*Queue, error) {
+	tag, err := db.pool.Exec(ctx, `UPDATE queues SET notify_thresholds = $2 WHERE id = $1`, queueID, joinThresholds(thresholds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update queue: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	return db.GetQueueByID(ctx, queueID)
+}
+
 // GetQueues retrieves all queues from the database.
 func (db *PostgresDB) GetQueues(ctx context.Context) ([]*Queue, error) {
 	var queues []*Queue
-	query := `SELECT id, name, created_at FROM queues ORDER BY created_at DESC`
+	query := `SELECT id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, notify_thresholds, created_at FROM queues ORDER BY created_at DESC`
 	rows, err := db.pool.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query queues: %w", err)
@@ -365,10 +997,12 @@ func (db *PostgresDB) GetQueues(ctx context.Context) ([]*Queue, error) {
 
 	for rows.Next() {
 		queue := &Queue{}
-		err := rows.Scan(&queue.ID, &queue.Name, &queue.CreatedAt)
+		var thresholds string
+		err := rows.Scan(&queue.ID, &queue.Name, &queue.Prefix, &queue.Width, &queue.StartNumber, &queue.ResetPolicy, &thresholds, &queue.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan queue row: %w", err)
 		}
+		queue.NotifyThresholds = splitThresholds(thresholds)
 		queues = append(queues, queue)
 	}
 
@@ -378,3 +1012,941 @@ func (db *PostgresDB) GetQueues(ctx context.Context) ([]*Queue, error) {
 
 	return queues, nil
 }
+
+// CreateCounter adds a counter to a queue. Counter names are unique per queue.
+func (db *PostgresDB) CreateCounter(ctx context.Context, queueID uuid.UUID, name string) (*Counter, error) {
+	counter := &Counter{
+		ID:        uuid.New(),
+		QueueID:   queueID,
+		Name:      name,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	query := `INSERT INTO counters (id, queue_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := db.pool.Exec(ctx, query, counter.ID, counter.QueueID, counter.Name, counter.CreatedAt, counter.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23503": // foreign_key_violation
+				return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+			case "23505": // unique_violation
+				return nil, fmt.Errorf("%w: %q", ErrCounterExists, name)
+			}
+		}
+		return nil, fmt.Errorf("failed to insert counter: %w", err)
+	}
+
+	return counter, nil
+}
+
+// GetCounterByID retrieves a counter by its ID.
+func (db *PostgresDB) GetCounterByID(ctx context.Context, id uuid.UUID) (*Counter, error) {
+	counter := &Counter{}
+	query := `SELECT id, queue_id, name, created_at, updated_at FROM counters WHERE id = $1`
+	err := db.pool.QueryRow(ctx, query, id).Scan(&counter.ID, &counter.QueueID, &counter.Name, &counter.CreatedAt, &counter.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get counter by ID: %w", err)
+	}
+	return counter, nil
+}
+
+// GetCountersByQueueID retrieves all counters of a queue, ordered by name.
+func (db *PostgresDB) GetCountersByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Counter, error) {
+	var counters []*Counter
+	query := `SELECT id, queue_id, name, created_at, updated_at FROM counters WHERE queue_id = $1 ORDER BY name ASC`
+	rows, err := db.pool.Query(ctx, query, queueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query counters: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		counter := &Counter{}
+		if err := rows.Scan(&counter.ID, &counter.QueueID, &counter.Name, &counter.CreatedAt, &counter.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan counter row: %w", err)
+		}
+		counters = append(counters, counter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return counters, nil
+}
+
+// UpdateCounter renames a counter.
+func (db *PostgresDB) UpdateCounter(ctx context.Context, id uuid.UUID, name string) (*Counter, error) {
+	counter := &Counter{}
+	query := `UPDATE counters SET name = $1, updated_at = NOW() WHERE id = $2 RETURNING id, queue_id, name, created_at, updated_at`
+	err := db.pool.QueryRow(ctx, query, name, id).Scan(&counter.ID, &counter.QueueID, &counter.Name, &counter.CreatedAt, &counter.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return nil, fmt.Errorf("%w: %q", ErrCounterExists, name)
+		}
+		return nil, fmt.Errorf("failed to update counter: %w", err)
+	}
+	return counter, nil
+}
+
+// DeleteCounter removes a counter. Tickets and history entries that referred to
+// it keep their data but lose the counter reference.
+func (db *PostgresDB) DeleteCounter(ctx context.Context, id uuid.UUID) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM counters WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete counter: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+	}
+	return nil
+}
+
+// CreateUser inserts a staff account. Usernames are unique.
+func (db *PostgresDB) CreateUser(ctx context.Context, username, passwordHash, role string) (*User, error) {
+	user := &User{
+		ID:           uuid.New(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	query := `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := db.pool.Exec(ctx, query, user.ID, user.Username, user.PasswordHash, user.Role, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return nil, fmt.Errorf("%w: %q", ErrUserExists, username)
+		}
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByID retrieves a staff account by its ID.
+func (db *PostgresDB) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	user := &User{}
+	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users WHERE id = $1`
+	err := db.pool.QueryRow(ctx, query, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername retrieves a staff account by its username.
+func (db *PostgresDB) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	user := &User{}
+	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users WHERE username = $1`
+	err := db.pool.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %q", ErrUserNotFound, username)
+		}
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	}
+	return user, nil
+}
+
+// GetUsers retrieves all staff accounts, ordered by username.
+func (db *PostgresDB) GetUsers(ctx context.Context) ([]*User, error) {
+	var users []*User
+	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users ORDER BY username ASC`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// DeleteUser removes a staff account.
+func (db *PostgresDB) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, id.String())
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key. Only the key's hash and display prefix
+// are kept; the key itself is shown to the admin once and never stored.
+func (db *PostgresDB) CreateAPIKey(ctx context.Context, name, keyPrefix, keyHash string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		ID:        uuid.New(),
+		Name:      name,
+		KeyPrefix: keyPrefix,
+		KeyHash:   keyHash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	query := `INSERT INTO api_keys (id, name, key_prefix, key_hash, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.pool.Exec(ctx, query, key.ID, key.Name, key.KeyPrefix, key.KeyHash, joinScopes(key.Scopes), key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key.
+func (db *PostgresDB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes string
+	query := `SELECT id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE key_hash = $1`
+	err := db.pool.QueryRow(ctx, query, keyHash).Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	key.Scopes = splitScopes(scopes)
+	return key, nil
+}
+
+// GetAPIKeys retrieves all API keys, newest first.
+func (db *PostgresDB) GetAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	var keys []*APIKey
+	query := `SELECT id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, created_at FROM api_keys ORDER BY created_at DESC`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key := &APIKey{}
+		var scopes string
+		if err := rows.Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key row: %w", err)
+		}
+		key.Scopes = splitScopes(scopes)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey records that an API key was used at usedAt.
+func (db *PostgresDB) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, usedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id.String())
+	}
+	return nil
+}
+
+// DeleteAPIKey revokes an API key.
+func (db *PostgresDB) DeleteAPIKey(ctx context.Context, id uuid.UUID) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id.String())
+	}
+	return nil
+}
+
+// EnqueueNotification records a pending message of the given channel,
+// template and threshold to a ticket's customer. It returns
+// ErrNotificationSent if the ticket already got that message.
+func (db *PostgresDB) EnqueueNotification(ctx context.Context, ticketID uuid.UUID, channel, template string, threshold int, recipient, payload string) (*Notification, error) {
+	now := time.Now()
+	n := &Notification{
+		ID:            uuid.New(),
+		TicketID:      ticketID,
+		Channel:       channel,
+		Template:      template,
+		Threshold:     threshold,
+		Recipient:     recipient,
+		Payload:       payload,
+		Status:        NotificationPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	query := `INSERT INTO notifications (id, ticket_id, channel, template, threshold, recipient, payload, status, next_attempt_at, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			  RETURNING (SELECT queue_id FROM tickets WHERE id = $2), (SELECT ticket_number FROM tickets WHERE id = $2)`
+	err := db.pool.QueryRow(ctx, query, n.ID, n.TicketID, n.Channel, n.Template, n.Threshold, n.Recipient, n.Payload,
+		n.Status, n.NextAttemptAt, n.CreatedAt, n.UpdatedAt).Scan(&n.QueueID, &n.TicketNumber)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505": // unique_violation
+				return nil, fmt.Errorf("%w: %s %d", ErrNotificationSent, template, threshold)
+			case "23503": // foreign_key_violation
+				return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+			}
+		}
+		return nil, fmt.Errorf("failed to insert notification: %w", err)
+	}
+	return n, nil
+}
+
+// notificationColumns are the columns scanNotifications reads, from
+// notifications n joined with tickets t.
+const notificationColumns = `n.id, n.ticket_id, t.queue_id, t.ticket_number, n.channel, n.template, n.threshold, n.recipient, n.payload,
+			  n.status, n.attempts, n.last_error, n.next_attempt_at, n.sent_at, n.created_at, n.updated_at`
+
+// ClaimNotifications takes up to limit pending notifications that are due at
+// now, oldest due first, counts an attempt for each and reserves them until
+// now plus lease. Notifications locked by a concurrent claim are skipped.
+func (db *PostgresDB) ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Notification, error) {
+	query := `UPDATE notifications n
+			  SET attempts = n.attempts + 1, next_attempt_at = $2, updated_at = $1
+			  FROM tickets t
+			  WHERE t.id = n.ticket_id AND n.id IN (
+				  SELECT id FROM notifications
+				  WHERE status = 'pending' AND next_attempt_at <= $1
+				  ORDER BY next_attempt_at ASC, created_at ASC
+				  LIMIT $3
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING ` + notificationColumns
+	rows, err := db.pool.Query(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim notifications: %w", err)
+	}
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].CreatedAt.Before(notifications[j].CreatedAt) })
+	return notifications, nil
+}
+
+// MarkNotificationSent records that a notification was delivered at the
+// given time.
+func (db *PostgresDB) MarkNotificationSent(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE notifications SET status = 'sent', sent_at = $2, updated_at = $2 WHERE id = $1`
+	return db.updateNotification(ctx, query, id, at)
+}
+
+// MarkNotificationFailed records a failed delivery attempt. The notification
+// stays pending until retryAt, or is given up if retryAt is nil.
+func (db *PostgresDB) MarkNotificationFailed(ctx context.Context, id uuid.UUID, lastError string, retryAt *time.Time, at time.Time) error {
+	if retryAt == nil {
+		query := `UPDATE notifications SET status = 'failed', last_error = $3, updated_at = $2 WHERE id = $1`
+		return db.updateNotification(ctx, query, id, at, lastError)
+	}
+	query := `UPDATE notifications SET last_error = $3, next_attempt_at = $4, updated_at = $2 WHERE id = $1`
+	return db.updateNotification(ctx, query, id, at, lastError, *retryAt)
+}
+
+// updateNotification runs an UPDATE of the notification with the given ID,
+// its first argument, and reports a missing one as ErrNotificationNotFound.
+func (db *PostgresDB) updateNotification(ctx context.Context, query string, id uuid.UUID, args ...interface{}) error {
+	tag, err := db.pool.Exec(ctx, query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrNotificationNotFound, id.String())
+	}
+	return nil
+}
+
+// GetTicketNotifications returns the messages to a ticket's customer, oldest
+// first.
+func (db *PostgresDB) GetTicketNotifications(ctx context.Context, ticketID uuid.UUID) ([]*Notification, error) {
+	var exists bool
+	if err := db.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tickets WHERE id = $1)`, ticketID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+
+	query := `SELECT ` + notificationColumns + `
+			  FROM notifications n
+			  JOIN tickets t ON t.id = n.ticket_id
+			  WHERE n.ticket_id = $1
+			  ORDER BY n.created_at ASC`
+	rows, err := db.pool.Query(ctx, query, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	return scanNotifications(rows)
+}
+
+// ListNotifications returns the notifications selected by filter, newest
+// first.
+func (db *PostgresDB) ListNotifications(ctx context.Context, filter NotificationFilter) ([]*Notification, error) {
+	query := `SELECT ` + notificationColumns + `
+			  FROM notifications n
+			  JOIN tickets t ON t.id = n.ticket_id
+			  WHERE TRUE`
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.QueueID != nil {
+		query += ` AND t.queue_id = ` + arg(*filter.QueueID)
+	}
+	if filter.TicketID != nil {
+		query += ` AND n.ticket_id = ` + arg(*filter.TicketID)
+	}
+	if filter.Status != "" {
+		query += ` AND n.status = ` + arg(filter.Status)
+	}
+	query += ` ORDER BY n.created_at DESC LIMIT ` + arg(filter.limit())
+
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	return scanNotifications(rows)
+}
+
+// scanNotifications reads rows of notificationColumns and closes rows.
+func scanNotifications(rows pgx.Rows) ([]*Notification, error) {
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		err := rows.Scan(
+			&n.ID,
+			&n.TicketID,
+			&n.QueueID,
+			&n.TicketNumber,
+			&n.Channel,
+			&n.Template,
+			&n.Threshold,
+			&n.Recipient,
+			&n.Payload,
+			&n.Status,
+			&n.Attempts,
+			&n.LastError,
+			&n.NextAttemptAt,
+			&n.SentAt,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification row: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return notifications, nil
+}
+
+// SetMessageTemplate creates or replaces the text of a template name and
+// locale, for one queue or, with a nil queue ID, for every queue.
+func (db *PostgresDB) SetMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale, body string) (*MessageTemplate, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	t := &MessageTemplate{QueueID: queueID, Name: name, Locale: locale, Body: body, UpdatedAt: time.Now()}
+	query := `UPDATE message_templates SET body = $4, updated_at = $5
+			  WHERE queue_id IS NOT DISTINCT FROM $1 AND name = $2 AND locale = $3
+			  RETURNING id, created_at`
+	err = tx.QueryRow(ctx, query, queueID, name, locale, body, t.UpdatedAt).Scan(&t.ID, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		t.ID, t.CreatedAt = uuid.New(), t.UpdatedAt
+		query = `INSERT INTO message_templates (id, queue_id, name, locale, body, created_at, updated_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		_, err = tx.Exec(ctx, query, t.ID, queueID, name, locale, body, t.CreatedAt, t.UpdatedAt)
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+			return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+		}
+		return nil, fmt.Errorf("failed to save message template: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return t, nil
+}
+
+// GetMessageTemplates returns the customized texts of one queue, or the
+// global ones for a nil queue ID, ordered by name and locale.
+func (db *PostgresDB) GetMessageTemplates(ctx context.Context, queueID *uuid.UUID) ([]*MessageTemplate, error) {
+	if queueID != nil {
+		if _, err := db.GetQueueByID(ctx, *queueID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `SELECT id, queue_id, name, locale, body, created_at, updated_at
+			  FROM message_templates
+			  WHERE queue_id IS NOT DISTINCT FROM $1
+			  ORDER BY name ASC, locale ASC`
+	rows, err := db.pool.Query(ctx, query, queueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []*MessageTemplate{}
+	for rows.Next() {
+		t := &MessageTemplate{}
+		if err := rows.Scan(&t.ID, &t.QueueID, &t.Name, &t.Locale, &t.Body, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message template row: %w", err)
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return templates, nil
+}
+
+// DeleteMessageTemplate removes a customized text, so that the next one in
+// the fallback chain is used again.
+func (db *PostgresDB) DeleteMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale string) error {
+	query := `DELETE FROM message_templates WHERE queue_id IS NOT DISTINCT FROM $1 AND name = $2 AND locale = $3`
+	tag, err := db.pool.Exec(ctx, query, queueID, name, locale)
+	if err != nil {
+		return fmt.Errorf("failed to delete message template: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s %s", ErrTemplateNotFound, name, locale)
+	}
+	return nil
+}
+
+// LogTicketEvent records a ticket_history row with the given status and the
+// ticket's counter, without changing the ticket.
+func (db *PostgresDB) LogTicketEvent(ctx context.Context, ticketID uuid.UUID, status string, audit Audit) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var counterID *uuid.UUID
+	if err := tx.QueryRow(ctx, `SELECT counter_id FROM tickets WHERE id = $1`, ticketID).Scan(&counterID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if err := LogTicketStatusChange(ctx, tx, ticketID, status, counterID, audit); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateWebhook stores a new webhook subscription to the given event types.
+func (db *PostgresDB) CreateWebhook(ctx context.Context, url, secret string, events []string, description string) (*Webhook, error) {
+	now := time.Now()
+	w := &Webhook{
+		ID:          uuid.New(),
+		URL:         url,
+		Secret:      secret,
+		Events:      events,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	query := `INSERT INTO webhooks (id, url, secret, events, description, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.pool.Exec(ctx, query, w.ID, w.URL, w.Secret, joinEvents(w.Events), w.Description, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return w, nil
+}
+
+// webhookColumns are the columns scanWebhook reads.
+const webhookColumns = `id, url, secret, events, description, created_at, updated_at`
+
+// GetWebhookByID retrieves a webhook by its ID.
+func (db *PostgresDB) GetWebhookByID(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	w, err := scanWebhook(db.pool.QueryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, id.String())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return w, nil
+}
+
+// GetWebhooks retrieves all webhooks, newest first.
+func (db *PostgresDB) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	return scanWebhooks(rows)
+}
+
+// scanWebhooks reads rows of webhookColumns and closes rows.
+func scanWebhooks(rows pgx.Rows) ([]*Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook row: %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return webhooks, nil
+}
+
+// scanWebhook reads a row of webhookColumns.
+func scanWebhook(row pgx.Row) (*Webhook, error) {
+	w := &Webhook{}
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Description, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = splitEvents(events)
+	return w, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (db *PostgresDB) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrWebhookNotFound, id.String())
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent records a pending delivery of an event for every webhook
+// subscribed to its type that has none yet, and returns them.
+func (db *PostgresDB) EnqueueWebhookEvent(ctx context.Context, eventID uuid.UUID, eventType, payload string) ([]*WebhookDelivery, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	deliveries := []*WebhookDelivery{}
+	for _, w := range webhooks {
+		if !w.Subscribes(eventType) {
+			continue
+		}
+		d := newWebhookDelivery(w, eventID, eventType, payload, now)
+		query := `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				  ON CONFLICT (webhook_id, event_id) DO NOTHING`
+		tag, err := tx.Exec(ctx, query, d.ID, d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert webhook delivery: %w", err)
+		}
+		if tag.RowsAffected() == 1 {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries, nil
+}
+
+// webhookDeliveryColumns are the columns scanWebhookDeliveries reads, from
+// webhook_deliveries d joined with webhooks w.
+const webhookDeliveryColumns = `d.id, d.webhook_id, w.url, w.secret, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+			  d.last_error, d.response_status, d.next_attempt_at, d.delivered_at, d.created_at, d.updated_at`
+
+// ClaimWebhookDeliveries takes up to limit pending deliveries that are due at
+// now, oldest due first, counts an attempt for each and reserves them until
+// now plus lease. Deliveries locked by a concurrent claim are skipped.
+func (db *PostgresDB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries d
+			  SET attempts = d.attempts + 1, next_attempt_at = $2, updated_at = $1
+			  FROM webhooks w
+			  WHERE w.id = d.webhook_id AND d.id IN (
+				  SELECT id FROM webhook_deliveries
+				  WHERE status = 'pending' AND next_attempt_at <= $1
+				  ORDER BY next_attempt_at ASC, created_at ASC
+				  LIMIT $3
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING ` + webhookDeliveryColumns
+	rows, err := db.pool.Query(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt) })
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records that a delivery was accepted at the given
+// time with the given HTTP status.
+func (db *PostgresDB) MarkWebhookDelivered(ctx context.Context, id uuid.UUID, responseStatus int, at time.Time) error {
+	query := `UPDATE webhook_deliveries SET status = 'sent', response_status = $3, last_error = '', delivered_at = $2, updated_at = $2 WHERE id = $1`
+	return db.updateWebhookDelivery(ctx, query, id, at, responseStatus)
+}
+
+// MarkWebhookDeliveryFailed records a failed delivery attempt and the HTTP
+// status of its response, or 0 if there was none. The delivery stays pending
+// until retryAt, or is given up if retryAt is nil.
+func (db *PostgresDB) MarkWebhookDeliveryFailed(ctx context.Context, id uuid.UUID, responseStatus int, lastError string, retryAt *time.Time, at time.Time) error {
+	if retryAt == nil {
+		query := `UPDATE webhook_deliveries SET status = 'failed', response_status = $3, last_error = $4, updated_at = $2 WHERE id = $1`
+		return db.updateWebhookDelivery(ctx, query, id, at, responseStatus, lastError)
+	}
+	query := `UPDATE webhook_deliveries SET response_status = $3, last_error = $4, next_attempt_at = $5, updated_at = $2 WHERE id = $1`
+	return db.updateWebhookDelivery(ctx, query, id, at, responseStatus, lastError, *retryAt)
+}
+
+// updateWebhookDelivery runs an UPDATE of the delivery with the given ID, its
+// first argument, and reports a missing one as ErrDeliveryNotFound.
+func (db *PostgresDB) updateWebhookDelivery(ctx context.Context, query string, id uuid.UUID, args ...interface{}) error {
+	tag, err := db.pool.Exec(ctx, query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the deliveries selected by filter, newest
+// first.
+func (db *PostgresDB) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + `
+			  FROM webhook_deliveries d
+			  JOIN webhooks w ON w.id = d.webhook_id
+			  WHERE TRUE`
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.WebhookID != nil {
+		query += ` AND d.webhook_id = ` + arg(*filter.WebhookID)
+	}
+	if filter.EventType != "" {
+		query += ` AND d.event_type = ` + arg(filter.EventType)
+	}
+	if filter.Status != "" {
+		query += ` AND d.status = ` + arg(filter.Status)
+	}
+	query += ` ORDER BY d.created_at DESC LIMIT ` + arg(filter.limit())
+
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// RedeliverWebhookDelivery makes a sent or failed delivery pending again, due
+// at the given time, with a fresh set of attempts.
+func (db *PostgresDB) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID, at time.Time) (*WebhookDelivery, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM webhook_deliveries WHERE id = $1 FOR UPDATE`, id).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	if status == NotificationPending {
+		return nil, fmt.Errorf("%w: %s", ErrDeliveryPending, id.String())
+	}
+	query := `UPDATE webhook_deliveries d
+			  SET status = 'pending', attempts = 0, next_attempt_at = $2, updated_at = $2
+			  FROM webhooks w
+			  WHERE w.id = d.webhook_id AND d.id = $1
+			  RETURNING ` + webhookDeliveryColumns
+	rows, err := tx.Query(ctx, query, id, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries[0], nil
+}
+
+// scanWebhookDeliveries reads rows of webhookDeliveryColumns and closes rows.
+func scanWebhookDeliveries(rows pgx.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.URL,
+			&d.Secret,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.LastError,
+			&d.ResponseStatus,
+			&d.NextAttemptAt,
+			&d.DeliveredAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return deliveries, nil
+}
+
+// outboxEventColumns are the columns scanOutboxEvents reads.
+const outboxEventColumns = `id, seq, event_type, ticket_id, queue_id, actor_type, payload, attempts, last_error, created_at, dispatched_at`
+
+// GetPendingOutboxEvents returns up to limit events not yet dispatched, in the
+// order they were written.
+func (db *PostgresDB) GetPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	if limit <= 0 {
+		limit = DefaultOutboxBatch
+	}
+	rows, err := db.pool.Query(ctx, `SELECT `+outboxEventColumns+` FROM outbox_events
+			  WHERE dispatched_at IS NULL
+			  ORDER BY seq ASC
+			  LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox events: %w", err)
+	}
+	return scanOutboxEvents(rows)
+}
+
+// scanOutboxEvents reads the outboxEventColumns of rows and closes them.
+func scanOutboxEvents(rows pgx.Rows) ([]*OutboxEvent, error) {
+	defer rows.Close()
+	events := []*OutboxEvent{}
+	for rows.Next() {
+		e := &OutboxEvent{}
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Type, &e.TicketID, &e.QueueID, &e.ActorType, &e.Payload, &e.Attempts, &e.LastError, &e.CreatedAt, &e.DispatchedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event row: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxEventDispatched records an event as dispatched at at.
+func (db *PostgresDB) MarkOutboxEventDispatched(ctx context.Context, id uuid.UUID, at time.Time) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE outbox_events SET dispatched_at = $2 WHERE id = $1`, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event dispatched: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrEventNotFound, id.String())
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed counts a failed attempt at dispatching an event, which
+// stays pending.
+func (db *PostgresDB) MarkOutboxEventFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE outbox_events SET attempts = attempts + 1, last_error = $2 WHERE id = $1`, id, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrEventNotFound, id.String())
+	}
+	return nil
+}
+
+// DeleteDispatchedOutboxEvents deletes the events dispatched before before and
+// returns how many there were.
+func (db *PostgresDB) DeleteDispatchedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM outbox_events WHERE dispatched_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dispatched outbox events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
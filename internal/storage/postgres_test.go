@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/config"
+)
+
+// newPostgresHarness connects to the database in DATABASE_URL and skips the
+// test when it is not set. Each test works on its own queues, so the suite can
+// share a database with other data.
+func newPostgresHarness(t *testing.T) *storeHarness {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" || IsSQLiteURL(databaseURL) {
+		t.Skip("DATABASE_URL is not set to a PostgreSQL database")
+	}
+
+	m, err := migrate.New("file://../../migrations", databaseURL)
+	if err != nil {
+		t.Fatalf("failed to create migrate instance: %v", err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	m.Close()
+
+	db, err := NewPostgresDB(&config.Config{DatabaseURL: databaseURL})
+	if err != nil {
+		t.Fatalf("NewPostgresDB: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	return &storeHarness{
+		Store: db,
+		rewindDay: func(t *testing.T, queueID uuid.UUID) {
+			ctx := context.Background()
+			if _, err := db.pool.Exec(ctx, `UPDATE tickets SET created_at = created_at - INTERVAL '1 day' WHERE queue_id = $1`, queueID); err != nil {
+				t.Fatalf("backdate tickets: %v", err)
+			}
+			q, err := db.GetQueueByID(ctx, queueID)
+			if err != nil {
+				t.Fatalf("get queue: %v", err)
+			}
+			yesterday := q.Period(time.Now().Add(-24 * time.Hour))
+			if _, err := db.pool.Exec(ctx, `UPDATE queue_counters SET number_period = $1 WHERE queue_id = $2`, yesterday, queueID); err != nil {
+				t.Fatalf("backdate counter: %v", err)
+			}
+		},
+		setHistoryTime: func(t *testing.T, ticketID uuid.UUID, status string, at time.Time) {
+			if _, err := db.pool.Exec(context.Background(), `UPDATE ticket_history SET timestamp = $1 WHERE ticket_id = $2 AND status = $3`, at, ticketID, status); err != nil {
+				t.Fatalf("set history time: %v", err)
+			}
+		},
+		history: func(t *testing.T, ticketID uuid.UUID) []string {
+			rows, err := db.pool.Query(context.Background(), `SELECT status FROM ticket_history WHERE ticket_id = $1 ORDER BY timestamp, created_at`, ticketID)
+			if err != nil {
+				t.Fatalf("query history: %v", err)
+			}
+			defer rows.Close()
+			var statuses []string
+			for rows.Next() {
+				var status string
+				if err := rows.Scan(&status); err != nil {
+					t.Fatalf("scan history: %v", err)
+				}
+				statuses = append(statuses, status)
+			}
+			return statuses
+		},
+	}
+}
+
+func TestPostgresDB(t *testing.T) {
+	runStoreConformance(t, newPostgresHarness)
+}
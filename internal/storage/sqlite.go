@@ -0,0 +1,1869 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3" // Also registers the sqlite3 driver
+	"github.com/smartq/smartq/internal/config"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// SQLiteScheme is the DATABASE_URL scheme that selects the embedded SQLite backend,
+// e.g. sqlite:///var/lib/smartq.db.
+const SQLiteScheme = "sqlite://"
+
+// IsSQLiteURL reports whether databaseURL points at an SQLite database file.
+func IsSQLiteURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, SQLiteScheme)
+}
+
+// SQLitePath returns the database file path encoded in an sqlite:// URL.
+func SQLitePath(databaseURL string) string {
+	return strings.TrimPrefix(databaseURL, SQLiteScheme)
+}
+
+// SQLiteDB is a Store backed by an embedded SQLite database file.
+// It is meant for single-box installs that cannot run PostgreSQL.
+type SQLiteDB struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteDB)(nil)
+
+func NewSQLiteDB(cfg *config.Config) (*SQLiteDB, error) {
+	// BEGIN IMMEDIATE takes the write lock up front so that concurrent
+	// CreateTicket calls serialize instead of racing on the ticket number.
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", SQLitePath(cfg.DatabaseURL))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sqlite database: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+
+	log.Println("Successfully opened SQLite database!")
+	return &SQLiteDB{db: db}, nil
+}
+
+func (s *SQLiteDB) Close() {
+	s.db.Close()
+	log.Println("SQLite database closed.")
+}
+
+// CreateQueue inserts a new queue into the database.
+// Zero-valued fields of format are filled with the queue package defaults;
+// notifyThresholds may be empty.
+func (s *SQLiteDB) CreateQueue(ctx context.Context, name string, format queue.TicketFormat, notifyThresholds []int) (*Queue, error) {
+	queue := &Queue{
+		ID:               uuid.New(),
+		Name:             name,
+		TicketFormat:     format.WithDefaults(),
+		NotifyThresholds: append([]int{}, notifyThresholds...),
+		CreatedAt:        time.Now().UTC(),
+	}
+
+	query := `INSERT INTO queues (id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, notify_thresholds, created_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query,
+		queue.ID,
+		queue.Name,
+		queue.Prefix,
+		queue.Width,
+		queue.StartNumber,
+		queue.ResetPolicy,
+		joinThresholds(queue.NotifyThresholds),
+		queue.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert queue: %w", err)
+	}
+
+	return queue, nil
+}
+
+// GetQueueByID retrieves a queue from the database by its ID.
+func (s *SQLiteDB) GetQueueByID(ctx context.Context, id uuid.UUID) (*Queue, error) {
+	queue := &Queue{}
+	var thresholds string
+	query := `SELECT id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, notify_thresholds, created_at FROM queues WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&queue.ID, &queue.Name, &queue.Prefix, &queue.Width, &queue.StartNumber, &queue.ResetPolicy, &thresholds, &queue.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get queue by ID: %w", err)
+	}
+	queue.NotifyThresholds = splitThresholds(thresholds)
+	return queue, nil
+}
+
+// SetQueueNotifyThresholds replaces the numbers of people ahead at which the
+// queue's waiting customers get a text.
+func (s *SQLiteDB) SetQueueNotifyThresholds(ctx context.Context, queueID uuid.UUID, thresholds []int) (*Queue, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE queues SET notify_thresholds = ? WHERE id = ?`, joinThresholds(thresholds), queueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update queue: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to update queue: %w", err)
+	} else if affected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	return s.GetQueueByID(ctx, queueID)
+}
+
+// GetQueues retrieves all queues from the database.
+func (s *SQLiteDB) GetQueues(ctx context.Context) ([]*Queue, error) {
+	var queues []*Queue
+	query := `SELECT id, name, ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy, notify_thresholds, created_at FROM queues ORDER BY created_at DESC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queues: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		queue := &Queue{}
+		var thresholds string
+		if err := rows.Scan(&queue.ID, &queue.Name, &queue.Prefix, &queue.Width, &queue.StartNumber, &queue.ResetPolicy, &thresholds, &queue.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan queue row: %w", err)
+		}
+		queue.NotifyThresholds = splitThresholds(thresholds)
+		queues = append(queues, queue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return queues, nil
+}
+
+// GetTicketByID retrieves a ticket by its ID.
+func (s *SQLiteDB) GetTicketByID(ctx context.Context, id uuid.UUID) (*Ticket, error) {
+	return s.getTicket(ctx, `t.id = ?`, id, id.String())
+}
+
+// GetTicketByAccessTokenHash retrieves the ticket with the given access token hash.
+func (s *SQLiteDB) GetTicketByAccessTokenHash(ctx context.Context, accessTokenHash string) (*Ticket, error) {
+	if accessTokenHash == "" {
+		return nil, fmt.Errorf("%w: no access token", ErrTicketNotFound)
+	}
+	return s.getTicket(ctx, `t.access_token_hash = ?`, accessTokenHash, "by access token")
+}
+
+// GetActiveTicketByPhone retrieves the most recently created waiting or
+// serving ticket with the given customer phone.
+func (s *SQLiteDB) GetActiveTicketByPhone(ctx context.Context, phone string) (*Ticket, error) {
+	if phone == "" {
+		return nil, fmt.Errorf("%w: no phone number", ErrTicketNotFound)
+	}
+	return s.getTicket(ctx, `t.customer_phone = ? AND t.status IN ('waiting', 'serving')
+			  ORDER BY t.created_at DESC LIMIT 1`, phone, "by phone number")
+}
+
+// getTicket retrieves the ticket matching the condition, which compares a
+// column of tickets t with a single placeholder. Lookup describes the ticket
+// in errors.
+func (s *SQLiteDB) getTicket(ctx context.Context, condition string, arg interface{}, lookup string) (*Ticket, error) {
+	ticket := &Ticket{}
+	query := `SELECT t.id, t.queue_id, t.customer_name, t.customer_phone, t.ticket_number, t.status, t.position, t.priority, t.counter_id, c.name, t.deferred_until, t.locale, t.created_at, t.updated_at
+			  FROM tickets t
+			  LEFT JOIN counters c ON c.id = t.counter_id
+			  WHERE ` + condition
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(
+		&ticket.ID,
+		&ticket.QueueID,
+		&ticket.CustomerName,
+		&ticket.CustomerPhone,
+		&ticket.TicketNumber,
+		&ticket.Status,
+		&ticket.Position,
+		&ticket.Priority,
+		&ticket.CounterID,
+		&ticket.CounterName,
+		&ticket.DeferredUntil,
+		&ticket.Locale,
+		&ticket.CreatedAt,
+		&ticket.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, lookup)
+		}
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// GetTicketsByQueueID retrieves all tickets for a given queue ID.
+func (s *SQLiteDB) GetTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error) {
+	return s.getTicketsByQueue(ctx, queueID, "")
+}
+
+// GetActiveTicketsByQueueID retrieves the waiting and serving tickets of a
+// queue.
+func (s *SQLiteDB) GetActiveTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error) {
+	return s.getTicketsByQueue(ctx, queueID, ` AND t.status IN ('waiting', 'serving')`)
+}
+
+// getTicketsByQueue retrieves the tickets of a queue matching the SQL condition
+// filter, if any, in call order.
+func (s *SQLiteDB) getTicketsByQueue(ctx context.Context, queueID uuid.UUID, filter string) ([]*Ticket, error) {
+	var tickets []*Ticket
+	query := `SELECT t.id, t.queue_id, t.customer_name, t.customer_phone, t.ticket_number, t.status, t.position, t.priority, t.counter_id, c.name, t.deferred_until, t.locale, t.created_at, t.updated_at
+			  FROM tickets t
+			  LEFT JOIN counters c ON c.id = t.counter_id
+			  WHERE t.queue_id = ?` + filter + `
+			  ORDER BY t.priority DESC, t.position ASC, t.created_at ASC`
+	rows, err := s.db.QueryContext(ctx, query, queueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tickets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ticket := &Ticket{}
+		err := rows.Scan(
+			&ticket.ID,
+			&ticket.QueueID,
+			&ticket.CustomerName,
+			&ticket.CustomerPhone,
+			&ticket.TicketNumber,
+			&ticket.Status,
+			&ticket.Position,
+			&ticket.Priority,
+			&ticket.CounterID,
+			&ticket.CounterName,
+			&ticket.DeferredUntil,
+			&ticket.Locale,
+			&ticket.CreatedAt,
+			&ticket.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ticket row: %w", err)
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// CreateTicket inserts a new ticket into the database.
+func (s *SQLiteDB) CreateTicket(ctx context.Context, queueID uuid.UUID, customerName, customerPhone, locale string, priority int, accessTokenHash string, audit Audit) (*Ticket, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Timestamps are stored in UTC so that they compare correctly as text.
+	now := time.Now().UTC()
+
+	ticketNumber, position, err := s.nextTicketCounter(ctx, tx, queueID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := &Ticket{
+		ID:            uuid.New(),
+		QueueID:       queueID,
+		CustomerName:  customerName,
+		CustomerPhone: customerPhone,
+		TicketNumber:  ticketNumber,
+		Status:        "waiting",
+		Position:      position,
+		Priority:      priority,
+		Locale:        locale,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	query := `INSERT INTO tickets (id, queue_id, customer_name, customer_phone, ticket_number, status, position, priority, access_token_hash, locale, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query,
+		ticket.ID,
+		ticket.QueueID,
+		ticket.CustomerName,
+		ticket.CustomerPhone,
+		ticket.TicketNumber,
+		ticket.Status,
+		ticket.Position,
+		ticket.Priority,
+		accessTokenHash,
+		ticket.Locale,
+		ticket.CreatedAt,
+		ticket.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert ticket: %w", err)
+	}
+
+	if err := logTicketStatusChangeSQL(ctx, tx, ticket.ID, ticket.Status, nil, audit); err != nil {
+		return nil, fmt.Errorf("failed to log initial ticket status: %w", err)
+	}
+	if err := insertTicketEventSQL(ctx, tx, ticket, ticket.Status, audit); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// nextTicketCounter increments the queue's counter row and returns the new
+// formatted ticket number and position, like its PostgresDB counterpart.
+func (s *SQLiteDB) nextTicketCounter(ctx context.Context, tx *sql.Tx, queueID uuid.UUID, now time.Time) (string, int, error) {
+	var format queue.TicketFormat
+	err := tx.QueryRowContext(ctx, `
+		SELECT ticket_prefix, ticket_number_width, ticket_start_number, ticket_reset_policy
+		FROM queues
+		WHERE id = ?`, queueID).Scan(&format.Prefix, &format.Width, &format.StartNumber, &format.ResetPolicy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", 0, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+		}
+		return "", 0, fmt.Errorf("failed to get ticket format: %w", err)
+	}
+
+	query := `
+		INSERT INTO queue_counters (queue_id, last_number, last_position, number_period)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (queue_id) DO UPDATE SET
+			last_number = CASE
+				WHEN queue_counters.number_period = excluded.number_period THEN queue_counters.last_number + 1
+				ELSE excluded.last_number
+			END,
+			last_position = queue_counters.last_position + 1,
+			number_period = excluded.number_period
+		RETURNING last_number, last_position`
+
+	var number, position int
+	if err := tx.QueryRowContext(ctx, query, queueID, format.StartNumber, format.Period(now)).Scan(&number, &position); err != nil {
+		return "", 0, fmt.Errorf("failed to allocate ticket number: %w", err)
+	}
+	return format.Format(number), position, nil
+}
+
+// UpdateTicketStatus moves a ticket to a new status, optionally assigning it to
+// a counter. It returns an error wrapping ErrInvalidTransition if the ticket
+// state machine forbids the move.
+func (s *SQLiteDB) UpdateTicketStatus(ctx context.Context, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	// The transaction starts with BEGIN IMMEDIATE, so no other writer can
+	// change the ticket between the transition check and the update.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var currentStatus string
+	var queueID uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT status, queue_id FROM tickets WHERE id = ?`, ticketID).Scan(&currentStatus, &queueID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return nil, fmt.Errorf("failed to get ticket status: %w", err)
+	}
+	if err := checkTransition(currentStatus, status); err != nil {
+		return nil, err
+	}
+	if err := checkCounterInQueueSQL(ctx, tx, counterID, queueID); err != nil {
+		return nil, err
+	}
+
+	ticket, err := s.setTicketStatus(ctx, tx, ticketID, status, counterID, audit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// CallNextTicket moves the highest-priority, earliest waiting ticket of a queue
+// to serving, optionally at the given counter. SQLite has no row locks; BEGIN IMMEDIATE serializes writers, so
+// concurrent callers never get the same ticket.
+func (s *SQLiteDB) CallNextTicket(ctx context.Context, queueID uuid.UUID, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM queues WHERE id = ?)`, queueID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check queue: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+	}
+	if err := checkCounterInQueueSQL(ctx, tx, counterID, queueID); err != nil {
+		return nil, err
+	}
+
+	var ticketID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		SELECT id
+		FROM tickets
+		WHERE queue_id = ? AND status = 'waiting' AND (deferred_until IS NULL OR deferred_until <= ?)
+		ORDER BY priority DESC, position ASC, created_at ASC
+		LIMIT 1`, queueID, time.Now().UTC()).Scan(&ticketID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrNoWaitingTickets, queueID.String())
+		}
+		return nil, fmt.Errorf("failed to select next ticket: %w", err)
+	}
+
+	ticket, err := s.setTicketStatus(ctx, tx, ticketID, "serving", counterID, audit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// DeferTicket lets a waiting ticket go behind the next places waiting tickets
+// of the same priority and/or keeps it from being called before until, like
+// its PostgresDB counterpart.
+func (s *SQLiteDB) DeferTicket(ctx context.Context, ticketID uuid.UUID, places int, until *time.Time, audit Audit) (*Ticket, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var queueID uuid.UUID
+	var priority, position int
+	var createdAt time.Time
+	err = tx.QueryRowContext(ctx, `SELECT status, queue_id, priority, position, created_at FROM tickets WHERE id = ?`, ticketID).
+		Scan(&status, &queueID, &priority, &position, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return nil, fmt.Errorf("failed to get ticket status: %w", err)
+	}
+	if status != ticket.StatusWaiting {
+		return nil, fmt.Errorf("%w: only waiting tickets can be deferred, ticket is %s", ErrInvalidTransition, status)
+	}
+
+	if places > 0 {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, position
+			FROM tickets
+			WHERE queue_id = ? AND status = 'waiting' AND priority = ?
+			  AND (position > ? OR (position = ? AND created_at > ?))
+			ORDER BY position ASC, created_at ASC
+			LIMIT ?`, queueID, priority, position, position, createdAt.UTC(), places)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select tickets behind: %w", err)
+		}
+		var behindIDs []uuid.UUID
+		var behindPositions []int
+		for rows.Next() {
+			var id uuid.UUID
+			var p int
+			if err := rows.Scan(&id, &p); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan ticket row: %w", err)
+			}
+			behindIDs = append(behindIDs, id)
+			behindPositions = append(behindPositions, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error after iterating rows: %w", err)
+		}
+
+		previous := position
+		for i, id := range behindIDs {
+			if _, err := tx.ExecContext(ctx, `UPDATE tickets SET position = ? WHERE id = ?`, previous, id); err != nil {
+				return nil, fmt.Errorf("failed to move ticket up: %w", err)
+			}
+			previous = behindPositions[i]
+		}
+		position = previous
+	}
+
+	var deferredUntil *time.Time
+	if until != nil {
+		utc := until.UTC()
+		deferredUntil = &utc
+	}
+	query := `UPDATE tickets SET position = ?, deferred_until = COALESCE(?, deferred_until), updated_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, position, deferredUntil, time.Now().UTC(), ticketID); err != nil {
+		return nil, fmt.Errorf("failed to defer ticket: %w", err)
+	}
+
+	t := &Ticket{}
+	query = `SELECT t.id, t.queue_id, t.customer_name, t.customer_phone, t.ticket_number, t.status, t.position, t.priority, t.counter_id, c.name, t.deferred_until, t.locale, t.created_at, t.updated_at
+			 FROM tickets t
+			 LEFT JOIN counters c ON c.id = t.counter_id
+			 WHERE t.id = ?`
+	err = tx.QueryRowContext(ctx, query, ticketID).Scan(
+		&t.ID,
+		&t.QueueID,
+		&t.CustomerName,
+		&t.CustomerPhone,
+		&t.TicketNumber,
+		&t.Status,
+		&t.Position,
+		&t.Priority,
+		&t.CounterID,
+		&t.CounterName,
+		&t.DeferredUntil,
+		&t.Locale,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deferred ticket: %w", err)
+	}
+
+	if err := logTicketStatusChangeSQL(ctx, tx, t.ID, ticket.StatusDeferred, t.CounterID, audit); err != nil {
+		return nil, fmt.Errorf("failed to log ticket deferral: %w", err)
+	}
+	if err := insertTicketEventSQL(ctx, tx, t, ticket.StatusDeferred, audit); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return t, nil
+}
+
+// setTicketStatus updates a ticket's status and counter, logs the change and
+// returns the updated ticket. The caller must have validated the transition
+// and the counter.
+func (s *SQLiteDB) setTicketStatus(ctx context.Context, tx *sql.Tx, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) (*Ticket, error) {
+	query := `UPDATE tickets SET status = ?, counter_id = COALESCE(?, counter_id), updated_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, status, counterID, time.Now().UTC(), ticketID); err != nil {
+		return nil, fmt.Errorf("failed to update ticket status: %w", err)
+	}
+
+	ticket := &Ticket{}
+	query = `SELECT t.id, t.queue_id, t.customer_name, t.customer_phone, t.ticket_number, t.status, t.position, t.priority, t.counter_id, c.name, t.deferred_until, t.locale, t.created_at, t.updated_at
+			 FROM tickets t
+			 LEFT JOIN counters c ON c.id = t.counter_id
+			 WHERE t.id = ?`
+	err := tx.QueryRowContext(ctx, query, ticketID).Scan(
+		&ticket.ID,
+		&ticket.QueueID,
+		&ticket.CustomerName,
+		&ticket.CustomerPhone,
+		&ticket.TicketNumber,
+		&ticket.Status,
+		&ticket.Position,
+		&ticket.Priority,
+		&ticket.CounterID,
+		&ticket.CounterName,
+		&ticket.DeferredUntil,
+		&ticket.Locale,
+		&ticket.CreatedAt,
+		&ticket.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read updated ticket: %w", err)
+	}
+
+	if err := logTicketStatusChangeSQL(ctx, tx, ticket.ID, ticket.Status, ticket.CounterID, audit); err != nil {
+		return nil, fmt.Errorf("failed to log ticket status change: %w", err)
+	}
+	if err := insertTicketEventSQL(ctx, tx, ticket, ticket.Status, audit); err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// checkCounterInQueueSQL is the database/sql counterpart of checkCounterInQueue.
+func checkCounterInQueueSQL(ctx context.Context, tx *sql.Tx, counterID *uuid.UUID, queueID uuid.UUID) error {
+	if counterID == nil {
+		return nil
+	}
+	var counterQueueID uuid.UUID
+	err := tx.QueryRowContext(ctx, `SELECT queue_id FROM counters WHERE id = ?`, *counterID).Scan(&counterQueueID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrCounterNotFound, counterID.String())
+		}
+		return fmt.Errorf("failed to get counter: %w", err)
+	}
+	if counterQueueID != queueID {
+		return fmt.Errorf("%w: %s", ErrCounterNotInQueue, counterID.String())
+	}
+	return nil
+}
+
+// logTicketStatusChangeSQL is the database/sql counterpart of LogTicketStatusChange.
+func logTicketStatusChangeSQL(ctx context.Context, tx *sql.Tx, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) error {
+	now := time.Now().UTC()
+	audit = audit.withDefaults()
+	query := `INSERT INTO ticket_history (id, ticket_id, status, counter_id, actor_type, actor_id, actor_name, source_ip, user_agent, reason, timestamp, created_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, query,
+		uuid.New(),
+		ticketID,
+		status,
+		counterID,
+		audit.ActorType,
+		audit.ActorID,
+		audit.ActorName,
+		audit.SourceIP,
+		audit.UserAgent,
+		audit.Reason,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log ticket status change: %w", err)
+	}
+	return nil
+}
+
+// insertTicketEventSQL is the database/sql counterpart of insertTicketEvent.
+func insertTicketEventSQL(ctx context.Context, tx *sql.Tx, t *Ticket, status string, audit Audit) error {
+	e, err := newTicketEvent(t, status, audit, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox_events (id, event_type, ticket_id, queue_id, actor_type, payload, created_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, query, e.ID, e.Type, e.TicketID, e.QueueID, e.ActorType, e.Payload, e.CreatedAt); err != nil {
+		return fmt.Errorf("failed to write ticket event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditTrail retrieves the ticket_history rows matching filter, newest first.
+func (s *SQLiteDB) GetAuditTrail(ctx context.Context, filter AuditFilter) ([]*TicketHistory, error) {
+	query := `SELECT th.id, th.ticket_id, t.queue_id, t.ticket_number, th.status, th.counter_id,
+			  th.actor_type, th.actor_id, th.actor_name, th.source_ip, th.user_agent, th.reason, th.timestamp, th.created_at
+			  FROM ticket_history th
+			  JOIN tickets t ON t.id = th.ticket_id
+			  WHERE 1 = 1`
+	var args []interface{}
+	if filter.TicketID != nil {
+		query += ` AND th.ticket_id = ?`
+		args = append(args, *filter.TicketID)
+	}
+	if filter.ActorType != "" {
+		query += ` AND th.actor_type = ?`
+		args = append(args, filter.ActorType)
+	}
+	if filter.ActorID != nil {
+		query += ` AND th.actor_id = ?`
+		args = append(args, *filter.ActorID)
+	}
+	if filter.From != nil {
+		query += ` AND th.timestamp >= ?`
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		query += ` AND th.timestamp < ?`
+		args = append(args, filter.To.UTC())
+	}
+	query += ` ORDER BY th.timestamp DESC, th.created_at DESC LIMIT ?`
+	args = append(args, filter.limit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ticket history: %w", err)
+	}
+	return scanTicketHistorySQL(rows)
+}
+
+// GetTicketHistory retrieves a ticket's status changes, oldest first.
+func (s *SQLiteDB) GetTicketHistory(ctx context.Context, ticketID uuid.UUID) ([]*TicketHistory, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tickets WHERE id = ?)`, ticketID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+
+	query := `SELECT th.id, th.ticket_id, t.queue_id, t.ticket_number, th.status, th.counter_id,
+			  th.actor_type, th.actor_id, th.actor_name, th.source_ip, th.user_agent, th.reason, th.timestamp, th.created_at
+			  FROM ticket_history th
+			  JOIN tickets t ON t.id = th.ticket_id
+			  WHERE th.ticket_id = ?
+			  ORDER BY th.timestamp ASC, th.created_at ASC`
+	rows, err := s.db.QueryContext(ctx, query, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ticket history: %w", err)
+	}
+	return scanTicketHistorySQL(rows)
+}
+
+// scanTicketHistorySQL reads the ticket_history rows selected by GetAuditTrail
+// and GetTicketHistory and closes rows.
+func scanTicketHistorySQL(rows *sql.Rows) ([]*TicketHistory, error) {
+	defer rows.Close()
+
+	var entries []*TicketHistory
+	for rows.Next() {
+		h := &TicketHistory{}
+		err := rows.Scan(
+			&h.ID,
+			&h.TicketID,
+			&h.QueueID,
+			&h.TicketNumber,
+			&h.Status,
+			&h.CounterID,
+			&h.ActorType,
+			&h.ActorID,
+			&h.ActorName,
+			&h.SourceIP,
+			&h.UserAgent,
+			&h.Reason,
+			&h.Timestamp,
+			&h.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ticket history row: %w", err)
+		}
+		entries = append(entries, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CalculateEstimatedWaitTime calculates the estimated wait time for a given queue
+// the same way PostgresDB does: the average time the last 10 served tickets
+// spent between 'waiting' and 'served'.
+func (s *SQLiteDB) CalculateEstimatedWaitTime(ctx context.Context, queueID uuid.UUID) (time.Duration, error) {
+	query := `
+		SELECT
+			th_waiting.timestamp, th_served.timestamp
+		FROM
+			tickets t
+		JOIN
+			ticket_history th_waiting ON t.id = th_waiting.ticket_id AND th_waiting.status = 'waiting'
+		JOIN
+			ticket_history th_served ON t.id = th_served.ticket_id AND th_served.status = 'served'
+		WHERE
+			t.queue_id = ?
+			AND t.status = 'served'
+		ORDER BY
+			th_served.timestamp DESC
+		LIMIT 10
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, queueID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query waiting durations: %w", err)
+	}
+	defer rows.Close()
+
+	var totalDurationSeconds float64
+	var count int
+	for rows.Next() {
+		var waitingAt, servedAt time.Time
+		if err := rows.Scan(&waitingAt, &servedAt); err != nil {
+			return 0, fmt.Errorf("failed to scan waiting duration: %w", err)
+		}
+		totalDurationSeconds += servedAt.Sub(waitingAt).Seconds()
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	if count == 0 {
+		return 0, nil // No historical data, so 0 wait time
+	}
+
+	averageDurationSeconds := totalDurationSeconds / float64(count)
+	return time.Duration(averageDurationSeconds) * time.Second, nil
+}
+
+// CreateCounter adds a counter to a queue. Counter names are unique per queue.
+func (s *SQLiteDB) CreateCounter(ctx context.Context, queueID uuid.UUID, name string) (*Counter, error) {
+	now := time.Now().UTC()
+	counter := &Counter{
+		ID:        uuid.New(),
+		QueueID:   queueID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	query := `INSERT INTO counters (id, queue_id, name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, counter.ID, counter.QueueID, counter.Name, counter.CreatedAt, counter.UpdatedAt)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) {
+			switch sqliteErr.ExtendedCode {
+			case sqlite3.ErrConstraintForeignKey:
+				return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+			case sqlite3.ErrConstraintUnique:
+				return nil, fmt.Errorf("%w: %q", ErrCounterExists, name)
+			}
+		}
+		return nil, fmt.Errorf("failed to insert counter: %w", err)
+	}
+
+	return counter, nil
+}
+
+// GetCounterByID retrieves a counter by its ID.
+func (s *SQLiteDB) GetCounterByID(ctx context.Context, id uuid.UUID) (*Counter, error) {
+	counter := &Counter{}
+	query := `SELECT id, queue_id, name, created_at, updated_at FROM counters WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&counter.ID, &counter.QueueID, &counter.Name, &counter.CreatedAt, &counter.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get counter by ID: %w", err)
+	}
+	return counter, nil
+}
+
+// GetCountersByQueueID retrieves all counters of a queue, ordered by name.
+func (s *SQLiteDB) GetCountersByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Counter, error) {
+	var counters []*Counter
+	query := `SELECT id, queue_id, name, created_at, updated_at FROM counters WHERE queue_id = ? ORDER BY name ASC`
+	rows, err := s.db.QueryContext(ctx, query, queueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query counters: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		counter := &Counter{}
+		if err := rows.Scan(&counter.ID, &counter.QueueID, &counter.Name, &counter.CreatedAt, &counter.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan counter row: %w", err)
+		}
+		counters = append(counters, counter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return counters, nil
+}
+
+// UpdateCounter renames a counter.
+func (s *SQLiteDB) UpdateCounter(ctx context.Context, id uuid.UUID, name string) (*Counter, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE counters SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now().UTC(), id)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, fmt.Errorf("%w: %q", ErrCounterExists, name)
+		}
+		return nil, fmt.Errorf("failed to update counter: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to update counter: %w", err)
+	} else if n == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+	}
+	return s.GetCounterByID(ctx, id)
+}
+
+// DeleteCounter removes a counter. Tickets and history entries that referred to
+// it keep their data but lose the counter reference.
+func (s *SQLiteDB) DeleteCounter(ctx context.Context, id uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM counters WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete counter: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete counter: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrCounterNotFound, id.String())
+	}
+
+	// The counter_id columns carry no foreign key in SQLite (see migration
+	// 000008), so clear the references here.
+	if _, err := tx.ExecContext(ctx, `UPDATE tickets SET counter_id = NULL WHERE counter_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear ticket counters: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE ticket_history SET counter_id = NULL WHERE counter_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear ticket history counters: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateUser inserts a staff account. Usernames are unique.
+func (s *SQLiteDB) CreateUser(ctx context.Context, username, passwordHash, role string) (*User, error) {
+	now := time.Now().UTC()
+	user := &User{
+		ID:           uuid.New(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	query := `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, user.ID, user.Username, user.PasswordHash, user.Role, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, fmt.Errorf("%w: %q", ErrUserExists, username)
+		}
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByID retrieves a staff account by its ID.
+func (s *SQLiteDB) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	user := &User{}
+	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername retrieves a staff account by its username.
+func (s *SQLiteDB) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	user := &User{}
+	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users WHERE username = ?`
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %q", ErrUserNotFound, username)
+		}
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	}
+	return user, nil
+}
+
+// GetUsers retrieves all staff accounts, ordered by username.
+func (s *SQLiteDB) GetUsers(ctx context.Context) ([]*User, error) {
+	var users []*User
+	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users ORDER BY username ASC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// DeleteUser removes a staff account.
+func (s *SQLiteDB) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, id.String())
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key. Only the key's hash and display prefix
+// are kept; the key itself is shown to the admin once and never stored.
+func (s *SQLiteDB) CreateAPIKey(ctx context.Context, name, keyPrefix, keyHash string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		ID:        uuid.New(),
+		Name:      name,
+		KeyPrefix: keyPrefix,
+		KeyHash:   keyHash,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if expiresAt != nil {
+		at := expiresAt.UTC()
+		key.ExpiresAt = &at
+	}
+
+	query := `INSERT INTO api_keys (id, name, key_prefix, key_hash, scopes, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, key.ID, key.Name, key.KeyPrefix, key.KeyHash, joinScopes(key.Scopes), key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key.
+func (s *SQLiteDB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes string
+	query := `SELECT id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE key_hash = ?`
+	err := s.db.QueryRowContext(ctx, query, keyHash).Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	key.Scopes = splitScopes(scopes)
+	return key, nil
+}
+
+// GetAPIKeys retrieves all API keys, newest first.
+func (s *SQLiteDB) GetAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	var keys []*APIKey
+	query := `SELECT id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, created_at FROM api_keys ORDER BY created_at DESC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key := &APIKey{}
+		var scopes string
+		if err := rows.Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key row: %w", err)
+		}
+		key.Scopes = splitScopes(scopes)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey records that an API key was used at usedAt.
+func (s *SQLiteDB) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, usedAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id.String())
+	}
+	return nil
+}
+
+// DeleteAPIKey revokes an API key.
+func (s *SQLiteDB) DeleteAPIKey(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id.String())
+	}
+	return nil
+}
+
+// EnqueueNotification records a pending message of the given channel,
+// template and threshold to a ticket's customer. It returns
+// ErrNotificationSent if the ticket already got that message.
+func (s *SQLiteDB) EnqueueNotification(ctx context.Context, ticketID uuid.UUID, channel, template string, threshold int, recipient, payload string) (*Notification, error) {
+	now := time.Now().UTC()
+	n := &Notification{
+		ID:            uuid.New(),
+		TicketID:      ticketID,
+		Channel:       channel,
+		Template:      template,
+		Threshold:     threshold,
+		Recipient:     recipient,
+		Payload:       payload,
+		Status:        NotificationPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	err := s.db.QueryRowContext(ctx, `SELECT queue_id, ticket_number FROM tickets WHERE id = ?`, ticketID).Scan(&n.QueueID, &n.TicketNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+
+	query := `INSERT INTO notifications (id, ticket_id, channel, template, threshold, recipient, payload, status, next_attempt_at, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.ExecContext(ctx, query, n.ID, n.TicketID, n.Channel, n.Template, n.Threshold, n.Recipient, n.Payload,
+		n.Status, n.NextAttemptAt, n.CreatedAt, n.UpdatedAt)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, fmt.Errorf("%w: %s %d", ErrNotificationSent, template, threshold)
+		}
+		return nil, fmt.Errorf("failed to insert notification: %w", err)
+	}
+	return n, nil
+}
+
+// notificationColumnsSQL are the columns scanNotificationsSQL reads, from
+// notifications n joined with tickets t.
+const notificationColumnsSQL = `n.id, n.ticket_id, t.queue_id, t.ticket_number, n.channel, n.template, n.threshold, n.recipient, n.payload,
+			  n.status, n.attempts, n.last_error, n.next_attempt_at, n.sent_at, n.created_at, n.updated_at`
+
+// ClaimNotifications takes up to limit pending notifications that are due at
+// now, oldest due first, counts an attempt for each and reserves them until
+// now plus lease. BEGIN IMMEDIATE keeps concurrent claims apart.
+func (s *SQLiteDB) ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Notification, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM notifications
+		WHERE status = 'pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC, created_at ASC
+		LIMIT ?`, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due notifications: %w", err)
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan notification ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*Notification{}, nil
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	query := `UPDATE notifications SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ? WHERE id IN (` + in + `)`
+	if _, err := tx.ExecContext(ctx, query, append([]interface{}{now.Add(lease).UTC(), now.UTC()}, ids...)...); err != nil {
+		return nil, fmt.Errorf("failed to claim notifications: %w", err)
+	}
+	query = `SELECT ` + notificationColumnsSQL + `
+			  FROM notifications n
+			  JOIN tickets t ON t.id = n.ticket_id
+			  WHERE n.id IN (` + in + `)
+			  ORDER BY n.created_at ASC`
+	rows, err = tx.QueryContext(ctx, query, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query claimed notifications: %w", err)
+	}
+	notifications, err := scanNotificationsSQL(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return notifications, nil
+}
+
+// MarkNotificationSent records that a notification was delivered at the
+// given time.
+func (s *SQLiteDB) MarkNotificationSent(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE notifications SET status = 'sent', sent_at = ?, updated_at = ? WHERE id = ?`
+	return s.updateNotification(ctx, id, query, at.UTC(), at.UTC(), id)
+}
+
+// MarkNotificationFailed records a failed delivery attempt. The notification
+// stays pending until retryAt, or is given up if retryAt is nil.
+func (s *SQLiteDB) MarkNotificationFailed(ctx context.Context, id uuid.UUID, lastError string, retryAt *time.Time, at time.Time) error {
+	if retryAt == nil {
+		query := `UPDATE notifications SET status = 'failed', last_error = ?, updated_at = ? WHERE id = ?`
+		return s.updateNotification(ctx, id, query, lastError, at.UTC(), id)
+	}
+	query := `UPDATE notifications SET last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`
+	return s.updateNotification(ctx, id, query, lastError, retryAt.UTC(), at.UTC(), id)
+}
+
+// updateNotification runs an UPDATE of the notification with the given ID and
+// reports a missing one as ErrNotificationNotFound.
+func (s *SQLiteDB) updateNotification(ctx context.Context, id uuid.UUID, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotificationNotFound, id.String())
+	}
+	return nil
+}
+
+// GetTicketNotifications returns the messages to a ticket's customer, oldest
+// first.
+func (s *SQLiteDB) GetTicketNotifications(ctx context.Context, ticketID uuid.UUID) ([]*Notification, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tickets WHERE id = ?)`, ticketID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+	}
+
+	query := `SELECT ` + notificationColumnsSQL + `
+			  FROM notifications n
+			  JOIN tickets t ON t.id = n.ticket_id
+			  WHERE n.ticket_id = ?
+			  ORDER BY n.created_at ASC`
+	rows, err := s.db.QueryContext(ctx, query, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	return scanNotificationsSQL(rows)
+}
+
+// ListNotifications returns the notifications selected by filter, newest
+// first.
+func (s *SQLiteDB) ListNotifications(ctx context.Context, filter NotificationFilter) ([]*Notification, error) {
+	query := `SELECT ` + notificationColumnsSQL + `
+			  FROM notifications n
+			  JOIN tickets t ON t.id = n.ticket_id
+			  WHERE 1 = 1`
+	var args []interface{}
+	if filter.QueueID != nil {
+		query += ` AND t.queue_id = ?`
+		args = append(args, *filter.QueueID)
+	}
+	if filter.TicketID != nil {
+		query += ` AND n.ticket_id = ?`
+		args = append(args, *filter.TicketID)
+	}
+	if filter.Status != "" {
+		query += ` AND n.status = ?`
+		args = append(args, filter.Status)
+	}
+	query += ` ORDER BY n.created_at DESC LIMIT ?`
+	args = append(args, filter.limit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	return scanNotificationsSQL(rows)
+}
+
+// scanNotificationsSQL reads rows of notificationColumnsSQL and closes rows.
+func scanNotificationsSQL(rows *sql.Rows) ([]*Notification, error) {
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		err := rows.Scan(
+			&n.ID,
+			&n.TicketID,
+			&n.QueueID,
+			&n.TicketNumber,
+			&n.Channel,
+			&n.Template,
+			&n.Threshold,
+			&n.Recipient,
+			&n.Payload,
+			&n.Status,
+			&n.Attempts,
+			&n.LastError,
+			&n.NextAttemptAt,
+			&n.SentAt,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification row: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return notifications, nil
+}
+
+// SetMessageTemplate creates or replaces the text of a template name and
+// locale, for one queue or, with a nil queue ID, for every queue.
+func (s *SQLiteDB) SetMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale, body string) (*MessageTemplate, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if queueID != nil {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM queues WHERE id = ?)`, *queueID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check queue: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queueID.String())
+		}
+	}
+
+	t := &MessageTemplate{QueueID: queueID, Name: name, Locale: locale, Body: body, UpdatedAt: time.Now().UTC()}
+	query := `SELECT id, created_at FROM message_templates WHERE queue_id IS ? AND name = ? AND locale = ?`
+	err = tx.QueryRowContext(ctx, query, queueID, name, locale).Scan(&t.ID, &t.CreatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		t.ID, t.CreatedAt = uuid.New(), t.UpdatedAt
+		query = `INSERT INTO message_templates (id, queue_id, name, locale, body, created_at, updated_at)
+				 VALUES (?, ?, ?, ?, ?, ?, ?)`
+		_, err = tx.ExecContext(ctx, query, t.ID, queueID, name, locale, body, t.CreatedAt, t.UpdatedAt)
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `UPDATE message_templates SET body = ?, updated_at = ? WHERE id = ?`, body, t.UpdatedAt, t.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message template: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return t, nil
+}
+
+// GetMessageTemplates returns the customized texts of one queue, or the
+// global ones for a nil queue ID, ordered by name and locale.
+func (s *SQLiteDB) GetMessageTemplates(ctx context.Context, queueID *uuid.UUID) ([]*MessageTemplate, error) {
+	if queueID != nil {
+		if _, err := s.GetQueueByID(ctx, *queueID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `SELECT id, queue_id, name, locale, body, created_at, updated_at
+			  FROM message_templates
+			  WHERE queue_id IS ?
+			  ORDER BY name ASC, locale ASC`
+	rows, err := s.db.QueryContext(ctx, query, queueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []*MessageTemplate{}
+	for rows.Next() {
+		t := &MessageTemplate{}
+		if err := rows.Scan(&t.ID, &t.QueueID, &t.Name, &t.Locale, &t.Body, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message template row: %w", err)
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return templates, nil
+}
+
+// DeleteMessageTemplate removes a customized text, so that the next one in
+// the fallback chain is used again.
+func (s *SQLiteDB) DeleteMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM message_templates WHERE queue_id IS ? AND name = ? AND locale = ?`, queueID, name, locale)
+	if err != nil {
+		return fmt.Errorf("failed to delete message template: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete message template: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s %s", ErrTemplateNotFound, name, locale)
+	}
+	return nil
+}
+
+// LogTicketEvent records a ticket_history row with the given status and the
+// ticket's counter, without changing the ticket.
+func (s *SQLiteDB) LogTicketEvent(ctx context.Context, ticketID uuid.UUID, status string, audit Audit) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var counterID *uuid.UUID
+	if err := tx.QueryRowContext(ctx, `SELECT counter_id FROM tickets WHERE id = ?`, ticketID).Scan(&counterID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrTicketNotFound, ticketID.String())
+		}
+		return fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if err := logTicketStatusChangeSQL(ctx, tx, ticketID, status, counterID, audit); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateWebhook stores a new webhook subscription to the given event types.
+func (s *SQLiteDB) CreateWebhook(ctx context.Context, url, secret string, events []string, description string) (*Webhook, error) {
+	now := time.Now().UTC()
+	w := &Webhook{
+		ID:          uuid.New(),
+		URL:         url,
+		Secret:      secret,
+		Events:      events,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	query := `INSERT INTO webhooks (id, url, secret, events, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, w.ID, w.URL, w.Secret, joinEvents(w.Events), w.Description, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return w, nil
+}
+
+// webhookColumnsSQL are the columns scanWebhooksSQL reads.
+const webhookColumnsSQL = `id, url, secret, events, description, created_at, updated_at`
+
+// GetWebhookByID retrieves a webhook by its ID.
+func (s *SQLiteDB) GetWebhookByID(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookColumnsSQL+` FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	webhooks, err := scanWebhooksSQL(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, id.String())
+	}
+	return webhooks[0], nil
+}
+
+// GetWebhooks retrieves all webhooks, newest first.
+func (s *SQLiteDB) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookColumnsSQL+` FROM webhooks ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	return scanWebhooksSQL(rows)
+}
+
+// scanWebhooksSQL reads rows of webhookColumnsSQL and closes rows.
+func scanWebhooksSQL(rows *sql.Rows) ([]*Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w := &Webhook{}
+		var events string
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Description, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook row: %w", err)
+		}
+		w.Events = splitEvents(events)
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (s *SQLiteDB) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrWebhookNotFound, id.String())
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent records a pending delivery of an event for every webhook
+// subscribed to its type that has none yet, and returns them.
+func (s *SQLiteDB) EnqueueWebhookEvent(ctx context.Context, eventID uuid.UUID, eventType, payload string) ([]*WebhookDelivery, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+webhookColumnsSQL+` FROM webhooks ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	webhooks, err := scanWebhooksSQL(rows)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	deliveries := []*WebhookDelivery{}
+	for _, w := range webhooks {
+		if !w.Subscribes(eventType) {
+			continue
+		}
+		d := newWebhookDelivery(w, eventID, eventType, payload, now)
+		query := `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+				  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				  ON CONFLICT (webhook_id, event_id) DO NOTHING`
+		result, err := tx.ExecContext(ctx, query, d.ID, d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert webhook delivery: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to insert webhook delivery: %w", err)
+		} else if n == 1 {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries, nil
+}
+
+// webhookDeliveryColumnsSQL are the columns scanWebhookDeliveriesSQL reads,
+// from webhook_deliveries d joined with webhooks w.
+const webhookDeliveryColumnsSQL = `d.id, d.webhook_id, w.url, w.secret, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+			  d.last_error, d.response_status, d.next_attempt_at, d.delivered_at, d.created_at, d.updated_at`
+
+// ClaimWebhookDeliveries takes up to limit pending deliveries that are due at
+// now, oldest due first, counts an attempt for each and reserves them until
+// now plus lease. BEGIN IMMEDIATE keeps concurrent claims apart.
+func (s *SQLiteDB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC, created_at ASC
+		LIMIT ?`, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due webhook deliveries: %w", err)
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan webhook delivery ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*WebhookDelivery{}, nil
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	query := `UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ? WHERE id IN (` + in + `)`
+	if _, err := tx.ExecContext(ctx, query, append([]interface{}{now.Add(lease).UTC(), now.UTC()}, ids...)...); err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	query = `SELECT ` + webhookDeliveryColumnsSQL + `
+			  FROM webhook_deliveries d
+			  JOIN webhooks w ON w.id = d.webhook_id
+			  WHERE d.id IN (` + in + `)
+			  ORDER BY d.created_at ASC`
+	rows, err = tx.QueryContext(ctx, query, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query claimed webhook deliveries: %w", err)
+	}
+	deliveries, err := scanWebhookDeliveriesSQL(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records that a delivery was accepted at the given
+// time with the given HTTP status.
+func (s *SQLiteDB) MarkWebhookDelivered(ctx context.Context, id uuid.UUID, responseStatus int, at time.Time) error {
+	query := `UPDATE webhook_deliveries SET status = 'sent', response_status = ?, last_error = '', delivered_at = ?, updated_at = ? WHERE id = ?`
+	return s.updateWebhookDelivery(ctx, id, query, responseStatus, at.UTC(), at.UTC(), id)
+}
+
+// MarkWebhookDeliveryFailed records a failed delivery attempt and the HTTP
+// status of its response, or 0 if there was none. The delivery stays pending
+// until retryAt, or is given up if retryAt is nil.
+func (s *SQLiteDB) MarkWebhookDeliveryFailed(ctx context.Context, id uuid.UUID, responseStatus int, lastError string, retryAt *time.Time, at time.Time) error {
+	if retryAt == nil {
+		query := `UPDATE webhook_deliveries SET status = 'failed', response_status = ?, last_error = ?, updated_at = ? WHERE id = ?`
+		return s.updateWebhookDelivery(ctx, id, query, responseStatus, lastError, at.UTC(), id)
+	}
+	query := `UPDATE webhook_deliveries SET response_status = ?, last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`
+	return s.updateWebhookDelivery(ctx, id, query, responseStatus, lastError, retryAt.UTC(), at.UTC(), id)
+}
+
+// updateWebhookDelivery runs an UPDATE of the delivery with the given ID and
+// reports a missing one as ErrDeliveryNotFound.
+func (s *SQLiteDB) updateWebhookDelivery(ctx context.Context, id uuid.UUID, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the deliveries selected by filter, newest
+// first.
+func (s *SQLiteDB) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumnsSQL + `
+			  FROM webhook_deliveries d
+			  JOIN webhooks w ON w.id = d.webhook_id
+			  WHERE 1 = 1`
+	var args []interface{}
+	if filter.WebhookID != nil {
+		query += ` AND d.webhook_id = ?`
+		args = append(args, *filter.WebhookID)
+	}
+	if filter.EventType != "" {
+		query += ` AND d.event_type = ?`
+		args = append(args, filter.EventType)
+	}
+	if filter.Status != "" {
+		query += ` AND d.status = ?`
+		args = append(args, filter.Status)
+	}
+	query += ` ORDER BY d.created_at DESC LIMIT ?`
+	args = append(args, filter.limit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	return scanWebhookDeliveriesSQL(rows)
+}
+
+// RedeliverWebhookDelivery makes a sent or failed delivery pending again, due
+// at the given time, with a fresh set of attempts.
+func (s *SQLiteDB) RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID, at time.Time) (*WebhookDelivery, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM webhook_deliveries WHERE id = ?`, id).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrDeliveryNotFound, id.String())
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	if status == NotificationPending {
+		return nil, fmt.Errorf("%w: %s", ErrDeliveryPending, id.String())
+	}
+	query := `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = ?, updated_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, at.UTC(), at.UTC(), id); err != nil {
+		return nil, fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	query = `SELECT ` + webhookDeliveryColumnsSQL + `
+			  FROM webhook_deliveries d
+			  JOIN webhooks w ON w.id = d.webhook_id
+			  WHERE d.id = ?`
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook delivery: %w", err)
+	}
+	deliveries, err := scanWebhookDeliveriesSQL(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries[0], nil
+}
+
+// scanWebhookDeliveriesSQL reads rows of webhookDeliveryColumnsSQL and closes
+// rows.
+func scanWebhookDeliveriesSQL(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.URL,
+			&d.Secret,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.LastError,
+			&d.ResponseStatus,
+			&d.NextAttemptAt,
+			&d.DeliveredAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return deliveries, nil
+}
+
+// GetPendingOutboxEvents returns up to limit events not yet dispatched, in the
+// order they were written.
+func (s *SQLiteDB) GetPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	if limit <= 0 {
+		limit = DefaultOutboxBatch
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+outboxEventColumns+` FROM outbox_events
+			  WHERE dispatched_at IS NULL
+			  ORDER BY seq ASC
+			  LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*OutboxEvent{}
+	for rows.Next() {
+		e := &OutboxEvent{}
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Type, &e.TicketID, &e.QueueID, &e.ActorType, &e.Payload, &e.Attempts, &e.LastError, &e.CreatedAt, &e.DispatchedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event row: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating rows: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxEventDispatched records an event as dispatched at at.
+func (s *SQLiteDB) MarkOutboxEventDispatched(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return s.updateOutboxEvent(ctx, id, `UPDATE outbox_events SET dispatched_at = ? WHERE id = ?`, at.UTC(), id)
+}
+
+// MarkOutboxEventFailed counts a failed attempt at dispatching an event, which
+// stays pending.
+func (s *SQLiteDB) MarkOutboxEventFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	return s.updateOutboxEvent(ctx, id, `UPDATE outbox_events SET attempts = attempts + 1, last_error = ? WHERE id = ?`, lastError, id)
+}
+
+// updateOutboxEvent runs an UPDATE of the event with the given ID and reports
+// a missing one as ErrEventNotFound.
+func (s *SQLiteDB) updateOutboxEvent(ctx context.Context, id uuid.UUID, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox event: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update outbox event: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrEventNotFound, id.String())
+	}
+	return nil
+}
+
+// DeleteDispatchedOutboxEvents deletes the events dispatched before before and
+// returns how many there were.
+func (s *SQLiteDB) DeleteDispatchedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE dispatched_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dispatched outbox events: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dispatched outbox events: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/config"
+)
+
+func newSQLiteHarness(t *testing.T) *storeHarness {
+	path := filepath.Join(t.TempDir(), "smartq.db")
+
+	m, err := migrate.New("file://../../migrations/sqlite", "sqlite3://"+path)
+	if err != nil {
+		t.Fatalf("failed to create migrate instance: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	m.Close()
+
+	s, err := NewSQLiteDB(&config.Config{DatabaseURL: SQLiteScheme + path})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	return &storeHarness{
+		Store: s,
+		rewindDay: func(t *testing.T, queueID uuid.UUID) {
+			rows, err := s.db.Query(`SELECT id, created_at FROM tickets WHERE queue_id = ?`, queueID)
+			if err != nil {
+				t.Fatalf("query tickets: %v", err)
+			}
+			created := make(map[uuid.UUID]time.Time)
+			for rows.Next() {
+				var id uuid.UUID
+				var at time.Time
+				if err := rows.Scan(&id, &at); err != nil {
+					t.Fatalf("scan ticket: %v", err)
+				}
+				created[id] = at
+			}
+			rows.Close()
+			for id, at := range created {
+				if _, err := s.db.Exec(`UPDATE tickets SET created_at = ? WHERE id = ?`, at.Add(-24*time.Hour).UTC(), id); err != nil {
+					t.Fatalf("backdate ticket: %v", err)
+				}
+			}
+			q, err := s.GetQueueByID(context.Background(), queueID)
+			if err != nil {
+				t.Fatalf("get queue: %v", err)
+			}
+			yesterday := q.Period(time.Now().Add(-24 * time.Hour))
+			if _, err := s.db.Exec(`UPDATE queue_counters SET number_period = ? WHERE queue_id = ?`, yesterday, queueID); err != nil {
+				t.Fatalf("backdate counter: %v", err)
+			}
+		},
+		setHistoryTime: func(t *testing.T, ticketID uuid.UUID, status string, at time.Time) {
+			if _, err := s.db.Exec(`UPDATE ticket_history SET timestamp = ? WHERE ticket_id = ? AND status = ?`, at.UTC(), ticketID, status); err != nil {
+				t.Fatalf("set history time: %v", err)
+			}
+		},
+		history: func(t *testing.T, ticketID uuid.UUID) []string {
+			rows, err := s.db.QueryContext(context.Background(), `SELECT status FROM ticket_history WHERE ticket_id = ? ORDER BY timestamp, created_at`, ticketID)
+			if err != nil {
+				t.Fatalf("query history: %v", err)
+			}
+			defer rows.Close()
+			var statuses []string
+			for rows.Next() {
+				var status string
+				if err := rows.Scan(&status); err != nil {
+					t.Fatalf("scan history: %v", err)
+				}
+				statuses = append(statuses, status)
+			}
+			return statuses
+		},
+	}
+}
+
+func TestSQLiteDB(t *testing.T) {
+	runStoreConformance(t, newSQLiteHarness)
+}
@@ -1,2 +1,378 @@
 // Package storage handles database interactions.
 package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/queue"
+	"github.com/smartq/smartq/internal/ticket"
+)
+
+// Errors returned by Store implementations. They are wrapped with %w, so
+// callers should test for them with errors.Is.
+var (
+	ErrQueueNotFound        = errors.New("queue not found")
+	ErrTicketNotFound       = errors.New("ticket not found")
+	ErrCounterNotFound      = errors.New("counter not found")
+	ErrCounterExists        = errors.New("counter already exists")
+	ErrCounterNotInQueue    = errors.New("counter does not belong to the ticket's queue")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserExists           = errors.New("user already exists")
+	ErrAPIKeyNotFound       = errors.New("API key not found")
+	ErrInvalidTransition    = errors.New("invalid ticket status transition")
+	ErrNoWaitingTickets     = errors.New("no waiting tickets")
+	ErrNotificationSent     = errors.New("notification already sent")
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrTemplateNotFound     = errors.New("message template not found")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrDeliveryNotFound     = errors.New("webhook delivery not found")
+	ErrDeliveryPending      = errors.New("webhook delivery is still pending")
+	ErrEventNotFound        = errors.New("outbox event not found")
+)
+
+// Actor types recorded with every ticket_history row.
+const (
+	ActorUser     = "user"     // a staff member logged in with a token
+	ActorAPIKey   = "api_key"  // a kiosk or integration using an API key
+	ActorCustomer = "customer" // the customer, e.g. checking in on the public form
+	ActorSMS      = "sms"      // the customer texting SmartQ; the actor name is their phone number
+	ActorSystem   = "system"   // the server itself, e.g. a background job
+)
+
+// Delivery statuses of a Notification or a WebhookDelivery.
+const (
+	NotificationPending = "pending" // waiting for its first attempt or a retry
+	NotificationSent    = "sent"    // accepted by the provider
+	NotificationFailed  = "failed"  // rejected by the provider or out of attempts
+)
+
+// Types of the ticket events the ticket actions write to the outbox. They are
+// also the event types delivered to webhooks.
+const (
+	EventTicketCreated   = "ticket.created"
+	EventTicketCalled    = "ticket.called" // the ticket moved to serving
+	EventTicketServed    = "ticket.served"
+	EventTicketCancelled = "ticket.cancelled"
+	EventTicketDeferred  = "ticket.deferred" // the customer let people go ahead or asked to be called later
+)
+
+// ticketEventTypes maps the status a ticket action records in ticket_history
+// to the type of the event it writes to the outbox.
+var ticketEventTypes = map[string]string{
+	ticket.StatusWaiting:   EventTicketCreated,
+	ticket.StatusServing:   EventTicketCalled,
+	ticket.StatusServed:    EventTicketServed,
+	ticket.StatusCancelled: EventTicketCancelled,
+	ticket.StatusDeferred:  EventTicketDeferred,
+}
+
+// Audit describes who performed a ticket action, from where and why. It is
+// stored with the ticket_history row the action writes. The zero value
+// attributes the action to the system.
+type Audit struct {
+	ActorType string     `json:"actor_type"`
+	ActorID   *uuid.UUID `json:"actor_id"`   // User or API key ID, if any
+	ActorName string     `json:"actor_name"` // Username or API key name, kept in case the actor is deleted
+	SourceIP  string     `json:"source_ip"`
+	UserAgent string     `json:"user_agent"`
+	Reason    string     `json:"reason"`
+}
+
+// withDefaults returns a with an empty actor type replaced by ActorSystem.
+func (a Audit) withDefaults() Audit {
+	if a.ActorType == "" {
+		a.ActorType = ActorSystem
+	}
+	return a
+}
+
+// AuditFilter selects ticket_history rows for GetAuditTrail, which returns
+// them newest first. Zero-valued fields do not filter. From is inclusive and
+// To exclusive.
+type AuditFilter struct {
+	TicketID  *uuid.UUID
+	ActorType string
+	ActorID   *uuid.UUID
+	From      *time.Time
+	To        *time.Time
+	Limit     int // At most this many rows; DefaultAuditLimit if zero
+}
+
+// DefaultAuditLimit caps GetAuditTrail results when the filter sets no limit.
+const DefaultAuditLimit = 500
+
+// NotificationFilter selects notifications for ListNotifications, which
+// returns them newest first. Zero-valued fields do not filter.
+type NotificationFilter struct {
+	QueueID  *uuid.UUID
+	TicketID *uuid.UUID
+	Status   string
+	Limit    int // At most this many notifications; DefaultNotificationLimit if zero
+}
+
+// DefaultNotificationLimit caps ListNotifications results when the filter sets
+// no limit.
+const DefaultNotificationLimit = 200
+
+// WebhookDeliveryFilter selects webhook deliveries for ListWebhookDeliveries,
+// which returns them newest first. Zero-valued fields do not filter.
+type WebhookDeliveryFilter struct {
+	WebhookID *uuid.UUID
+	EventType string
+	Status    string
+	Limit     int // At most this many deliveries; DefaultNotificationLimit if zero
+}
+
+// DefaultOutboxBatch caps GetPendingOutboxEvents results when no limit is
+// given.
+const DefaultOutboxBatch = 100
+
+// Store is the set of operations the API needs from a storage backend.
+// PostgresDB is the primary implementation.
+//
+// UpdateTicketStatus and CallNextTicket take an optional counter: when it is
+// set, the ticket is assigned to that counter, which must belong to the
+// ticket's queue. Otherwise the ticket keeps its current counter. The ticket
+// actions also take the Audit recorded with the history row they write.
+// GetTicketHistory returns a ticket's history rows oldest first.
+//
+// DeferTicket lets a waiting ticket go behind the next places waiting tickets
+// of the same priority, and/or keeps it from being called before until; it
+// logs a ticket.StatusDeferred history row. CallNextTicket skips tickets
+// deferred until a later time.
+//
+// GetActiveTicketsByQueueID returns only the waiting and serving tickets of a
+// queue, in the same order as GetTicketsByQueueID, so that computing places in
+// line does not read the queue's whole past.
+//
+// GetActiveTicketByPhone returns the most recently created waiting or serving
+// ticket with the given customer phone, e.g. the sender of a text message.
+// Phones are compared as stored, so callers store and look them up in the
+// E.164 form of ticket.NormalizePhone.
+// LogTicketEvent records a history row that does not change the ticket, such
+// as a ticket.StatusChecked request.
+//
+// CreateTicket stores the hash of the ticket's access token, the secret that
+// lets the customer follow the ticket without logging in. An empty hash
+// creates a ticket without one.
+//
+// EnqueueNotification records a message to a ticket's customer as pending,
+// and returns ErrNotificationSent if the ticket already got one of the same
+// template and threshold, so that each message is sent once. The delivery
+// worker takes due pending notifications with ClaimNotifications, which counts
+// an attempt and reserves them for lease so that no one else takes them in the
+// meantime, then records the outcome with MarkNotificationSent or
+// MarkNotificationFailed. A failed attempt with a retry time stays pending
+// until then; without one the notification is given up. A notification whose
+// attempt never reports back is taken again once its lease runs out.
+//
+// Message templates are customized texts of the messages to customers. Those
+// with a nil queue ID apply to every queue. SetMessageTemplate creates or
+// replaces the text of a template name and locale; GetMessageTemplates returns
+// the texts of one queue, or the global ones for a nil queue ID, ordered by
+// name and locale.
+//
+// Webhooks are subscriptions of other systems to event types. GetWebhooks
+// returns them newest first. EnqueueWebhookEvent records a pending delivery of
+// an event's payload for every webhook subscribed to its type, in one
+// transaction, and returns them; an event nobody subscribes to is dropped.
+// Deliveries go through ClaimWebhookDeliveries, MarkWebhookDelivered and
+// MarkWebhookDeliveryFailed like notifications, and read back with their
+// webhook's URL and secret. RedeliverWebhookDelivery makes a sent or failed
+// delivery pending again with no attempts, and returns ErrDeliveryPending for
+// one that still is. EnqueueWebhookEvent skips the webhooks that already have
+// a delivery of the event, so that enqueueing it again has no effect.
+//
+// CreateTicket, UpdateTicketStatus, CallNextTicket and DeferTicket write an
+// OutboxEvent with the ticket as it was committed in the same transaction as
+// the change, so that an event is recorded for every committed change and
+// for nothing else. GetPendingOutboxEvents returns the events not yet
+// dispatched in the order they were written, which is the order of the
+// changes to each ticket and queue. MarkOutboxEventDispatched records an
+// event as dispatched, MarkOutboxEventFailed counts a failed attempt at it,
+// and DeleteDispatchedOutboxEvents drops the events dispatched before a time.
+type Store interface {
+	CreateQueue(ctx context.Context, name string, format queue.TicketFormat, notifyThresholds []int) (*Queue, error)
+	GetQueueByID(ctx context.Context, id uuid.UUID) (*Queue, error)
+	GetQueues(ctx context.Context) ([]*Queue, error)
+	SetQueueNotifyThresholds(ctx context.Context, queueID uuid.UUID, thresholds []int) (*Queue, error)
+	CreateTicket(ctx context.Context, queueID uuid.UUID, customerName, customerPhone, locale string, priority int, accessTokenHash string, audit Audit) (*Ticket, error)
+	UpdateTicketStatus(ctx context.Context, ticketID uuid.UUID, status string, counterID *uuid.UUID, audit Audit) (*Ticket, error)
+	CallNextTicket(ctx context.Context, queueID uuid.UUID, counterID *uuid.UUID, audit Audit) (*Ticket, error)
+	DeferTicket(ctx context.Context, ticketID uuid.UUID, places int, until *time.Time, audit Audit) (*Ticket, error)
+	GetTicketByID(ctx context.Context, id uuid.UUID) (*Ticket, error)
+	GetTicketByAccessTokenHash(ctx context.Context, accessTokenHash string) (*Ticket, error)
+	GetActiveTicketByPhone(ctx context.Context, phone string) (*Ticket, error)
+	LogTicketEvent(ctx context.Context, ticketID uuid.UUID, status string, audit Audit) error
+	GetTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error)
+	GetActiveTicketsByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Ticket, error)
+	GetTicketHistory(ctx context.Context, ticketID uuid.UUID) ([]*TicketHistory, error)
+	CalculateEstimatedWaitTime(ctx context.Context, queueID uuid.UUID) (time.Duration, error)
+	GetAuditTrail(ctx context.Context, filter AuditFilter) ([]*TicketHistory, error)
+	EnqueueNotification(ctx context.Context, ticketID uuid.UUID, channel, template string, threshold int, recipient, payload string) (*Notification, error)
+	ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Notification, error)
+	MarkNotificationSent(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkNotificationFailed(ctx context.Context, id uuid.UUID, lastError string, retryAt *time.Time, at time.Time) error
+	GetTicketNotifications(ctx context.Context, ticketID uuid.UUID) ([]*Notification, error)
+	ListNotifications(ctx context.Context, filter NotificationFilter) ([]*Notification, error)
+
+	SetMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale, body string) (*MessageTemplate, error)
+	GetMessageTemplates(ctx context.Context, queueID *uuid.UUID) ([]*MessageTemplate, error)
+	DeleteMessageTemplate(ctx context.Context, queueID *uuid.UUID, name, locale string) error
+
+	CreateWebhook(ctx context.Context, url, secret string, events []string, description string) (*Webhook, error)
+	GetWebhookByID(ctx context.Context, id uuid.UUID) (*Webhook, error)
+	GetWebhooks(ctx context.Context) ([]*Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	EnqueueWebhookEvent(ctx context.Context, eventID uuid.UUID, eventType, payload string) ([]*WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, id uuid.UUID, responseStatus int, at time.Time) error
+	MarkWebhookDeliveryFailed(ctx context.Context, id uuid.UUID, responseStatus int, lastError string, retryAt *time.Time, at time.Time) error
+	ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, id uuid.UUID, at time.Time) (*WebhookDelivery, error)
+
+	GetPendingOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error)
+	MarkOutboxEventDispatched(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkOutboxEventFailed(ctx context.Context, id uuid.UUID, lastError string) error
+	DeleteDispatchedOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+
+	CreateCounter(ctx context.Context, queueID uuid.UUID, name string) (*Counter, error)
+	GetCounterByID(ctx context.Context, id uuid.UUID) (*Counter, error)
+	GetCountersByQueueID(ctx context.Context, queueID uuid.UUID) ([]*Counter, error)
+	UpdateCounter(ctx context.Context, id uuid.UUID, name string) (*Counter, error)
+	DeleteCounter(ctx context.Context, id uuid.UUID) error
+
+	CreateUser(ctx context.Context, username, passwordHash, role string) (*User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUsers(ctx context.Context) ([]*User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+
+	CreateAPIKey(ctx context.Context, name, keyPrefix, keyHash string, scopes []string, expiresAt *time.Time) (*APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]*APIKey, error)
+	TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+	DeleteAPIKey(ctx context.Context, id uuid.UUID) error
+}
+
+// checkTransition validates a status change against the ticket state machine
+// and wraps a rejection in ErrInvalidTransition.
+func checkTransition(from, to string) error {
+	if err := ticket.ValidateTransition(from, to); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTransition, err)
+	}
+	return nil
+}
+
+// limit returns the number of rows GetAuditTrail may return for f.
+func (f AuditFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultAuditLimit
+	}
+	return f.Limit
+}
+
+// limit returns the number of notifications ListNotifications may return for f.
+func (f NotificationFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultNotificationLimit
+	}
+	return f.Limit
+}
+
+// limit returns the number of deliveries ListWebhookDeliveries may return for f.
+func (f WebhookDeliveryFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultNotificationLimit
+	}
+	return f.Limit
+}
+
+// newWebhookDelivery returns a pending delivery of an event to w, due at now.
+func newWebhookDelivery(w *Webhook, eventID uuid.UUID, eventType, payload string, now time.Time) *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     w.ID,
+		URL:           w.URL,
+		Secret:        w.Secret,
+		EventID:       eventID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        NotificationPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// newTicketEvent returns the outbox event of a ticket action that recorded
+// status in ticket_history, with t as the action left it.
+func newTicketEvent(t *Ticket, status string, audit Audit, now time.Time) (*OutboxEvent, error) {
+	eventType, ok := ticketEventTypes[status]
+	if !ok {
+		return nil, fmt.Errorf("no event for ticket status %q", status)
+	}
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ticket event: %w", err)
+	}
+	return &OutboxEvent{
+		ID:        uuid.New(),
+		Type:      eventType,
+		TicketID:  t.ID,
+		QueueID:   t.QueueID,
+		ActorType: audit.withDefaults().ActorType,
+		Payload:   string(payload),
+		CreatedAt: now,
+	}, nil
+}
+
+// joinScopes encodes API key scopes for the space-separated scopes column.
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// splitScopes decodes the scopes column.
+func splitScopes(column string) []string {
+	return strings.Fields(column)
+}
+
+// joinEvents encodes webhook event types for the space-separated events
+// column.
+func joinEvents(events []string) string {
+	return strings.Join(events, " ")
+}
+
+// splitEvents decodes the events column.
+func splitEvents(column string) []string {
+	return strings.Fields(column)
+}
+
+// joinThresholds encodes notification thresholds for the space-separated
+// notify_thresholds column.
+func joinThresholds(thresholds []int) string {
+	fields := make([]string, len(thresholds))
+	for i, threshold := range thresholds {
+		fields[i] = strconv.Itoa(threshold)
+	}
+	return strings.Join(fields, " ")
+}
+
+// splitThresholds decodes the notify_thresholds column, skipping anything that
+// is not a number.
+func splitThresholds(column string) []int {
+	thresholds := []int{}
+	for _, field := range strings.Fields(column) {
+		if threshold, err := strconv.Atoi(field); err == nil {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	return thresholds
+}
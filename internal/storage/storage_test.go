@@ -0,0 +1,1909 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/smartq/smartq/internal/queue"
+)
+
+// storeHarness wraps a Store under test with backend-specific hooks that let
+// the conformance suite rewrite timestamps and read back ticket_history.
+type storeHarness struct {
+	Store
+
+	// rewindDay moves a queue's tickets and ticket counter back by one day, as
+	// if everything so far had happened yesterday.
+	rewindDay func(t *testing.T, queueID uuid.UUID)
+	// setHistoryTime moves the timestamp of a ticket's history entry with the given status.
+	setHistoryTime func(t *testing.T, ticketID uuid.UUID, status string, at time.Time)
+	// history returns a ticket's recorded statuses in chronological order.
+	history func(t *testing.T, ticketID uuid.UUID) []string
+}
+
+// runStoreConformance runs the shared Store conformance suite. Every backend
+// calls it from its own test with a constructor for a ready-to-use harness.
+func runStoreConformance(t *testing.T, newHarness func(t *testing.T) *storeHarness) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, h *storeHarness)
+	}{
+		{"QueueCRUD", testQueueCRUD},
+		{"QueueNotFound", testQueueNotFound},
+		{"QueueNotifyThresholds", testQueueNotifyThresholds},
+		{"SequentialTicketNumbers", testSequentialTicketNumbers},
+		{"TicketNumbersResetDaily", testTicketNumbersResetDaily},
+		{"TicketNumbersPerQueue", testTicketNumbersPerQueue},
+		{"TicketFormats", testTicketFormats},
+		{"TicketNumbersPastPaddingWidth", testTicketNumbersPastPaddingWidth},
+		{"TicketNumbersNeverReset", testTicketNumbersNeverReset},
+		{"PositionAssignment", testPositionAssignment},
+		{"PriorityOrdering", testPriorityOrdering},
+		{"ActiveTicketsByQueue", testActiveTicketsByQueue},
+		{"CreateTicketUnknownQueue", testCreateTicketUnknownQueue},
+		{"ConcurrentCheckIns", testConcurrentCheckIns},
+		{"UpdateTicketStatus", testUpdateTicketStatus},
+		{"TicketNotFound", testTicketNotFound},
+		{"GetTicketByID", testGetTicketByID},
+		{"TicketAccessToken", testTicketAccessToken},
+		{"InvalidTransitions", testInvalidTransitions},
+		{"HistoryLogging", testHistoryLogging},
+		{"TicketHistory", testTicketHistory},
+		{"AuditTrail", testAuditTrail},
+		{"CallNextTicket", testCallNextTicket},
+		{"CallNextEmptyQueue", testCallNextEmptyQueue},
+		{"CallNextUnknownQueue", testCallNextUnknownQueue},
+		{"ConcurrentCallNext", testConcurrentCallNext},
+		{"DeferTicket", testDeferTicket},
+		{"DeferTicketUntil", testDeferTicketUntil},
+		{"DeferTicketErrors", testDeferTicketErrors},
+		{"TicketNotifications", testTicketNotifications},
+		{"NotificationDelivery", testNotificationDelivery},
+		{"ListNotifications", testListNotifications},
+		{"MessageTemplates", testMessageTemplates},
+		{"ActiveTicketByPhone", testActiveTicketByPhone},
+		{"LogTicketEvent", testLogTicketEvent},
+		{"Webhooks", testWebhooks},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"OutboxEvents", testOutboxEvents},
+		{"CounterCRUD", testCounterCRUD},
+		{"CounterNotFound", testCounterNotFound},
+		{"DuplicateCounterName", testDuplicateCounterName},
+		{"CallAtCounter", testCallAtCounter},
+		{"CallAtCounterOfOtherQueue", testCallAtCounterOfOtherQueue},
+		{"DeleteCounterKeepsTickets", testDeleteCounterKeepsTickets},
+		{"UserCRUD", testUserCRUD},
+		{"UserNotFound", testUserNotFound},
+		{"DuplicateUsername", testDuplicateUsername},
+		{"APIKeyCRUD", testAPIKeyCRUD},
+		{"APIKeyNotFound", testAPIKeyNotFound},
+		{"EstimatedWaitTimeEmpty", testEstimatedWaitTimeEmpty},
+		{"EstimatedWaitTime", testEstimatedWaitTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newHarness(t))
+		})
+	}
+}
+
+func mustCreateQueue(t *testing.T, s Store, name string) *Queue {
+	t.Helper()
+	return mustCreateQueueWithFormat(t, s, name, queue.TicketFormat{})
+}
+
+func mustCreateQueueWithFormat(t *testing.T, s Store, name string, format queue.TicketFormat) *Queue {
+	t.Helper()
+	q, err := s.CreateQueue(context.Background(), name, format, nil)
+	if err != nil {
+		t.Fatalf("CreateQueue(%q): %v", name, err)
+	}
+	return q
+}
+
+func mustCreateTicket(t *testing.T, s Store, queueID uuid.UUID, name string, priority int) *Ticket {
+	t.Helper()
+	ticket, err := s.CreateTicket(context.Background(), queueID, name, "+15550000000", "", priority, "", Audit{})
+	if err != nil {
+		t.Fatalf("CreateTicket(%s): %v", name, err)
+	}
+	return ticket
+}
+
+func mustCreateCounter(t *testing.T, s Store, queueID uuid.UUID, name string) *Counter {
+	t.Helper()
+	counter, err := s.CreateCounter(context.Background(), queueID, name)
+	if err != nil {
+		t.Fatalf("CreateCounter(%q): %v", name, err)
+	}
+	return counter
+}
+
+func mustUpdateStatus(t *testing.T, s Store, ticketID uuid.UUID, status string) *Ticket {
+	t.Helper()
+	ticket, err := s.UpdateTicketStatus(context.Background(), ticketID, status, nil, Audit{})
+	if err != nil {
+		t.Fatalf("UpdateTicketStatus(%s, %s): %v", ticketID, status, err)
+	}
+	return ticket
+}
+
+func testQueueCRUD(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+
+	first := mustCreateQueue(t, h, "Dr. Smith")
+	if first.ID == uuid.Nil || first.Name != "Dr. Smith" || first.CreatedAt.IsZero() {
+		t.Fatalf("CreateQueue returned incomplete queue: %+v", first)
+	}
+	time.Sleep(5 * time.Millisecond)
+	second := mustCreateQueue(t, h, "Walk-ins")
+
+	got, err := h.GetQueueByID(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("GetQueueByID: %v", err)
+	}
+	if got.ID != first.ID || got.Name != first.Name {
+		t.Errorf("GetQueueByID = %+v, want %+v", got, first)
+	}
+	if got.TicketFormat != queue.DefaultTicketFormat() {
+		t.Errorf("default ticket format = %+v, want %+v", got.TicketFormat, queue.DefaultTicketFormat())
+	}
+
+	queues, err := h.GetQueues(ctx)
+	if err != nil {
+		t.Fatalf("GetQueues: %v", err)
+	}
+	firstIdx, secondIdx := -1, -1
+	for i, q := range queues {
+		switch q.ID {
+		case first.ID:
+			firstIdx = i
+		case second.ID:
+			secondIdx = i
+		}
+	}
+	if firstIdx < 0 || secondIdx < 0 {
+		t.Fatalf("GetQueues is missing created queues: %+v", queues)
+	}
+	if secondIdx > firstIdx {
+		t.Errorf("GetQueues should list newest first, got %q at %d and %q at %d", first.Name, firstIdx, second.Name, secondIdx)
+	}
+}
+
+func testQueueNotifyThresholds(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	q := mustCreateQueue(t, h, "Notify")
+	if q.NotifyThresholds == nil || len(q.NotifyThresholds) != 0 {
+		t.Errorf("new queue thresholds = %#v, want empty", q.NotifyThresholds)
+	}
+
+	updated, err := h.SetQueueNotifyThresholds(ctx, q.ID, []int{3, 0})
+	if err != nil {
+		t.Fatalf("SetQueueNotifyThresholds: %v", err)
+	}
+	if fmt.Sprint(updated.NotifyThresholds) != "[3 0]" {
+		t.Errorf("updated thresholds = %v, want [3 0]", updated.NotifyThresholds)
+	}
+	got, err := h.GetQueueByID(ctx, q.ID)
+	if err != nil {
+		t.Fatalf("GetQueueByID: %v", err)
+	}
+	if fmt.Sprint(got.NotifyThresholds) != "[3 0]" {
+		t.Errorf("stored thresholds = %v, want [3 0]", got.NotifyThresholds)
+	}
+
+	if _, err := h.SetQueueNotifyThresholds(ctx, q.ID, nil); err != nil {
+		t.Fatalf("SetQueueNotifyThresholds(nil): %v", err)
+	}
+	queues, err := h.GetQueues(ctx)
+	if err != nil {
+		t.Fatalf("GetQueues: %v", err)
+	}
+	for _, listed := range queues {
+		if listed.ID == q.ID && len(listed.NotifyThresholds) != 0 {
+			t.Errorf("GetQueues thresholds = %v, want none", listed.NotifyThresholds)
+		}
+	}
+
+	if _, err := h.SetQueueNotifyThresholds(ctx, uuid.New(), []int{1}); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("SetQueueNotifyThresholds on unknown queue: err = %v, want ErrQueueNotFound", err)
+	}
+	created, err := h.CreateQueue(ctx, "Notify at creation", queue.TicketFormat{}, []int{5, 1})
+	if err != nil {
+		t.Fatalf("CreateQueue with thresholds: %v", err)
+	}
+	got, err = h.GetQueueByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetQueueByID: %v", err)
+	}
+	if fmt.Sprint(created.NotifyThresholds) != "[5 1]" || fmt.Sprint(got.NotifyThresholds) != "[5 1]" {
+		t.Errorf("thresholds given at creation = %v, stored %v, want [5 1]", created.NotifyThresholds, got.NotifyThresholds)
+	}
+}
+
+func testQueueNotFound(t *testing.T, h *storeHarness) {
+	_, err := h.GetQueueByID(context.Background(), uuid.New())
+	if !errors.Is(err, ErrQueueNotFound) {
+		t.Fatalf("GetQueueByID(unknown) error = %v, want ErrQueueNotFound", err)
+	}
+}
+
+func testSequentialTicketNumbers(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Sequential")
+	for i, want := range []string{"A-001", "A-002", "A-003"} {
+		ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+		if ticket.TicketNumber != want {
+			t.Errorf("ticket %d number = %q, want %q", i, ticket.TicketNumber, want)
+		}
+		if ticket.Status != "waiting" {
+			t.Errorf("ticket %d status = %q, want waiting", i, ticket.Status)
+		}
+	}
+}
+
+func testTicketNumbersResetDaily(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Daily reset")
+	mustCreateTicket(t, h, queue.ID, "yesterday1", 0)
+	mustCreateTicket(t, h, queue.ID, "yesterday2", 0)
+	h.rewindDay(t, queue.ID)
+
+	ticket := mustCreateTicket(t, h, queue.ID, "today", 0)
+	if ticket.TicketNumber != "A-001" {
+		t.Errorf("first ticket of the day = %q, want A-001", ticket.TicketNumber)
+	}
+	if ticket.Position != 3 {
+		t.Errorf("position = %d, want 3 (positions do not reset)", ticket.Position)
+	}
+}
+
+func testTicketNumbersPerQueue(t *testing.T, h *storeHarness) {
+	a := mustCreateQueue(t, h, "Queue A")
+	b := mustCreateQueue(t, h, "Queue B")
+	mustCreateTicket(t, h, a.ID, "a1", 0)
+	mustCreateTicket(t, h, a.ID, "a2", 0)
+
+	ticket := mustCreateTicket(t, h, b.ID, "b1", 0)
+	if ticket.TicketNumber != "A-001" || ticket.Position != 1 {
+		t.Errorf("first ticket of a new queue = %q at %d, want A-001 at 1", ticket.TicketNumber, ticket.Position)
+	}
+}
+
+func testTicketFormats(t *testing.T, h *storeHarness) {
+	smith := mustCreateQueueWithFormat(t, h, "Dr. Smith", queue.TicketFormat{Prefix: "S"})
+	walkIns := mustCreateQueueWithFormat(t, h, "Walk-ins", queue.TicketFormat{Prefix: "WI", Width: 2, StartNumber: 5})
+
+	got, err := h.GetQueueByID(context.Background(), walkIns.ID)
+	if err != nil {
+		t.Fatalf("GetQueueByID: %v", err)
+	}
+	want := queue.TicketFormat{Prefix: "WI", Width: 2, StartNumber: 5, ResetPolicy: queue.ResetDaily}
+	if got.TicketFormat != want {
+		t.Errorf("stored ticket format = %+v, want %+v", got.TicketFormat, want)
+	}
+
+	for _, tc := range []struct {
+		queueID uuid.UUID
+		want    string
+	}{
+		{smith.ID, "S-001"},
+		{walkIns.ID, "WI-05"},
+		{smith.ID, "S-002"},
+		{walkIns.ID, "WI-06"},
+	} {
+		if ticket := mustCreateTicket(t, h, tc.queueID, "customer", 0); ticket.TicketNumber != tc.want {
+			t.Errorf("ticket number = %q, want %q", ticket.TicketNumber, tc.want)
+		}
+	}
+}
+
+// testTicketNumbersPastPaddingWidth guards against deriving the next number
+// from the previous string, where "A-1000" sorts below "A-999".
+func testTicketNumbersPastPaddingWidth(t *testing.T, h *storeHarness) {
+	q := mustCreateQueueWithFormat(t, h, "Busy", queue.TicketFormat{StartNumber: 998})
+	for _, want := range []string{"A-998", "A-999", "A-1000", "A-1001"} {
+		if ticket := mustCreateTicket(t, h, q.ID, "customer", 0); ticket.TicketNumber != want {
+			t.Errorf("ticket number = %q, want %q", ticket.TicketNumber, want)
+		}
+	}
+}
+
+func testTicketNumbersNeverReset(t *testing.T, h *storeHarness) {
+	q := mustCreateQueueWithFormat(t, h, "Never", queue.TicketFormat{Prefix: "N", ResetPolicy: queue.ResetNever})
+	mustCreateTicket(t, h, q.ID, "yesterday1", 0)
+	mustCreateTicket(t, h, q.ID, "yesterday2", 0)
+	h.rewindDay(t, q.ID)
+
+	if ticket := mustCreateTicket(t, h, q.ID, "today", 0); ticket.TicketNumber != "N-003" {
+		t.Errorf("ticket number = %q, want N-003", ticket.TicketNumber)
+	}
+}
+
+func testPositionAssignment(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Positions")
+	for want := 1; want <= 3; want++ {
+		ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+		if ticket.Position != want {
+			t.Errorf("position = %d, want %d", ticket.Position, want)
+		}
+	}
+
+	// Served and cancelled tickets keep their slot; new tickets go to the end.
+	tickets, err := h.GetTicketsByQueueID(context.Background(), queue.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	mustUpdateStatus(t, h, tickets[0].ID, "cancelled")
+	if ticket := mustCreateTicket(t, h, queue.ID, "late", 0); ticket.Position != 4 {
+		t.Errorf("position after cancel = %d, want 4", ticket.Position)
+	}
+}
+
+func testPriorityOrdering(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Priority")
+	normal1 := mustCreateTicket(t, h, queue.ID, "normal1", 0)
+	urgent := mustCreateTicket(t, h, queue.ID, "urgent", 10)
+	normal2 := mustCreateTicket(t, h, queue.ID, "normal2", 0)
+	elevated := mustCreateTicket(t, h, queue.ID, "elevated", 5)
+
+	tickets, err := h.GetTicketsByQueueID(context.Background(), queue.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	want := []uuid.UUID{urgent.ID, elevated.ID, normal1.ID, normal2.ID}
+	if len(tickets) != len(want) {
+		t.Fatalf("got %d tickets, want %d", len(tickets), len(want))
+	}
+	for i, ticket := range tickets {
+		if ticket.ID != want[i] {
+			t.Errorf("tickets[%d] = %s (priority %d), want %s", i, ticket.CustomerName, ticket.Priority, want[i])
+		}
+	}
+	if tickets[0].Priority != 10 {
+		t.Errorf("priority = %d, want 10", tickets[0].Priority)
+	}
+}
+
+func testActiveTicketsByQueue(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Active")
+	other := mustCreateQueue(t, h, "Active elsewhere")
+	served := mustCreateTicket(t, h, queue.ID, "served", 0)
+	waiting := mustCreateTicket(t, h, queue.ID, "waiting", 0)
+	cancelled := mustCreateTicket(t, h, queue.ID, "cancelled", 0)
+	urgent := mustCreateTicket(t, h, queue.ID, "urgent", 10)
+	serving := mustCreateTicket(t, h, queue.ID, "serving", 0)
+	mustCreateTicket(t, h, other.ID, "elsewhere", 0)
+	mustUpdateStatus(t, h, served.ID, "serving")
+	mustUpdateStatus(t, h, served.ID, "served")
+	mustUpdateStatus(t, h, cancelled.ID, "cancelled")
+	mustUpdateStatus(t, h, serving.ID, "serving")
+
+	tickets, err := h.GetActiveTicketsByQueueID(ctx, queue.ID)
+	if err != nil {
+		t.Fatalf("GetActiveTicketsByQueueID: %v", err)
+	}
+	want := []uuid.UUID{urgent.ID, waiting.ID, serving.ID}
+	if len(tickets) != len(want) {
+		t.Fatalf("got %d tickets, want the %d waiting and serving ones", len(tickets), len(want))
+	}
+	for i, ticket := range tickets {
+		if ticket.ID != want[i] {
+			t.Errorf("tickets[%d] = %s (%s), want %s", i, ticket.CustomerName, ticket.Status, want[i])
+		}
+	}
+	if all, err := h.GetTicketsByQueueID(ctx, queue.ID); err != nil || len(all) != 5 {
+		t.Errorf("GetTicketsByQueueID = %d tickets, %v; want all 5", len(all), err)
+	}
+}
+
+func testCreateTicketUnknownQueue(t *testing.T, h *storeHarness) {
+	_, err := h.CreateTicket(context.Background(), uuid.New(), "nobody", "+15550000000", "", 0, "", Audit{})
+	if !errors.Is(err, ErrQueueNotFound) {
+		t.Fatalf("CreateTicket(unknown queue) error = %v, want ErrQueueNotFound", err)
+	}
+}
+
+// testConcurrentCheckIns creates hundreds of tickets in parallel and checks
+// that every one got a distinct number and position.
+func testConcurrentCheckIns(t *testing.T, h *storeHarness) {
+	const n = 300
+	queue := mustCreateQueue(t, h, "Rush hour")
+
+	var wg sync.WaitGroup
+	tickets := make([]*Ticket, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tickets[i], errs[i] = h.CreateTicket(context.Background(), queue.ID, fmt.Sprintf("customer %d", i), "+15550000000", "", 0, "", Audit{})
+		}(i)
+	}
+	wg.Wait()
+
+	numbers := make(map[string]bool, n)
+	positions := make(map[int]bool, n)
+	for i, ticket := range tickets {
+		if errs[i] != nil {
+			t.Fatalf("CreateTicket #%d: %v", i, errs[i])
+		}
+		if numbers[ticket.TicketNumber] {
+			t.Errorf("ticket number %s issued twice", ticket.TicketNumber)
+		}
+		if positions[ticket.Position] {
+			t.Errorf("position %d assigned twice", ticket.Position)
+		}
+		numbers[ticket.TicketNumber] = true
+		positions[ticket.Position] = true
+	}
+	for i := 1; i <= n; i++ {
+		if !numbers[fmt.Sprintf("A-%03d", i)] || !positions[i] {
+			t.Errorf("number A-%03d or position %d was skipped", i, i)
+		}
+	}
+
+	stored, err := h.GetTicketsByQueueID(context.Background(), queue.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	if len(stored) != n {
+		t.Errorf("stored %d tickets, want %d", len(stored), n)
+	}
+}
+
+func testUpdateTicketStatus(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Update")
+	created := mustCreateTicket(t, h, queue.ID, "customer", 3)
+
+	updated := mustUpdateStatus(t, h, created.ID, "serving")
+	if updated.Status != "serving" {
+		t.Errorf("status = %q, want serving", updated.Status)
+	}
+	if updated.ID != created.ID || updated.QueueID != queue.ID || updated.TicketNumber != created.TicketNumber ||
+		updated.Position != created.Position || updated.Priority != created.Priority {
+		t.Errorf("UpdateTicketStatus returned %+v, want fields of %+v", updated, created)
+	}
+	if updated.UpdatedAt.Before(created.UpdatedAt) {
+		t.Errorf("updated_at went backwards: %v < %v", updated.UpdatedAt, created.UpdatedAt)
+	}
+}
+
+func testTicketNotFound(t *testing.T, h *storeHarness) {
+	_, err := h.UpdateTicketStatus(context.Background(), uuid.New(), "serving", nil, Audit{})
+	if !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("UpdateTicketStatus(unknown) error = %v, want ErrTicketNotFound", err)
+	}
+}
+
+func testGetTicketByID(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Lookup")
+	counter := mustCreateCounter(t, h, queue.ID, "Desk 1")
+	created, err := h.CreateTicket(ctx, queue.ID, "customer", "+15550000000", "pt-BR", 2, "", Audit{})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	if created.Locale != "pt-BR" {
+		t.Errorf("CreateTicket locale = %q, want pt-BR", created.Locale)
+	}
+	called, err := h.UpdateTicketStatus(ctx, created.ID, "serving", &counter.ID, Audit{})
+	if err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+	if called.Locale != "pt-BR" {
+		t.Errorf("UpdateTicketStatus locale = %q, want pt-BR", called.Locale)
+	}
+
+	got, err := h.GetTicketByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetTicketByID: %v", err)
+	}
+	if got.ID != created.ID || got.QueueID != queue.ID || got.TicketNumber != created.TicketNumber ||
+		got.Status != "serving" || got.Priority != 2 || got.CustomerName != "customer" || got.Locale != "pt-BR" {
+		t.Errorf("GetTicketByID returned %+v, want the called ticket", got)
+	}
+	if got.CounterID == nil || *got.CounterID != counter.ID || got.CounterName == nil || *got.CounterName != "Desk 1" {
+		t.Errorf("counter = %v/%v, want Desk 1", got.CounterID, got.CounterName)
+	}
+
+	if _, err := h.GetTicketByID(ctx, uuid.New()); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("GetTicketByID(unknown) error = %v, want ErrTicketNotFound", err)
+	}
+}
+
+func testTicketAccessToken(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Tokens")
+	hash := strings.Repeat("ab", 32)
+	ticket, err := h.CreateTicket(ctx, queue.ID, "customer", "+15550000000", "", 0, hash, Audit{})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	// Tickets without a token must not collide with each other.
+	mustCreateTicket(t, h, queue.ID, "no token 1", 0)
+	mustCreateTicket(t, h, queue.ID, "no token 2", 0)
+
+	got, err := h.GetTicketByAccessTokenHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("GetTicketByAccessTokenHash: %v", err)
+	}
+	if got.ID != ticket.ID || got.TicketNumber != ticket.TicketNumber {
+		t.Errorf("GetTicketByAccessTokenHash returned %s, want %s", got.TicketNumber, ticket.TicketNumber)
+	}
+
+	for _, unknown := range []string{strings.Repeat("cd", 32), ""} {
+		if _, err := h.GetTicketByAccessTokenHash(ctx, unknown); !errors.Is(err, ErrTicketNotFound) {
+			t.Errorf("GetTicketByAccessTokenHash(%q) error = %v, want ErrTicketNotFound", unknown, err)
+		}
+	}
+}
+
+func testInvalidTransitions(t *testing.T, h *storeHarness) {
+	q := mustCreateQueue(t, h, "Transitions")
+	waiting := mustCreateTicket(t, h, q.ID, "waiting", 0)
+	served := mustCreateTicket(t, h, q.ID, "served", 0)
+	mustUpdateStatus(t, h, served.ID, "serving")
+	mustUpdateStatus(t, h, served.ID, "served")
+
+	for _, tc := range []struct {
+		ticketID uuid.UUID
+		status   string
+	}{
+		{waiting.ID, "served"},
+		{waiting.ID, "waiting"},
+		{waiting.ID, "teleported"},
+		{served.ID, "serving"},
+		{served.ID, "cancelled"},
+	} {
+		_, err := h.UpdateTicketStatus(context.Background(), tc.ticketID, tc.status, nil, Audit{})
+		if !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("UpdateTicketStatus(%s) error = %v, want ErrInvalidTransition", tc.status, err)
+		}
+	}
+
+	// Rejected transitions leave no trace in the ticket or its history.
+	if got := h.history(t, waiting.ID); len(got) != 1 || got[0] != "waiting" {
+		t.Errorf("history after rejected transitions = %v, want [waiting]", got)
+	}
+	tickets, err := h.GetTicketsByQueueID(context.Background(), q.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	for _, ticket := range tickets {
+		if ticket.ID == waiting.ID && ticket.Status != "waiting" {
+			t.Errorf("status after rejected transitions = %q, want waiting", ticket.Status)
+		}
+	}
+}
+
+func testHistoryLogging(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "History")
+	ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+	if got := h.history(t, ticket.ID); len(got) != 1 || got[0] != "waiting" {
+		t.Fatalf("history after create = %v, want [waiting]", got)
+	}
+
+	mustUpdateStatus(t, h, ticket.ID, "serving")
+	mustUpdateStatus(t, h, ticket.ID, "served")
+
+	want := []string{"waiting", "serving", "served"}
+	got := h.history(t, ticket.ID)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+}
+
+func testTicketHistory(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Timeline")
+	ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+	other := mustCreateTicket(t, h, queue.ID, "other", 0)
+	staffID := uuid.New()
+	staff := Audit{ActorType: ActorUser, ActorID: &staffID, ActorName: "alice", Reason: "no show"}
+	mustUpdateStatus(t, h, ticket.ID, "serving")
+	if _, err := h.UpdateTicketStatus(ctx, ticket.ID, "cancelled", nil, staff); err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+	mustUpdateStatus(t, h, other.ID, "cancelled")
+
+	base := time.Now().Add(-time.Hour)
+	h.setHistoryTime(t, ticket.ID, "waiting", base)
+	h.setHistoryTime(t, ticket.ID, "serving", base.Add(10*time.Minute))
+	h.setHistoryTime(t, ticket.ID, "cancelled", base.Add(15*time.Minute))
+
+	entries, err := h.GetTicketHistory(ctx, ticket.ID)
+	if err != nil {
+		t.Fatalf("GetTicketHistory: %v", err)
+	}
+	var statuses []string
+	for _, e := range entries {
+		statuses = append(statuses, e.Status)
+		if e.TicketID != ticket.ID || e.QueueID != queue.ID || e.TicketNumber != ticket.TicketNumber {
+			t.Errorf("entry %+v does not describe ticket %s", e, ticket.TicketNumber)
+		}
+	}
+	if got := strings.Join(statuses, ","); got != "waiting,serving,cancelled" {
+		t.Fatalf("history = %s, want waiting,serving,cancelled", got)
+	}
+	if d := entries[1].Timestamp.Sub(entries[0].Timestamp); d != 10*time.Minute {
+		t.Errorf("time from waiting to serving = %v, want 10m", d)
+	}
+	if last := entries[2]; last.ActorName != "alice" || last.Reason != "no show" {
+		t.Errorf("cancel entry audit = %+v, want alice with a reason", last.Audit)
+	}
+
+	if _, err := h.GetTicketHistory(ctx, uuid.New()); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("GetTicketHistory(unknown) error = %v, want ErrTicketNotFound", err)
+	}
+}
+
+func testAuditTrail(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Audit")
+	kioskID, staffID := uuid.New(), uuid.New()
+
+	kiosk := Audit{ActorType: ActorAPIKey, ActorID: &kioskID, ActorName: "Lobby kiosk", SourceIP: "10.0.0.7", UserAgent: "kiosk/1.0"}
+	ticket, err := h.CreateTicket(ctx, queue.ID, "customer", "+15550000000", "", 0, "", kiosk)
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	staff := Audit{ActorType: ActorUser, ActorID: &staffID, ActorName: "alice", SourceIP: "10.0.0.8", Reason: "walked up to the desk"}
+	if _, err := h.UpdateTicketStatus(ctx, ticket.ID, "serving", nil, staff); err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+	mustUpdateStatus(t, h, ticket.ID, "served")
+
+	base := time.Now().Add(-3 * time.Hour)
+	h.setHistoryTime(t, ticket.ID, "waiting", base)
+	h.setHistoryTime(t, ticket.ID, "serving", base.Add(time.Hour))
+	h.setHistoryTime(t, ticket.ID, "served", base.Add(2*time.Hour))
+
+	entries, err := h.GetAuditTrail(ctx, AuditFilter{TicketID: &ticket.ID})
+	if err != nil {
+		t.Fatalf("GetAuditTrail(ticket): %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("GetAuditTrail(ticket) returned %d entries, want 3", len(entries))
+	}
+	served, serving, waiting := entries[0], entries[1], entries[2]
+	if served.Status != "served" || serving.Status != "serving" || waiting.Status != "waiting" {
+		t.Fatalf("statuses = %s, %s, %s, want newest first", served.Status, serving.Status, waiting.Status)
+	}
+	if waiting.ActorType != ActorAPIKey || waiting.ActorID == nil || *waiting.ActorID != kioskID ||
+		waiting.ActorName != "Lobby kiosk" || waiting.SourceIP != "10.0.0.7" || waiting.UserAgent != "kiosk/1.0" {
+		t.Errorf("check-in entry = %+v, want the kiosk", waiting.Audit)
+	}
+	if serving.ActorType != ActorUser || serving.ActorName != "alice" || serving.Reason != "walked up to the desk" {
+		t.Errorf("call entry = %+v, want alice with a reason", serving.Audit)
+	}
+	if served.ActorType != ActorSystem || served.ActorID != nil {
+		t.Errorf("serve entry = %+v, want the system for a zero Audit", served.Audit)
+	}
+	if waiting.QueueID != queue.ID || waiting.TicketNumber != ticket.TicketNumber {
+		t.Errorf("entry ticket = %s/%s, want %s/%s", waiting.QueueID, waiting.TicketNumber, queue.ID, ticket.TicketNumber)
+	}
+
+	entries, err = h.GetAuditTrail(ctx, AuditFilter{ActorID: &staffID})
+	if err != nil {
+		t.Fatalf("GetAuditTrail(actor): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status != "serving" {
+		t.Errorf("GetAuditTrail(actor) = %+v, want only the call", entries)
+	}
+
+	entries, err = h.GetAuditTrail(ctx, AuditFilter{TicketID: &ticket.ID, ActorType: ActorSystem})
+	if err != nil {
+		t.Fatalf("GetAuditTrail(actor type): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status != "served" {
+		t.Errorf("GetAuditTrail(actor type) = %+v, want only the serve", entries)
+	}
+
+	from, to := base.Add(30*time.Minute), base.Add(2*time.Hour)
+	entries, err = h.GetAuditTrail(ctx, AuditFilter{TicketID: &ticket.ID, From: &from, To: &to})
+	if err != nil {
+		t.Fatalf("GetAuditTrail(range): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status != "serving" {
+		t.Errorf("GetAuditTrail(range) = %+v, want only the call; To is exclusive", entries)
+	}
+
+	entries, err = h.GetAuditTrail(ctx, AuditFilter{TicketID: &ticket.ID, Limit: 2})
+	if err != nil {
+		t.Fatalf("GetAuditTrail(limit): %v", err)
+	}
+	if len(entries) != 2 || entries[0].Status != "served" {
+		t.Errorf("GetAuditTrail(limit 2) = %+v, want the two newest entries", entries)
+	}
+}
+
+func testCallNextTicket(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Call next")
+	first := mustCreateTicket(t, h, queue.ID, "first", 0)
+	second := mustCreateTicket(t, h, queue.ID, "second", 0)
+	urgent := mustCreateTicket(t, h, queue.ID, "urgent", 5)
+	cancelled := mustCreateTicket(t, h, queue.ID, "cancelled", 9)
+	mustUpdateStatus(t, h, cancelled.ID, "cancelled")
+
+	for _, want := range []*Ticket{urgent, first, second} {
+		got, err := h.CallNextTicket(context.Background(), queue.ID, nil, Audit{})
+		if err != nil {
+			t.Fatalf("CallNextTicket: %v", err)
+		}
+		if got.ID != want.ID {
+			t.Fatalf("called %s (%s), want %s (%s)", got.TicketNumber, got.CustomerName, want.TicketNumber, want.CustomerName)
+		}
+		if got.Status != "serving" {
+			t.Errorf("called ticket status = %q, want serving", got.Status)
+		}
+	}
+
+	want := []string{"waiting", "serving"}
+	if got := h.history(t, first.ID); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+}
+
+func testCallNextEmptyQueue(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Empty")
+	_, err := h.CallNextTicket(context.Background(), queue.ID, nil, Audit{})
+	if !errors.Is(err, ErrNoWaitingTickets) {
+		t.Errorf("CallNextTicket on empty queue: err = %v, want ErrNoWaitingTickets", err)
+	}
+
+	served := mustCreateTicket(t, h, queue.ID, "served", 0)
+	mustUpdateStatus(t, h, served.ID, "serving")
+	_, err = h.CallNextTicket(context.Background(), queue.ID, nil, Audit{})
+	if !errors.Is(err, ErrNoWaitingTickets) {
+		t.Errorf("CallNextTicket with nobody waiting: err = %v, want ErrNoWaitingTickets", err)
+	}
+}
+
+func testCallNextUnknownQueue(t *testing.T, h *storeHarness) {
+	_, err := h.CallNextTicket(context.Background(), uuid.New(), nil, Audit{})
+	if !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("CallNextTicket on unknown queue: err = %v, want ErrQueueNotFound", err)
+	}
+}
+
+func testTicketNotifications(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Texts")
+	ticket := mustCreateTicket(t, h, queue.ID, "texted", 0)
+	other := mustCreateTicket(t, h, queue.ID, "other", 0)
+
+	first, err := h.EnqueueNotification(ctx, ticket.ID, "sms", "next_in_line", 3, "+15550000000", "3 people ahead")
+	if err != nil {
+		t.Fatalf("EnqueueNotification: %v", err)
+	}
+	if first.ID == uuid.Nil || first.TicketID != ticket.ID || first.CreatedAt.IsZero() {
+		t.Errorf("EnqueueNotification returned incomplete record: %+v", first)
+	}
+	if first.Status != NotificationPending || first.Attempts != 0 || first.QueueID != queue.ID || first.TicketNumber != ticket.TicketNumber {
+		t.Errorf("EnqueueNotification = %+v, want a pending notification of the ticket with no attempts", first)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := h.EnqueueNotification(ctx, ticket.ID, "sms", "next_in_line", 0, "+15550000000", "You're next"); err != nil {
+		t.Fatalf("EnqueueNotification(another threshold): %v", err)
+	}
+	if _, err := h.EnqueueNotification(ctx, other.ID, "sms", "next_in_line", 3, "+15550000000", "3 people ahead"); err != nil {
+		t.Fatalf("EnqueueNotification(another ticket): %v", err)
+	}
+
+	_, err = h.EnqueueNotification(ctx, ticket.ID, "sms", "next_in_line", 3, "+15550000000", "3 people ahead")
+	if !errors.Is(err, ErrNotificationSent) {
+		t.Errorf("enqueueing the same notification twice: err = %v, want ErrNotificationSent", err)
+	}
+
+	notifications, err := h.GetTicketNotifications(ctx, ticket.ID)
+	if err != nil {
+		t.Fatalf("GetTicketNotifications: %v", err)
+	}
+	if len(notifications) != 2 || notifications[0].Threshold != 3 || notifications[1].Payload != "You're next" {
+		t.Errorf("GetTicketNotifications = %+v, want the two notifications oldest first", notifications)
+	}
+
+	if _, err := h.EnqueueNotification(ctx, uuid.New(), "sms", "called", 0, "+1", "hi"); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("EnqueueNotification on unknown ticket: err = %v, want ErrTicketNotFound", err)
+	}
+	if _, err := h.GetTicketNotifications(ctx, uuid.New()); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("GetTicketNotifications on unknown ticket: err = %v, want ErrTicketNotFound", err)
+	}
+}
+
+// claimOwn claims the due notifications at now and returns those among ids,
+// so that the test ignores notifications of other tests sharing the database.
+func claimOwn(t *testing.T, h *storeHarness, now time.Time, ids ...uuid.UUID) []*Notification {
+	t.Helper()
+	claimed, err := h.ClaimNotifications(context.Background(), now, time.Minute, 1000)
+	if err != nil {
+		t.Fatalf("ClaimNotifications: %v", err)
+	}
+	var own []*Notification
+	for _, n := range claimed {
+		for _, id := range ids {
+			if n.ID == id {
+				own = append(own, n)
+			}
+		}
+	}
+	return own
+}
+
+func testNotificationDelivery(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Delivery")
+	ticket := mustCreateTicket(t, h, queue.ID, "texted", 0)
+
+	sent, err := h.EnqueueNotification(ctx, ticket.ID, "sms", "called", 0, "+15550000000", "Your turn")
+	if err != nil {
+		t.Fatalf("EnqueueNotification: %v", err)
+	}
+	retried, err := h.EnqueueNotification(ctx, ticket.ID, "sms", "next_in_line", 0, "+15550000000", "You're next")
+	if err != nil {
+		t.Fatalf("EnqueueNotification: %v", err)
+	}
+
+	now := time.Now().Add(time.Second)
+	claimed := claimOwn(t, h, now, sent.ID, retried.ID)
+	if len(claimed) != 2 || claimed[0].ID != sent.ID || claimed[0].Attempts != 1 || claimed[0].TicketNumber != ticket.TicketNumber {
+		t.Fatalf("ClaimNotifications = %+v, want both notifications oldest first with one attempt", claimed)
+	}
+	if again := claimOwn(t, h, now, sent.ID, retried.ID); len(again) != 0 {
+		t.Errorf("claiming again during the lease returned %d notifications, want none", len(again))
+	}
+
+	if err := h.MarkNotificationSent(ctx, sent.ID, now); err != nil {
+		t.Fatalf("MarkNotificationSent: %v", err)
+	}
+	retryAt := now.Add(time.Minute)
+	if err := h.MarkNotificationFailed(ctx, retried.ID, "gateway timeout", &retryAt, now); err != nil {
+		t.Fatalf("MarkNotificationFailed: %v", err)
+	}
+	if again := claimOwn(t, h, now.Add(30*time.Second), sent.ID, retried.ID); len(again) != 0 {
+		t.Errorf("claiming before the retry is due returned %d notifications, want none", len(again))
+	}
+	claimed = claimOwn(t, h, retryAt, sent.ID, retried.ID)
+	if len(claimed) != 1 || claimed[0].ID != retried.ID || claimed[0].Attempts != 2 || claimed[0].LastError != "gateway timeout" {
+		t.Fatalf("claiming the due retry = %+v, want the failed notification with two attempts", claimed)
+	}
+	if err := h.MarkNotificationFailed(ctx, retried.ID, "invalid number", nil, retryAt); err != nil {
+		t.Fatalf("MarkNotificationFailed(give up): %v", err)
+	}
+	if again := claimOwn(t, h, retryAt.Add(time.Hour), sent.ID, retried.ID); len(again) != 0 {
+		t.Errorf("claiming after giving up returned %d notifications, want none", len(again))
+	}
+
+	notifications, err := h.GetTicketNotifications(ctx, ticket.ID)
+	if err != nil {
+		t.Fatalf("GetTicketNotifications: %v", err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("GetTicketNotifications returned %d notifications, want 2", len(notifications))
+	}
+	if n := notifications[0]; n.Status != NotificationSent || n.SentAt == nil || !n.SentAt.Equal(now) {
+		t.Errorf("sent notification = %+v, want status sent at %v", n, now)
+	}
+	if n := notifications[1]; n.Status != NotificationFailed || n.Attempts != 2 || n.LastError != "invalid number" || n.SentAt != nil {
+		t.Errorf("failed notification = %+v, want status failed after 2 attempts", n)
+	}
+
+	if err := h.MarkNotificationSent(ctx, uuid.New(), now); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("MarkNotificationSent on unknown notification: err = %v, want ErrNotificationNotFound", err)
+	}
+	if err := h.MarkNotificationFailed(ctx, uuid.New(), "x", nil, now); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("MarkNotificationFailed on unknown notification: err = %v, want ErrNotificationNotFound", err)
+	}
+}
+
+func testListNotifications(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Listed")
+	otherQueue := mustCreateQueue(t, h, "Not listed")
+	a := mustCreateTicket(t, h, queue.ID, "a", 0)
+	b := mustCreateTicket(t, h, queue.ID, "b", 0)
+	c := mustCreateTicket(t, h, otherQueue.ID, "c", 0)
+
+	var ids []uuid.UUID
+	for _, ticket := range []*Ticket{a, b, c} {
+		n, err := h.EnqueueNotification(ctx, ticket.ID, "sms", "called", 0, "+15550000000", "Your turn")
+		if err != nil {
+			t.Fatalf("EnqueueNotification: %v", err)
+		}
+		ids = append(ids, n.ID)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := h.MarkNotificationSent(ctx, ids[0], time.Now()); err != nil {
+		t.Fatalf("MarkNotificationSent: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter NotificationFilter
+		want   []uuid.UUID
+	}{
+		{"queue", NotificationFilter{QueueID: &queue.ID}, []uuid.UUID{ids[1], ids[0]}},
+		{"ticket", NotificationFilter{TicketID: &b.ID}, []uuid.UUID{ids[1]}},
+		{"status", NotificationFilter{QueueID: &queue.ID, Status: NotificationPending}, []uuid.UUID{ids[1]}},
+		{"limit", NotificationFilter{QueueID: &queue.ID, Limit: 1}, []uuid.UUID{ids[1]}},
+	}
+	for _, tt := range tests {
+		got, err := h.ListNotifications(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("ListNotifications(%s): %v", tt.name, err)
+		}
+		var gotIDs []uuid.UUID
+		for _, n := range got {
+			gotIDs = append(gotIDs, n.ID)
+		}
+		if fmt.Sprint(gotIDs) != fmt.Sprint(tt.want) {
+			t.Errorf("ListNotifications(%s) = %v, want %v", tt.name, gotIDs, tt.want)
+		}
+	}
+}
+
+func testMessageTemplates(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Templated")
+	// Global templates are shared by every test, so use a locale of our own.
+	locale := "x-" + uuid.NewString()[:8]
+
+	if _, err := h.SetMessageTemplate(ctx, nil, "called", locale, "Global {ticket_number}"); err != nil {
+		t.Fatalf("SetMessageTemplate(global): %v", err)
+	}
+	first, err := h.SetMessageTemplate(ctx, &queue.ID, "called", locale, "Queue {ticket_number}")
+	if err != nil {
+		t.Fatalf("SetMessageTemplate(queue): %v", err)
+	}
+	if _, err := h.SetMessageTemplate(ctx, &queue.ID, "cancelled", "en", "Bye"); err != nil {
+		t.Fatalf("SetMessageTemplate(queue): %v", err)
+	}
+	replaced, err := h.SetMessageTemplate(ctx, &queue.ID, "called", locale, "Queue again {ticket_number}")
+	if err != nil {
+		t.Fatalf("SetMessageTemplate(replace): %v", err)
+	}
+	if replaced.ID != first.ID || replaced.Body != "Queue again {ticket_number}" {
+		t.Errorf("replaced template = %+v, want ID %s with the new body", replaced, first.ID)
+	}
+
+	templates, err := h.GetMessageTemplates(ctx, &queue.ID)
+	if err != nil {
+		t.Fatalf("GetMessageTemplates(queue): %v", err)
+	}
+	var got []string
+	for _, tmpl := range templates {
+		if tmpl.QueueID == nil || *tmpl.QueueID != queue.ID {
+			t.Errorf("template %s/%s has queue %v, want %s", tmpl.Name, tmpl.Locale, tmpl.QueueID, queue.ID)
+		}
+		got = append(got, tmpl.Name+"/"+tmpl.Body)
+	}
+	want := []string{"called/Queue again {ticket_number}", "cancelled/Bye"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("queue templates = %v, want %v", got, want)
+	}
+
+	global, err := h.GetMessageTemplates(ctx, nil)
+	if err != nil {
+		t.Fatalf("GetMessageTemplates(global): %v", err)
+	}
+	found := false
+	for _, tmpl := range global {
+		if tmpl.QueueID != nil {
+			t.Errorf("global templates include queue template %s/%s", tmpl.Name, tmpl.Locale)
+		}
+		if tmpl.Locale == locale {
+			found = tmpl.Body == "Global {ticket_number}"
+		}
+	}
+	if !found {
+		t.Errorf("global templates do not include ours: %+v", global)
+	}
+
+	if err := h.DeleteMessageTemplate(ctx, &queue.ID, "called", locale); err != nil {
+		t.Fatalf("DeleteMessageTemplate: %v", err)
+	}
+	if err := h.DeleteMessageTemplate(ctx, &queue.ID, "called", locale); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("second DeleteMessageTemplate error = %v, want ErrTemplateNotFound", err)
+	}
+	if err := h.DeleteMessageTemplate(ctx, nil, "called", locale); err != nil {
+		t.Fatalf("DeleteMessageTemplate(global): %v", err)
+	}
+
+	missing := uuid.New()
+	if _, err := h.SetMessageTemplate(ctx, &missing, "called", "en", "Hi"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("SetMessageTemplate(unknown queue) error = %v, want ErrQueueNotFound", err)
+	}
+	if _, err := h.GetMessageTemplates(ctx, &missing); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("GetMessageTemplates(unknown queue) error = %v, want ErrQueueNotFound", err)
+	}
+}
+
+func testActiveTicketByPhone(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Texting")
+	// The tickets of other tests share a phone number, so use one of our own.
+	phone := "+1555" + fmt.Sprint(time.Now().UnixNano()%10000000)
+
+	create := func(name string) *Ticket {
+		ticket, err := h.CreateTicket(ctx, queue.ID, name, phone, "", 0, "", Audit{})
+		if err != nil {
+			t.Fatalf("CreateTicket(%s): %v", name, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		return ticket
+	}
+	older := create("older")
+	newer := create("newer")
+
+	got, err := h.GetActiveTicketByPhone(ctx, phone)
+	if err != nil {
+		t.Fatalf("GetActiveTicketByPhone: %v", err)
+	}
+	if got.ID != newer.ID {
+		t.Errorf("GetActiveTicketByPhone = %s, want the newer ticket %s", got.TicketNumber, newer.TicketNumber)
+	}
+
+	mustUpdateStatus(t, h, newer.ID, "cancelled")
+	mustUpdateStatus(t, h, older.ID, "serving")
+	got, err = h.GetActiveTicketByPhone(ctx, phone)
+	if err != nil {
+		t.Fatalf("GetActiveTicketByPhone: %v", err)
+	}
+	if got.ID != older.ID || got.Status != "serving" {
+		t.Errorf("GetActiveTicketByPhone = %s (%s), want the serving ticket %s", got.TicketNumber, got.Status, older.TicketNumber)
+	}
+
+	mustUpdateStatus(t, h, older.ID, "served")
+	for _, p := range []string{phone, "+15559999999999", ""} {
+		if _, err := h.GetActiveTicketByPhone(ctx, p); !errors.Is(err, ErrTicketNotFound) {
+			t.Errorf("GetActiveTicketByPhone(%q) error = %v, want ErrTicketNotFound", p, err)
+		}
+	}
+}
+
+func testLogTicketEvent(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Events")
+	created := mustCreateTicket(t, h, queue.ID, "asker", 0)
+
+	audit := Audit{ActorType: ActorSMS, ActorName: "+15550000000", Reason: "STATUS"}
+	if err := h.LogTicketEvent(ctx, created.ID, "status_checked", audit); err != nil {
+		t.Fatalf("LogTicketEvent: %v", err)
+	}
+
+	entries, err := h.GetTicketHistory(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetTicketHistory: %v", err)
+	}
+	last := entries[len(entries)-1]
+	if last.Status != "status_checked" || last.ActorType != ActorSMS || last.ActorName != audit.ActorName || last.Reason != "STATUS" {
+		t.Errorf("last history entry = %+v, want a status_checked entry by %s", last, audit.ActorName)
+	}
+	after, err := h.GetTicketByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetTicketByID: %v", err)
+	}
+	if after.Status != "waiting" || !after.UpdatedAt.Equal(created.UpdatedAt) {
+		t.Errorf("ticket changed to %s at %v, want it unchanged", after.Status, after.UpdatedAt)
+	}
+
+	if err := h.LogTicketEvent(ctx, uuid.New(), "status_checked", audit); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("LogTicketEvent(unknown ticket) error = %v, want ErrTicketNotFound", err)
+	}
+}
+
+func testWebhooks(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	created, err := h.CreateWebhook(ctx, "https://crm.example.com/hooks", "whsec_test", []string{"ticket.called", "ticket.served"}, "CRM")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	got, err := h.GetWebhookByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetWebhookByID: %v", err)
+	}
+	if got.URL != created.URL || got.Secret != "whsec_test" || got.Description != "CRM" ||
+		strings.Join(got.Events, " ") != "ticket.called ticket.served" {
+		t.Errorf("GetWebhookByID = %+v, want %+v", got, created)
+	}
+	if !got.Subscribes("ticket.called") || got.Subscribes("ticket.created") {
+		t.Errorf("Subscribes: want ticket.called only among ticket.called and ticket.created")
+	}
+
+	webhooks, err := h.GetWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("GetWebhooks: %v", err)
+	}
+	var listed bool
+	for _, w := range webhooks {
+		listed = listed || w.ID == created.ID
+	}
+	if !listed {
+		t.Errorf("GetWebhooks does not list webhook %s", created.ID)
+	}
+
+	if err := h.DeleteWebhook(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if _, err := h.GetWebhookByID(ctx, created.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("GetWebhookByID after delete: err = %v, want ErrWebhookNotFound", err)
+	}
+	if err := h.DeleteWebhook(ctx, created.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("DeleteWebhook twice: err = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func claimOwnDeliveries(t *testing.T, h *storeHarness, now time.Time, ids ...uuid.UUID) []*WebhookDelivery {
+	t.Helper()
+	claimed, err := h.ClaimWebhookDeliveries(context.Background(), now, time.Minute, 1000)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	var own []*WebhookDelivery
+	for _, d := range claimed {
+		for _, id := range ids {
+			if d.ID == id {
+				own = append(own, d)
+			}
+		}
+	}
+	return own
+}
+
+func testWebhookDeliveries(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	// Event types of this test only, so that webhooks of other tests sharing
+	// the database get none of its events.
+	called, served := "called."+uuid.NewString(), "served."+uuid.NewString()
+	both, err := h.CreateWebhook(ctx, "https://a.example.com", "secret-a", []string{called, served}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	servedOnly, err := h.CreateWebhook(ctx, "https://b.example.com", "secret-b", []string{served}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	calledEvent := uuid.New()
+	deliveries, err := h.EnqueueWebhookEvent(ctx, calledEvent, called, `{"type":"called"}`)
+	if err != nil {
+		t.Fatalf("EnqueueWebhookEvent: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].WebhookID != both.ID || deliveries[0].EventID != calledEvent ||
+		deliveries[0].Status != NotificationPending {
+		t.Fatalf("EnqueueWebhookEvent(%s) = %+v, want one pending delivery to the first webhook", called, deliveries)
+	}
+	first := deliveries[0]
+	if again, err := h.EnqueueWebhookEvent(ctx, calledEvent, called, `{"type":"called"}`); err != nil || len(again) != 0 {
+		t.Errorf("EnqueueWebhookEvent of the same event again = %d deliveries, %v; want none", len(again), err)
+	}
+	if deliveries, err = h.EnqueueWebhookEvent(ctx, uuid.New(), served, `{"type":"served"}`); err != nil {
+		t.Fatalf("EnqueueWebhookEvent: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("EnqueueWebhookEvent(%s) returned %d deliveries, want one per webhook", served, len(deliveries))
+	}
+	var second *WebhookDelivery
+	for _, d := range deliveries {
+		if d.WebhookID == servedOnly.ID {
+			second = d
+		}
+	}
+	if second == nil {
+		t.Fatalf("EnqueueWebhookEvent(%s) = %+v, want a delivery to the second webhook", served, deliveries)
+	}
+	if deliveries, err = h.EnqueueWebhookEvent(ctx, uuid.New(), "unsubscribed."+uuid.NewString(), `{}`); err != nil || len(deliveries) != 0 {
+		t.Errorf("EnqueueWebhookEvent of an unsubscribed type = %d deliveries, %v; want none", len(deliveries), err)
+	}
+
+	now := time.Now().Add(time.Second)
+	claimed := claimOwnDeliveries(t, h, now, first.ID, second.ID)
+	if len(claimed) != 2 || claimed[0].ID != first.ID || claimed[0].Attempts != 1 ||
+		claimed[0].URL != "https://a.example.com" || claimed[0].Secret != "secret-a" || claimed[0].Payload != `{"type":"called"}` {
+		t.Fatalf("ClaimWebhookDeliveries = %+v, want both deliveries oldest first with their webhook", claimed)
+	}
+	if again := claimOwnDeliveries(t, h, now, first.ID, second.ID); len(again) != 0 {
+		t.Errorf("claiming again during the lease returned %d deliveries, want none", len(again))
+	}
+
+	if err := h.MarkWebhookDelivered(ctx, first.ID, 200, now); err != nil {
+		t.Fatalf("MarkWebhookDelivered: %v", err)
+	}
+	retryAt := now.Add(time.Minute)
+	if err := h.MarkWebhookDeliveryFailed(ctx, second.ID, 503, "HTTP 503", &retryAt, now); err != nil {
+		t.Fatalf("MarkWebhookDeliveryFailed: %v", err)
+	}
+	claimed = claimOwnDeliveries(t, h, retryAt, first.ID, second.ID)
+	if len(claimed) != 1 || claimed[0].ID != second.ID || claimed[0].Attempts != 2 || claimed[0].ResponseStatus != 503 {
+		t.Fatalf("claiming the due retry = %+v, want the failed delivery with two attempts", claimed)
+	}
+	if err := h.MarkWebhookDeliveryFailed(ctx, second.ID, 0, "connection refused", nil, retryAt); err != nil {
+		t.Fatalf("MarkWebhookDeliveryFailed(give up): %v", err)
+	}
+
+	failed, err := h.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{WebhookID: &servedOnly.ID, Status: NotificationFailed})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(failed) != 1 || failed[0].ID != second.ID || failed[0].LastError != "connection refused" || failed[0].DeliveredAt != nil {
+		t.Fatalf("ListWebhookDeliveries(failed) = %+v, want the given up delivery", failed)
+	}
+	listed, err := h.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{WebhookID: &both.ID})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(listed) != 2 || listed[1].ID != first.ID || listed[1].Status != NotificationSent || listed[1].DeliveredAt == nil {
+		t.Fatalf("ListWebhookDeliveries(webhook) = %+v, want its two deliveries newest first", listed)
+	}
+	if listed, err = h.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{EventType: called}); err != nil || len(listed) != 1 {
+		t.Errorf("ListWebhookDeliveries(event type) = %d deliveries, %v; want 1", len(listed), err)
+	}
+
+	redelivered, err := h.RedeliverWebhookDelivery(ctx, second.ID, retryAt)
+	if err != nil {
+		t.Fatalf("RedeliverWebhookDelivery: %v", err)
+	}
+	if redelivered.Status != NotificationPending || redelivered.Attempts != 0 || redelivered.URL != "https://b.example.com" {
+		t.Errorf("RedeliverWebhookDelivery = %+v, want pending with no attempts", redelivered)
+	}
+	if _, err := h.RedeliverWebhookDelivery(ctx, second.ID, retryAt); !errors.Is(err, ErrDeliveryPending) {
+		t.Errorf("RedeliverWebhookDelivery of a pending delivery: err = %v, want ErrDeliveryPending", err)
+	}
+	if claimed = claimOwnDeliveries(t, h, retryAt, first.ID, second.ID); len(claimed) != 1 || claimed[0].ID != second.ID {
+		t.Errorf("claiming after redelivery = %+v, want the redelivered delivery", claimed)
+	}
+
+	if _, err := h.RedeliverWebhookDelivery(ctx, uuid.New(), now); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("RedeliverWebhookDelivery of unknown delivery: err = %v, want ErrDeliveryNotFound", err)
+	}
+	if err := h.MarkWebhookDelivered(ctx, uuid.New(), 200, now); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("MarkWebhookDelivered on unknown delivery: err = %v, want ErrDeliveryNotFound", err)
+	}
+
+	if err := h.DeleteWebhook(ctx, servedOnly.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if listed, err = h.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{WebhookID: &servedOnly.ID}); err != nil || len(listed) != 0 {
+		t.Errorf("deliveries of a deleted webhook = %d, %v; want none", len(listed), err)
+	}
+	if err := h.DeleteWebhook(ctx, both.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+}
+
+// callOrder calls every waiting ticket of the queue and returns the customer
+// names in the order they were called.
+// dispatchAllOutboxEvents marks every pending outbox event dispatched, so that
+// a test sees only the events it writes, and returns how many there were.
+func dispatchAllOutboxEvents(t *testing.T, h *storeHarness) int {
+	t.Helper()
+	ctx := context.Background()
+	dispatched := 0
+	for {
+		events, err := h.GetPendingOutboxEvents(ctx, 0)
+		if err != nil {
+			t.Fatalf("GetPendingOutboxEvents: %v", err)
+		}
+		if len(events) == 0 {
+			return dispatched
+		}
+		for _, e := range events {
+			if err := h.MarkOutboxEventDispatched(ctx, e.ID, time.Now()); err != nil {
+				t.Fatalf("MarkOutboxEventDispatched: %v", err)
+			}
+			dispatched++
+		}
+	}
+}
+
+func testOutboxEvents(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	dispatchAllOutboxEvents(t, h)
+
+	queue := mustCreateQueue(t, h, "Outbox")
+	created, err := h.CreateTicket(ctx, queue.ID, "first", "+15550000000", "", 0, "", Audit{ActorType: ActorCustomer})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	other := mustCreateTicket(t, h, queue.ID, "second", 0)
+	if _, err := h.DeferTicket(ctx, created.ID, 1, nil, Audit{ActorType: ActorSMS}); err != nil {
+		t.Fatalf("DeferTicket: %v", err)
+	}
+	called, err := h.CallNextTicket(ctx, queue.ID, nil, Audit{})
+	if err != nil || called.ID != other.ID {
+		t.Fatalf("CallNextTicket = %+v, %v; want the second ticket", called, err)
+	}
+	mustUpdateStatus(t, h, other.ID, "served")
+	// A change that is rolled back writes no event.
+	if _, err := h.UpdateTicketStatus(ctx, other.ID, "serving", nil, Audit{}); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("UpdateTicketStatus(served to serving) error = %v, want ErrInvalidTransition", err)
+	}
+
+	events, err := h.GetPendingOutboxEvents(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetPendingOutboxEvents: %v", err)
+	}
+	want := []struct {
+		eventType, actorType, status string
+		ticketID                     uuid.UUID
+	}{
+		{EventTicketCreated, ActorCustomer, "waiting", created.ID},
+		{EventTicketCreated, ActorSystem, "waiting", other.ID},
+		{EventTicketDeferred, ActorSMS, "waiting", created.ID},
+		{EventTicketCalled, ActorSystem, "serving", other.ID},
+		{EventTicketServed, ActorSystem, "served", other.ID},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("GetPendingOutboxEvents returned %d events, want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		w := want[i]
+		payload, err := e.Ticket()
+		if err != nil {
+			t.Fatalf("event %d Ticket: %v", i, err)
+		}
+		if e.Type != w.eventType || e.ActorType != w.actorType || e.TicketID != w.ticketID || e.QueueID != queue.ID ||
+			payload.ID != w.ticketID || payload.Status != w.status || e.DispatchedAt != nil {
+			t.Errorf("event %d = %+v with ticket %s %s, want %s by %s with the ticket %s", i, e, payload.ID, payload.Status, w.eventType, w.actorType, w.status)
+		}
+		if i > 0 && e.Seq <= events[i-1].Seq {
+			t.Errorf("event %d has seq %d after %d, want increasing seqs", i, e.Seq, events[i-1].Seq)
+		}
+	}
+	if limited, err := h.GetPendingOutboxEvents(ctx, 2); err != nil || len(limited) != 2 || limited[1].ID != events[1].ID {
+		t.Errorf("GetPendingOutboxEvents(2) = %d events, %v; want the first two", len(limited), err)
+	}
+
+	// A failed attempt leaves the event pending, in its place.
+	if err := h.MarkOutboxEventFailed(ctx, events[0].ID, "webhooks unavailable"); err != nil {
+		t.Fatalf("MarkOutboxEventFailed: %v", err)
+	}
+	if pending, err := h.GetPendingOutboxEvents(ctx, 1); err != nil || len(pending) != 1 || pending[0].ID != events[0].ID ||
+		pending[0].Attempts != 1 || pending[0].LastError != "webhooks unavailable" {
+		t.Errorf("GetPendingOutboxEvents after a failure = %+v, %v; want the failed event first with its attempt", pending, err)
+	}
+	if n := dispatchAllOutboxEvents(t, h); n != len(want) {
+		t.Errorf("dispatched %d events, want %d", n, len(want))
+	}
+
+	if err := h.MarkOutboxEventDispatched(ctx, uuid.New(), time.Now()); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("MarkOutboxEventDispatched(unknown event) error = %v, want ErrEventNotFound", err)
+	}
+	if err := h.MarkOutboxEventFailed(ctx, uuid.New(), "x"); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("MarkOutboxEventFailed(unknown event) error = %v, want ErrEventNotFound", err)
+	}
+	if deleted, err := h.DeleteDispatchedOutboxEvents(ctx, time.Now().Add(time.Second)); err != nil || deleted < int64(len(want)) {
+		t.Errorf("DeleteDispatchedOutboxEvents = %d, %v; want at least this test's %d events", deleted, err, len(want))
+	}
+	if err := h.MarkOutboxEventDispatched(ctx, events[0].ID, time.Now()); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("MarkOutboxEventDispatched(deleted event) error = %v, want ErrEventNotFound", err)
+	}
+}
+
+func callOrder(t *testing.T, h *storeHarness, queueID uuid.UUID) []string {
+	t.Helper()
+	var names []string
+	for {
+		ticket, err := h.CallNextTicket(context.Background(), queueID, nil, Audit{})
+		if errors.Is(err, ErrNoWaitingTickets) {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("CallNextTicket: %v", err)
+		}
+		names = append(names, ticket.CustomerName)
+		mustUpdateStatus(t, h, ticket.ID, "served")
+	}
+}
+
+func testDeferTicket(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Running late")
+	a := mustCreateTicket(t, h, queue.ID, "a", 0)
+	mustCreateTicket(t, h, queue.ID, "b", 0)
+	mustCreateTicket(t, h, queue.ID, "c", 0)
+	d := mustCreateTicket(t, h, queue.ID, "d", 0)
+	mustCreateTicket(t, h, queue.ID, "urgent", 5)
+
+	deferred, err := h.DeferTicket(context.Background(), a.ID, 2, nil, Audit{ActorType: ActorCustomer, Reason: "back 2 places"})
+	if err != nil {
+		t.Fatalf("DeferTicket: %v", err)
+	}
+	if deferred.Status != "waiting" || deferred.DeferredUntil != nil {
+		t.Errorf("deferred ticket = %s until %v, want waiting with no deadline", deferred.Status, deferred.DeferredUntil)
+	}
+	// Deferring past the end of the queue just moves the ticket to the back.
+	if _, err := h.DeferTicket(context.Background(), d.ID, 10, nil, Audit{}); err != nil {
+		t.Fatalf("DeferTicket past the end: %v", err)
+	}
+
+	want := []string{"urgent", "b", "c", "a", "d"}
+	if got := callOrder(t, h, queue.ID); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("call order = %v, want %v", got, want)
+	}
+
+	wantHistory := []string{"waiting", "deferred", "serving", "served"}
+	if got := h.history(t, a.ID); strings.Join(got, ",") != strings.Join(wantHistory, ",") {
+		t.Errorf("history = %v, want %v", got, wantHistory)
+	}
+	history, err := h.GetTicketHistory(context.Background(), a.ID)
+	if err != nil {
+		t.Fatalf("GetTicketHistory: %v", err)
+	}
+	if entry := history[1]; entry.ActorType != ActorCustomer || entry.Reason != "back 2 places" {
+		t.Errorf("deferred entry = %+v, want the customer's audit", entry)
+	}
+}
+
+func testDeferTicketUntil(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Hold")
+	late := mustCreateTicket(t, h, queue.ID, "late", 0)
+	mustCreateTicket(t, h, queue.ID, "on time", 0)
+
+	until := time.Now().Add(time.Hour)
+	deferred, err := h.DeferTicket(context.Background(), late.ID, 0, &until, Audit{})
+	if err != nil {
+		t.Fatalf("DeferTicket: %v", err)
+	}
+	if deferred.DeferredUntil == nil || !deferred.DeferredUntil.Equal(until) {
+		t.Errorf("deferred_until = %v, want %v", deferred.DeferredUntil, until)
+	}
+
+	if got := callOrder(t, h, queue.ID); strings.Join(got, ",") != "on time" {
+		t.Errorf("call order = %v, want only the ticket that is on time", got)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := h.DeferTicket(context.Background(), late.ID, 0, &past, Audit{}); err != nil {
+		t.Fatalf("DeferTicket: %v", err)
+	}
+	if got := callOrder(t, h, queue.ID); strings.Join(got, ",") != "late" {
+		t.Errorf("call order = %v, want the late ticket once its hold has passed", got)
+	}
+}
+
+func testDeferTicketErrors(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Defer errors")
+	serving := mustCreateTicket(t, h, queue.ID, "serving", 0)
+	mustUpdateStatus(t, h, serving.ID, "serving")
+
+	_, err := h.DeferTicket(context.Background(), serving.ID, 1, nil, Audit{})
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("DeferTicket on a serving ticket: err = %v, want ErrInvalidTransition", err)
+	}
+	_, err = h.DeferTicket(context.Background(), uuid.New(), 1, nil, Audit{})
+	if !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("DeferTicket on unknown ticket: err = %v, want ErrTicketNotFound", err)
+	}
+}
+
+func testConcurrentCallNext(t *testing.T, h *storeHarness) {
+	const n = 50
+	queue := mustCreateQueue(t, h, "Busy desk")
+	for i := 0; i < n; i++ {
+		mustCreateTicket(t, h, queue.ID, fmt.Sprintf("customer %d", i), 0)
+	}
+
+	var wg sync.WaitGroup
+	called := make([]*Ticket, 2*n)
+	errs := make([]error, 2*n)
+	for i := 0; i < 2*n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			called[i], errs[i] = h.CallNextTicket(context.Background(), queue.ID, nil, Audit{})
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uuid.UUID]bool, n)
+	var empty int
+	for i, ticket := range called {
+		if errors.Is(errs[i], ErrNoWaitingTickets) {
+			empty++
+			continue
+		}
+		if errs[i] != nil {
+			t.Fatalf("CallNextTicket #%d: %v", i, errs[i])
+		}
+		if seen[ticket.ID] {
+			t.Errorf("ticket %s called twice", ticket.TicketNumber)
+		}
+		seen[ticket.ID] = true
+	}
+	if len(seen) != n || empty != n {
+		t.Errorf("called %d tickets and got %d empty results, want %d of each", len(seen), empty, n)
+	}
+}
+
+func testCounterCRUD(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Counters")
+	other := mustCreateQueue(t, h, "Other")
+
+	c2 := mustCreateCounter(t, h, queue.ID, "Counter 2")
+	c1 := mustCreateCounter(t, h, queue.ID, "Counter 1")
+	mustCreateCounter(t, h, other.ID, "Counter 1")
+	if c1.QueueID != queue.ID || c1.Name != "Counter 1" {
+		t.Errorf("CreateCounter returned %+v", c1)
+	}
+
+	got, err := h.GetCounterByID(ctx, c1.ID)
+	if err != nil {
+		t.Fatalf("GetCounterByID: %v", err)
+	}
+	if got.ID != c1.ID || got.Name != c1.Name || got.QueueID != queue.ID {
+		t.Errorf("GetCounterByID = %+v, want %+v", got, c1)
+	}
+
+	counters, err := h.GetCountersByQueueID(ctx, queue.ID)
+	if err != nil {
+		t.Fatalf("GetCountersByQueueID: %v", err)
+	}
+	if len(counters) != 2 || counters[0].ID != c1.ID || counters[1].ID != c2.ID {
+		t.Errorf("GetCountersByQueueID = %+v, want Counter 1 and Counter 2 of this queue", counters)
+	}
+
+	renamed, err := h.UpdateCounter(ctx, c2.ID, "Window B")
+	if err != nil {
+		t.Fatalf("UpdateCounter: %v", err)
+	}
+	if renamed.Name != "Window B" || renamed.QueueID != queue.ID {
+		t.Errorf("UpdateCounter = %+v, want name Window B", renamed)
+	}
+
+	if err := h.DeleteCounter(ctx, c1.ID); err != nil {
+		t.Fatalf("DeleteCounter: %v", err)
+	}
+	if _, err := h.GetCounterByID(ctx, c1.ID); !errors.Is(err, ErrCounterNotFound) {
+		t.Errorf("GetCounterByID(deleted) error = %v, want ErrCounterNotFound", err)
+	}
+}
+
+func testCounterNotFound(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	if _, err := h.GetCounterByID(ctx, uuid.New()); !errors.Is(err, ErrCounterNotFound) {
+		t.Errorf("GetCounterByID(unknown) error = %v, want ErrCounterNotFound", err)
+	}
+	if _, err := h.UpdateCounter(ctx, uuid.New(), "x"); !errors.Is(err, ErrCounterNotFound) {
+		t.Errorf("UpdateCounter(unknown) error = %v, want ErrCounterNotFound", err)
+	}
+	if err := h.DeleteCounter(ctx, uuid.New()); !errors.Is(err, ErrCounterNotFound) {
+		t.Errorf("DeleteCounter(unknown) error = %v, want ErrCounterNotFound", err)
+	}
+	if _, err := h.CreateCounter(ctx, uuid.New(), "x"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("CreateCounter(unknown queue) error = %v, want ErrQueueNotFound", err)
+	}
+
+	queue := mustCreateQueue(t, h, "Missing counter")
+	ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+	missing := uuid.New()
+	if _, err := h.UpdateTicketStatus(ctx, ticket.ID, "serving", &missing, Audit{}); !errors.Is(err, ErrCounterNotFound) {
+		t.Errorf("UpdateTicketStatus(unknown counter) error = %v, want ErrCounterNotFound", err)
+	}
+}
+
+func testDuplicateCounterName(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Duplicates")
+	mustCreateCounter(t, h, queue.ID, "Counter 1")
+	c2 := mustCreateCounter(t, h, queue.ID, "Counter 2")
+
+	if _, err := h.CreateCounter(ctx, queue.ID, "Counter 1"); !errors.Is(err, ErrCounterExists) {
+		t.Errorf("CreateCounter(duplicate) error = %v, want ErrCounterExists", err)
+	}
+	if _, err := h.UpdateCounter(ctx, c2.ID, "Counter 1"); !errors.Is(err, ErrCounterExists) {
+		t.Errorf("UpdateCounter(duplicate) error = %v, want ErrCounterExists", err)
+	}
+}
+
+func testCallAtCounter(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Clinic")
+	counter := mustCreateCounter(t, h, queue.ID, "Counter 3")
+	first := mustCreateTicket(t, h, queue.ID, "first", 0)
+	second := mustCreateTicket(t, h, queue.ID, "second", 0)
+
+	called, err := h.UpdateTicketStatus(ctx, first.ID, "serving", &counter.ID, Audit{})
+	if err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+	if called.CounterID == nil || *called.CounterID != counter.ID || called.CounterName == nil || *called.CounterName != "Counter 3" {
+		t.Errorf("called ticket counter = %v/%v, want Counter 3", called.CounterID, called.CounterName)
+	}
+
+	// Serving without naming a counter keeps the one that called the ticket.
+	served := mustUpdateStatus(t, h, first.ID, "served")
+	if served.CounterID == nil || *served.CounterID != counter.ID {
+		t.Errorf("served ticket lost its counter: %v", served.CounterID)
+	}
+
+	next, err := h.CallNextTicket(ctx, queue.ID, &counter.ID, Audit{})
+	if err != nil {
+		t.Fatalf("CallNextTicket: %v", err)
+	}
+	if next.ID != second.ID || next.CounterName == nil || *next.CounterName != "Counter 3" {
+		t.Errorf("CallNextTicket = %+v, want second ticket at Counter 3", next)
+	}
+
+	if _, err := h.UpdateCounter(ctx, counter.ID, "Room 3"); err != nil {
+		t.Fatalf("UpdateCounter: %v", err)
+	}
+	tickets, err := h.GetTicketsByQueueID(ctx, queue.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	for _, ticket := range tickets {
+		if ticket.CounterName == nil || *ticket.CounterName != "Room 3" {
+			t.Errorf("ticket %s counter name = %v, want Room 3", ticket.TicketNumber, ticket.CounterName)
+		}
+	}
+}
+
+func testCallAtCounterOfOtherQueue(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Mine")
+	other := mustCreateQueue(t, h, "Theirs")
+	foreign := mustCreateCounter(t, h, other.ID, "Counter 1")
+	ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+
+	if _, err := h.UpdateTicketStatus(ctx, ticket.ID, "serving", &foreign.ID, Audit{}); !errors.Is(err, ErrCounterNotInQueue) {
+		t.Errorf("UpdateTicketStatus(foreign counter) error = %v, want ErrCounterNotInQueue", err)
+	}
+	if _, err := h.CallNextTicket(ctx, queue.ID, &foreign.ID, Audit{}); !errors.Is(err, ErrCounterNotInQueue) {
+		t.Errorf("CallNextTicket(foreign counter) error = %v, want ErrCounterNotInQueue", err)
+	}
+
+	tickets, err := h.GetTicketsByQueueID(ctx, queue.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	if len(tickets) != 1 || tickets[0].Status != "waiting" {
+		t.Errorf("rejected call changed the ticket: %+v", tickets)
+	}
+}
+
+func testDeleteCounterKeepsTickets(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	queue := mustCreateQueue(t, h, "Closing desk")
+	counter := mustCreateCounter(t, h, queue.ID, "Counter 1")
+	ticket := mustCreateTicket(t, h, queue.ID, "customer", 0)
+	if _, err := h.UpdateTicketStatus(ctx, ticket.ID, "serving", &counter.ID, Audit{}); err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+
+	if err := h.DeleteCounter(ctx, counter.ID); err != nil {
+		t.Fatalf("DeleteCounter: %v", err)
+	}
+	tickets, err := h.GetTicketsByQueueID(ctx, queue.ID)
+	if err != nil {
+		t.Fatalf("GetTicketsByQueueID: %v", err)
+	}
+	if len(tickets) != 1 || tickets[0].CounterID != nil || tickets[0].CounterName != nil {
+		t.Errorf("tickets after DeleteCounter = %+v, want one ticket without a counter", tickets)
+	}
+	mustUpdateStatus(t, h, ticket.ID, "served")
+}
+
+// uniqueUsername returns name with a random suffix, so that user tests can
+// share a database with earlier runs.
+func uniqueUsername(name string) string {
+	return name + "-" + uuid.NewString()[:8]
+}
+
+func testUserCRUD(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	bobName, aliceName := uniqueUsername("bob"), uniqueUsername("alice")
+	bob, err := h.CreateUser(ctx, bobName, "hash-b", "staff")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	alice, err := h.CreateUser(ctx, aliceName, "hash-a", "admin")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	got, err := h.GetUserByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got.Username != aliceName || got.PasswordHash != "hash-a" || got.Role != "admin" {
+		t.Errorf("GetUserByID = %+v, want alice", got)
+	}
+
+	got, err = h.GetUserByUsername(ctx, bobName)
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got.ID != bob.ID || got.PasswordHash != "hash-b" || got.Role != "staff" {
+		t.Errorf("GetUserByUsername = %+v, want bob", got)
+	}
+
+	users, err := h.GetUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	aliceAt, bobAt := -1, -1
+	for i, user := range users {
+		switch user.ID {
+		case alice.ID:
+			aliceAt = i
+		case bob.ID:
+			bobAt = i
+		}
+	}
+	if aliceAt < 0 || bobAt < 0 || aliceAt > bobAt {
+		t.Errorf("GetUsers = %+v, want alice before bob", users)
+	}
+
+	if err := h.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := h.GetUserByUsername(ctx, bobName); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByUsername(deleted) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testUserNotFound(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	if _, err := h.GetUserByID(ctx, uuid.New()); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByID(unknown) error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := h.GetUserByUsername(ctx, uniqueUsername("nobody")); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByUsername(unknown) error = %v, want ErrUserNotFound", err)
+	}
+	if err := h.DeleteUser(ctx, uuid.New()); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("DeleteUser(unknown) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testDuplicateUsername(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	carol := uniqueUsername("carol")
+	if _, err := h.CreateUser(ctx, carol, "hash", "staff"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := h.CreateUser(ctx, carol, "hash", "admin"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("CreateUser(duplicate) error = %v, want ErrUserExists", err)
+	}
+}
+
+// uniqueKeyHash returns a fake key hash that does not collide with other
+// tests sharing a database.
+func uniqueKeyHash() string {
+	return strings.ReplaceAll(uuid.NewString()+uuid.NewString(), "-", "")
+}
+
+func testAPIKeyCRUD(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+
+	kioskHash, signageHash := uniqueKeyHash(), uniqueKeyHash()
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	kiosk, err := h.CreateAPIKey(ctx, "Lobby kiosk", "sq_kiosk", kioskHash, []string{"tickets:create"}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if kiosk.ID == uuid.Nil || kiosk.ExpiresAt != nil || kiosk.LastUsedAt != nil || kiosk.CreatedAt.IsZero() {
+		t.Fatalf("CreateAPIKey returned incomplete key: %+v", kiosk)
+	}
+	time.Sleep(5 * time.Millisecond)
+	signage, err := h.CreateAPIKey(ctx, "Waiting room TV", "sq_signs", signageHash, []string{"queues:read", "tickets:create"}, &expiresAt)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	got, err := h.GetAPIKeyByHash(ctx, signageHash)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if got.ID != signage.ID || got.Name != "Waiting room TV" || got.KeyPrefix != "sq_signs" || got.KeyHash != signageHash {
+		t.Errorf("GetAPIKeyByHash = %+v, want the signage key", got)
+	}
+	if strings.Join(got.Scopes, " ") != "queues:read tickets:create" {
+		t.Errorf("scopes = %v, want [queues:read tickets:create]", got.Scopes)
+	}
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires_at = %v, want %v", got.ExpiresAt, expiresAt)
+	}
+	if got.Expired(time.Now()) || !got.Expired(expiresAt) {
+		t.Errorf("Expired() is wrong for a key expiring at %v", expiresAt)
+	}
+
+	usedAt := time.Now().Truncate(time.Second)
+	if err := h.TouchAPIKey(ctx, kiosk.ID, usedAt); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	got, err = h.GetAPIKeyByHash(ctx, kioskHash)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if got.LastUsedAt == nil || !got.LastUsedAt.Equal(usedAt) {
+		t.Errorf("last_used_at = %v, want %v", got.LastUsedAt, usedAt)
+	}
+
+	keys, err := h.GetAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("GetAPIKeys: %v", err)
+	}
+	kioskAt, signageAt := -1, -1
+	for i, key := range keys {
+		switch key.ID {
+		case kiosk.ID:
+			kioskAt = i
+		case signage.ID:
+			signageAt = i
+		}
+	}
+	if kioskAt < 0 || signageAt < 0 || signageAt > kioskAt {
+		t.Errorf("GetAPIKeys = %+v, want the newer signage key before the kiosk key", keys)
+	}
+
+	if err := h.DeleteAPIKey(ctx, kiosk.ID); err != nil {
+		t.Fatalf("DeleteAPIKey: %v", err)
+	}
+	if _, err := h.GetAPIKeyByHash(ctx, kioskHash); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("GetAPIKeyByHash(deleted) error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func testAPIKeyNotFound(t *testing.T, h *storeHarness) {
+	ctx := context.Background()
+	if _, err := h.GetAPIKeyByHash(ctx, uniqueKeyHash()); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("GetAPIKeyByHash(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := h.TouchAPIKey(ctx, uuid.New(), time.Now()); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("TouchAPIKey(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := h.DeleteAPIKey(ctx, uuid.New()); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("DeleteAPIKey(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func testEstimatedWaitTimeEmpty(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "No history")
+	mustCreateTicket(t, h, queue.ID, "waiting", 0)
+
+	wait, err := h.CalculateEstimatedWaitTime(context.Background(), queue.ID)
+	if err != nil {
+		t.Fatalf("CalculateEstimatedWaitTime: %v", err)
+	}
+	if wait != 0 {
+		t.Errorf("wait = %v, want 0 without served tickets", wait)
+	}
+}
+
+func testEstimatedWaitTime(t *testing.T, h *storeHarness) {
+	queue := mustCreateQueue(t, h, "Wait time")
+	other := mustCreateQueue(t, h, "Other queue")
+	base := time.Now().Add(-time.Hour)
+
+	serve := func(queueID uuid.UUID, waited time.Duration) *Ticket {
+		ticket := mustCreateTicket(t, h, queueID, "customer", 0)
+		mustUpdateStatus(t, h, ticket.ID, "serving")
+		mustUpdateStatus(t, h, ticket.ID, "served")
+		h.setHistoryTime(t, ticket.ID, "waiting", base)
+		h.setHistoryTime(t, ticket.ID, "served", base.Add(waited))
+		return ticket
+	}
+	serve(queue.ID, 60*time.Second)
+	serve(queue.ID, 120*time.Second)
+	serve(other.ID, time.Hour)
+
+	// Cancelled tickets do not contribute to the estimate.
+	cancelled := mustCreateTicket(t, h, queue.ID, "cancelled", 0)
+	mustUpdateStatus(t, h, cancelled.ID, "cancelled")
+
+	wait, err := h.CalculateEstimatedWaitTime(context.Background(), queue.ID)
+	if err != nil {
+		t.Fatalf("CalculateEstimatedWaitTime: %v", err)
+	}
+	if wait != 90*time.Second {
+		t.Errorf("wait = %v, want 1m30s", wait)
+	}
+}
@@ -0,0 +1,52 @@
+package ticket
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultCountryCode is the calling code assumed for phone numbers given
+// without one, e.g. "1" for the United States and Canada.
+const DefaultCountryCode = "1"
+
+// NormalizePhone returns phone in E.164 form, e.g. "+15551234567" for
+// "(555) 123-4567", so that the number a customer typed at check-in matches
+// the one their text messages come from. Spaces, dots, dashes, slashes and
+// parentheses are dropped; a number starting with "+" or "00" keeps its
+// calling code, and any other number gets countryCode after its trunk prefix
+// ("0", or "1" for country code 1) is removed. It returns an error if phone
+// has other characters or too few or too many digits.
+func NormalizePhone(phone, countryCode string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", fmt.Errorf("invalid phone number %q: %s", phone, reason)
+	}
+
+	var digits strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" .-/()", r):
+		default:
+			return invalid("use digits with an optional + and calling code, e.g. +15551234567")
+		}
+	}
+	number := digits.String()
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(phone), "+"):
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case countryCode == "1" && len(number) == 11 && number[0] == '1':
+		// Already has the calling code, which is also the trunk prefix.
+	default:
+		number = countryCode + strings.TrimPrefix(number, "0")
+	}
+
+	// E.164 numbers have at most 15 digits; the shortest in use have 7.
+	if len(number) < 7 || len(number) > 15 || number[0] == '0' {
+		return invalid("it must have a calling code and 7 to 15 digits")
+	}
+	return "+" + number, nil
+}
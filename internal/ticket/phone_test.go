@@ -0,0 +1,29 @@
+package ticket
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	for _, tt := range []struct {
+		phone, countryCode, want string
+	}{
+		{"+15551234567", "1", "+15551234567"},
+		{"(555) 123-4567", "1", "+15551234567"},
+		{"555.123.4567", "1", "+15551234567"},
+		{" 1 555 123 4567 ", "1", "+15551234567"},
+		{"+1 (555) 123-4567", "1", "+15551234567"},
+		{"0044 20 7946 0958", "1", "+442079460958"},
+		{"020 7946 0958", "44", "+442079460958"},
+		{"+44 20 7946 0958", "1", "+442079460958"},
+	} {
+		got, err := NormalizePhone(tt.phone, tt.countryCode)
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q, %s) = %q, %v, want %q", tt.phone, tt.countryCode, got, err, tt.want)
+		}
+	}
+
+	for _, phone := range []string{"", "+", "call me", "555-1234x12", "12+345678", "+1234", "+1234567890123456", "+0123456789"} {
+		if got, err := NormalizePhone(phone, "1"); err == nil {
+			t.Errorf("NormalizePhone(%q) = %q, want an error", phone, got)
+		}
+	}
+}
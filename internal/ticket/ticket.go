@@ -1,2 +1,99 @@
 // Package ticket contains the logic for creating and managing tickets.
 package ticket
+
+import "fmt"
+
+// Ticket statuses. A ticket starts out waiting, is called to serving and ends
+// up either served or cancelled.
+const (
+	StatusWaiting   = "waiting"
+	StatusServing   = "serving"
+	StatusServed    = "served"
+	StatusCancelled = "cancelled"
+)
+
+// StatusDeferred is only recorded in a ticket's history, when the customer
+// defers a waiting ticket. The ticket itself stays waiting.
+const StatusDeferred = "deferred"
+
+// StatusChecked is only recorded in a ticket's history, when the customer asks
+// for their place in line by text message. The ticket itself is unchanged.
+const StatusChecked = "status_checked"
+
+// StartsPhase reports whether a history row with status starts a new phase of
+// the ticket's life, as status changes and deferrals do, rather than
+// recording an action that leaves the ticket as it was, like a status check.
+func StartsPhase(status string) bool {
+	return status != StatusChecked
+}
+
+// IsActive reports whether a ticket in status is still in line or being
+// served, as opposed to finished.
+func IsActive(status string) bool {
+	return status == StatusWaiting || status == StatusServing
+}
+
+// transitions lists, for every status, the statuses a ticket may move to next.
+// Served and cancelled are terminal.
+var transitions = map[string][]string{
+	StatusWaiting:   {StatusServing, StatusCancelled},
+	StatusServing:   {StatusServed, StatusCancelled},
+	StatusServed:    {},
+	StatusCancelled: {},
+}
+
+// IsValidStatus reports whether status is one of the known ticket statuses.
+func IsValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// IsTerminal reports whether no further transitions are allowed from status.
+func IsTerminal(status string) bool {
+	next, ok := transitions[status]
+	return ok && len(next) == 0
+}
+
+// TransitionError explains why a ticket cannot move from one status to another.
+type TransitionError struct {
+	From   string
+	To     string
+	Reason string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move ticket from %s to %s: %s", e.From, e.To, e.Reason)
+}
+
+// ValidateTransition returns nil if a ticket in status from may move to status
+// to, and a *TransitionError describing the rejection otherwise.
+func ValidateTransition(from, to string) error {
+	reject := func(reason string) error {
+		return &TransitionError{From: from, To: to, Reason: reason}
+	}
+
+	if !IsValidStatus(to) {
+		return reject(fmt.Sprintf("unknown status %q", to))
+	}
+	if !IsValidStatus(from) {
+		return reject(fmt.Sprintf("unknown current status %q", from))
+	}
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+
+	switch {
+	case from == to:
+		return reject(fmt.Sprintf("ticket is already %s", to))
+	case from == StatusServed:
+		return reject("ticket has already been served")
+	case from == StatusCancelled:
+		return reject("ticket has been cancelled")
+	case from == StatusWaiting && to == StatusServed:
+		return reject("ticket must be called before it can be served")
+	default:
+		return reject("transition is not allowed")
+	}
+}
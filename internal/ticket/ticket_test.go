@@ -0,0 +1,85 @@
+package ticket
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	allowed := [][2]string{
+		{StatusWaiting, StatusServing},
+		{StatusWaiting, StatusCancelled},
+		{StatusServing, StatusServed},
+		{StatusServing, StatusCancelled},
+	}
+	for _, tr := range allowed {
+		if err := ValidateTransition(tr[0], tr[1]); err != nil {
+			t.Errorf("ValidateTransition(%s, %s) = %v, want nil", tr[0], tr[1], err)
+		}
+	}
+
+	rejected := []struct {
+		from, to, reason string
+	}{
+		{StatusWaiting, StatusServed, "ticket must be called before it can be served"},
+		{StatusWaiting, StatusWaiting, "ticket is already waiting"},
+		{StatusServed, StatusServing, "ticket has already been served"},
+		{StatusCancelled, StatusServing, "ticket has been cancelled"},
+		{StatusServing, StatusWaiting, "transition is not allowed"},
+		{StatusWaiting, "done", `unknown status "done"`},
+	}
+	for _, tt := range rejected {
+		err := ValidateTransition(tt.from, tt.to)
+		var transitionErr *TransitionError
+		if !errors.As(err, &transitionErr) {
+			t.Errorf("ValidateTransition(%s, %s) = %v, want a *TransitionError", tt.from, tt.to, err)
+			continue
+		}
+		if transitionErr.Reason != tt.reason {
+			t.Errorf("ValidateTransition(%s, %s) reason = %q, want %q", tt.from, tt.to, transitionErr.Reason, tt.reason)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	for status, want := range map[string]bool{
+		StatusWaiting:   false,
+		StatusServing:   false,
+		StatusServed:    true,
+		StatusCancelled: true,
+		"unknown":       false,
+	} {
+		if got := IsTerminal(status); got != want {
+			t.Errorf("IsTerminal(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	for status, want := range map[string]bool{
+		StatusWaiting:   true,
+		StatusServing:   true,
+		StatusServed:    false,
+		StatusCancelled: false,
+		StatusDeferred:  false,
+	} {
+		if got := IsActive(status); got != want {
+			t.Errorf("IsActive(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestStartsPhase(t *testing.T) {
+	for status, want := range map[string]bool{
+		StatusWaiting:   true,
+		StatusServing:   true,
+		StatusServed:    true,
+		StatusCancelled: true,
+		StatusDeferred:  true,
+		StatusChecked:   false,
+	} {
+		if got := StartsPhase(status); got != want {
+			t.Errorf("StartsPhase(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tickets_queue_id_ticket_number_day;
+CREATE UNIQUE INDEX idx_tickets_queue_id_ticket_number ON tickets(queue_id, ticket_number);
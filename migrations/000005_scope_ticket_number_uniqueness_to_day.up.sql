@@ -0,0 +1,3 @@
+-- Ticket numbers restart every (UTC) day, so they are only unique within a day.
+DROP INDEX IF EXISTS idx_tickets_queue_id_ticket_number;
+CREATE UNIQUE INDEX idx_tickets_queue_id_ticket_number_day ON tickets(queue_id, ticket_number, ((created_at AT TIME ZONE 'UTC')::date));
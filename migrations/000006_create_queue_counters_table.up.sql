@@ -0,0 +1,22 @@
+-- One row per queue holding the last issued ticket number and position.
+-- CreateTicket increments it with an upsert, which row-locks the counter until
+-- the ticket is committed and so serializes concurrent check-ins per queue.
+CREATE TABLE queue_counters (
+    queue_id UUID PRIMARY KEY REFERENCES queues(id) ON DELETE CASCADE,
+    last_number INTEGER NOT NULL DEFAULT 0,
+    last_position INTEGER NOT NULL DEFAULT 0,
+    number_date DATE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')::date
+);
+
+INSERT INTO queue_counters (queue_id, last_number, last_position, number_date)
+SELECT
+    q.id,
+    COALESCE((
+        SELECT MAX(CAST(SUBSTRING(t.ticket_number FROM 3) AS INTEGER))
+        FROM tickets t
+        WHERE t.queue_id = q.id
+          AND (t.created_at AT TIME ZONE 'UTC')::date = (NOW() AT TIME ZONE 'UTC')::date
+    ), 0),
+    COALESCE((SELECT MAX(t.position) FROM tickets t WHERE t.queue_id = q.id), 0),
+    (NOW() AT TIME ZONE 'UTC')::date
+FROM queues q;
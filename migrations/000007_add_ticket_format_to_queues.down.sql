@@ -0,0 +1,10 @@
+ALTER TABLE queue_counters ADD COLUMN number_date DATE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')::date;
+ALTER TABLE queue_counters DROP COLUMN number_period;
+
+ALTER TABLE tickets ALTER COLUMN ticket_number TYPE VARCHAR(10);
+
+ALTER TABLE queues
+    DROP COLUMN ticket_prefix,
+    DROP COLUMN ticket_number_width,
+    DROP COLUMN ticket_start_number,
+    DROP COLUMN ticket_reset_policy;
@@ -0,0 +1,14 @@
+ALTER TABLE queues
+    ADD COLUMN ticket_prefix VARCHAR(5) NOT NULL DEFAULT 'A',
+    ADD COLUMN ticket_number_width INTEGER NOT NULL DEFAULT 3,
+    ADD COLUMN ticket_start_number INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN ticket_reset_policy VARCHAR(10) NOT NULL DEFAULT 'daily';
+
+-- Numbers past the padding width ("A-1000") and longer prefixes need more room.
+ALTER TABLE tickets ALTER COLUMN ticket_number TYPE VARCHAR(32);
+
+-- The counter now tracks an opaque numbering period computed from the queue's
+-- reset policy (a date, an ISO week or nothing) instead of a date.
+ALTER TABLE queue_counters ADD COLUMN number_period VARCHAR(16) NOT NULL DEFAULT '';
+UPDATE queue_counters SET number_period = to_char(number_date, 'YYYY-MM-DD');
+ALTER TABLE queue_counters DROP COLUMN number_date;
@@ -0,0 +1,3 @@
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS counter_id;
+ALTER TABLE tickets DROP COLUMN IF EXISTS counter_id;
+DROP TABLE IF EXISTS counters;
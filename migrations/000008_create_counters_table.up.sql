@@ -0,0 +1,12 @@
+CREATE TABLE counters (
+    id UUID PRIMARY KEY,
+    queue_id UUID NOT NULL REFERENCES queues(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (queue_id, name)
+);
+
+-- The counter that called a ticket, and the counter that handled each status change.
+ALTER TABLE tickets ADD COLUMN counter_id UUID REFERENCES counters(id) ON DELETE SET NULL;
+ALTER TABLE ticket_history ADD COLUMN counter_id UUID REFERENCES counters(id) ON DELETE SET NULL;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_ticket_history_timestamp;
+DROP INDEX IF EXISTS idx_ticket_history_actor;
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS reason;
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS source_ip;
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS actor_name;
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS actor_id;
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS actor_type;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tickets_access_token_hash;
+ALTER TABLE tickets DROP COLUMN IF EXISTS access_token_hash;
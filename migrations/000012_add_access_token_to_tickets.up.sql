@@ -0,0 +1,5 @@
+-- Hash of the secret that gives a customer access to their ticket's status
+-- page. Tickets created before this migration have none.
+ALTER TABLE tickets ADD COLUMN access_token_hash CHAR(64);
+
+CREATE UNIQUE INDEX idx_tickets_access_token_hash ON tickets(access_token_hash);
@@ -0,0 +1,12 @@
+-- Text messages sent to a ticket's customer. The unique key makes sure each
+-- customer gets each message once, e.g. "you're next" or "3 people ahead".
+CREATE TABLE ticket_notifications (
+    id UUID PRIMARY KEY,
+    ticket_id UUID NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    kind VARCHAR(32) NOT NULL,
+    threshold INTEGER NOT NULL DEFAULT 0,
+    recipient VARCHAR(50) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (ticket_id, kind, threshold)
+);
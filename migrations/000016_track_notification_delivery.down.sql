@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_notifications_created_at;
+DROP INDEX IF EXISTS idx_notifications_due;
+ALTER TABLE notifications
+    DROP COLUMN updated_at,
+    DROP COLUMN sent_at,
+    DROP COLUMN next_attempt_at,
+    DROP COLUMN last_error,
+    DROP COLUMN attempts,
+    DROP COLUMN status,
+    DROP COLUMN channel;
+ALTER TABLE notifications RENAME COLUMN payload TO body;
+ALTER TABLE notifications RENAME COLUMN template TO kind;
+ALTER TABLE notifications RENAME TO ticket_notifications;
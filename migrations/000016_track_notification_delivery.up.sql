@@ -0,0 +1,22 @@
+-- Notifications become a delivery log and the queue of messages still to be
+-- sent: a background worker sends pending ones, retrying failed attempts with
+-- backoff, so messages survive gateway outages and server restarts. Messages
+-- recorded before this were handed to the gateway and count as sent.
+ALTER TABLE ticket_notifications RENAME TO notifications;
+ALTER TABLE notifications RENAME COLUMN kind TO template;
+ALTER TABLE notifications RENAME COLUMN body TO payload;
+ALTER TABLE notifications
+    ADD COLUMN channel VARCHAR(16) NOT NULL DEFAULT 'sms',
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'sent',
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN last_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ADD COLUMN sent_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+UPDATE notifications SET sent_at = created_at, next_attempt_at = created_at, updated_at = created_at;
+ALTER TABLE notifications
+    ALTER COLUMN status SET DEFAULT 'pending',
+    ALTER COLUMN attempts SET DEFAULT 0;
+
+CREATE INDEX idx_notifications_due ON notifications (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_notifications_created_at ON notifications (created_at);
@@ -0,0 +1,4 @@
+-- The language the customer chose at check-in, e.g. 'es' or 'pt-BR'. Their
+-- messages use the templates of that locale when there are any. Empty means
+-- the default language.
+ALTER TABLE tickets ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT '';
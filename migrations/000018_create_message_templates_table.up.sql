@@ -0,0 +1,16 @@
+-- Customized texts of the messages to customers, replacing the built-in ones.
+-- A template without a queue applies to every queue; one with a queue applies
+-- to that queue only and takes precedence.
+CREATE TABLE message_templates (
+    id UUID PRIMARY KEY,
+    queue_id UUID REFERENCES queues(id) ON DELETE CASCADE,
+    name VARCHAR(32) NOT NULL,
+    locale VARCHAR(16) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- One template per scope, name and locale; the global scope has no queue.
+CREATE UNIQUE INDEX idx_message_templates_scope
+    ON message_templates (COALESCE(queue_id, '00000000-0000-0000-0000-000000000000'), name, locale);
@@ -0,0 +1,22 @@
+-- Domain events, written in the same transaction as the ticket change they
+-- describe and dispatched in seq order to WebSocket clients, webhooks and
+-- customers afterwards. Payload is the ticket after the change, as JSON.
+CREATE TABLE outbox_events (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    event_type VARCHAR(64) NOT NULL,
+    ticket_id UUID NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    queue_id UUID NOT NULL,
+    actor_type VARCHAR(20) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (seq) WHERE dispatched_at IS NULL;
+CREATE INDEX idx_outbox_events_dispatched_at ON outbox_events (dispatched_at);
+
+-- An event dispatched again must not be delivered to a webhook twice.
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
@@ -0,0 +1,14 @@
+CREATE TABLE tickets (
+    id TEXT PRIMARY KEY,
+    queue_id TEXT NOT NULL REFERENCES queues(id) ON DELETE CASCADE,
+    customer_name TEXT NOT NULL,
+    customer_phone TEXT NOT NULL,
+    ticket_number TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'waiting',
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_tickets_queue_id ON tickets(queue_id);
+CREATE UNIQUE INDEX idx_tickets_queue_id_ticket_number ON tickets(queue_id, ticket_number);
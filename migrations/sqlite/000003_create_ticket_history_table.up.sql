@@ -0,0 +1,10 @@
+CREATE TABLE ticket_history (
+    id TEXT PRIMARY KEY,
+    ticket_id TEXT NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ticket_history_ticket_id ON ticket_history(ticket_id);
+CREATE INDEX idx_ticket_history_status_timestamp ON ticket_history(status, timestamp);
@@ -0,0 +1 @@
+ALTER TABLE tickets ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
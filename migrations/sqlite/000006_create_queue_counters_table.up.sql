@@ -0,0 +1,21 @@
+-- One row per queue holding the last issued ticket number and position.
+-- CreateTicket increments it with an upsert inside the same transaction as the
+-- ticket insert, so concurrent check-ins never see the same counter value.
+CREATE TABLE queue_counters (
+    queue_id TEXT PRIMARY KEY REFERENCES queues(id) ON DELETE CASCADE,
+    last_number INTEGER NOT NULL DEFAULT 0,
+    last_position INTEGER NOT NULL DEFAULT 0,
+    number_date TEXT NOT NULL DEFAULT (date('now'))
+);
+
+INSERT INTO queue_counters (queue_id, last_number, last_position, number_date)
+SELECT
+    q.id,
+    COALESCE((
+        SELECT MAX(CAST(substr(t.ticket_number, 3) AS INTEGER))
+        FROM tickets t
+        WHERE t.queue_id = q.id AND date(t.created_at) = date('now')
+    ), 0),
+    COALESCE((SELECT MAX(t.position) FROM tickets t WHERE t.queue_id = q.id), 0),
+    date('now')
+FROM queues q;
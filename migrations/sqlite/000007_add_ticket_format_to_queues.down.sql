@@ -0,0 +1,7 @@
+ALTER TABLE queue_counters ADD COLUMN number_date TEXT NOT NULL DEFAULT (date('now'));
+ALTER TABLE queue_counters DROP COLUMN number_period;
+
+ALTER TABLE queues DROP COLUMN ticket_prefix;
+ALTER TABLE queues DROP COLUMN ticket_number_width;
+ALTER TABLE queues DROP COLUMN ticket_start_number;
+ALTER TABLE queues DROP COLUMN ticket_reset_policy;
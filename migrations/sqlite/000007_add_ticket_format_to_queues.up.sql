@@ -0,0 +1,10 @@
+ALTER TABLE queues ADD COLUMN ticket_prefix TEXT NOT NULL DEFAULT 'A';
+ALTER TABLE queues ADD COLUMN ticket_number_width INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE queues ADD COLUMN ticket_start_number INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE queues ADD COLUMN ticket_reset_policy TEXT NOT NULL DEFAULT 'daily';
+
+-- The counter now tracks an opaque numbering period computed from the queue's
+-- reset policy (a date, an ISO week or nothing) instead of a date.
+ALTER TABLE queue_counters ADD COLUMN number_period TEXT NOT NULL DEFAULT '';
+UPDATE queue_counters SET number_period = number_date;
+ALTER TABLE queue_counters DROP COLUMN number_date;
@@ -0,0 +1,3 @@
+ALTER TABLE ticket_history DROP COLUMN counter_id;
+ALTER TABLE tickets DROP COLUMN counter_id;
+DROP TABLE IF EXISTS counters;
@@ -0,0 +1,14 @@
+CREATE TABLE counters (
+    id TEXT PRIMARY KEY,
+    queue_id TEXT NOT NULL REFERENCES queues(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (queue_id, name)
+);
+
+-- The counter that called a ticket, and the counter that handled each status change.
+-- SQLite cannot drop a column that is part of a foreign key, so these are plain
+-- columns; SQLiteDB.DeleteCounter clears them itself.
+ALTER TABLE tickets ADD COLUMN counter_id TEXT;
+ALTER TABLE ticket_history ADD COLUMN counter_id TEXT;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_ticket_history_timestamp;
+DROP INDEX IF EXISTS idx_ticket_history_actor;
+ALTER TABLE ticket_history DROP COLUMN reason;
+ALTER TABLE ticket_history DROP COLUMN user_agent;
+ALTER TABLE ticket_history DROP COLUMN source_ip;
+ALTER TABLE ticket_history DROP COLUMN actor_name;
+ALTER TABLE ticket_history DROP COLUMN actor_id;
+ALTER TABLE ticket_history DROP COLUMN actor_type;
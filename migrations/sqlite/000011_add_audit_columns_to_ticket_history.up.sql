@@ -0,0 +1,11 @@
+-- Who performed each ticket action, from where, and why. Rows written before
+-- this migration are attributed to the system.
+ALTER TABLE ticket_history ADD COLUMN actor_type TEXT NOT NULL DEFAULT 'system';
+ALTER TABLE ticket_history ADD COLUMN actor_id TEXT;
+ALTER TABLE ticket_history ADD COLUMN actor_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE ticket_history ADD COLUMN source_ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE ticket_history ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE ticket_history ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_ticket_history_actor ON ticket_history(actor_type, actor_id, timestamp);
+CREATE INDEX idx_ticket_history_timestamp ON ticket_history(timestamp);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tickets_access_token_hash;
+ALTER TABLE tickets DROP COLUMN access_token_hash;
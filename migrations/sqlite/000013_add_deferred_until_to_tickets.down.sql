@@ -0,0 +1 @@
+ALTER TABLE tickets DROP COLUMN deferred_until;
@@ -0,0 +1,3 @@
+-- A waiting ticket the customer deferred until a chosen time is not called
+-- before then. It keeps its place in line.
+ALTER TABLE tickets ADD COLUMN deferred_until TIMESTAMP;
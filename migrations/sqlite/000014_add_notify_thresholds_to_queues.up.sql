@@ -0,0 +1,3 @@
+-- Numbers of people ahead at which a waiting customer gets a text, e.g. '3 0'
+-- for "3 people ahead" and "you're next". Space-separated; empty sends none.
+ALTER TABLE queues ADD COLUMN notify_thresholds TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- Text messages sent to a ticket's customer. The unique key makes sure each
+-- customer gets each message once, e.g. "you're next" or "3 people ahead".
+CREATE TABLE ticket_notifications (
+    id TEXT PRIMARY KEY,
+    ticket_id TEXT NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    threshold INTEGER NOT NULL DEFAULT 0,
+    recipient TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ticket_id, kind, threshold)
+);
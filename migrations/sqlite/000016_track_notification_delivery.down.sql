@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_notifications_created_at;
+DROP INDEX IF EXISTS idx_notifications_due;
+ALTER TABLE notifications DROP COLUMN updated_at;
+ALTER TABLE notifications DROP COLUMN sent_at;
+ALTER TABLE notifications DROP COLUMN next_attempt_at;
+ALTER TABLE notifications DROP COLUMN last_error;
+ALTER TABLE notifications DROP COLUMN attempts;
+ALTER TABLE notifications DROP COLUMN status;
+ALTER TABLE notifications DROP COLUMN channel;
+ALTER TABLE notifications RENAME COLUMN payload TO body;
+ALTER TABLE notifications RENAME COLUMN template TO kind;
+ALTER TABLE notifications RENAME TO ticket_notifications;
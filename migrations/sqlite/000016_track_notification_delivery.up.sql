@@ -0,0 +1,18 @@
+-- Notifications become a delivery log and the queue of messages still to be
+-- sent: a background worker sends pending ones, retrying failed attempts with
+-- backoff, so messages survive gateway outages and server restarts. Messages
+-- recorded before this were handed to the gateway and count as sent.
+ALTER TABLE ticket_notifications RENAME TO notifications;
+ALTER TABLE notifications RENAME COLUMN kind TO template;
+ALTER TABLE notifications RENAME COLUMN body TO payload;
+ALTER TABLE notifications ADD COLUMN channel TEXT NOT NULL DEFAULT 'sms';
+ALTER TABLE notifications ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE notifications ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE notifications ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE notifications ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE notifications ADD COLUMN sent_at TIMESTAMP;
+ALTER TABLE notifications ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+UPDATE notifications SET status = 'sent', attempts = 1, sent_at = created_at, next_attempt_at = created_at, updated_at = created_at;
+
+CREATE INDEX idx_notifications_due ON notifications (status, next_attempt_at);
+CREATE INDEX idx_notifications_created_at ON notifications (created_at);
@@ -0,0 +1,16 @@
+-- Customized texts of the messages to customers, replacing the built-in ones.
+-- A template without a queue applies to every queue; one with a queue applies
+-- to that queue only and takes precedence.
+CREATE TABLE message_templates (
+    id TEXT PRIMARY KEY,
+    queue_id TEXT REFERENCES queues(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One template per scope, name and locale; the global scope has no queue.
+CREATE UNIQUE INDEX idx_message_templates_scope
+    ON message_templates (COALESCE(queue_id, ''), name, locale);
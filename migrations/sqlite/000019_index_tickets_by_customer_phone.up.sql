@@ -0,0 +1,4 @@
+-- Text messages from customers are matched to their ticket by phone number.
+-- Only tickets still in line or being served can be acted on.
+CREATE INDEX idx_tickets_active_phone ON tickets(customer_phone, created_at)
+    WHERE status IN ('waiting', 'serving');
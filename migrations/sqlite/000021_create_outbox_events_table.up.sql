@@ -0,0 +1,21 @@
+-- Domain events, written in the same transaction as the ticket change they
+-- describe and dispatched in seq order to WebSocket clients, webhooks and
+-- customers afterwards. Payload is the ticket after the change, as JSON.
+CREATE TABLE outbox_events (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    ticket_id TEXT NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    queue_id TEXT NOT NULL,
+    actor_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (dispatched_at, seq);
+
+-- An event dispatched again must not be delivered to a webhook twice.
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
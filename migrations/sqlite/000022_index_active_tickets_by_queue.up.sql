@@ -0,0 +1,4 @@
+-- Places in line are computed from the waiting and serving tickets of a queue
+-- only, however many finished tickets it has.
+CREATE INDEX idx_tickets_active_queue ON tickets(queue_id)
+    WHERE status IN ('waiting', 'serving');
@@ -1,11 +1,24 @@
 const API_BASE_URL = 'http://localhost:8080/api/v1';
 const WS_BASE_URL = 'ws://localhost:8080/ws'; // WebSocket URL
-let currentQueueId = ''; // This should be set dynamically, e.g., from URL or config
+const TOKEN_STORAGE_KEY = 'smartqDisplayToken';
+let currentQueueId = ''; // Set from the ?queue= parameter
+
+// The display signs in with a token of a display account, passed once as
+// ?token=... and remembered afterwards.
+let authToken = new URLSearchParams(window.location.search).get('token') || localStorage.getItem(TOKEN_STORAGE_KEY);
+if (authToken) {
+    localStorage.setItem(TOKEN_STORAGE_KEY, authToken);
+}
 
 document.addEventListener('DOMContentLoaded', () => {
-    // For now, we'll hardcode a queue ID for testing.
-    // In a real app, this would come from a configuration or URL parameter.
-    currentQueueId = 'f400a87d-45c7-459c-b76a-aa7b7a68c822'; // Replace with a valid queue ID from your DB
+    if (!authToken) {
+        showUnauthorized();
+        return;
+    }
+
+    // The queue to show, e.g. /display/?queue=<queue ID>. Without it we
+    // fall back to a test queue.
+    currentQueueId = new URLSearchParams(window.location.search).get('queue') || 'f400a87d-45c7-459c-b76a-aa7b7a68c822';
 
     if (currentQueueId) {
         fetchQueueTickets(currentQueueId);
@@ -16,9 +29,24 @@ document.addEventListener('DOMContentLoaded', () => {
     }
 });
 
+function showUnauthorized() {
+    document.getElementById('serving-ticket').textContent = '---';
+    document.getElementById('waiting-tickets').innerHTML = '<li>Display not signed in. Open this page with ?token=&lt;display token&gt;.</li>';
+}
+
 async function fetchQueueTickets(queueId) {
     try {
-        const response = await fetch(`${API_BASE_URL}/queues/${queueId}/tickets`);
+        const response = await fetch(`${API_BASE_URL}/queues/${queueId}/tickets`, {
+            headers: {
+                'Authorization': `Bearer ${authToken}`,
+            },
+        });
+        if (response.status === 401 || response.status === 403) {
+            authToken = null;
+            localStorage.removeItem(TOKEN_STORAGE_KEY);
+            showUnauthorized();
+            return;
+        }
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
@@ -32,7 +60,9 @@ async function fetchQueueTickets(queueId) {
 }
 
 function setupWebSocket() {
-    const socket = new WebSocket(WS_BASE_URL);
+    // Browsers cannot set headers on WebSocket requests, so the token goes in
+    // the URL. The server only sends the updates of the queues we follow.
+    const socket = new WebSocket(`${WS_BASE_URL}?access_token=${encodeURIComponent(authToken)}&queue_id=${encodeURIComponent(currentQueueId)}`);
 
     socket.onopen = (event) => {
         console.log('WebSocket connected:', event);
@@ -42,23 +72,24 @@ function setupWebSocket() {
         const message = JSON.parse(event.data);
         console.log('WebSocket message received:', message);
 
-        if (message.type === 'ticket_update') {
+        if (message.type === 'ticket_update' && message.data.queue_id === currentQueueId) {
             // Re-fetch all tickets for the current queue to ensure consistency
             // A more optimized approach would be to update individual tickets in the DOM
             // but for simplicity, re-fetching is sufficient for now.
             fetchQueueTickets(currentQueueId);
         } else if (message.type === 'queue_update') {
-            // If a queue update is received, and it's relevant to our current queue,
-            // we might want to re-fetch queue details or tickets.
-            // For now, we'll just log it.
             console.log('Queue update received:', message.data);
+        } else if (message.type === 'error') {
+            console.error('WebSocket subscription refused:', message.data.message);
         }
     };
 
     socket.onclose = (event) => {
         console.log('WebSocket disconnected:', event);
-        // Attempt to reconnect after a delay
-        setTimeout(setupWebSocket, 3000);
+        // Attempt to reconnect after a delay, unless the token was rejected
+        if (authToken) {
+            setTimeout(setupWebSocket, 3000);
+        }
     };
 
     socket.onerror = (error) => {
@@ -71,19 +102,22 @@ function renderTickets(tickets) {
     const waitingTicketsList = document.getElementById('waiting-tickets');
     waitingTicketsList.innerHTML = ''; // Clear existing tickets
 
-    let servingTicket = null;
+    const serving = [];
     const waiting = [];
 
     tickets.forEach(ticket => {
         if (ticket.status === 'serving') {
-            servingTicket = ticket;
+            serving.push(ticket);
         } else if (ticket.status === 'waiting') {
             waiting.push(ticket);
         }
     });
 
-    if (servingTicket) {
-        servingTicketSpan.textContent = servingTicket.ticket_number;
+    if (serving.length > 0) {
+        // e.g. "A-014 → Counter 3, A-015 → Counter 1"
+        servingTicketSpan.textContent = serving
+            .map(ticket => ticket.counter_name ? `${ticket.ticket_number} → ${ticket.counter_name}` : ticket.ticket_number)
+            .join(', ');
     } else {
         servingTicketSpan.textContent = '---';
     }
@@ -1,31 +1,106 @@
 const API_BASE_URL = 'http://localhost:8080/api/v1';
 const WS_BASE_URL = 'ws://localhost:8080/ws'; // WebSocket URL
-let currentQueueId = ''; // This should be set dynamically, e.g., from URL or config
+const TOKEN_STORAGE_KEY = 'smartqToken';
+let currentQueueId = ''; // Set from the ?queue= parameter
+let authToken = localStorage.getItem(TOKEN_STORAGE_KEY);
+let socket = null;
 
 document.addEventListener('DOMContentLoaded', () => {
-    // For now, we'll hardcode a queue ID for testing.
-    // In a real app, this would come from a login or selection process.
-    currentQueueId = 'f400a87d-45c7-459c-b76a-aa7b7a68c822'; // Replace with a valid queue ID from your DB
+    document.getElementById('login-form').addEventListener('submit', login);
+    if (authToken) {
+        startDashboard();
+    } else {
+        showLogin();
+    }
+});
+
+function showLogin(message = '') {
+    authToken = null;
+    localStorage.removeItem(TOKEN_STORAGE_KEY);
+    if (socket) {
+        socket.close();
+    }
+    document.getElementById('dashboard').hidden = true;
+    document.getElementById('login-form').hidden = false;
+    document.getElementById('login-error').textContent = message;
+}
+
+async function login(event) {
+    event.preventDefault();
+    try {
+        const response = await fetch(`${API_BASE_URL}/auth/login`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                username: document.getElementById('login-username').value,
+                password: document.getElementById('login-password').value,
+            }),
+        });
+        if (!response.ok) {
+            document.getElementById('login-error').textContent = 'Invalid username or password.';
+            return;
+        }
+        const result = await response.json();
+        authToken = result.token;
+        localStorage.setItem(TOKEN_STORAGE_KEY, authToken);
+        document.getElementById('login-password').value = '';
+        startDashboard();
+    } catch (error) {
+        console.error('Error logging in:', error);
+        document.getElementById('login-error').textContent = 'Failed to log in.';
+    }
+}
+
+function logout() {
+    showLogin();
+}
+
+// apiFetch calls the API with the staff login token and returns to the login
+// form when the token is rejected.
+async function apiFetch(path, options = {}) {
+    const response = await fetch(`${API_BASE_URL}${path}`, {
+        ...options,
+        headers: {
+            ...(options.headers || {}),
+            'Authorization': `Bearer ${authToken}`,
+        },
+    });
+    if (response.status === 401) {
+        showLogin('Your session has expired. Please log in again.');
+    }
+    return response;
+}
+
+function startDashboard() {
+    document.getElementById('login-form').hidden = true;
+    document.getElementById('dashboard').hidden = false;
+
+    // The queue to work on, e.g. /staff/?queue=<queue ID>. Without it we
+    // fall back to a test queue.
+    currentQueueId = new URLSearchParams(window.location.search).get('queue') || 'f400a87d-45c7-459c-b76a-aa7b7a68c822';
 
     if (currentQueueId) {
         fetchQueueDetails(currentQueueId);
         fetchQueueTickets(currentQueueId);
+        fetchNotifications(currentQueueId);
         setupWebSocket(); // Setup WebSocket instead of polling
     } else {
         document.getElementById('queue-info').textContent = 'Please select a queue.';
     }
-});
+}
 
 async function fetchQueueDetails(queueId) {
     try {
-        const response = await fetch(`${API_BASE_URL}/queues/${queueId}`);
+        const response = await apiFetch(`/queues/${queueId}`);
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
         const queue = await response.json();
         document.getElementById('queue-info').innerHTML = `
-            <p><strong>Queue Name:</strong> ${queue.name}</p>
-            <p><strong>Queue ID:</strong> ${queue.id}</p>
+            <p><strong>Queue Name:</strong> ${escapeHTML(queue.name)}</p>
+            <p><strong>Queue ID:</strong> ${escapeHTML(queue.id)}</p>
         `;
     } catch (error) {
         console.error('Error fetching queue details:', error);
@@ -35,7 +110,7 @@ async function fetchQueueDetails(queueId) {
 
 async function fetchQueueTickets(queueId) {
     try {
-        const response = await fetch(`${API_BASE_URL}/queues/${queueId}/tickets`);
+        const response = await apiFetch(`/queues/${queueId}/tickets`);
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
@@ -47,8 +122,26 @@ async function fetchQueueTickets(queueId) {
     }
 }
 
+// fetchNotifications loads the latest text messages to the queue's customers
+// and their delivery status.
+async function fetchNotifications(queueId) {
+    try {
+        const response = await apiFetch(`/notifications?queue_id=${queueId}&limit=20`);
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        const notifications = await response.json();
+        renderNotifications(notifications);
+    } catch (error) {
+        console.error('Error fetching notifications:', error);
+        document.getElementById('notifications').innerHTML = '<li>Failed to load text messages.</li>';
+    }
+}
+
 function setupWebSocket() {
-    const socket = new WebSocket(WS_BASE_URL);
+    // Browsers cannot set headers on WebSocket requests, so the token goes in
+    // the URL. The server only sends the updates of the queues we follow.
+    socket = new WebSocket(`${WS_BASE_URL}?access_token=${encodeURIComponent(authToken)}&queue_id=${encodeURIComponent(currentQueueId)}`);
 
     socket.onopen = (event) => {
         console.log('WebSocket connected:', event);
@@ -58,24 +151,30 @@ function setupWebSocket() {
         const message = JSON.parse(event.data);
         console.log('WebSocket message received:', message);
 
-        if (message.type === 'ticket_update') {
+        if (message.type === 'ticket_update' && message.data.queue_id === currentQueueId) {
             // Re-fetch all tickets for the current queue to ensure consistency
             // A more optimized approach would be to update individual tickets in the DOM
             // but for simplicity, re-fetching is sufficient for now.
             fetchQueueTickets(currentQueueId);
-        } else if (message.type === 'queue_update') {
-            // If a queue update is received, and it's relevant to our current queue,
-            // we might want to re-fetch queue details or tickets.
-            // For now, we'll just log it.
+        } else if (message.type === 'queue_update' && message.data.id === currentQueueId) {
             console.log('Queue update received:', message.data);
             fetchQueueDetails(currentQueueId); // Re-fetch queue details on update
+        } else if (message.type === 'notification_update') {
+            // A text message was queued, sent or failed
+            if (message.data.queue_id === currentQueueId) {
+                fetchNotifications(currentQueueId);
+            }
+        } else if (message.type === 'error') {
+            console.error('WebSocket subscription refused:', message.data.message);
         }
     };
 
     socket.onclose = (event) => {
         console.log('WebSocket disconnected:', event);
-        // Attempt to reconnect after a delay
-        setTimeout(setupWebSocket, 3000);
+        // Attempt to reconnect after a delay, unless we logged out
+        if (authToken) {
+            setTimeout(setupWebSocket, 3000);
+        }
     };
 
     socket.onerror = (error) => {
@@ -97,9 +196,9 @@ function renderTickets(tickets) {
         listItem.className = ticket.status; // Add status as class for styling
         listItem.innerHTML = `
             <div>
-                <strong>${ticket.ticket_number}</strong> - ${ticket.customer_name} (${ticket.customer_phone})
+                <strong>${escapeHTML(ticket.ticket_number)}</strong> - ${escapeHTML(ticket.customer_name)} (${escapeHTML(ticket.customer_phone)})
                 <br>
-                Status: ${ticket.status}
+                Status: ${escapeHTML(ticket.status)}${ticket.counter_name ? ` at ${escapeHTML(ticket.counter_name)}` : ''}${ticket.people_ahead !== undefined ? ` (${escapeHTML(ticket.people_ahead)} ahead)` : ''}
             </div>
             <div class="ticket-actions">
                 ${ticket.status === 'waiting' ? `<button onclick="callTicket('${ticket.id}')">Call</button>` : ''}
@@ -111,10 +210,67 @@ function renderTickets(tickets) {
     });
 }
 
+// escapeHTML returns value as text safe to put into innerHTML. Fields such as
+// customer names, phone numbers and gateway errors come from outside SmartQ,
+// and script injected through them could read the login token.
+function escapeHTML(value) {
+    const div = document.createElement('div');
+    div.textContent = value ?? '';
+    return div.innerHTML;
+}
+
+function renderNotifications(notifications) {
+    const notificationsList = document.getElementById('notifications');
+    notificationsList.innerHTML = '';
+
+    if (notifications.length === 0) {
+        notificationsList.innerHTML = '<li>No text messages yet.</li>';
+        return;
+    }
+
+    notifications.forEach(notification => {
+        const listItem = document.createElement('li');
+        listItem.className = notification.status;
+        let delivery = notification.status;
+        if (notification.status === 'sent') {
+            delivery = `sent at ${new Date(notification.sent_at).toLocaleTimeString()}`;
+        } else if (notification.status === 'pending' && notification.attempts > 0) {
+            delivery = `retrying at ${new Date(notification.next_attempt_at).toLocaleTimeString()}`;
+        }
+        listItem.innerHTML = `
+            <div>
+                <strong>${escapeHTML(notification.ticket_number)}</strong> - ${escapeHTML(notification.template)} to ${escapeHTML(notification.recipient)}
+                <br>
+                ${escapeHTML(delivery)} after ${escapeHTML(notification.attempts)} attempt(s)${notification.last_error ? ` <span class="error">(${escapeHTML(notification.last_error)})</span>` : ''}
+            </div>
+        `;
+        notificationsList.appendChild(listItem);
+    });
+}
+
 async function callTicket(ticketId) {
     await updateTicketStatus(ticketId, 'call');
 }
 
+async function callNextTicket() {
+    try {
+        const response = await apiFetch(`/queues/${currentQueueId}/call-next`, {
+            method: 'POST',
+        });
+        if (response.status === 204) {
+            alert('No tickets are waiting.');
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        // The called ticket arrives through the WebSocket update
+    } catch (error) {
+        console.error('Error calling next ticket:', error);
+        alert('Failed to call next ticket.');
+    }
+}
+
 async function serveTicket(ticketId) {
     await updateTicketStatus(ticketId, 'serve');
 }
@@ -125,7 +281,7 @@ async function cancelTicket(ticketId) {
 
 async function updateTicketStatus(ticketId, action) {
     try {
-        const response = await fetch(`${API_BASE_URL}/tickets/${ticketId}/${action}`, {
+        const response = await apiFetch(`/tickets/${ticketId}/${action}`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
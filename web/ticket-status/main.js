@@ -0,0 +1,174 @@
+// The page lives at /t/<token>; the token is the ticket's only credential.
+const token = decodeURIComponent(window.location.pathname.split('/').filter(Boolean).pop() || '');
+const statusURL = `/t/${encodeURIComponent(token)}`;
+const RECONNECT_DELAY_MS = 5000;
+
+const STATUS_LABELS = {
+    waiting: 'Waiting',
+    serving: "It's your turn!",
+    served: 'Served - thank you for your visit',
+    cancelled: 'Cancelled',
+};
+
+document.addEventListener('DOMContentLoaded', () => {
+    document.querySelectorAll('#actions [data-places]').forEach((button) => {
+        button.addEventListener('click', () => deferTicket({ places: Number(button.dataset.places) }));
+    });
+    document.querySelectorAll('#actions [data-minutes]').forEach((button) => {
+        const until = () => new Date(Date.now() + Number(button.dataset.minutes) * 60000).toISOString();
+        button.addEventListener('click', () => deferTicket({ until: until() }));
+    });
+    document.getElementById('cancel-button').addEventListener('click', cancelTicket);
+
+    fetchStatus();
+    connect();
+});
+
+async function deferTicket(body) {
+    await postAction('defer', body);
+}
+
+async function cancelTicket() {
+    if (!confirm('Leave the queue? Your ticket will be cancelled.')) {
+        return;
+    }
+    await postAction('cancel', {});
+}
+
+// postAction sends one of the customer's own actions and shows the ticket's
+// new status. Other pages following the ticket get it over the WebSocket.
+async function postAction(action, body) {
+    const errorText = document.getElementById('action-error');
+    errorText.hidden = true;
+    try {
+        const response = await fetch(`${statusURL}/${action}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'Accept': 'application/json' },
+            body: JSON.stringify(body),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP error! status: ${response.status}`);
+        }
+        render(data);
+    } catch (error) {
+        console.error(`Error sending ${action}:`, error);
+        errorText.textContent = 'Sorry, that did not work. Please try again or ask at the desk.';
+        errorText.hidden = false;
+    }
+}
+
+async function fetchStatus() {
+    try {
+        const response = await fetch(statusURL, {
+            headers: { 'Accept': 'application/json' },
+            cache: 'no-store',
+        });
+        if (response.status === 404) {
+            showError('This ticket link is not valid.');
+            return false;
+        }
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        render(await response.json());
+        return true;
+    } catch (error) {
+        console.error('Error fetching ticket status:', error);
+        showError('Could not load your ticket. Retrying...');
+        return true;
+    }
+}
+
+function connect() {
+    const protocol = window.location.protocol === 'https:' ? 'wss' : 'ws';
+    const socket = new WebSocket(`${protocol}://${window.location.host}${statusURL}/ws`);
+
+    socket.onopen = () => {
+        setConnection('Live');
+        // Catch up on anything that changed before the socket was open.
+        fetchStatus();
+    };
+
+    socket.onmessage = (event) => {
+        const message = JSON.parse(event.data);
+        if (message.type === 'ticket_status') {
+            render(message.data);
+        }
+    };
+
+    socket.onclose = async () => {
+        setConnection('Connection lost. Reconnecting...');
+        // Stop once the link turns out to be invalid or the ticket is finished.
+        const keepGoing = await fetchStatus();
+        if (keepGoing && !isFinished()) {
+            setTimeout(connect, RECONNECT_DELAY_MS);
+        } else if (isFinished()) {
+            setConnection('');
+        }
+    };
+
+    socket.onerror = (error) => {
+        console.error('WebSocket error:', error);
+    };
+}
+
+let lastStatus = null;
+
+function isFinished() {
+    return lastStatus === 'served' || lastStatus === 'cancelled';
+}
+
+function render(ticket) {
+    lastStatus = ticket.status;
+    document.getElementById('queue-name').textContent = ticket.queue_name;
+    document.getElementById('ticket-number').textContent = ticket.ticket_number;
+
+    const status = document.getElementById('status');
+    status.textContent = STATUS_LABELS[ticket.status] || ticket.status;
+    status.className = `status status-${ticket.status}`;
+
+    const waiting = ticket.status === 'waiting';
+    document.getElementById('position-row').hidden = !waiting;
+    document.getElementById('ahead-row').hidden = !waiting;
+    document.getElementById('wait-row').hidden = !waiting;
+    if (waiting) {
+        document.getElementById('position').textContent = ticket.position;
+        document.getElementById('people-ahead').textContent = ticket.people_ahead;
+        document.getElementById('estimated-wait').textContent = formatWait(ticket.estimated_wait_seconds);
+    }
+
+    const deferredUntil = waiting && ticket.deferred_until ? new Date(ticket.deferred_until) : null;
+    document.getElementById('deferred-row').hidden = !deferredUntil;
+    document.getElementById('deferred-until').textContent = deferredUntil
+        ? deferredUntil.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })
+        : '';
+    document.getElementById('actions').hidden = !waiting;
+
+    const atCounter = ticket.status === 'serving' && ticket.counter_name;
+    document.getElementById('counter-row').hidden = !atCounter;
+    document.getElementById('counter-name').textContent = atCounter ? ticket.counter_name : '';
+
+    if (isFinished()) {
+        setConnection('');
+    }
+}
+
+function formatWait(seconds) {
+    if (!seconds) {
+        return 'Not enough data yet';
+    }
+    const minutes = Math.round(seconds / 60);
+    return minutes < 1 ? 'Less than a minute' : `About ${minutes} min`;
+}
+
+function showError(message) {
+    document.getElementById('status').textContent = message;
+    document.getElementById('status').className = 'status status-error';
+    document.getElementById('details').hidden = true;
+    document.getElementById('actions').hidden = true;
+}
+
+function setConnection(text) {
+    document.getElementById('connection').textContent = text;
+}